@@ -0,0 +1,171 @@
+// Package admin serves the endpoints reserved to the operators of the instance.
+package admin
+
+import (
+	"context"
+
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/pkg/mail"
+)
+
+type Deps struct {
+	Identify func(ctx context.Context, in business.CommonInput) (business.Identity, error)
+
+	// IsAdmin reports whether the user holds the admin role, an email alone proves nothing
+	// since signing up does not verify it.
+	IsAdmin func(ctx context.Context, userID string) (bool, error)
+
+	Templates *mail.Registry
+	Render    func(param mail.Param, data any) (mail.Message, error)
+	SendEmail func(ctx context.Context, param mail.Param, data any) error
+}
+
+type MailTemplate struct {
+	Name    string   `json:"name"`
+	Locales []string `json:"locales"`
+}
+
+type ListMailsOutput struct {
+	business.CommonResponse
+	Templates []MailTemplate `json:"templates"`
+}
+
+// ListMails lists every mail template with the locales it is translated to.
+func (d *Deps) ListMails(ctx context.Context, common business.CommonInput) ListMailsOutput {
+	var out ListMailsOutput
+
+	if !d.admin(ctx, common, &out.CommonResponse) {
+		return out
+	}
+
+	for _, msg := range mail.MsgTypes() {
+		out.Templates = append(out.Templates, MailTemplate{
+			Name:    msg.String(),
+			Locales: d.Templates.Locales(msg),
+		})
+	}
+
+	out.SetOK()
+	return out
+}
+
+type PreviewMailInput struct {
+	Template string `url:"template"`
+	Locale   string `query:"locale"`
+}
+
+type PreviewMailOutput struct {
+	business.CommonResponse
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+// PreviewMail renders a template with its sample data.
+func (d *Deps) PreviewMail(ctx context.Context, in PreviewMailInput, common business.CommonInput) PreviewMailOutput {
+	var out PreviewMailOutput
+
+	if !d.admin(ctx, common, &out.CommonResponse) {
+		return out
+	}
+
+	msg, data, ok := sample(in.Template, &out.CommonResponse)
+	if !ok {
+		return out
+	}
+
+	m, err := d.Render(mail.Param{Name: "Jane", Email: "jane@example.com", TemplateTypes: msg, Locale: in.Locale}, data)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.Subject = m.Subject
+	out.HTML = m.HTML
+	out.Text = m.Text
+	out.SetOK()
+	return out
+}
+
+type SendTestMailInput struct {
+	Template string `url:"template"`
+	Email    string `json:"email" validate:"required,email"`
+	Locale   string `json:"locale"`
+}
+
+type SendTestMailOutput struct {
+	business.CommonResponse
+}
+
+// SendTestMail sends a template with its sample data to any address, through the configured sender.
+func (d *Deps) SendTestMail(ctx context.Context, in SendTestMailInput, common business.CommonInput) SendTestMailOutput {
+	var out SendTestMailOutput
+
+	if !d.admin(ctx, common, &out.CommonResponse) {
+		return out
+	}
+
+	msg, data, ok := sample(in.Template, &out.CommonResponse)
+	if !ok {
+		return out
+	}
+
+	param := mail.Param{
+		Name:          in.Email,
+		Email:         in.Email,
+		Subject:       "Test " + msg.String(),
+		TemplateTypes: msg,
+		Locale:        in.Locale,
+	}
+
+	if err := d.SendEmail(ctx, param, data); err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.SetOK()
+	return out
+}
+
+// admin lets through the sessions of the users with the admin role, tokens are never admins.
+func (d *Deps) admin(ctx context.Context, common business.CommonInput, out *business.CommonResponse) bool {
+	identity, err := business.Authenticated(ctx, common, d.Identify)
+	if err != nil {
+		out.SetError(err)
+		return false
+	}
+
+	if identity.SessionID == "" {
+		out.RawError(403, "admin only")
+		return false
+	}
+
+	isAdmin, err := d.IsAdmin(ctx, identity.User.ID)
+	if err != nil {
+		out.SetError(err)
+		return false
+	}
+
+	if !isAdmin {
+		out.RawError(403, "admin only")
+		return false
+	}
+
+	return true
+}
+
+func sample(name string, out *business.CommonResponse) (mail.MsgType, any, bool) {
+	msg, ok := mail.ParseMsgType(name)
+	if !ok {
+		out.RawError(404, "unknown template "+name)
+		return msg, nil, false
+	}
+
+	data, ok := mail.Sample(msg)
+	if !ok {
+		out.RawError(404, "no sample for template "+name)
+		return msg, nil, false
+	}
+
+	return msg, data, true
+}
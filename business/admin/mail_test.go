@@ -0,0 +1,114 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/model"
+	"github.com/samuelsih/guwu/pkg/mail"
+	"github.com/samuelsih/guwu/pkg/mail/mailtest"
+)
+
+func newDeps(t *testing.T) (*Deps, *mail.MemorySender) {
+	t.Helper()
+
+	templates, err := mail.NewRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent := mail.NewMemorySender()
+	client := mail.NewClient(sent, "Guwu", "info@gmail.com", templates)
+
+	return &Deps{
+		IsAdmin: func(ctx context.Context, userID string) (bool, error) {
+			if userID == "broken" {
+				return false, errors.New("db is down")
+			}
+
+			return userID == "admin", nil
+		},
+		Templates: templates,
+		Render:    client.Render,
+		SendEmail: client.Send,
+	}, sent
+}
+
+// as signs in userID, every user claims the address of the admin since only the role counts.
+func as(userID, sessionID string) business.CommonInput {
+	return business.CommonInput{Identity: &business.Identity{
+		User:      model.User{ID: userID, Email: "admin@gmail.com"},
+		SessionID: sessionID,
+		TokenID:   "token",
+	}}
+}
+
+func TestAdminOnly(t *testing.T) {
+	deps, _ := newDeps(t)
+
+	tests := []struct {
+		name   string
+		common business.CommonInput
+		status int
+	}{
+		{"Admin", as("admin", "sess"), 200},
+		{"NotAdmin", as("user", "sess"), 403},
+		{"AdminToken", as("admin", ""), 403},
+		{"LookupFailed", as("broken", "sess"), 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if out := deps.ListMails(context.Background(), tt.common); out.StatusCode != tt.status {
+				t.Fatalf("ListMails() = %d, want %d", out.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestListMails(t *testing.T) {
+	deps, _ := newDeps(t)
+
+	out := deps.ListMails(context.Background(), as("admin", "sess"))
+	if len(out.Templates) != len(mail.MsgTypes()) {
+		t.Fatalf("expected every template, got %v", out.Templates)
+	}
+
+	if out.Templates[0].Name != "otp" || len(out.Templates[0].Locales) != 2 {
+		t.Fatalf("expected otp in en and id, got %v", out.Templates[0])
+	}
+}
+
+func TestPreviewMail(t *testing.T) {
+	deps, sent := newDeps(t)
+	common := as("admin", "sess")
+
+	out := deps.PreviewMail(context.Background(), PreviewMailInput{Template: "otp", Locale: "id"}, common)
+	if out.StatusCode != 200 || out.Subject != "Verifikasi Email" || !strings.Contains(out.HTML, "123456") || !strings.Contains(out.Text, "123456") {
+		t.Fatalf("unexpected preview: %+v", out)
+	}
+
+	mailtest.ExpectNone(t, sent)
+
+	out = deps.PreviewMail(context.Background(), PreviewMailInput{Template: "nope"}, common)
+	if out.StatusCode != 404 {
+		t.Fatalf("expected 404 for an unknown template, got %d", out.StatusCode)
+	}
+}
+
+func TestSendTestMail(t *testing.T) {
+	deps, sent := newDeps(t)
+
+	out := deps.SendTestMail(context.Background(), SendTestMailInput{Template: "email_changed", Email: "designer@example.com"}, as("admin", "sess"))
+	if out.StatusCode != 200 {
+		t.Fatalf("expected 200, got %v", out)
+	}
+
+	m := mailtest.ExpectSent(t, sent, "designer@example.com", mail.EmailChangedMsg)
+	if !strings.Contains(m.Text, "jane.new@example.com") {
+		t.Fatalf("expected the sample data, got %q", m.Text)
+	}
+}
@@ -0,0 +1,40 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/pkg/logger"
+)
+
+type VarsOutput struct {
+	business.CommonResponse
+	Vars map[string]any `json:"vars"`
+}
+
+// Vars reports the published expvar variables, e.g. the depth of the mail outbox.
+func (d *Deps) Vars(ctx context.Context, common business.CommonInput) VarsOutput {
+	var out VarsOutput
+
+	if !d.admin(ctx, common, &out.CommonResponse) {
+		return out
+	}
+
+	out.Vars = map[string]any{}
+
+	// every expvar.Var is a JSON value, decoded so that every codec can encode it
+	expvar.Do(func(kv expvar.KeyValue) {
+		var value any
+		if err := json.Unmarshal([]byte(kv.Value.String()), &value); err != nil {
+			logger.Err(err)
+			return
+		}
+
+		out.Vars[kv.Key] = value
+	})
+
+	out.SetOK()
+	return out
+}
@@ -0,0 +1,23 @@
+package admin
+
+import (
+	"context"
+	"testing"
+)
+
+func TestVars(t *testing.T) {
+	deps, _ := newDeps(t)
+
+	if out := deps.Vars(context.Background(), as("user", "sess")); out.StatusCode != 403 || out.Vars != nil {
+		t.Fatalf("expected 403 without vars, got %v", out)
+	}
+
+	out := deps.Vars(context.Background(), as("admin", "sess"))
+	if out.StatusCode != 200 {
+		t.Fatalf("expected 200, got %v", out)
+	}
+
+	if _, ok := out.Vars["memstats"].(map[string]any); !ok {
+		t.Fatalf("expected memstats, got %v", out.Vars["memstats"])
+	}
+}
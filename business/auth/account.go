@@ -0,0 +1,398 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/business/outbox"
+	"github.com/samuelsih/guwu/model"
+	"github.com/samuelsih/guwu/pkg/errs"
+	"github.com/samuelsih/guwu/pkg/logger"
+	"github.com/samuelsih/guwu/pkg/mail"
+	"github.com/samuelsih/guwu/pkg/passcode"
+	"github.com/samuelsih/guwu/pkg/securer"
+)
+
+const (
+	DELETION_GRACE      = 7 * 24 * time.Hour
+	EMAIL_CHANGE_PREFIX = "email_change_"
+	SESS_INDEX_PREFIX   = "user_sessions_"
+)
+
+type pendingEmailChange struct {
+	Email string `json:"email"`
+	OTP   string `json:"otp"`
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password" validate:"required,min=9"`
+}
+
+type ChangePasswordOutput struct {
+	business.CommonResponse
+}
+
+func (d *Deps) ChangePassword(ctx context.Context, in ChangePasswordInput, commonIn business.CommonInput) ChangePasswordOutput {
+	var out ChangePasswordOutput
+
+	if err := validPassword(in.NewPassword); err != nil {
+		out.RawError(400, err.Error())
+		return out
+	}
+
+	sessID, user, err := d.currentUser(ctx, commonIn)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	if err := d.reconfirmPassword(ctx, user.ID, in.CurrentPassword); err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	hashedPassword, err := model.HashPassword(in.NewPassword)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	err = model.UpdateUserPassword(ctx, d.DB, user.ID, hashedPassword)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	err = d.revokeOtherSessions(ctx, user.ID, sessID)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.SetOK()
+	return out
+}
+
+type ChangeEmailInput struct {
+	NewEmail string `json:"new_email" validate:"required,email"`
+	Password string `json:"password"`
+}
+
+type ChangeEmailOutput struct {
+	business.CommonResponse
+}
+
+func (d *Deps) ChangeEmail(ctx context.Context, in ChangeEmailInput, commonIn business.CommonInput) ChangeEmailOutput {
+	var out ChangeEmailOutput
+
+	if err := validEmail(in.NewEmail); err != nil {
+		out.RawError(400, err.Error())
+		return out
+	}
+
+	_, user, err := d.currentUser(ctx, commonIn)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	if in.NewEmail == user.Email {
+		out.RawError(400, "new email must be different from the current one")
+		return out
+	}
+
+	if err := d.reconfirmPassword(ctx, user.ID, in.Password); err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	pending := pendingEmailChange{
+		Email: in.NewEmail,
+		OTP:   passcode.Generate(6),
+	}
+
+	err = d.Store(ctx, EMAIL_CHANGE_PREFIX+user.ID, pending, OTP_DURATION)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	param := mail.Param{
+		Name:          user.Username,
+		Email:         in.NewEmail,
+		Subject:       "Email Verification",
+		TemplateTypes: mail.OTPMsg,
+		Locale:        user.Locale,
+		UserID:        user.ID,
+	}
+
+	data := mail.OTPTplData{
+		Username: user.Username,
+		OTP:      pending.OTP,
+	}
+
+	err = d.SendEmail(ctx, param, data)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.SetOK()
+	return out
+}
+
+type VerifyEmailChangeInput struct {
+	OTP string `json:"otp" validate:"required"`
+}
+
+type VerifyEmailChangeOutput struct {
+	business.CommonResponse
+	User model.User `json:"user"`
+}
+
+func (d *Deps) VerifyEmailChange(ctx context.Context, in VerifyEmailChangeInput, commonIn business.CommonInput) VerifyEmailChangeOutput {
+	var out VerifyEmailChangeOutput
+
+	if in.OTP == "" {
+		out.RawError(400, "otp is required")
+		return out
+	}
+
+	sessID, user, err := d.currentUser(ctx, commonIn)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	var pending pendingEmailChange
+
+	err = d.Get(ctx, EMAIL_CHANGE_PREFIX+user.ID, &pending)
+	if err != nil {
+		out.RawError(400, "no pending email change")
+		return out
+	}
+
+	if pending.OTP != in.OTP {
+		out.RawError(400, "invalid otp")
+		return out
+	}
+
+	notice, err := outbox.Mail(mail.Param{
+		Name:          user.Username,
+		Email:         user.Email,
+		Subject:       "Your Email Has Been Changed",
+		TemplateTypes: mail.EmailChangedMsg,
+		Locale:        user.Locale,
+		UserID:        user.ID,
+	}, mail.EmailChangedTplData{
+		Username: user.Username,
+		NewEmail: pending.Email,
+	})
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	err = model.UpdateUserEmail(ctx, d.DB, user.ID, pending.Email, notice)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	if err := d.Destroy(ctx, EMAIL_CHANGE_PREFIX+user.ID); err != nil {
+		logger.Err(err)
+	}
+
+	user.Email = pending.Email
+
+	err = d.Store(ctx, sessID, user, int64(SESS_MAX_AGE))
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.User = user
+	out.SetOK()
+	return out
+}
+
+type DeleteAccountInput struct {
+	Password string `json:"password"`
+}
+
+type DeleteAccountOutput struct {
+	business.CommonResponse
+	DeleteAt time.Time `json:"delete_at"`
+}
+
+func (d *Deps) DeleteAccount(ctx context.Context, in DeleteAccountInput, commonIn business.CommonInput) DeleteAccountOutput {
+	var out DeleteAccountOutput
+
+	sessID, user, err := d.currentUser(ctx, commonIn)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	if err := d.reconfirmPassword(ctx, user.ID, in.Password); err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	deleteAt := time.Now().Add(DELETION_GRACE).UTC()
+
+	notice, err := outbox.Mail(mail.Param{
+		Name:          user.Username,
+		Email:         user.Email,
+		Subject:       "Account Deletion",
+		TemplateTypes: mail.AccountDeletionMsg,
+		Locale:        user.Locale,
+		UserID:        user.ID,
+	}, mail.AccountDeletionTplData{
+		Username: user.Username,
+		DeleteAt: deleteAt.Format(time.RFC1123),
+	})
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	err = model.ScheduleUserDeletion(ctx, d.DB, user.ID, deleteAt, notice)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	err = d.revokeOtherSessions(ctx, user.ID, sessID)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.DeleteAt = deleteAt
+	out.SetOK()
+	return out
+}
+
+type RestoreAccountOutput struct {
+	business.CommonResponse
+}
+
+func (d *Deps) RestoreAccount(ctx context.Context, commonIn business.CommonInput) RestoreAccountOutput {
+	var out RestoreAccountOutput
+
+	_, user, err := d.currentUser(ctx, commonIn)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	err = model.CancelUserDeletion(ctx, d.DB, user.ID)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.SetOK()
+	return out
+}
+
+// PurgeDeletedAccounts removes the accounts whose grace period has ended.
+func (d *Deps) PurgeDeletedAccounts(ctx context.Context) error {
+	purged, err := model.PurgeScheduledUsers(ctx, d.DB, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	// the sessions would otherwise keep resolving to the removed users until they expire
+	for _, userID := range purged {
+		if err := d.revokeOtherSessions(ctx, userID, ""); err != nil {
+			logger.Err(err)
+		}
+	}
+
+	if len(purged) > 0 {
+		logger.SysInfof("purged %d deleted accounts", len(purged))
+	}
+
+	return nil
+}
+
+func (d *Deps) currentUser(ctx context.Context, commonIn business.CommonInput) (string, model.User, error) {
+	const op = errs.Op("auth.currentUser")
+	var user model.User
+
+	// already resolved by the presentation layer
+	if commonIn.Identity != nil && commonIn.Identity.SessionID != "" {
+		return commonIn.Identity.SessionID, commonIn.Identity.User, nil
+	}
+
+	if commonIn.SessionID == "" {
+		return "", user, errs.E(op, errs.KindUnauthorized, errSessionRequired, errSessionRequired.Error())
+	}
+
+	sessID, err := securer.Decrypt(commonIn.SessionID)
+	if err != nil {
+		return "", user, err
+	}
+
+	err = d.Get(ctx, string(sessID), &user)
+	if err != nil {
+		return "", user, err
+	}
+
+	return string(sessID), user, nil
+}
+
+func (d *Deps) reconfirmPassword(ctx context.Context, userID, plain string) error {
+	const op = errs.Op("auth.reconfirmPassword")
+
+	user, err := model.FindUserByID(ctx, d.DB, userID)
+	if err != nil {
+		return err
+	}
+
+	// users created through a social login have no password to reconfirm, the session is enough
+	if !user.Password.Valid {
+		return nil
+	}
+
+	if plain == "" {
+		return errs.E(op, errs.KindBadRequest, errPasswordRequired, errPasswordRequired.Error())
+	}
+
+	if match, _ := model.CheckUserPassword(user.Password.String, plain); !match {
+		return errs.E(op, errs.KindBadRequest, errInvalidCredentials, errInvalidCredentials.Error())
+	}
+
+	return nil
+}
+
+// revokeOtherSessions destroys every tracked session of userID but keepSessID, none is kept when it is empty.
+func (d *Deps) revokeOtherSessions(ctx context.Context, userID, keepSessID string) error {
+	key := SESS_INDEX_PREFIX + userID
+
+	sessions, err := d.Members(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	for _, sess := range sessions {
+		if sess == keepSessID {
+			continue
+		}
+
+		// the session may have already expired or logged out
+		if err := d.Destroy(ctx, sess); err != nil {
+			logger.Err(err)
+		}
+
+		if err := d.Untrack(ctx, key, sess); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,316 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/business/outbox"
+	"github.com/samuelsih/guwu/model"
+	"github.com/samuelsih/guwu/pkg/errs"
+	"github.com/samuelsih/guwu/pkg/mail"
+	"github.com/samuelsih/guwu/pkg/securer"
+)
+
+type memoryStore struct {
+	mu    sync.Mutex
+	kv    map[string][]byte
+	ttl   map[string]int64
+	sets  map[string]map[string]struct{}
+	mails []mail.Param
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		kv:   map[string][]byte{},
+		ttl:  map[string]int64{},
+		sets: map[string]map[string]struct{}{},
+	}
+}
+
+func (m *memoryStore) deps() Deps {
+	return Deps{
+		DB: testDB,
+		Store: func(ctx context.Context, key string, in any, time int64) error {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			m.kv[key], _ = json.Marshal(in)
+			m.ttl[key] = time
+			return nil
+		},
+		TTL: func(ctx context.Context, key string) (int64, error) {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			if _, ok := m.kv[key]; !ok {
+				return -2, nil
+			}
+
+			return m.ttl[key], nil
+		},
+		Expire: func(ctx context.Context, key string, time int64) error {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			m.ttl[key] = time
+			return nil
+		},
+		Get: func(ctx context.Context, key string, dst any) error {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			data, ok := m.kv[key]
+			if !ok {
+				return errs.E(errs.Op("memoryStore.Get"), errs.KindBadRequest, nil, "unknown input")
+			}
+
+			return json.Unmarshal(data, dst)
+		},
+		Destroy: func(ctx context.Context, key string) error {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			delete(m.kv, key)
+			return nil
+		},
+		Track: func(ctx context.Context, key, member string, time int64) error {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			if m.sets[key] == nil {
+				m.sets[key] = map[string]struct{}{}
+			}
+
+			m.sets[key][member] = struct{}{}
+			return nil
+		},
+		Untrack: func(ctx context.Context, key, member string) error {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			delete(m.sets[key], member)
+			return nil
+		},
+		Members: func(ctx context.Context, key string) ([]string, error) {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			var members []string
+			for member := range m.sets[key] {
+				members = append(members, member)
+			}
+
+			return members, nil
+		},
+		SendEmail: func(ctx context.Context, param mail.Param, data any) error {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			m.mails = append(m.mails, param)
+			return nil
+		},
+	}
+}
+
+func (m *memoryStore) has(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.kv[key]
+	return ok
+}
+
+func registerAndLogin(t *testing.T, deps Deps, username, email, password string) (business.CommonInput, model.User) {
+	t.Helper()
+
+	reg := deps.Register(context.Background(), RegisterInput{Username: username, Email: email, Password: password}, business.CommonInput{})
+	if reg.StatusCode != 200 {
+		t.Fatalf("register - expected 200, got %v", reg)
+	}
+
+	out := deps.Login(context.Background(), LoginInput{Email: email, Password: password}, business.CommonInput{})
+	if out.StatusCode != 200 {
+		t.Fatalf("login - expected 200, got %v", out)
+	}
+
+	return business.CommonInput{SessionID: out.SessionID}, out.User
+}
+
+func TestChangePassword(t *testing.T) {
+	t.Parallel()
+
+	store := newMemoryStore()
+	deps := store.deps()
+
+	common, _ := registerAndLogin(t, deps, "passchanger", "passchanger@gmail.com", "Passchanger123!")
+	other, _ := registerAndLogin(t, deps, "passchanger", "passchanger@gmail.com", "Passchanger123!")
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		out := deps.ChangePassword(context.Background(), ChangePasswordInput{CurrentPassword: "Passchanger123!", NewPassword: "Passchanger456!"}, business.CommonInput{})
+		if out.StatusCode != 401 {
+			t.Fatalf("TestChangePassword.Unauthenticated - expected 401, got %v", out)
+		}
+	})
+
+	t.Run("WrongCurrentPassword", func(t *testing.T) {
+		out := deps.ChangePassword(context.Background(), ChangePasswordInput{CurrentPassword: "Wrong123!", NewPassword: "Passchanger456!"}, common)
+		if out.StatusCode != 400 || out.Msg != errInvalidCredentials.Error() {
+			t.Fatalf("TestChangePassword.WrongCurrentPassword - expected 400, got %v", out)
+		}
+	})
+
+	t.Run("WeakNewPassword", func(t *testing.T) {
+		out := deps.ChangePassword(context.Background(), ChangePasswordInput{CurrentPassword: "Passchanger123!", NewPassword: "weak"}, common)
+		if out.StatusCode != 400 {
+			t.Fatalf("TestChangePassword.WeakNewPassword - expected 400, got %v", out)
+		}
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		out := deps.ChangePassword(context.Background(), ChangePasswordInput{CurrentPassword: "Passchanger123!", NewPassword: "Passchanger456!"}, common)
+		if out.StatusCode != 200 {
+			t.Fatalf("TestChangePassword.Success - expected 200, got %v", out)
+		}
+
+		otherSess, _ := securer.Decrypt(other.SessionID)
+		if store.has(string(otherSess)) {
+			t.Fatal("TestChangePassword.Success - other session must be revoked")
+		}
+
+		currentSess, _ := securer.Decrypt(common.SessionID)
+		if !store.has(string(currentSess)) {
+			t.Fatal("TestChangePassword.Success - current session must be kept")
+		}
+
+		login := deps.Login(context.Background(), LoginInput{Email: "passchanger@gmail.com", Password: "Passchanger456!"}, business.CommonInput{})
+		if login.StatusCode != 200 {
+			t.Fatalf("TestChangePassword.Success - login with new password expected 200, got %v", login)
+		}
+	})
+}
+
+func TestChangeEmail(t *testing.T) {
+	t.Parallel()
+
+	store := newMemoryStore()
+	deps := store.deps()
+
+	common, user := registerAndLogin(t, deps, "emailchanger", "emailchanger@gmail.com", "Emailchanger123!")
+
+	out := deps.ChangeEmail(context.Background(), ChangeEmailInput{NewEmail: "emailchanged@gmail.com", Password: "Emailchanger123!"}, common)
+	if out.StatusCode != 200 {
+		t.Fatalf("TestChangeEmail - expected 200, got %v", out)
+	}
+
+	var pending pendingEmailChange
+	if err := deps.Get(context.Background(), EMAIL_CHANGE_PREFIX+user.ID, &pending); err != nil {
+		t.Fatalf("TestChangeEmail - expected pending change, got %v", err)
+	}
+
+	last := store.mails[len(store.mails)-1]
+	if last.Email != "emailchanged@gmail.com" || last.TemplateTypes != mail.OTPMsg {
+		t.Fatalf("TestChangeEmail - expected otp sent to new address, got %v", last)
+	}
+
+	wrong := deps.VerifyEmailChange(context.Background(), VerifyEmailChangeInput{OTP: "000000x"}, common)
+	if wrong.StatusCode != 400 {
+		t.Fatalf("TestChangeEmail - wrong otp expected 400, got %v", wrong)
+	}
+
+	verified := deps.VerifyEmailChange(context.Background(), VerifyEmailChangeInput{OTP: pending.OTP}, common)
+	if verified.StatusCode != 200 || verified.User.Email != "emailchanged@gmail.com" {
+		t.Fatalf("TestChangeEmail - expected 200 with new email, got %v", verified)
+	}
+
+	queued, err := model.ListOutboxMails(context.Background(), testDB, model.OutboxPending, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notified := false
+	for _, m := range queued {
+		notified = notified || (m.Email == "emailchanger@gmail.com" && m.Template == int(mail.EmailChangedMsg))
+	}
+
+	if !notified {
+		t.Fatalf("TestChangeEmail - expected old address notified, got %v", queued)
+	}
+
+	updated, err := model.FindUserByID(context.Background(), testDB, user.ID)
+	if err != nil || updated.Email != "emailchanged@gmail.com" || !updated.UpdatedAt.Valid {
+		t.Fatalf("TestChangeEmail - expected stored email updated, got %v %v", updated, err)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	t.Parallel()
+
+	store := newMemoryStore()
+	deps := store.deps()
+
+	common, user := registerAndLogin(t, deps, "deleter", "deleter@gmail.com", "Deleter123!")
+
+	wrong := deps.DeleteAccount(context.Background(), DeleteAccountInput{Password: "Wrong123!"}, common)
+	if wrong.StatusCode != 400 {
+		t.Fatalf("TestDeleteAccount - wrong password expected 400, got %v", wrong)
+	}
+
+	out := deps.DeleteAccount(context.Background(), DeleteAccountInput{Password: "Deleter123!"}, common)
+	if out.StatusCode != 200 || out.DeleteAt.IsZero() {
+		t.Fatalf("TestDeleteAccount - expected 200, got %v", out)
+	}
+
+	restored := deps.RestoreAccount(context.Background(), common)
+	if restored.StatusCode != 200 {
+		t.Fatalf("TestDeleteAccount - restore expected 200, got %v", restored)
+	}
+
+	restoredAgain := deps.RestoreAccount(context.Background(), common)
+	if restoredAgain.StatusCode != 400 {
+		t.Fatalf("TestDeleteAccount - restore without deletion expected 400, got %v", restoredAgain)
+	}
+
+	if err := model.ScheduleUserDeletion(context.Background(), testDB, user.ID, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	digest, err := outbox.Mail(mail.Param{UserID: user.ID, Name: "deleter", Email: "forwarded@gmail.com", Subject: "Digest", TemplateTypes: mail.DigestMsg}, mail.DigestTplData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := model.EnqueueMail(context.Background(), testDB, digest); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := deps.PurgeDeletedAccounts(context.Background()); err != nil {
+		t.Fatalf("TestDeleteAccount - purge expected nil, got %v", err)
+	}
+
+	if _, err := model.FindUserByID(context.Background(), testDB, user.ID); errs.GetKind(err) != errs.KindBadRequest {
+		t.Fatalf("TestDeleteAccount - expected user purged, got %v", err)
+	}
+
+	if members, _ := deps.Members(context.Background(), SESS_INDEX_PREFIX+user.ID); len(members) != 0 {
+		t.Fatalf("TestDeleteAccount - expected sessions revoked, got %v", members)
+	}
+
+	if sessID, _ := securer.Decrypt(common.SessionID); store.has(string(sessID)) {
+		t.Fatal("TestDeleteAccount - expected purged session destroyed")
+	}
+
+	queued, err := model.ListOutboxMails(context.Background(), testDB, model.OutboxPending, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range queued {
+		if m.Email == "deleter@gmail.com" || m.UserID.String == user.ID {
+			t.Fatalf("TestDeleteAccount - expected purged mails removed, got %v", m)
+		}
+	}
+}
@@ -2,22 +2,40 @@ package auth
 
 import (
 	"context"
+	"errors"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/rs/xid"
 	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/business/outbox"
 	"github.com/samuelsih/guwu/model"
 	"github.com/samuelsih/guwu/pkg/errs"
+	"github.com/samuelsih/guwu/pkg/logger"
 	"github.com/samuelsih/guwu/pkg/mail"
+	"github.com/samuelsih/guwu/pkg/oidc"
 	"github.com/samuelsih/guwu/pkg/passcode"
 	"github.com/samuelsih/guwu/pkg/securer"
 )
 
 const (
-	SESS_MAX_AGE       = 60 * 60 * 24
-	OTP_DURATION int64 = 60 * 5
-	SESS_PREFIX        = "sessionid_"
-	OTP_PREFIX         = "otp_"
+	SESS_MAX_AGE           = 60 * 60 * 24
+	SESS_SLIDE_AFTER       = SESS_MAX_AGE / 2
+	OTP_DURATION     int64 = 60 * 5
+	SESS_PREFIX            = "sessionid_"
+	OTP_PREFIX             = "otp_"
+)
+
+const (
+	PAT_PREFIX   = "guwu_pat_"
+	OAUTH_PREFIX = "guwu_oat_"
+)
+
+var (
+	errSessionRequired    = errors.New("session id is required")
+	errInvalidCredentials = errors.New("invalid credentials")
+	errUnknownToken       = errors.New("unknown token type")
+	errUnauthenticated    = errors.New("invalid or expired credentials")
 )
 
 type Deps struct {
@@ -26,13 +44,23 @@ type Deps struct {
 	Store   func(ctx context.Context, key string, in any, time int64) error
 	Destroy func(ctx context.Context, sessionID string) error
 	Get     func(ctx context.Context, key string, dst any) error
+	TTL     func(ctx context.Context, key string) (int64, error)
+	Expire  func(ctx context.Context, key string, time int64) error
+
+	Track   func(ctx context.Context, key, member string, time int64) error
+	Untrack func(ctx context.Context, key, member string) error
+	Members func(ctx context.Context, key string) ([]string, error)
+
+	IdentifyOAuth func(ctx context.Context, token string) (business.Identity, error)
+
+	Providers map[string]*oidc.Provider
 
 	SendEmail func(ctx context.Context, param mail.Param, data any) error
 }
 
 type LoginInput struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
 }
 
 type LoginOutput struct {
@@ -59,20 +87,17 @@ func (d *Deps) Login(ctx context.Context, in LoginInput, commonIn business.Commo
 		return out
 	}
 
-	if !model.CheckUserPassword(user.Password.String, in.Password) {
-		out.RawError(errs.KindBadRequest, "invalid credentials")
+	match, needsRehash := model.CheckUserPassword(user.Password.String, in.Password)
+	if !match {
+		out.RawError(errs.KindBadRequest, errInvalidCredentials.Error())
 		return out
 	}
 
-	sessionID := xid.New().String()
-
-	err = d.Store(ctx, sessionID, user, int64(SESS_MAX_AGE))
-	if err != nil {
-		out.SetError(err)
-		return out
+	if needsRehash {
+		d.rehashPassword(ctx, user.ID, in.Password)
 	}
 
-	encryptedSessionID, err := securer.Encrypt([]byte(sessionID))
+	encryptedSessionID, err := d.startSession(ctx, user)
 	if err != nil {
 		out.SetError(err)
 		return out
@@ -86,10 +111,42 @@ func (d *Deps) Login(ctx context.Context, in LoginInput, commonIn business.Commo
 	return out
 }
 
+// startSession stores a new session for user and returns its encrypted id.
+func (d *Deps) startSession(ctx context.Context, user model.User) (string, error) {
+	sessionID := xid.New().String()
+
+	err := d.Store(ctx, sessionID, user, int64(SESS_MAX_AGE))
+	if err != nil {
+		return "", err
+	}
+
+	err = d.Track(ctx, SESS_INDEX_PREFIX+user.ID, sessionID, int64(SESS_MAX_AGE))
+	if err != nil {
+		return "", err
+	}
+
+	return securer.Encrypt([]byte(sessionID))
+}
+
+// rehashPassword upgrades the stored hash to the configured algorithm.
+// A failure here must not prevent the user from logging in.
+func (d *Deps) rehashPassword(ctx context.Context, userID, plain string) {
+	hashed, err := model.HashPassword(plain)
+	if err != nil {
+		logger.Err(err)
+		return
+	}
+
+	if err := model.UpdateUserPassword(ctx, d.DB, userID, hashed); err != nil {
+		logger.Err(err)
+	}
+}
+
 type RegisterInput struct {
-	Email    string `json:"email"`
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,email"`
+	Username string `json:"username" validate:"required,max=99"`
+	Password string `json:"password" validate:"required,min=9"`
+	Locale   string `json:"locale" validate:"max=35"`
 }
 
 type RegisterOutput struct {
@@ -104,30 +161,30 @@ func (d *Deps) Register(ctx context.Context, in RegisterInput, commonIn business
 		return out
 	}
 
-	hashedPassword, err := model.HashPassword(in.Password)
-	if err != nil {
-		out.SetError(err)
+	if err := validLocale(in.Locale); err != nil {
+		out.RawError(400, err.Error())
 		return out
 	}
 
-	_, err = model.InsertUser(ctx, d.DB, in.Username, in.Email, hashedPassword)
-	if err != nil {
-		out.SetError(err)
-		return out
+	locale := in.Locale
+	if locale == "" {
+		locale = mail.DEFAULT_LOCALE
 	}
 
-	otp := passcode.Generate(6)
-	err = d.Store(ctx, (OTP_PREFIX + in.Email), otp, OTP_DURATION)
+	hashedPassword, err := model.HashPassword(in.Password)
 	if err != nil {
 		out.SetError(err)
 		return out
 	}
 
+	otp := passcode.Generate(6)
+
 	param := mail.Param{
 		Name:          in.Username,
 		Email:         in.Email,
 		Subject:       "Email Verification",
 		TemplateTypes: mail.OTPMsg,
+		Locale:        locale,
 	}
 
 	data := mail.OTPTplData{
@@ -135,8 +192,26 @@ func (d *Deps) Register(ctx context.Context, in RegisterInput, commonIn business
 		OTP:      otp,
 	}
 
-	err = d.SendEmail(ctx, param, data)
+	verification, err := outbox.Mail(param, data)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	// stored first so a queued mail never carries a code that cannot be verified
+	err = d.Store(ctx, (OTP_PREFIX + in.Email), otp, OTP_DURATION)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	// the mail is only queued with the user, SMTP failures are retried by the outbox worker
+	_, err = model.InsertUser(ctx, d.DB, in.Username, in.Email, hashedPassword, locale, verification)
 	if err != nil {
+		if err := d.Destroy(ctx, OTP_PREFIX+in.Email); err != nil {
+			logger.Err(err)
+		}
+
 		out.SetError(err)
 		return out
 	}
@@ -163,6 +238,10 @@ func (d *Deps) Logout(ctx context.Context, in business.CommonInput) LogoutOutput
 		return out
 	}
 
+	// an expired session has nothing left to untrack
+	var user model.User
+	_ = d.Get(ctx, string(sessID), &user)
+
 	err = d.Destroy(ctx, string(sessID))
 
 	if err != nil {
@@ -170,6 +249,12 @@ func (d *Deps) Logout(ctx context.Context, in business.CommonInput) LogoutOutput
 		return out
 	}
 
+	if user.ID != "" {
+		if err := d.Untrack(ctx, SESS_INDEX_PREFIX+user.ID, string(sessID)); err != nil {
+			logger.Err(err)
+		}
+	}
+
 	out.SessionID = ""
 	out.SessionMaxAge = -1
 	out.SetOK()
@@ -186,28 +271,100 @@ type PersonalOut struct {
 func (d *Deps) WhoAmI(ctx context.Context, in business.CommonInput) PersonalOut {
 	var out PersonalOut
 
-	if in.SessionID == "" {
-		out.RawError(400, "session id is required")
-		return out
-	}
-
-	sessID, err := securer.Decrypt(in.SessionID)
+	identity, err := business.Authenticated(ctx, in, d.Identify)
 	if err != nil {
 		out.SetError(err)
 		return out
 	}
 
-	var user model.User
-
-	err = d.Get(ctx, string(sessID), &user)
-	if err != nil {
-		out.SetError(err)
+	if !identity.Can(business.ScopeAccountRead) {
+		out.RawError(403, "token is missing scope "+business.ScopeAccountRead)
 		return out
 	}
 
-	out.Username = user.Username
-	out.Email = user.Email
+	out.Username = identity.User.Username
+	out.Email = identity.User.Email
+	out.SetLastModified(identity.User.LastModified())
 
 	out.SetOK()
 	return out
 }
+
+// Identify resolves the user behind the session cookie or the bearer access token.
+func (d *Deps) Identify(ctx context.Context, in business.CommonInput) (business.Identity, error) {
+	const op = errs.Op("auth.Identify")
+
+	if strings.HasPrefix(in.AccessToken, OAUTH_PREFIX) {
+		return d.IdentifyOAuth(ctx, in.AccessToken)
+	}
+
+	if in.AccessToken != "" {
+		if !strings.HasPrefix(in.AccessToken, PAT_PREFIX) {
+			return business.Identity{}, errs.E(op, errs.KindUnauthorized, errUnknownToken, "invalid token")
+		}
+
+		user, token, err := model.FindUserByAccessToken(ctx, d.DB, securer.Digest(in.AccessToken))
+		if err != nil {
+			return business.Identity{}, err
+		}
+
+		return business.Identity{User: user, TokenID: token.ID, Scopes: token.Scopes}, nil
+	}
+
+	sessID, user, err := d.currentUser(ctx, in)
+	if err != nil {
+		return business.Identity{}, err
+	}
+
+	return business.Identity{User: user, SessionID: sessID}, nil
+}
+
+// Authenticate resolves the user of a route requiring one. Every failure but an unexpected one is a 401,
+// and a session past half of its lifetime is extended.
+func (d *Deps) Authenticate(ctx context.Context, in business.CommonInput) (business.Identity, error) {
+	const op = errs.Op("auth.Authenticate")
+
+	if in.SessionID == "" && in.AccessToken == "" {
+		return business.Identity{}, errs.E(op, errs.KindUnauthorized, errSessionRequired, errSessionRequired.Error())
+	}
+
+	identity, err := d.Identify(ctx, in)
+	if err != nil {
+		if errs.GetKind(err) == errs.KindUnexpected {
+			return identity, errs.E(op, errs.KindUnexpected, err, err.Error())
+		}
+
+		return identity, errs.E(op, errs.KindUnauthorized, err, errUnauthenticated.Error())
+	}
+
+	if identity.SessionID != "" {
+		d.slideSession(ctx, &identity)
+	}
+
+	return identity, nil
+}
+
+// slideSession extends the session once half of it has passed, so an active user stays logged in.
+// A failure here only means the session expires at its original time.
+func (d *Deps) slideSession(ctx context.Context, identity *business.Identity) {
+	ttl, err := d.TTL(ctx, identity.SessionID)
+	if err != nil {
+		logger.Err(err)
+		return
+	}
+
+	if ttl < 0 || ttl > SESS_SLIDE_AFTER {
+		return
+	}
+
+	if err := d.Expire(ctx, identity.SessionID, int64(SESS_MAX_AGE)); err != nil {
+		logger.Err(err)
+		return
+	}
+
+	if err := d.Track(ctx, SESS_INDEX_PREFIX+identity.User.ID, identity.SessionID, int64(SESS_MAX_AGE)); err != nil {
+		logger.Err(err)
+	}
+
+	identity.SessionMaxAge = SESS_MAX_AGE
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/samuelsih/guwu/pkg/securer"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -108,6 +109,8 @@ func TestRegister(t *testing.T) {
 	})
 
 	t.Run("RegisterMultipleAcc", func(t *testing.T) {
+		var destroyed string
+
 		d := Deps{
 			DB: testDB,
 			SendEmail: func(ctx context.Context, param mail.Param, data any) error {
@@ -116,6 +119,10 @@ func TestRegister(t *testing.T) {
 			Store: func(ctx context.Context, key string, in any, time int64) error {
 				return nil
 			},
+			Destroy: func(ctx context.Context, key string) error {
+				destroyed = key
+				return nil
+			},
 		}
 
 		in := d.Register(context.Background(), RegisterInput{
@@ -144,6 +151,34 @@ func TestRegister(t *testing.T) {
 		if got.StatusCode != expected.StatusCode || !strings.Contains(got.Msg, "already taken") {
 			t.Fatalf("TestRegister.RegisterEmptyUsername - expected %v, got %v", expected, got)
 		}
+
+		if destroyed != OTP_PREFIX+input.Email {
+			t.Fatalf("TestRegister.RegisterMultipleAcc - expected the otp destroyed, got %q", destroyed)
+		}
+	})
+
+	t.Run("RegisterStoreFailed", func(t *testing.T) {
+		d := Deps{
+			DB: testDB,
+			Store: func(ctx context.Context, key string, in any, time int64) error {
+				return errors.New("redis is down")
+			},
+		}
+
+		input := RegisterInput{
+			Email:    "unstored@gmail.com",
+			Username: "unstored",
+			Password: "Unstored123!",
+		}
+
+		got := d.Register(context.Background(), input, business.CommonInput{})
+		if got.StatusCode != 500 {
+			t.Fatalf("TestRegister.RegisterStoreFailed - expected 500, got %v", got)
+		}
+
+		if _, err := model.FindUserByEmail(context.Background(), testDB, input.Email); err == nil {
+			t.Fatalf("TestRegister.RegisterStoreFailed - expected the email to stay free")
+		}
 	})
 }
 
@@ -218,6 +253,9 @@ func TestLogin(t *testing.T) {
 			Store: func(ctx context.Context, key string, in any, time int64) error {
 				return nil
 			},
+			Track: func(ctx context.Context, key, member string, time int64) error {
+				return nil
+			},
 			SendEmail: func(ctx context.Context, param mail.Param, data any) error {
 				return nil
 			},
@@ -261,6 +299,9 @@ func TestLogin(t *testing.T) {
 			Store: func(ctx context.Context, key string, in any, time int64) error {
 				return nil
 			},
+			Track: func(ctx context.Context, key, member string, time int64) error {
+				return nil
+			},
 			SendEmail: func(ctx context.Context, param mail.Param, data any) error {
 				return nil
 			},
@@ -304,6 +345,54 @@ func TestLogin(t *testing.T) {
 	})
 }
 
+func TestLoginRehash(t *testing.T) {
+	t.Parallel()
+
+	deps := Deps{
+		DB: testDB,
+		Store: func(ctx context.Context, key string, in any, time int64) error {
+			return nil
+		},
+		Track: func(ctx context.Context, key, member string, time int64) error {
+			return nil
+		},
+	}
+
+	// bcrypt hash of "Rehash123!" with cost 4
+	outdated, err := bcrypt.GenerateFromPassword([]byte("Rehash123!"), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = model.InsertUser(context.Background(), testDB, "rehasher", "rehasher@gmail.com", string(outdated), "en")
+	if err != nil {
+		t.Fatalf("TestLoginRehash.InsertUser - got err: %v", err)
+	}
+
+	out := deps.Login(context.Background(), LoginInput{Email: "rehasher@gmail.com", Password: "Rehash123!"}, business.CommonInput{})
+	if out.StatusCode != 200 {
+		t.Fatalf("TestLoginRehash - expected 200, got %v", out)
+	}
+
+	user, err := model.FindUserByEmail(context.Background(), testDB, "rehasher@gmail.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(user.Password.String, "$argon2id$") {
+		t.Fatalf("TestLoginRehash - expected argon2id hash, got %v", user.Password.String)
+	}
+
+	if !user.UpdatedAt.Valid {
+		t.Fatal("TestLoginRehash - expected updated_at to be set")
+	}
+
+	out = deps.Login(context.Background(), LoginInput{Email: "rehasher@gmail.com", Password: "Rehash123!"}, business.CommonInput{})
+	if out.StatusCode != 200 {
+		t.Fatalf("TestLoginRehash - login after rehash expected 200, got %v", out)
+	}
+}
+
 func TestLogout(t *testing.T) {
 	t.Parallel()
 
@@ -324,6 +413,7 @@ func TestLogout(t *testing.T) {
 
 	t.Run("UnknownSessionID", func(t *testing.T) {
 		deps := Deps{
+			Get: noSession,
 			Destroy: func(ctx context.Context, sessionID string) error {
 				return errs.E(errs.Op("some_op"), errs.KindBadRequest, err, "unknown input")
 			},
@@ -340,6 +430,7 @@ func TestLogout(t *testing.T) {
 
 	t.Run("InternalErr", func(t *testing.T) {
 		internalErrDeps := Deps{
+			Get: noSession,
 			Destroy: func(ctx context.Context, sessionID string) error {
 				return errs.E(errs.Op("some_op"), errs.KindUnexpected, err, "unknown input")
 			},
@@ -355,11 +446,14 @@ func TestLogout(t *testing.T) {
 	})
 
 	t.Run("Success", func(t *testing.T) {
-		deps := Deps{
-			Destroy: func(ctx context.Context, sessionID string) error {
-				return nil
-			},
-		}
+		store := newMemoryStore()
+		deps := store.deps()
+
+		user := model.User{ID: "logout-user"}
+		key := SESS_INDEX_PREFIX + user.ID
+
+		_ = deps.Store(context.Background(), "i-am-session", user, int64(SESS_MAX_AGE))
+		_ = deps.Track(context.Background(), key, "i-am-session", int64(SESS_MAX_AGE))
 
 		input := business.CommonInput{SessionID: sessionEncrypted}
 
@@ -368,9 +462,21 @@ func TestLogout(t *testing.T) {
 		if out.StatusCode != 200 {
 			t.Fatalf("TestLogout.Success - expected 200 got %d - %v", out.StatusCode, out)
 		}
+
+		if store.has("i-am-session") {
+			t.Fatal("TestLogout.Success - expected session destroyed")
+		}
+
+		if members, _ := deps.Members(context.Background(), key); len(members) != 0 {
+			t.Fatalf("TestLogout.Success - expected session untracked, got %v", members)
+		}
 	})
 }
 
+func noSession(ctx context.Context, key string, dst any) error {
+	return errs.E(errs.Op("noSession"), errs.KindBadRequest, nil, "unknown input")
+}
+
 func setup() (func() error, error) {
 	ctx := context.Background()
 
@@ -428,3 +534,52 @@ func setup() (func() error, error) {
 
 	return cleanup, nil
 }
+
+func TestAuthenticate(t *testing.T) {
+	t.Parallel()
+
+	store := newMemoryStore()
+	deps := store.deps()
+
+	common, user := registerAndLogin(t, deps, "authenticated", "authenticated@gmail.com", "Authenticated123!")
+
+	sessID, _ := securer.Decrypt(common.SessionID)
+
+	t.Run("MissingCredentials", func(t *testing.T) {
+		_, err := deps.Authenticate(context.Background(), business.CommonInput{})
+		if errs.GetKind(err) != errs.KindUnauthorized {
+			t.Fatalf("TestAuthenticate.MissingCredentials - expected 401, got %v", err)
+		}
+	})
+
+	t.Run("UnknownSession", func(t *testing.T) {
+		unknown, _ := securer.Encrypt([]byte("unknown"))
+
+		_, err := deps.Authenticate(context.Background(), business.CommonInput{SessionID: unknown})
+		if errs.GetKind(err) != errs.KindUnauthorized {
+			t.Fatalf("TestAuthenticate.UnknownSession - expected 401, got %v", err)
+		}
+	})
+
+	t.Run("FreshSession", func(t *testing.T) {
+		identity, err := deps.Authenticate(context.Background(), common)
+		if err != nil || identity.User.ID != user.ID || identity.SessionMaxAge != 0 {
+			t.Fatalf("TestAuthenticate.FreshSession - expected the user without sliding, got %v %v", identity, err)
+		}
+	})
+
+	t.Run("SlidingSession", func(t *testing.T) {
+		if err := deps.Expire(context.Background(), string(sessID), 60); err != nil {
+			t.Fatal(err)
+		}
+
+		identity, err := deps.Authenticate(context.Background(), common)
+		if err != nil || identity.SessionMaxAge != SESS_MAX_AGE {
+			t.Fatalf("TestAuthenticate.SlidingSession - expected the session extended, got %v %v", identity, err)
+		}
+
+		if ttl, _ := deps.TTL(context.Background(), string(sessID)); ttl != SESS_MAX_AGE {
+			t.Fatalf("TestAuthenticate.SlidingSession - expected ttl %d, got %d", SESS_MAX_AGE, ttl)
+		}
+	})
+}
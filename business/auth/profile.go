@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/model"
+)
+
+const MAX_BIO = 500
+
+type UpdateProfileInput struct {
+	Username business.Optional[string] `json:"username" validate:"max=99"`
+	Bio      business.Optional[string] `json:"bio" validate:"max=500"`
+	Locale   business.Optional[string] `json:"locale" validate:"max=35"`
+}
+
+type UpdateProfileOutput struct {
+	business.CommonResponse
+	User model.User `json:"user"`
+}
+
+// UpdateProfile applies a merge patch to the profile, a null bio removes it.
+// The locale picks the language of the mails sent to the user.
+func (d *Deps) UpdateProfile(ctx context.Context, in UpdateProfileInput, commonIn business.CommonInput) UpdateProfileOutput {
+	var out UpdateProfileOutput
+
+	if in.Username.Null {
+		out.RawError(400, "username cannot be removed")
+		return out
+	}
+
+	if in.Username.Set {
+		if err := validUsername(in.Username.Value); err != nil {
+			out.RawError(400, err.Error())
+			return out
+		}
+	}
+
+	if in.Bio.Present() && utf8.RuneCountInString(in.Bio.Value) > MAX_BIO {
+		out.RawError(400, "bio must be at most 500 characters")
+		return out
+	}
+
+	if in.Locale.Null {
+		out.RawError(400, "locale cannot be removed")
+		return out
+	}
+
+	if err := validLocale(in.Locale.Value); err != nil {
+		out.RawError(400, err.Error())
+		return out
+	}
+
+	sessID, user, err := d.currentUser(ctx, commonIn)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	current, err := model.FindUserByID(ctx, d.DB, user.ID)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	if in.Username.Present() {
+		current.Username = in.Username.Value
+	}
+
+	if in.Locale.Value != "" {
+		current.Locale = in.Locale.Value
+	}
+
+	if in.Bio.Set {
+		current.Bio.String = in.Bio.Value
+		current.Bio.Valid = !in.Bio.Null
+	}
+
+	updated, err := model.UpdateUserProfile(ctx, d.DB, current)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	err = d.Store(ctx, sessID, updated, int64(SESS_MAX_AGE))
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.User = updated
+	out.SetOK()
+	return out
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestUpdateProfile(t *testing.T) {
+	t.Parallel()
+
+	deps := newMemoryStore().deps()
+	common, _ := registerAndLogin(t, deps, "profiler", "profiler@gmail.com", "Profiler123!")
+
+	patch := func(body string) UpdateProfileInput {
+		var in UpdateProfileInput
+		if err := json.Unmarshal([]byte(body), &in); err != nil {
+			t.Fatal(err)
+		}
+
+		return in
+	}
+
+	out := deps.UpdateProfile(context.Background(), patch(`{"bio": "hello there"}`), common)
+	if out.StatusCode != 200 || out.User.Username != "profiler" || out.User.Bio.String != "hello there" {
+		t.Fatalf("TestUpdateProfile.SetBio - expected bio set and username kept, got %v", out)
+	}
+
+	out = deps.UpdateProfile(context.Background(), patch(`{"username": "renamed"}`), common)
+	if out.StatusCode != 200 || out.User.Username != "renamed" || out.User.Bio.String != "hello there" {
+		t.Fatalf("TestUpdateProfile.Rename - expected username changed and bio kept, got %v", out)
+	}
+
+	out = deps.UpdateProfile(context.Background(), patch(`{"bio": null}`), common)
+	if out.StatusCode != 200 || out.User.Bio.Valid || out.User.Locale != "en" {
+		t.Fatalf("TestUpdateProfile.RemoveBio - expected bio removed, got %v", out)
+	}
+
+	out = deps.UpdateProfile(context.Background(), patch(`{"username": null}`), common)
+	if out.StatusCode != 400 {
+		t.Fatalf("TestUpdateProfile.RemoveUsername - expected 400, got %v", out)
+	}
+
+	out = deps.UpdateProfile(context.Background(), patch(`{"locale": "id"}`), common)
+	if out.StatusCode != 200 || out.User.Locale != "id" || out.User.Username != "renamed" {
+		t.Fatalf("TestUpdateProfile.SetLocale - expected locale changed, got %v", out)
+	}
+
+	out = deps.UpdateProfile(context.Background(), patch(`{"locale": "../id"}`), common)
+	if out.StatusCode != 400 {
+		t.Fatalf("TestUpdateProfile.InvalidLocale - expected 400, got %v", out)
+	}
+
+	who := deps.WhoAmI(context.Background(), common)
+	if who.Username != "renamed" {
+		t.Fatalf("TestUpdateProfile.Session - expected session refreshed, got %v", who)
+	}
+}
@@ -0,0 +1,398 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/model"
+	"github.com/samuelsih/guwu/pkg/errs"
+	"github.com/samuelsih/guwu/pkg/logger"
+	"github.com/samuelsih/guwu/pkg/oidc"
+	"github.com/samuelsih/guwu/pkg/securer"
+)
+
+const (
+	SOCIAL_STATE_PREFIX         = "social_state_"
+	SOCIAL_STATE_DURATION int64 = 60 * 10
+)
+
+var errUnknownProvider = errors.New("unknown provider")
+
+// socialState is kept server side between the redirect to the provider and its callback.
+type socialState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	LinkUserID   string `json:"link_user_id,omitempty"`
+}
+
+type SocialStartInput struct {
+	Provider string `json:"provider" validate:"required"`
+}
+
+type SocialStartOutput struct {
+	business.CommonResponse
+	RedirectTo string `json:"redirect_to"`
+}
+
+// SocialLogin returns the provider url where the user logs in or registers.
+func (d *Deps) SocialLogin(ctx context.Context, in SocialStartInput, commonIn business.CommonInput) SocialStartOutput {
+	var out SocialStartOutput
+
+	redirectTo, err := d.startSocial(ctx, in.Provider, "")
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.RedirectTo = redirectTo
+	out.SetOK()
+	return out
+}
+
+// SocialLink returns the provider url where the logged in user authenticates the account to link.
+func (d *Deps) SocialLink(ctx context.Context, in SocialStartInput, commonIn business.CommonInput) SocialStartOutput {
+	var out SocialStartOutput
+
+	_, user, err := d.currentUser(ctx, commonIn)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	redirectTo, err := d.startSocial(ctx, in.Provider, user.ID)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.RedirectTo = redirectTo
+	out.SetOK()
+	return out
+}
+
+type SocialCallbackInput struct {
+	Provider string `json:"provider" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+	State    string `json:"state" validate:"required"`
+}
+
+type SocialCallbackOutput struct {
+	business.CommonResponse
+	User    model.User `json:"user"`
+	Created bool       `json:"created"`
+}
+
+// SocialCallback finishes a social login. The identity is matched by provider subject first,
+// then linked to the user owning the same verified email, otherwise a new user is registered.
+func (d *Deps) SocialCallback(ctx context.Context, in SocialCallbackInput, commonIn business.CommonInput) SocialCallbackOutput {
+	var out SocialCallbackOutput
+
+	state, claims, err := d.finishSocial(ctx, in)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	if state.LinkUserID != "" {
+		out.RawError(400, "state was issued to link an account")
+		return out
+	}
+
+	user, created, err := d.socialUser(ctx, in.Provider, claims)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	encryptedSessionID, err := d.startSession(ctx, user)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.User = user
+	out.Created = created
+	out.SessionID = encryptedSessionID
+	out.SessionMaxAge = SESS_MAX_AGE
+	out.SetOK()
+	return out
+}
+
+type SocialLinkOutput struct {
+	business.CommonResponse
+	Identity model.UserIdentity `json:"identity"`
+}
+
+// SocialLinkCallback links the provider account to the logged in user who started the flow.
+func (d *Deps) SocialLinkCallback(ctx context.Context, in SocialCallbackInput, commonIn business.CommonInput) SocialLinkOutput {
+	var out SocialLinkOutput
+
+	_, user, err := d.currentUser(ctx, commonIn)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	state, claims, err := d.finishSocial(ctx, in)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	if state.LinkUserID != user.ID {
+		out.RawError(400, "state was not issued to link this account")
+		return out
+	}
+
+	identity, err := model.InsertUserIdentity(ctx, d.DB, model.UserIdentity{
+		UserID:   user.ID,
+		Provider: in.Provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.Identity = identity
+	out.SetOK()
+	return out
+}
+
+type IdentitiesOutput struct {
+	business.CommonResponse
+	Identities []model.UserIdentity `json:"identities"`
+}
+
+func (d *Deps) Identities(ctx context.Context, commonIn business.CommonInput) IdentitiesOutput {
+	var out IdentitiesOutput
+
+	_, user, err := d.currentUser(ctx, commonIn)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	identities, err := model.ListUserIdentities(ctx, d.DB, user.ID)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.Identities = identities
+	out.SetOK()
+	return out
+}
+
+type UnlinkInput struct {
+	Provider string `json:"provider" validate:"required"`
+}
+
+type UnlinkOutput struct {
+	business.CommonResponse
+}
+
+// Unlink removes a provider from the user, unless it is the only way left to log in.
+func (d *Deps) Unlink(ctx context.Context, in UnlinkInput, commonIn business.CommonInput) UnlinkOutput {
+	var out UnlinkOutput
+
+	if in.Provider == "" {
+		out.RawError(400, "provider is required")
+		return out
+	}
+
+	_, user, err := d.currentUser(ctx, commonIn)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	current, err := model.FindUserByID(ctx, d.DB, user.ID)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	identities, err := model.ListUserIdentities(ctx, d.DB, user.ID)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	if !current.Password.Valid && len(identities) <= 1 {
+		out.RawError(400, "set a password before unlinking the last provider")
+		return out
+	}
+
+	err = model.DeleteUserIdentity(ctx, d.DB, user.ID, in.Provider)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.SetOK()
+	return out
+}
+
+func (d *Deps) startSocial(ctx context.Context, providerName, linkUserID string) (string, error) {
+	provider, err := d.provider(providerName)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := securer.RandomToken("", 32)
+	if err != nil {
+		return "", err
+	}
+
+	nonce, err := securer.RandomToken("", 32)
+	if err != nil {
+		return "", err
+	}
+
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", err
+	}
+
+	redirectTo, err := provider.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		return "", err
+	}
+
+	data := socialState{
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		LinkUserID:   linkUserID,
+	}
+
+	err = d.Store(ctx, SOCIAL_STATE_PREFIX+securer.Digest(state), data, SOCIAL_STATE_DURATION)
+	if err != nil {
+		return "", err
+	}
+
+	return redirectTo, nil
+}
+
+// finishSocial consumes the state and returns the verified claims of the provider.
+func (d *Deps) finishSocial(ctx context.Context, in SocialCallbackInput) (socialState, oidc.Claims, error) {
+	const op = errs.Op("auth.finishSocial")
+	var state socialState
+
+	if in.Code == "" || in.State == "" {
+		return state, oidc.Claims{}, errs.E(op, errs.KindBadRequest, nil, "code and state are required")
+	}
+
+	provider, err := d.provider(in.Provider)
+	if err != nil {
+		return state, oidc.Claims{}, err
+	}
+
+	key := SOCIAL_STATE_PREFIX + securer.Digest(in.State)
+
+	if err := d.Get(ctx, key, &state); err != nil {
+		return state, oidc.Claims{}, errs.E(op, errs.KindBadRequest, err, "invalid or expired state")
+	}
+
+	// a state is single use, even when the exchange below fails
+	if err := d.Destroy(ctx, key); err != nil {
+		logger.Err(err)
+	}
+
+	if state.Provider != in.Provider {
+		return state, oidc.Claims{}, errs.E(op, errs.KindBadRequest, nil, "invalid or expired state")
+	}
+
+	claims, err := provider.Authenticate(ctx, in.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		return state, claims, err
+	}
+
+	return state, claims, nil
+}
+
+// socialUser resolves the user behind claims, linking or registering it when needed.
+func (d *Deps) socialUser(ctx context.Context, providerName string, claims oidc.Claims) (model.User, bool, error) {
+	const op = errs.Op("auth.socialUser")
+
+	user, err := model.FindUserByIdentity(ctx, d.DB, providerName, claims.Subject)
+	if err == nil {
+		return user, false, nil
+	}
+
+	if errs.GetKind(err) != errs.KindNotFound {
+		return user, false, err
+	}
+
+	if claims.Email == "" {
+		return user, false, errs.E(op, errs.KindBadRequest, nil, "provider did not share an email address")
+	}
+
+	identity := model.UserIdentity{
+		Provider: providerName,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+
+	user, err = model.FindUserByEmail(ctx, d.DB, claims.Email)
+	if err == nil {
+		// an unverified email could be anyone's, linking it would hand over the account
+		if !claims.EmailVerified {
+			return user, false, errs.E(op, errs.KindBadRequest, nil, "an account already uses this email, login and link the provider instead")
+		}
+
+		identity.UserID = user.ID
+
+		if _, err := model.InsertUserIdentity(ctx, d.DB, identity); err != nil {
+			return user, false, err
+		}
+
+		return user, false, nil
+	}
+
+	if errs.GetKind(err) != errs.KindBadRequest {
+		return user, false, err
+	}
+
+	user, err = model.InsertSocialUser(ctx, d.DB, socialUsername(claims), claims.Email, identity)
+	if err != nil {
+		return user, false, err
+	}
+
+	return user, true, nil
+}
+
+func (d *Deps) provider(name string) (*oidc.Provider, error) {
+	const op = errs.Op("auth.provider")
+
+	provider, ok := d.Providers[name]
+	if !ok || name == "" {
+		return nil, errs.E(op, errs.KindBadRequest, errUnknownProvider, errUnknownProvider.Error())
+	}
+
+	return provider, nil
+}
+
+func socialUsername(claims oidc.Claims) string {
+	username := claims.PreferredUsername
+
+	if username == "" {
+		username = claims.Name
+	}
+
+	if username == "" {
+		username, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	if len(username) > 99 {
+		username = username[:99]
+	}
+
+	return username
+}
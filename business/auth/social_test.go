@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/model"
+	"github.com/samuelsih/guwu/pkg/oidc"
+	"github.com/samuelsih/guwu/pkg/oidc/oidctest"
+)
+
+func socialDeps(t *testing.T) (Deps, *oidctest.Server) {
+	t.Helper()
+
+	server := oidctest.NewServer("guwu", "secret")
+	t.Cleanup(server.Close)
+
+	deps := newMemoryStore().deps()
+	deps.Providers = map[string]*oidc.Provider{
+		"local": oidc.New(oidc.Config{
+			Issuer:       server.Issuer(),
+			ClientID:     "guwu",
+			ClientSecret: "secret",
+			RedirectURL:  "https://guwu.example.com/auth/callback",
+		}, server.Client()),
+	}
+
+	return deps, server
+}
+
+// loginAtProvider plays the browser: it follows redirectTo to the provider and returns the callback input.
+func loginAtProvider(t *testing.T, server *oidctest.Server, redirectTo string, user oidctest.User) SocialCallbackInput {
+	t.Helper()
+
+	code, err := server.Login(redirectTo, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(redirectTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return SocialCallbackInput{Provider: "local", Code: code, State: u.Query().Get("state")}
+}
+
+func socialLogin(t *testing.T, deps Deps, server *oidctest.Server, user oidctest.User) SocialCallbackOutput {
+	t.Helper()
+
+	start := deps.SocialLogin(context.Background(), SocialStartInput{Provider: "local"}, business.CommonInput{})
+	if start.StatusCode != 200 {
+		t.Fatalf("social login - expected 200, got %v", start)
+	}
+
+	return deps.SocialCallback(context.Background(), loginAtProvider(t, server, start.RedirectTo, user), business.CommonInput{})
+}
+
+func TestSocialLoginRegisters(t *testing.T) {
+	t.Parallel()
+
+	deps, server := socialDeps(t)
+	user := oidctest.User{Subject: "new-1", Email: "socialnew@gmail.com", EmailVerified: true, Name: "Social New"}
+
+	first := socialLogin(t, deps, server, user)
+	if first.StatusCode != 200 || !first.Created || first.SessionID == "" || first.User.Username != "Social New" {
+		t.Fatalf("TestSocialLoginRegisters - expected created user, got %v", first)
+	}
+
+	again := socialLogin(t, deps, server, user)
+	if again.StatusCode != 200 || again.Created || again.User.ID != first.User.ID {
+		t.Fatalf("TestSocialLoginRegisters - expected same user, got %v", again)
+	}
+
+	stored, err := model.FindUserByID(context.Background(), testDB, first.User.ID)
+	if err != nil || stored.Password.Valid {
+		t.Fatalf("TestSocialLoginRegisters - expected user without password, got %v %v", stored, err)
+	}
+
+	login := deps.Login(context.Background(), LoginInput{Email: "socialnew@gmail.com", Password: "Whatever123!"}, business.CommonInput{})
+	if login.StatusCode != 400 {
+		t.Fatalf("TestSocialLoginRegisters - password login expected 400, got %v", login)
+	}
+
+	common := business.CommonInput{SessionID: first.SessionID}
+
+	unlink := deps.Unlink(context.Background(), UnlinkInput{Provider: "local"}, common)
+	if unlink.StatusCode != 400 {
+		t.Fatalf("TestSocialLoginRegisters - unlinking the only login method expected 400, got %v", unlink)
+	}
+
+	set := deps.ChangePassword(context.Background(), ChangePasswordInput{NewPassword: "Socialnew123!"}, common)
+	if set.StatusCode != 200 {
+		t.Fatalf("TestSocialLoginRegisters - setting a first password expected 200, got %v", set)
+	}
+
+	unlink = deps.Unlink(context.Background(), UnlinkInput{Provider: "local"}, common)
+	if unlink.StatusCode != 200 {
+		t.Fatalf("TestSocialLoginRegisters - unlink expected 200, got %v", unlink)
+	}
+}
+
+func TestSocialLoginLinksVerifiedEmail(t *testing.T) {
+	t.Parallel()
+
+	deps, server := socialDeps(t)
+	_, existing := registerAndLogin(t, deps, "linkbyemail", "linkbyemail@gmail.com", "Linkbyemail123!")
+
+	unverified := socialLogin(t, deps, server, oidctest.User{Subject: "link-1", Email: "linkbyemail@gmail.com"})
+	if unverified.StatusCode != 400 {
+		t.Fatalf("TestSocialLoginLinksVerifiedEmail.Unverified - expected 400, got %v", unverified)
+	}
+
+	verified := socialLogin(t, deps, server, oidctest.User{Subject: "link-1", Email: "linkbyemail@gmail.com", EmailVerified: true})
+	if verified.StatusCode != 200 || verified.Created || verified.User.ID != existing.ID {
+		t.Fatalf("TestSocialLoginLinksVerifiedEmail.Verified - expected existing user, got %v", verified)
+	}
+
+	identities := deps.Identities(context.Background(), business.CommonInput{SessionID: verified.SessionID})
+	if identities.StatusCode != 200 || len(identities.Identities) != 1 || identities.Identities[0].Provider != "local" {
+		t.Fatalf("TestSocialLoginLinksVerifiedEmail.Identities - expected linked provider, got %v", identities)
+	}
+}
+
+func TestSocialLink(t *testing.T) {
+	t.Parallel()
+
+	deps, server := socialDeps(t)
+	common, user := registerAndLogin(t, deps, "linker", "linker@gmail.com", "Linker123!")
+
+	start := deps.SocialLink(context.Background(), SocialStartInput{Provider: "local"}, common)
+	if start.StatusCode != 200 {
+		t.Fatalf("TestSocialLink.Start - expected 200, got %v", start)
+	}
+
+	// the provider account uses another email, linking is explicit so it does not matter
+	input := loginAtProvider(t, server, start.RedirectTo, oidctest.User{Subject: "linker-1", Email: "elsewhere@gmail.com"})
+
+	t.Run("LoginCallbackRejected", func(t *testing.T) {
+		other := deps.SocialLink(context.Background(), SocialStartInput{Provider: "local"}, common)
+		in := loginAtProvider(t, server, other.RedirectTo, oidctest.User{Subject: "linker-2"})
+
+		out := deps.SocialCallback(context.Background(), in, business.CommonInput{})
+		if out.StatusCode != 400 {
+			t.Fatalf("TestSocialLink.LoginCallbackRejected - expected 400, got %v", out)
+		}
+	})
+
+	out := deps.SocialLinkCallback(context.Background(), input, common)
+	if out.StatusCode != 200 || out.Identity.Provider != "local" {
+		t.Fatalf("TestSocialLink.Callback - expected 200, got %v", out)
+	}
+
+	replay := deps.SocialLinkCallback(context.Background(), input, common)
+	if replay.StatusCode != 400 {
+		t.Fatalf("TestSocialLink.Replay - state must be single use, got %v", replay)
+	}
+
+	login := socialLogin(t, deps, server, oidctest.User{Subject: "linker-1", Email: "elsewhere@gmail.com"})
+	if login.StatusCode != 200 || login.User.ID != user.ID {
+		t.Fatalf("TestSocialLink.Login - expected linked user, got %v", login)
+	}
+}
+
+func TestSocialInvalidInput(t *testing.T) {
+	t.Parallel()
+
+	deps, server := socialDeps(t)
+
+	unknown := deps.SocialLogin(context.Background(), SocialStartInput{Provider: "nope"}, business.CommonInput{})
+	if unknown.StatusCode != 400 {
+		t.Fatalf("TestSocialInvalidInput.UnknownProvider - expected 400, got %v", unknown)
+	}
+
+	start := deps.SocialLogin(context.Background(), SocialStartInput{Provider: "local"}, business.CommonInput{})
+	input := loginAtProvider(t, server, start.RedirectTo, oidctest.User{Subject: "invalid-1", Email: "invalid@gmail.com"})
+
+	forged := input
+	forged.State = "forged"
+
+	out := deps.SocialCallback(context.Background(), forged, business.CommonInput{})
+	if out.StatusCode != 400 {
+		t.Fatalf("TestSocialInvalidInput.ForgedState - expected 400, got %v", out)
+	}
+
+	wrongCode := input
+	wrongCode.Code = "wrong"
+
+	out = deps.SocialCallback(context.Background(), wrongCode, business.CommonInput{})
+	if out.StatusCode != 400 {
+		t.Fatalf("TestSocialInvalidInput.WrongCode - expected 400, got %v", out)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"net"
 	"net/mail"
+	"regexp"
 	"strings"
 	"unicode"
 
@@ -24,8 +25,12 @@ var (
 
 	errUsernameRequired  = errors.New("username is required")
 	errUsernameMaxLength = errors.New("username length must be lower than 50 characters")
+
+	errInvalidLocale = errors.New("locale must be a language tag such as en or pt-BR")
 )
 
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,8}([-_][a-zA-Z0-9]{1,8}){0,3}$`)
+
 func validAccount(username, email, password string) error {
 	if err := validEmail(email); err != nil {
 		return setError(errs.Op("validation.validAccount.validEmail"), err)
@@ -126,3 +131,12 @@ func validPassword(password string) error {
 func setError(op errs.Op, err error) error {
 	return errs.E(op, errs.KindBadRequest, err, err.Error())
 }
+
+// validLocale accepts an empty locale, which stands for the default one.
+func validLocale(locale string) error {
+	if locale != "" && !localePattern.MatchString(locale) {
+		return errInvalidLocale
+	}
+
+	return nil
+}
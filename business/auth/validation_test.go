@@ -52,6 +52,31 @@ func Test_validUsername(t *testing.T) {
 	}
 }
 
+func Test_validLocale(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		TestUsername string
+		Locale       string
+		Result       error
+	}{
+		{"Empty", "", nil},
+		{"Language", "id", nil},
+		{"Region", "pt-BR", nil},
+		{"Underscore", "pt_BR", nil},
+		{"Path", "../id", errInvalidLocale},
+		{"Too_Short", "e", errInvalidLocale},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.TestUsername, func(t *testing.T) {
+			if tt.Result != validLocale(tt.Locale) {
+				t.Errorf("validLocale() = %v, want %v", validLocale(tt.Locale), tt.Result)
+			}
+		})
+	}
+}
+
 func Test_validPassword(t *testing.T) {
 	t.Parallel()
 
@@ -1,20 +1,83 @@
 package business
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"time"
 
+	"github.com/samuelsih/guwu/model"
 	"github.com/samuelsih/guwu/pkg/errs"
 	"github.com/samuelsih/guwu/pkg/logger"
 )
 
+var errUnauthenticated = errors.New("unauthenticated")
+
 // type check interface
 var _ CommonOutput = (*CommonResponse)(nil)
 
 type CommonInputMatcher interface{}
 type CommonInput struct {
-	SessionID  string
-	URLParam   []string
-	QueryParam []string
+	SessionID   string
+	AccessToken string
+	URLParam    Params
+	QueryParam  Params
+
+	// Identity is set by the presentation layer on routes requiring a user.
+	Identity *Identity
+}
+
+// User returns the authenticated user, if any.
+func (c CommonInput) User() (model.User, bool) {
+	if c.Identity == nil {
+		return model.User{}, false
+	}
+
+	return c.Identity.User, true
+}
+
+// Authenticated returns the identity resolved by the presentation layer,
+// or resolves it with identify when the route did not require a user.
+func Authenticated(ctx context.Context, in CommonInput, identify func(ctx context.Context, in CommonInput) (Identity, error)) (Identity, error) {
+	const op = errs.Op("business.Authenticated")
+
+	if in.Identity != nil {
+		return *in.Identity, nil
+	}
+
+	if in.SessionID == "" && in.AccessToken == "" {
+		return Identity{}, errs.E(op, errs.KindUnauthorized, errUnauthenticated, errUnauthenticated.Error())
+	}
+
+	return identify(ctx, in)
+}
+
+// Params holds the resolved url or query parameters of a request.
+type Params map[string]string
+
+func (p Params) Get(key string) string {
+	return p[key]
+}
+
+// Identity is the user behind a request, resolved from either a session or an access token.
+type Identity struct {
+	User      model.User
+	SessionID string
+	TokenID   string
+	ClientID  string
+	Scopes    []string
+
+	// SessionMaxAge is set when the session expiry was extended, the cookie must follow.
+	SessionMaxAge int
+}
+
+// Can reports whether the identity is granted scope. Sessions are granted every scope.
+func (i Identity) Can(scope string) bool {
+	if i.SessionID != "" {
+		return true
+	}
+
+	return hasScope(i.Scopes, scope)
 }
 
 type CommonResponse struct {
@@ -22,6 +85,10 @@ type CommonResponse struct {
 	Msg           string `json:"message,omitempty"`
 	SessionID     string `json:"-"`
 	SessionMaxAge int    `json:"-"`
+
+	// Version and LastModified validate conditional reads, without a version the ETag hashes the body.
+	Version      string    `json:"-"`
+	LastModified time.Time `json:"-"`
 }
 
 func (res *CommonResponse) SetError(err error) {
@@ -41,6 +108,18 @@ func (res *CommonResponse) SetOK() {
 	res.Msg = "OK"
 }
 
+// SetVersion identifies the state of the resource, e.g. a revision counter.
+func (res *CommonResponse) SetVersion(version string) {
+	res.Version = version
+}
+
+// SetLastModified keeps the latest of the times given so far, lists call it for each item.
+func (res *CommonResponse) SetLastModified(t time.Time) {
+	if t.After(res.LastModified) {
+		res.LastModified = t
+	}
+}
+
 func (res CommonResponse) CommonRes() *CommonResponse {
 	return &res
 }
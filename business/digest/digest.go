@@ -0,0 +1,130 @@
+// Package digest mails users the activity they missed, daily or weekly as they chose.
+package digest
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samuelsih/guwu/business/outbox"
+	"github.com/samuelsih/guwu/model"
+	"github.com/samuelsih/guwu/pkg/logger"
+	"github.com/samuelsih/guwu/pkg/mail"
+)
+
+const (
+	BATCH_SIZE     = 100
+	MAX_ITEMS      = 5
+	EXCERPT_LENGTH = 140
+)
+
+type Deps struct {
+	DB *sqlx.DB
+
+	// Now is the clock of the job, time.Now when nil.
+	Now func() time.Time
+}
+
+// Send queues the digest of up to BATCH_SIZE due users in the outbox, the others wait for the next run.
+// Users without any activity get no mail, their digest period starts over all the same.
+func (d *Deps) Send(ctx context.Context) error {
+	now := time.Now
+	if d.Now != nil {
+		now = d.Now
+	}
+
+	sentAt := now().UTC()
+
+	recipients, err := model.DueDigests(ctx, d.DB, sentAt, BATCH_SIZE)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range recipients {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := d.send(ctx, r, sentAt); err != nil {
+			logger.Err(err)
+		}
+	}
+
+	return nil
+}
+
+func (d *Deps) send(ctx context.Context, r model.DigestRecipient, sentAt time.Time) error {
+	data, err := d.Activity(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	var mails []model.OutboxMail
+
+	if data.FollowerCount > 0 || len(data.Mentions) > 0 || len(data.Posts) > 0 {
+		param := mail.Param{
+			Name:          r.Username,
+			Email:         r.Email,
+			Subject:       "Your digest",
+			TemplateTypes: mail.DigestMsg,
+			Locale:        r.Locale,
+			UserID:        r.UserID,
+		}
+
+		m, err := outbox.Mail(param, data)
+		if err != nil {
+			return err
+		}
+
+		mails = append(mails, m)
+	}
+
+	_, err = model.RecordDigest(ctx, d.DB, r, sentAt, mails...)
+	return err
+}
+
+// Activity gathers what happened to r since its last digest.
+func (d *Deps) Activity(ctx context.Context, r model.DigestRecipient) (mail.DigestTplData, error) {
+	data := mail.DigestTplData{Username: r.Username, Frequency: r.Frequency}
+
+	var err error
+
+	data.FollowerCount, data.Followers, err = model.NewFollowers(ctx, d.DB, r.UserID, r.Since, MAX_ITEMS)
+	if err != nil {
+		return data, err
+	}
+
+	mentions, err := model.Mentions(ctx, d.DB, r.UserID, r.Username, r.Since, MAX_ITEMS)
+	if err != nil {
+		return data, err
+	}
+
+	posts, err := model.FollowedPosts(ctx, d.DB, r.UserID, r.Since, MAX_ITEMS)
+	if err != nil {
+		return data, err
+	}
+
+	data.Mentions = excerpts(mentions)
+	data.Posts = excerpts(posts)
+
+	return data, nil
+}
+
+func excerpts(posts []model.DigestPost) []mail.DigestPost {
+	result := make([]mail.DigestPost, 0, len(posts))
+
+	for _, p := range posts {
+		result = append(result, mail.DigestPost{Username: p.Username, Excerpt: excerpt(p.Description)})
+	}
+
+	return result
+}
+
+func excerpt(s string) string {
+	runes := []rune(s)
+	if len(runes) <= EXCERPT_LENGTH {
+		return s
+	}
+
+	return string(runes[:EXCERPT_LENGTH-1]) + "…"
+}
@@ -0,0 +1,249 @@
+package digest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samuelsih/guwu/config"
+	"github.com/samuelsih/guwu/model"
+	"github.com/samuelsih/guwu/pkg/mail"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+var testDB *sqlx.DB
+
+func TestMain(m *testing.M) {
+	cleanup, err := setup()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	code := m.Run()
+
+	if err := cleanup(); err != nil {
+		log.Fatalf("error cleaning up: %v", err)
+	}
+
+	os.Exit(code)
+}
+
+func insertUser(t *testing.T, username string) model.User {
+	t.Helper()
+
+	user, err := model.InsertUser(context.Background(), testDB, username, username+"@gmail.com", "", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+func digests(t *testing.T) map[string]mail.DigestTplData {
+	t.Helper()
+
+	mails, err := model.ListOutboxMails(context.Background(), testDB, model.OutboxPending, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := map[string]mail.DigestTplData{}
+	for _, m := range mails {
+		if mail.MsgType(m.Template) != mail.DigestMsg {
+			continue
+		}
+
+		var data mail.DigestTplData
+		if err := json.Unmarshal(m.Data, &data); err != nil {
+			t.Fatal(err)
+		}
+
+		result[m.Email] = data
+	}
+
+	return result
+}
+
+func TestSend(t *testing.T) {
+	ctx := context.Background()
+
+	jane, john, tina := insertUser(t, "jane"), insertUser(t, "john"), insertUser(t, "tina")
+	quiet := insertUser(t, "quiet")
+
+	for _, f := range [][2]string{{john.ID, jane.ID}, {jane.ID, tina.ID}, {quiet.ID, jane.ID}} {
+		if err := model.FollowUser(ctx, testDB, f[0], f[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	posts := []model.Post{
+		{ID: "p1", UserID: john.ID, Description: "Lunch with @Jane today"},
+		{ID: "p2", UserID: tina.ID, Description: strings.Repeat("a", EXCERPT_LENGTH+10)},
+		{ID: "p3", UserID: john.ID, Description: "Not a mention of @janet nor of foo@jane.com"},
+	}
+
+	for _, p := range posts {
+		if _, err := model.InsertPost(ctx, testDB, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := model.SetEmailPreference(ctx, testDB, quiet.ID, string(mail.DigestCategory), false); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	deps := Deps{DB: testDB, Now: func() time.Time { return now }}
+
+	if err := deps.Send(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if sent := digests(t); len(sent) != 0 {
+		t.Fatalf("TestSend.NotDue - expected no digest before a week, got %v", sent)
+	}
+
+	now = now.Add(8 * 24 * time.Hour)
+
+	if err := deps.Send(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := digests(t)
+	if len(sent) != 2 {
+		t.Fatalf("TestSend.Due - expected the digests of jane and tina, got %v", sent)
+	}
+
+	got := sent[jane.Email]
+	if got.Frequency != model.DigestWeekly || got.FollowerCount != 2 || len(got.Mentions) != 1 || got.Mentions[0].Username != "john" {
+		t.Fatalf("TestSend.Jane - unexpected digest %+v", got)
+	}
+
+	if len(got.Posts) != 1 || len([]rune(got.Posts[0].Excerpt)) != EXCERPT_LENGTH {
+		t.Fatalf("TestSend.Excerpt - expected the post of tina cut, got %+v", got.Posts)
+	}
+
+	if got := sent[tina.Email]; got.FollowerCount != 1 || got.Followers[0] != "jane" {
+		t.Fatalf("TestSend.Tina - unexpected digest %+v", got)
+	}
+
+	// a restart runs the job again right away
+	if err := deps.Send(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if again := digests(t); len(again) != 2 {
+		t.Fatalf("TestSend.Duplicate - expected no other digest, got %v", again)
+	}
+
+	t.Run("Daily", func(t *testing.T) {
+		if err := model.SetDigestFrequency(ctx, testDB, jane.ID, model.DigestDaily); err != nil {
+			t.Fatal(err)
+		}
+
+		now = now.Add(25 * time.Hour)
+
+		due, err := model.DueDigests(ctx, testDB, now.UTC(), BATCH_SIZE)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(due) != 1 || due[0].UserID != jane.ID || due[0].Frequency != model.DigestDaily {
+			t.Fatalf("TestSend.Daily - expected jane only, got %v", due)
+		}
+
+		data, err := deps.Activity(ctx, due[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if data.FollowerCount != 0 || len(data.Mentions) != 0 || len(data.Posts) != 0 {
+			t.Fatalf("TestSend.Daily - expected nothing new since the last digest, got %+v", data)
+		}
+	})
+}
+
+func TestRecordDigestOnce(t *testing.T) {
+	ctx := context.Background()
+	user := insertUser(t, "racer")
+
+	r := model.DigestRecipient{UserID: user.ID, Frequency: model.DigestWeekly}
+	sentAt := time.Now().UTC()
+
+	recorded, err := model.RecordDigest(ctx, testDB, r, sentAt)
+	if err != nil || !recorded {
+		t.Fatalf("TestRecordDigestOnce.First - expected recorded, got %v %v", recorded, err)
+	}
+
+	// another worker read the recipient before the first digest
+	recorded, err = model.RecordDigest(ctx, testDB, r, sentAt.Add(time.Minute))
+	if err != nil || recorded {
+		t.Fatalf("TestRecordDigestOnce.Second - expected skipped, got %v %v", recorded, err)
+	}
+}
+
+func setup() (func() error, error) {
+	ctx := context.Background()
+
+	req := testcontainers.ContainerRequest{
+		Image:        "postgres:latest",
+		ExposedPorts: []string{"5432/tcp"},
+		WaitingFor:   wait.ForListeningPort("5432/tcp"),
+		Env: map[string]string{
+			"POSTGRES_DB":       "testdb",
+			"POSTGRES_PASSWORD": "postgres",
+			"POSTGRES_USER":     "postgres",
+		},
+	}
+
+	container, err := testcontainers.GenericContainer(
+		ctx,
+		testcontainers.GenericContainerRequest{
+			ContainerRequest: req,
+			Started:          true,
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	mappedPort, err := container.MappedPort(ctx, "5432")
+	if err != nil {
+		return nil, err
+	}
+
+	hostIP, err := container.Host(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	uri := fmt.Sprintf("postgres://postgres:postgres@%v:%v/testdb?sslmode=disable", hostIP, mappedPort.Port())
+
+	testDB = config.ConnectPostgres(uri)
+	if testDB == nil {
+		return nil, errors.New("cannot connect testGuestDB")
+	}
+
+	if err := config.LoadPostgresExtension(testDB); err != nil {
+		return nil, errors.New("cannot load postgres extension")
+	}
+
+	if err := config.MigrateAll(testDB); err != nil {
+		return nil, err
+	}
+
+	cleanup := func() error {
+		return container.Terminate(ctx)
+	}
+
+	return cleanup, nil
+}
@@ -0,0 +1,194 @@
+// Package event streams what happens to users as it happens, across every instance of the API.
+//
+// Events are appended to a short Redis stream per user, kept for reconnecting clients,
+// and the id of each one is published on a channel of the same name to wake up the readers.
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/model"
+	"github.com/samuelsih/guwu/pkg/errs"
+	"github.com/samuelsih/guwu/pkg/logger"
+	"github.com/samuelsih/guwu/pkg/redis"
+)
+
+const (
+	TypeNotification = "notification"
+	TypeFollow       = "follow"
+	TypePost         = "post"
+
+	// BACKLOG_SIZE events are kept about, for BACKLOG_TTL seconds after the last one.
+	BACKLOG_SIZE = 100
+	BACKLOG_TTL  = 60 * 60
+	BATCH_SIZE   = 100
+
+	// POLL_INTERVAL catches the events published before the subscription was ready.
+	POLL_INTERVAL = 10 * time.Second
+)
+
+var errMalformedEvent = errors.New("malformed event")
+
+type Deps struct {
+	DB       *sqlx.DB
+	Identify func(ctx context.Context, in business.CommonInput) (business.Identity, error)
+
+	Append    func(ctx context.Context, key, channel string, maxLen, time int64, value string) (string, error)
+	Range     func(ctx context.Context, key, after string, count int64) ([]redis.StreamEntry, error)
+	LastID    func(ctx context.Context, key string) (string, error)
+	Subscribe func(ctx context.Context, channel string, fn func(message string)) error
+}
+
+// record is an event as stored in the stream, its id is the one of the entry.
+type record struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+func streamKey(userID string) string {
+	return "events:" + userID
+}
+
+// Publish streams an event of eventType to userID.
+func (d *Deps) Publish(ctx context.Context, userID, eventType string, data any) error {
+	const op = errs.Op("event.Publish")
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot publish the event")
+	}
+
+	value, err := json.Marshal(record{Type: eventType, Data: encoded})
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot publish the event")
+	}
+
+	key := streamKey(userID)
+
+	_, err = d.Append(ctx, key, key, BACKLOG_SIZE, BACKLOG_TTL, string(value))
+	return err
+}
+
+// PublishFollowers streams an event of eventType to every follower of userID, the failures are
+// logged so that one of them does not deprive the next followers.
+func (d *Deps) PublishFollowers(ctx context.Context, userID, eventType string, data any) error {
+	followers, err := model.FollowerIDs(ctx, d.DB, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, follower := range followers {
+		if err := d.Publish(ctx, follower, eventType, data); err != nil {
+			logger.Err(err)
+		}
+	}
+
+	return nil
+}
+
+// Stream sends the events of the user, the ones following lastEventID first when the client
+// resumes, as long as they are kept. Without lastEventID only the next events are sent.
+func (d *Deps) Stream(ctx context.Context, lastEventID string, common business.CommonInput) (business.Stream, error) {
+	const op = errs.Op("event.Stream")
+
+	identity, err := business.Authenticated(ctx, common, d.Identify)
+	if err != nil {
+		return business.Stream{}, err
+	}
+
+	if !identity.Can(business.ScopeEventsRead) {
+		return business.Stream{}, errs.E(op, 403, nil, "token is missing scope "+business.ScopeEventsRead)
+	}
+
+	key := streamKey(identity.User.ID)
+
+	if !redis.ValidStreamID(lastEventID) {
+		if lastEventID, err = d.LastID(ctx, key); err != nil {
+			return business.Stream{}, err
+		}
+	}
+
+	stream := business.Stream{LastEventID: lastEventID}
+
+	stream.Run = func(ctx context.Context, send func(business.Event) error) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		wake := make(chan struct{}, 1)
+		subscription := make(chan error, 1)
+
+		go func() {
+			subscription <- d.Subscribe(ctx, key, func(string) {
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			})
+		}()
+
+		timer := time.NewTimer(POLL_INTERVAL)
+		defer timer.Stop()
+
+		for {
+			entries, err := d.Range(ctx, key, lastEventID, BATCH_SIZE)
+			if err != nil {
+				return err
+			}
+
+			for _, entry := range entries {
+				event, err := decode(entry)
+				if err != nil {
+					logger.Err(err)
+				} else if err := send(event); err != nil {
+					return err
+				}
+
+				lastEventID = entry.ID
+			}
+
+			if len(entries) == BATCH_SIZE {
+				continue
+			}
+
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+
+			timer.Reset(POLL_INTERVAL)
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case err := <-subscription:
+				if ctx.Err() != nil {
+					return nil
+				}
+
+				return err
+			case <-wake:
+			case <-timer.C:
+			}
+		}
+	}
+
+	return stream, nil
+}
+
+func decode(entry redis.StreamEntry) (business.Event, error) {
+	const op = errs.Op("event.decode")
+
+	var r record
+	if err := json.Unmarshal([]byte(entry.Value), &r); err != nil {
+		return business.Event{}, errs.E(op, errs.KindUnexpected, err, errMalformedEvent.Error())
+	}
+
+	return business.Event{ID: entry.ID, Type: r.Type, Data: r.Data}, nil
+}
@@ -0,0 +1,335 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/config"
+	"github.com/samuelsih/guwu/model"
+	"github.com/samuelsih/guwu/pkg/errs"
+	"github.com/samuelsih/guwu/pkg/redis"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+var testDB *sqlx.DB
+
+func TestMain(m *testing.M) {
+	cleanup, err := setup()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	code := m.Run()
+
+	if err := cleanup(); err != nil {
+		log.Fatalf("error cleaning up: %v", err)
+	}
+
+	os.Exit(code)
+}
+
+// memoryStreams stands in for the streams and channels of Redis.
+type memoryStreams struct {
+	mu          sync.Mutex
+	seq         int
+	entries     map[string][]redis.StreamEntry
+	subscribers map[string][]func(string)
+}
+
+func newMemoryStreams() *memoryStreams {
+	return &memoryStreams{entries: map[string][]redis.StreamEntry{}, subscribers: map[string][]func(string){}}
+}
+
+func (m *memoryStreams) deps() Deps {
+	return Deps{DB: testDB, Append: m.Append, Range: m.Range, LastID: m.LastID, Subscribe: m.Subscribe}
+}
+
+func (m *memoryStreams) Append(ctx context.Context, key, channel string, maxLen, time int64, value string) (string, error) {
+	m.mu.Lock()
+	m.seq++
+	id := "1-" + strconv.Itoa(m.seq)
+	m.entries[key] = append(m.entries[key], redis.StreamEntry{ID: id, Value: value})
+	subscribers := m.subscribers[channel]
+	m.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(id)
+	}
+
+	return id, nil
+}
+
+func (m *memoryStreams) Range(ctx context.Context, key, after string, count int64) ([]redis.StreamEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result []redis.StreamEntry
+
+	for _, e := range m.entries[key] {
+		if after == "" || seqOf(e.ID) > seqOf(after) {
+			result = append(result, e)
+		}
+	}
+
+	if int64(len(result)) > count {
+		result = result[:count]
+	}
+
+	return result, nil
+}
+
+func (m *memoryStreams) LastID(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entries := m.entries[key]; len(entries) > 0 {
+		return entries[len(entries)-1].ID, nil
+	}
+
+	return "0-0", nil
+}
+
+func (m *memoryStreams) Subscribe(ctx context.Context, channel string, fn func(string)) error {
+	m.mu.Lock()
+	m.subscribers[channel] = append(m.subscribers[channel], fn)
+	m.mu.Unlock()
+
+	<-ctx.Done()
+	return nil
+}
+
+func seqOf(id string) int {
+	seq, _ := strconv.Atoi(id[len("1-"):])
+	return seq
+}
+
+func insertUser(t *testing.T, username string) model.User {
+	t.Helper()
+
+	user, err := model.InsertUser(context.Background(), testDB, username, username+"@gmail.com", "", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+func as(user model.User) business.CommonInput {
+	return business.CommonInput{Identity: &business.Identity{User: user, SessionID: "session"}}
+}
+
+// collect runs the stream until want events were sent or a second went by.
+func collect(t *testing.T, stream business.StreamFunc, want int, publish func()) []business.Event {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var events []business.Event
+	done := make(chan error, 1)
+
+	go func() {
+		done <- stream(ctx, func(e business.Event) error {
+			events = append(events, e)
+			if len(events) == want {
+				cancel()
+			}
+
+			return nil
+		})
+	}()
+
+	if publish != nil {
+		// the subscription of the memory streams is immediate but not synchronous
+		time.Sleep(50 * time.Millisecond)
+		publish()
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	return events
+}
+
+func TestStream(t *testing.T) {
+	ctx := context.Background()
+	streams := newMemoryStreams()
+	deps := streams.deps()
+	user := insertUser(t, "streamer")
+
+	if err := deps.Publish(ctx, user.ID, TypeFollow, map[string]string{"follower_id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("resumes after the last event id", func(t *testing.T) {
+		stream, err := deps.Stream(ctx, "0-0", as(user))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		events := collect(t, stream.Run, 2, func() {
+			if err := deps.Publish(ctx, user.ID, TypePost, map[string]string{"id": "post"}); err != nil {
+				t.Error(err)
+			}
+		})
+
+		if len(events) != 2 || events[0].Type != TypeFollow || events[1].Type != TypePost {
+			t.Fatalf("expected the backlog then the new event, got %+v", events)
+		}
+
+		data, _ := json.Marshal(events[1].Data)
+		if string(data) != `{"id":"post"}` {
+			t.Fatalf("unexpected data %s", data)
+		}
+	})
+
+	t.Run("only new events without last event id", func(t *testing.T) {
+		stream, err := deps.Stream(ctx, "", as(user))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		events := collect(t, stream.Run, 1, func() {
+			if err := deps.Publish(ctx, user.ID, TypeNotification, map[string]string{"message": "hi"}); err != nil {
+				t.Error(err)
+			}
+		})
+
+		if len(events) != 1 || events[0].Type != TypeNotification {
+			t.Fatalf("expected the new event only, got %+v", events)
+		}
+	})
+
+	t.Run("resumes after a stream without events", func(t *testing.T) {
+		first, err := deps.Stream(ctx, "", as(user))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if last, _ := streams.LastID(ctx, streamKey(user.ID)); first.LastEventID != last {
+			t.Fatalf("expected the stream to start at %s, got %s", last, first.LastEventID)
+		}
+
+		if events := collect(t, first.Run, 1, nil); len(events) != 0 {
+			t.Fatalf("expected no event, got %+v", events)
+		}
+
+		// published while the client reconnects
+		if err := deps.Publish(ctx, user.ID, TypePost, map[string]string{"id": "missed"}); err != nil {
+			t.Fatal(err)
+		}
+
+		resumed, err := deps.Stream(ctx, first.LastEventID, as(user))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if events := collect(t, resumed.Run, 1, nil); len(events) != 1 || events[0].Type != TypePost {
+			t.Fatalf("expected the missed post, got %+v", events)
+		}
+	})
+}
+
+func TestPublishFollowers(t *testing.T) {
+	ctx := context.Background()
+	streams := newMemoryStreams()
+	deps := streams.deps()
+
+	author := insertUser(t, "author")
+	follower := insertUser(t, "reader")
+	stranger := insertUser(t, "stranger")
+
+	if err := model.FollowUser(ctx, testDB, follower.ID, author.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := deps.PublishFollowers(ctx, author.ID, TypePost, map[string]string{"id": "post"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if entries, _ := streams.Range(ctx, streamKey(follower.ID), "", 10); len(entries) != 1 {
+		t.Fatalf("expected the post for the follower, got %v", entries)
+	}
+
+	if entries, _ := streams.Range(ctx, streamKey(stranger.ID), "", 10); len(entries) != 0 {
+		t.Fatalf("expected nothing for the stranger, got %v", entries)
+	}
+}
+
+func TestScopes(t *testing.T) {
+	deps := newMemoryStreams().deps()
+	common := business.CommonInput{Identity: &business.Identity{TokenID: "token", Scopes: []string{business.ScopeNotificationsRead}}}
+
+	if _, err := deps.Stream(context.Background(), "", common); errs.GetKind(err) != 403 {
+		t.Fatalf("expected 403 without events:read, got %v", err)
+	}
+}
+func setup() (func() error, error) {
+	ctx := context.Background()
+
+	req := testcontainers.ContainerRequest{
+		Image:        "postgres:latest",
+		ExposedPorts: []string{"5432/tcp"},
+		WaitingFor:   wait.ForListeningPort("5432/tcp"),
+		Env: map[string]string{
+			"POSTGRES_DB":       "testdb",
+			"POSTGRES_PASSWORD": "postgres",
+			"POSTGRES_USER":     "postgres",
+		},
+	}
+
+	container, err := testcontainers.GenericContainer(
+		ctx,
+		testcontainers.GenericContainerRequest{
+			ContainerRequest: req,
+			Started:          true,
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	mappedPort, err := container.MappedPort(ctx, "5432")
+	if err != nil {
+		return nil, err
+	}
+
+	hostIP, err := container.Host(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	uri := fmt.Sprintf("postgres://postgres:postgres@%v:%v/testdb?sslmode=disable", hostIP, mappedPort.Port())
+
+	testDB = config.ConnectPostgres(uri)
+	if testDB == nil {
+		return nil, errors.New("cannot connect testGuestDB")
+	}
+
+	if err := config.LoadPostgresExtension(testDB); err != nil {
+		return nil, errors.New("cannot load postgres extension")
+	}
+
+	if err := config.MigrateAll(testDB); err != nil {
+		return nil, err
+	}
+
+	cleanup := func() error {
+		return container.Terminate(ctx)
+	}
+
+	return cleanup, nil
+}
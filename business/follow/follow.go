@@ -5,18 +5,24 @@ import (
 
 	"github.com/jmoiron/sqlx"
 	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/business/event"
 	"github.com/samuelsih/guwu/model"
-
-	"github.com/samuelsih/guwu/pkg/securer"
+	"github.com/samuelsih/guwu/pkg/logger"
 )
 
 type Deps struct {
-	DB             *sqlx.DB
-	GetUserSession func(ctx context.Context, key string, dst any) error
+	DB       *sqlx.DB
+	Identify func(ctx context.Context, in business.CommonInput) (business.Identity, error)
+
+	// Notify tells the followed user, a failure does not undo the follow.
+	Notify func(ctx context.Context, events ...model.NotificationEvent) error
+
+	// Publish streams the follow to the connected clients of the followed user.
+	Publish func(ctx context.Context, userID, eventType string, data any) error
 }
 
 type FollowIn struct {
-	UserID string `json:"user_id"`
+	UserID string `json:"user_id" validate:"required"`
 }
 
 type FollowOut struct {
@@ -25,65 +31,67 @@ type FollowOut struct {
 
 func (d *Deps) Follow(ctx context.Context, in FollowIn, common business.CommonInput) FollowOut {
 	var out FollowOut
-	var user model.User
-
-	if common.SessionID == "" {
-		out.RawError(403, "Unauthenticated")
-		return out
-	}
 
-	sessionID, err := securer.Decrypt(common.SessionID)
+	identity, err := business.Authenticated(ctx, common, d.Identify)
 	if err != nil {
 		out.SetError(err)
 		return out
 	}
 
-	err = d.GetUserSession(ctx, string(sessionID), &user)
-	if err != nil {
-		out.SetError(err)
+	if !identity.Can(business.ScopeFollowsWrite) {
+		out.RawError(403, "token is missing scope "+business.ScopeFollowsWrite)
 		return out
 	}
 
-	err = model.FollowUser(ctx, d.DB, user.ID, in.UserID)
+	err = model.FollowUser(ctx, d.DB, identity.User.ID, in.UserID)
 	if err != nil {
 		out.SetError(err)
 		return out
 	}
 
+	if d.Notify != nil {
+		notification := model.NotificationEvent{UserID: in.UserID, ActorID: identity.User.ID, Type: model.NotificationFollow}
+
+		if err := d.Notify(ctx, notification); err != nil {
+			logger.Err(err)
+		}
+	}
+
+	if d.Publish != nil {
+		data := map[string]string{"follower_id": identity.User.ID, "follower_username": identity.User.Username}
+
+		if err := d.Publish(ctx, in.UserID, event.TypeFollow, data); err != nil {
+			logger.Err(err)
+		}
+	}
+
 	out.SetOK()
 	return out
 }
 
 type UnfollowIn struct {
-	UserID string `json:"user_id"`
+	UserID string `url:"id"`
 }
 
 type UnfollowOut struct {
 	business.CommonResponse
 }
 
-func (d *Deps) Unfollow(ctx context.Context, in FollowIn, common business.CommonInput) UnfollowOut {
+func (d *Deps) Unfollow(ctx context.Context, in UnfollowIn, common business.CommonInput) UnfollowOut {
 	var out UnfollowOut
-	var user model.User
 
-	if common.SessionID == "" {
-		out.RawError(403, "Unauthenticated")
-		return out
-	}
-
-	sessionID, err := securer.Decrypt(common.SessionID)
+	identity, err := business.Authenticated(ctx, common, d.Identify)
 	if err != nil {
 		out.SetError(err)
 		return out
 	}
 
-	err = d.GetUserSession(ctx, string(sessionID), &user)
-	if err != nil {
-		out.SetError(err)
+	if !identity.Can(business.ScopeFollowsWrite) {
+		out.RawError(403, "token is missing scope "+business.ScopeFollowsWrite)
 		return out
 	}
 
-	err = model.UnfollowUser(ctx, d.DB, user.ID, in.UserID)
+	err = model.UnfollowUser(ctx, d.DB, identity.User.ID, in.UserID)
 	if err != nil {
 		out.SetError(err)
 		return out
@@ -64,8 +64,8 @@ func TestFollow(t *testing.T) {
 
 		out := deps.Follow(context.Background(), FollowIn{}, business.CommonInput{})
 
-		if out.StatusCode != 403 {
-			t.Fatalf("expected status code 400, got %d - %v", out.StatusCode, out)
+		if out.StatusCode != 401 {
+			t.Fatalf("expected status code 401, got %d - %v", out.StatusCode, out)
 		}
 	})
 
@@ -74,8 +74,8 @@ func TestFollow(t *testing.T) {
 
 		deps := Deps {
 			DB: testDB,
-			GetUserSession: func(ctx context.Context, key string, dst any) error {
-				return errs.E(errs.Op("GetUserSession"), errs.KindBadRequest, errors.New("unknown input"), "unknown input")
+			Identify: func(ctx context.Context, in business.CommonInput) (business.Identity, error) {
+				return business.Identity{}, errs.E(errs.Op("Identify"), errs.KindBadRequest, errors.New("unknown input"), "unknown input")
 			},
 		}
 
@@ -100,12 +100,27 @@ func TestFollow(t *testing.T) {
 		}
 	})
 
+	t.Run("Token without follows:write scope", func(t *testing.T) {
+		deps := Deps {
+			DB: testDB,
+			Identify: func(ctx context.Context, in business.CommonInput) (business.Identity, error) {
+				return business.Identity{TokenID: "123", Scopes: []string{business.ScopeFollowsRead}}, nil
+			},
+		}
+
+		out := deps.Follow(context.Background(), FollowIn{UserID: "123123123"}, business.CommonInput{AccessToken: "guwu_pat_123"})
+
+		if out.StatusCode != 403 {
+			t.Fatalf("expected status code 403, got %d - %v", out.StatusCode, out)
+		}
+	})
+
 	t.Run("Unknown user_follow_id", func(t *testing.T) {
 		sess, _ := securer.Encrypt([]byte("1231231231231232123"))
 		deps := Deps {
 			DB: testDB,
-			GetUserSession: func(ctx context.Context, key string, dst any) error {
-				return nil
+			Identify: func(ctx context.Context, in business.CommonInput) (business.Identity, error) {
+				return business.Identity{SessionID: "1231231231231232123"}, nil
 			},
 		}
 
@@ -0,0 +1,392 @@
+// Package notification keeps the follows, mentions, likes and replies of users until they read them.
+package notification
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/xid"
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/business/event"
+	"github.com/samuelsih/guwu/model"
+	"github.com/samuelsih/guwu/pkg/errs"
+	"github.com/samuelsih/guwu/pkg/logger"
+	push "github.com/samuelsih/guwu/pkg/notification"
+)
+
+const (
+	DEFAULT_LIMIT = 20
+	MAX_LIMIT     = 100
+	MAX_BULK      = 100
+	MAX_MENTIONS  = 10
+
+	PUSH_TIMEOUT = 30 * time.Second
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\pL\pN_])@([\pL\pN_.]+)`)
+
+// actions describe the notifications of a type, after the actors.
+var actions = map[string]string{
+	model.NotificationFollow:  "followed you",
+	model.NotificationMention: "mentioned you in a post",
+	model.NotificationLike:    "liked your post",
+	model.NotificationReply:   "replied to your post",
+}
+
+type Deps struct {
+	DB       *sqlx.DB
+	Identify func(ctx context.Context, in business.CommonInput) (business.Identity, error)
+
+	// Push sends each recorded event to the devices of its user when set.
+	Push func(ctx context.Context, m push.Message, userIDs ...string) error
+
+	// Publish streams each recorded event to the connected clients of its user when set.
+	Publish func(ctx context.Context, userID, eventType string, data any) error
+}
+
+// Notification is a group of events along with a sentence describing it.
+type Notification struct {
+	model.Notification
+	Message string `json:"message"`
+}
+
+// Record stores events for their users, the ones users trigger themselves are dropped.
+func (d *Deps) Record(ctx context.Context, events ...model.NotificationEvent) error {
+	for _, e := range events {
+		if e.UserID == e.ActorID {
+			continue
+		}
+
+		if err := model.RecordNotification(ctx, d.DB, xid.New().String(), e); err != nil {
+			return err
+		}
+
+		if d.Push != nil || d.Publish != nil {
+			d.deliver(ctx, e)
+		}
+	}
+
+	return nil
+}
+
+// deliver only logs its errors as the event is recorded already,
+// pushing in the background along with its retries.
+func (d *Deps) deliver(ctx context.Context, e model.NotificationEvent) {
+	actor, err := model.FindUserByID(ctx, d.DB, e.ActorID)
+	if err != nil {
+		logger.Err(err)
+		return
+	}
+
+	message := Message(model.Notification{Type: e.Type, ActorUsername: actor.Username, ActorCount: 1})
+	data := map[string]any{"type": e.Type, "subject_id": e.SubjectID, "actor_id": e.ActorID}
+
+	if d.Publish != nil {
+		if err := d.Publish(ctx, e.UserID, event.TypeNotification, map[string]any{
+			"type":           e.Type,
+			"subject_id":     e.SubjectID,
+			"actor_id":       e.ActorID,
+			"actor_username": actor.Username,
+			"message":        message,
+		}); err != nil {
+			logger.Err(err)
+		}
+	}
+
+	if d.Push == nil {
+		return
+	}
+
+	m := push.Message{Title: "Guwu", Body: message, Data: data}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), PUSH_TIMEOUT)
+		defer cancel()
+
+		if err := d.Push(ctx, m, e.UserID); err != nil {
+			logger.Err(err)
+		}
+	}()
+}
+
+// Mentioned notifies the users written as @username in text, the post postID of actorID.
+func (d *Deps) Mentioned(ctx context.Context, actorID, postID, text string) error {
+	usernames := Mentions(text)
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	ids, err := model.FindUserIDsByUsernames(ctx, d.DB, usernames)
+	if err != nil {
+		return err
+	}
+
+	events := make([]model.NotificationEvent, 0, len(ids))
+	for _, id := range ids {
+		events = append(events, model.NotificationEvent{UserID: id, ActorID: actorID, Type: model.NotificationMention, SubjectID: postID})
+	}
+
+	return d.Record(ctx, events...)
+}
+
+// Mentions returns the distinct usernames mentioned in text, up to MAX_MENTIONS.
+func Mentions(text string) []string {
+	var usernames []string
+	seen := map[string]bool{}
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		username := strings.TrimRight(match[1], ".")
+		key := strings.ToLower(username)
+
+		if username == "" || seen[key] {
+			continue
+		}
+
+		seen[key] = true
+		usernames = append(usernames, username)
+
+		if len(usernames) == MAX_MENTIONS {
+			break
+		}
+	}
+
+	return usernames
+}
+
+// Message is "jane followed you", or "jane and 4 others followed you" for a group.
+func Message(n model.Notification) string {
+	action, ok := actions[n.Type]
+	if !ok {
+		action = n.Type
+	}
+
+	switch others := n.ActorCount - 1; {
+	case others == 1:
+		return fmt.Sprintf("%s and 1 other %s", n.ActorUsername, action)
+	case others > 1:
+		return fmt.Sprintf("%s and %d others %s", n.ActorUsername, others, action)
+	default:
+		return n.ActorUsername + " " + action
+	}
+}
+
+// encodeCursor points after n, notifications are listed by their last update then id.
+func encodeCursor(n model.Notification) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(n.UpdatedAt.UTC().Format(time.RFC3339Nano) + " " + n.ID))
+}
+
+func decodeCursor(cursor string) (time.Time, string, error) {
+	const op = errs.Op("notification.decodeCursor")
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", errs.E(op, errs.KindBadRequest, err, errInvalidCursor.Error())
+	}
+
+	at, id, found := strings.Cut(string(raw), " ")
+	if !found || id == "" {
+		return time.Time{}, "", errs.E(op, errs.KindBadRequest, errInvalidCursor, errInvalidCursor.Error())
+	}
+
+	updatedAt, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return time.Time{}, "", errs.E(op, errs.KindBadRequest, err, errInvalidCursor.Error())
+	}
+
+	return updatedAt, id, nil
+}
+
+type ListInput struct {
+	Cursor string `query:"cursor"`
+	Limit  int    `query:"limit" validate:"min=0,max=100"`
+}
+
+type ListOutput struct {
+	business.CommonResponse
+	Notifications []Notification `json:"notifications"`
+
+	// NextCursor is the cursor of the next page, empty on the last one.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// List returns the notifications of the user, latest first, a page after Cursor when set.
+func (d *Deps) List(ctx context.Context, in ListInput, common business.CommonInput) ListOutput {
+	var out ListOutput
+
+	if in.Limit == 0 {
+		in.Limit = DEFAULT_LIMIT
+	}
+
+	if in.Limit < 0 || in.Limit > MAX_LIMIT {
+		out.RawError(400, "limit must be between 1 and 100")
+		return out
+	}
+
+	var before time.Time
+	var beforeID string
+
+	if in.Cursor != "" {
+		var err error
+		if before, beforeID, err = decodeCursor(in.Cursor); err != nil {
+			out.SetError(err)
+			return out
+		}
+	}
+
+	identity, ok := d.reader(ctx, common, &out.CommonResponse)
+	if !ok {
+		return out
+	}
+
+	// one more than the page tells whether there is a next one
+	notifications, err := model.ListNotifications(ctx, d.DB, identity.User.ID, before, beforeID, in.Limit+1)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	if len(notifications) > in.Limit {
+		notifications = notifications[:in.Limit]
+		out.NextCursor = encodeCursor(notifications[in.Limit-1])
+	}
+
+	out.Notifications = make([]Notification, 0, len(notifications))
+	for _, n := range notifications {
+		out.Notifications = append(out.Notifications, Notification{Notification: n, Message: Message(n)})
+	}
+
+	out.SetOK()
+	return out
+}
+
+type UnreadOutput struct {
+	business.CommonResponse
+	Unread int `json:"unread"`
+}
+
+// Unread counts the unread notifications, a group counts once.
+func (d *Deps) Unread(ctx context.Context, common business.CommonInput) UnreadOutput {
+	var out UnreadOutput
+
+	identity, ok := d.reader(ctx, common, &out.CommonResponse)
+	if !ok {
+		return out
+	}
+
+	unread, err := model.CountUnreadNotifications(ctx, d.DB, identity.User.ID)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.Unread = unread
+	out.SetOK()
+	return out
+}
+
+type MarkInput struct {
+	ID string `url:"id"`
+}
+
+type MarkOutput struct {
+	business.CommonResponse
+	Updated int64 `json:"updated"`
+}
+
+func (d *Deps) MarkRead(ctx context.Context, in MarkInput, common business.CommonInput) MarkOutput {
+	return d.mark(ctx, in.ID, true, common)
+}
+
+func (d *Deps) MarkUnread(ctx context.Context, in MarkInput, common business.CommonInput) MarkOutput {
+	return d.mark(ctx, in.ID, false, common)
+}
+
+func (d *Deps) mark(ctx context.Context, id string, read bool, common business.CommonInput) MarkOutput {
+	var out MarkOutput
+
+	identity, ok := d.writer(ctx, common, &out.CommonResponse)
+	if !ok {
+		return out
+	}
+
+	updated, err := model.MarkNotifications(ctx, d.DB, identity.User.ID, []string{id}, read)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	if updated == 0 {
+		out.RawError(404, "unknown notification")
+		return out
+	}
+
+	out.Updated = updated
+	out.SetOK()
+	return out
+}
+
+type MarkManyInput struct {
+	IDs  []string `json:"ids"`
+	Read *bool    `json:"read"`
+}
+
+// MarkMany marks the notifications of IDs read or unread, all of them when IDs is empty.
+func (d *Deps) MarkMany(ctx context.Context, in MarkManyInput, common business.CommonInput) MarkOutput {
+	var out MarkOutput
+
+	if in.Read == nil {
+		out.RawError(400, "read is required")
+		return out
+	}
+
+	if len(in.IDs) > MAX_BULK {
+		out.RawError(400, "at most 100 notifications can be marked at once")
+		return out
+	}
+
+	identity, ok := d.writer(ctx, common, &out.CommonResponse)
+	if !ok {
+		return out
+	}
+
+	updated, err := model.MarkNotifications(ctx, d.DB, identity.User.ID, in.IDs, *in.Read)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.Updated = updated
+	out.SetOK()
+	return out
+}
+
+func (d *Deps) reader(ctx context.Context, common business.CommonInput, out *business.CommonResponse) (business.Identity, bool) {
+	return d.authorized(ctx, common, business.ScopeNotificationsRead, out)
+}
+
+func (d *Deps) writer(ctx context.Context, common business.CommonInput, out *business.CommonResponse) (business.Identity, bool) {
+	return d.authorized(ctx, common, business.ScopeNotificationsWrite, out)
+}
+
+func (d *Deps) authorized(ctx context.Context, common business.CommonInput, scope string, out *business.CommonResponse) (business.Identity, bool) {
+	identity, err := business.Authenticated(ctx, common, d.Identify)
+	if err != nil {
+		out.SetError(err)
+		return identity, false
+	}
+
+	if !identity.Can(scope) {
+		out.RawError(403, "token is missing scope "+scope)
+		return identity, false
+	}
+
+	return identity, true
+}
@@ -0,0 +1,245 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/config"
+	"github.com/samuelsih/guwu/model"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+var testDB *sqlx.DB
+
+func TestMain(m *testing.M) {
+	cleanup, err := setup()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	code := m.Run()
+
+	if err := cleanup(); err != nil {
+		log.Fatalf("error cleaning up: %v", err)
+	}
+
+	os.Exit(code)
+}
+
+func insertUser(t *testing.T, username string) model.User {
+	t.Helper()
+
+	user, err := model.InsertUser(context.Background(), testDB, username, username+"@gmail.com", "", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+func as(user model.User) business.CommonInput {
+	return business.CommonInput{Identity: &business.Identity{User: user, SessionID: "session"}}
+}
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"hello world", nil},
+		{"@jane and @John.", []string{"jane", "John"}},
+		{"@jane @JANE again", []string{"jane"}},
+		{"mail me at jane@gmail.com", nil},
+		{"(@budi_jakarta)", []string{"budi_jakarta"}},
+	}
+
+	for _, tt := range tests {
+		if got := Mentions(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("Mentions(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestMessage(t *testing.T) {
+	tests := []struct {
+		n    model.Notification
+		want string
+	}{
+		{model.Notification{Type: model.NotificationFollow, ActorUsername: "jane", ActorCount: 1}, "jane followed you"},
+		{model.Notification{Type: model.NotificationLike, ActorUsername: "jane", ActorCount: 2}, "jane and 1 other liked your post"},
+		{model.Notification{Type: model.NotificationFollow, ActorUsername: "jane", ActorCount: 5}, "jane and 4 others followed you"},
+	}
+
+	for _, tt := range tests {
+		if got := Message(tt.n); got != tt.want {
+			t.Fatalf("Message() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	ctx := context.Background()
+	deps := Deps{DB: testDB}
+
+	jane := insertUser(t, "jane")
+	followers := []model.User{insertUser(t, "john"), insertUser(t, "tina"), insertUser(t, "budi")}
+
+	for _, f := range append(followers, followers[0], jane) {
+		if err := deps.Record(ctx, model.NotificationEvent{UserID: jane.ID, ActorID: f.ID, Type: model.NotificationFollow}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := deps.Mentioned(ctx, followers[1].ID, "post1", "hi @Jane and @nobody"); err != nil {
+		t.Fatal(err)
+	}
+
+	list := deps.List(ctx, ListInput{}, as(jane))
+	if list.StatusCode != 200 || len(list.Notifications) != 2 || list.NextCursor != "" {
+		t.Fatalf("TestNotifications.List - expected the follows and the mention, got %v", list)
+	}
+
+	mention, follows := list.Notifications[0], list.Notifications[1]
+	if mention.Type != model.NotificationMention || mention.SubjectID != "post1" || mention.Message != "tina mentioned you in a post" {
+		t.Fatalf("TestNotifications.Mention - unexpected %+v", mention)
+	}
+
+	if follows.ActorCount != 3 || follows.Message != "john and 2 others followed you" {
+		t.Fatalf("TestNotifications.Group - expected the follows grouped, got %+v", follows)
+	}
+
+	if unread := deps.Unread(ctx, as(jane)); unread.Unread != 2 {
+		t.Fatalf("TestNotifications.Unread - expected 2, got %v", unread)
+	}
+
+	t.Run("Page", func(t *testing.T) {
+		first := deps.List(ctx, ListInput{Limit: 1}, as(jane))
+		if len(first.Notifications) != 1 || first.NextCursor == "" {
+			t.Fatalf("expected a next page, got %v", first)
+		}
+
+		second := deps.List(ctx, ListInput{Limit: 1, Cursor: first.NextCursor}, as(jane))
+		if len(second.Notifications) != 1 || second.NextCursor != "" || second.Notifications[0].ID != follows.ID {
+			t.Fatalf("expected the follows on the last page, got %v", second)
+		}
+
+		if invalid := deps.List(ctx, ListInput{Cursor: "nope"}, as(jane)); invalid.StatusCode != 400 {
+			t.Fatalf("expected 400 for an invalid cursor, got %v", invalid)
+		}
+	})
+
+	t.Run("Mark", func(t *testing.T) {
+		if out := deps.MarkRead(ctx, MarkInput{ID: follows.ID}, as(jane)); out.StatusCode != 200 {
+			t.Fatalf("MarkRead - expected 200, got %v", out)
+		}
+
+		if out := deps.MarkRead(ctx, MarkInput{ID: follows.ID}, as(followers[0])); out.StatusCode != 404 {
+			t.Fatalf("MarkRead - expected 404 for the notification of another user, got %v", out)
+		}
+
+		if unread := deps.Unread(ctx, as(jane)); unread.Unread != 1 {
+			t.Fatalf("MarkRead - expected 1 unread, got %v", unread)
+		}
+
+		// a follow after the group was read starts a new one
+		if err := deps.Record(ctx, model.NotificationEvent{UserID: jane.ID, ActorID: followers[2].ID, Type: model.NotificationFollow}); err != nil {
+			t.Fatal(err)
+		}
+
+		if unread := deps.Unread(ctx, as(jane)); unread.Unread != 2 {
+			t.Fatalf("Record - expected a new group, got %v", unread)
+		}
+
+		read := true
+		if out := deps.MarkMany(ctx, MarkManyInput{Read: &read}, as(jane)); out.StatusCode != 200 || out.Updated != 3 {
+			t.Fatalf("MarkMany - expected every notification read, got %v", out)
+		}
+
+		if out := deps.MarkUnread(ctx, MarkInput{ID: mention.ID}, as(jane)); out.StatusCode != 200 {
+			t.Fatalf("MarkUnread - expected 200, got %v", out)
+		}
+
+		if unread := deps.Unread(ctx, as(jane)); unread.Unread != 1 {
+			t.Fatalf("MarkUnread - expected the mention unread, got %v", unread)
+		}
+
+		if out := deps.MarkMany(ctx, MarkManyInput{IDs: []string{mention.ID}}, as(jane)); out.StatusCode != 400 {
+			t.Fatalf("MarkMany - expected 400 without read, got %v", out)
+		}
+	})
+}
+
+func TestScopes(t *testing.T) {
+	deps := Deps{DB: testDB}
+	common := business.CommonInput{Identity: &business.Identity{TokenID: "token", Scopes: []string{business.ScopeNotificationsRead}}}
+
+	if out := deps.MarkRead(context.Background(), MarkInput{ID: "1"}, common); out.StatusCode != 403 {
+		t.Fatalf("expected 403 without notifications:write, got %v", out)
+	}
+}
+
+func setup() (func() error, error) {
+	ctx := context.Background()
+
+	req := testcontainers.ContainerRequest{
+		Image:        "postgres:latest",
+		ExposedPorts: []string{"5432/tcp"},
+		WaitingFor:   wait.ForListeningPort("5432/tcp"),
+		Env: map[string]string{
+			"POSTGRES_DB":       "testdb",
+			"POSTGRES_PASSWORD": "postgres",
+			"POSTGRES_USER":     "postgres",
+		},
+	}
+
+	container, err := testcontainers.GenericContainer(
+		ctx,
+		testcontainers.GenericContainerRequest{
+			ContainerRequest: req,
+			Started:          true,
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	mappedPort, err := container.MappedPort(ctx, "5432")
+	if err != nil {
+		return nil, err
+	}
+
+	hostIP, err := container.Host(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	uri := fmt.Sprintf("postgres://postgres:postgres@%v:%v/testdb?sslmode=disable", hostIP, mappedPort.Port())
+
+	testDB = config.ConnectPostgres(uri)
+	if testDB == nil {
+		return nil, errors.New("cannot connect testGuestDB")
+	}
+
+	if err := config.LoadPostgresExtension(testDB); err != nil {
+		return nil, errors.New("cannot load postgres extension")
+	}
+
+	if err := config.MigrateAll(testDB); err != nil {
+		return nil, err
+	}
+
+	cleanup := func() error {
+		return container.Terminate(ctx)
+	}
+
+	return cleanup, nil
+}
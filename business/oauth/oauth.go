@@ -0,0 +1,321 @@
+package oauth
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/model"
+	"github.com/samuelsih/guwu/pkg/securer"
+)
+
+const (
+	CODE_PREFIX                = "oauth_code_"
+	REVOKED_PREFIX             = "oauth_revoked_"
+	CLIENT_SECRET_PREFIX       = "guwu_cs_"
+	CODE_DURATION        int64 = 60
+	MAX_CLIENT_NAME            = 100
+)
+
+type Deps struct {
+	DB *sqlx.DB
+
+	Identify func(ctx context.Context, in business.CommonInput) (business.Identity, error)
+
+	Store   func(ctx context.Context, key string, in any, time int64) error
+	Get     func(ctx context.Context, key string, dst any) error
+	Destroy func(ctx context.Context, key string) error
+	Exists  func(ctx context.Context, keys ...string) (bool, error)
+}
+
+type authCode struct {
+	ClientID      string   `json:"client_id"`
+	UserID        string   `json:"user_id"`
+	RedirectURI   string   `json:"redirect_uri"`
+	Scopes        []string `json:"scopes"`
+	CodeChallenge string   `json:"code_challenge"`
+}
+
+type RegisterClientInput struct {
+	Name         string   `json:"name" validate:"required,max=100"`
+	RedirectURIs []string `json:"redirect_uris" validate:"required"`
+	Scopes       []string `json:"scopes" validate:"required"`
+	Confidential bool     `json:"confidential"`
+}
+
+type RegisterClientOutput struct {
+	business.CommonResponse
+	Client       model.OAuthClient `json:"client"`
+	ClientSecret string            `json:"client_secret,omitempty"`
+}
+
+func (d *Deps) RegisterClient(ctx context.Context, in RegisterClientInput, common business.CommonInput) RegisterClientOutput {
+	var out RegisterClientOutput
+
+	if in.Name == "" || utf8.RuneCountInString(in.Name) > MAX_CLIENT_NAME {
+		out.RawError(400, "name is required and must be at most 100 characters")
+		return out
+	}
+
+	if len(in.RedirectURIs) == 0 {
+		out.RawError(400, "at least one redirect uri is required")
+		return out
+	}
+
+	for _, uri := range in.RedirectURIs {
+		if !validRedirectURI(uri) {
+			out.RawError(400, "invalid redirect uri "+uri)
+			return out
+		}
+	}
+
+	if len(in.Scopes) == 0 {
+		out.RawError(400, "at least one scope is required")
+		return out
+	}
+
+	if scope, unknown := business.UnknownScope(in.Scopes); unknown {
+		out.RawError(400, "unknown scope "+scope)
+		return out
+	}
+
+	identity, err := business.Authenticated(ctx, common, d.Identify)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	if identity.SessionID == "" {
+		out.RawError(403, "clients can only be registered with a session")
+		return out
+	}
+
+	client := model.OAuthClient{
+		UserID:       identity.User.ID,
+		Name:         in.Name,
+		RedirectURIs: in.RedirectURIs,
+		Scopes:       in.Scopes,
+	}
+
+	var secret string
+
+	if in.Confidential {
+		secret, err = securer.RandomToken(CLIENT_SECRET_PREFIX, 32)
+		if err != nil {
+			out.SetError(err)
+			return out
+		}
+
+		client.SecretHash.String = securer.Digest(secret)
+		client.SecretHash.Valid = true
+	}
+
+	client, err = model.InsertOAuthClient(ctx, d.DB, client)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.Client = client
+	out.ClientSecret = secret
+	out.SetOK()
+	return out
+}
+
+type AuthorizeInput struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Approve             bool   `json:"approve"`
+}
+
+type ConsentScope struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type ConsentOutput struct {
+	business.CommonResponse
+	ClientID    string         `json:"client_id"`
+	ClientName  string         `json:"client_name"`
+	RedirectURI string         `json:"redirect_uri"`
+	Scopes      []ConsentScope `json:"scopes"`
+	State       string         `json:"state"`
+}
+
+// Consent validates an authorization request and returns what the consent screen has to show.
+func (d *Deps) Consent(ctx context.Context, in AuthorizeInput, common business.CommonInput) ConsentOutput {
+	var out ConsentOutput
+
+	client, scopes, ok := d.validAuthorize(ctx, in, common, &out.CommonResponse)
+	if !ok {
+		return out
+	}
+
+	for _, scope := range scopes {
+		out.Scopes = append(out.Scopes, ConsentScope{Name: scope, Description: business.ScopeDescriptions[scope]})
+	}
+
+	out.ClientID = client.ID
+	out.ClientName = client.Name
+	out.RedirectURI = in.RedirectURI
+	out.State = in.State
+	out.SetOK()
+	return out
+}
+
+type AuthorizeOutput struct {
+	business.CommonResponse
+	RedirectTo string `json:"redirect_to"`
+}
+
+// Authorize records the decision of the user and returns where the user agent must be redirected.
+func (d *Deps) Authorize(ctx context.Context, in AuthorizeInput, common business.CommonInput) AuthorizeOutput {
+	var out AuthorizeOutput
+
+	client, scopes, ok := d.validAuthorize(ctx, in, common, &out.CommonResponse)
+	if !ok {
+		return out
+	}
+
+	query := url.Values{}
+	if in.State != "" {
+		query.Set("state", in.State)
+	}
+
+	if !in.Approve {
+		query.Set("error", "access_denied")
+		out.RedirectTo = withQuery(in.RedirectURI, query)
+		out.SetOK()
+		return out
+	}
+
+	identity, err := business.Authenticated(ctx, common, d.Identify)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	code, err := securer.RandomToken("", 32)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	data := authCode{
+		ClientID:      client.ID,
+		UserID:        identity.User.ID,
+		RedirectURI:   in.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: in.CodeChallenge,
+	}
+
+	err = d.Store(ctx, CODE_PREFIX+securer.Digest(code), data, CODE_DURATION)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	query.Set("code", code)
+	out.RedirectTo = withQuery(in.RedirectURI, query)
+	out.SetOK()
+	return out
+}
+
+func (d *Deps) validAuthorize(ctx context.Context, in AuthorizeInput, common business.CommonInput, out *business.CommonResponse) (model.OAuthClient, []string, bool) {
+	identity, err := business.Authenticated(ctx, common, d.Identify)
+	if err != nil {
+		out.SetError(err)
+		return model.OAuthClient{}, nil, false
+	}
+
+	if identity.SessionID == "" {
+		out.RawError(403, "authorization requires a session")
+		return model.OAuthClient{}, nil, false
+	}
+
+	if in.ClientID == "" {
+		out.RawError(400, "client_id is required")
+		return model.OAuthClient{}, nil, false
+	}
+
+	client, err := model.FindOAuthClient(ctx, d.DB, in.ClientID)
+	if err != nil {
+		out.SetError(err)
+		return client, nil, false
+	}
+
+	if !contains(client.RedirectURIs, in.RedirectURI) {
+		out.RawError(400, "redirect_uri is not registered for this client")
+		return client, nil, false
+	}
+
+	if in.ResponseType != "code" {
+		out.RawError(400, "response_type must be code")
+		return client, nil, false
+	}
+
+	if in.CodeChallengeMethod != "S256" || !validPKCEValue(in.CodeChallenge, 43, 43) {
+		out.RawError(400, "code_challenge with code_challenge_method S256 is required")
+		return client, nil, false
+	}
+
+	scopes := strings.Fields(in.Scope)
+	if len(scopes) == 0 {
+		out.RawError(400, "scope is required")
+		return client, nil, false
+	}
+
+	if !business.Subset(scopes, client.Scopes) {
+		out.RawError(400, "scope is not allowed for this client")
+		return client, nil, false
+	}
+
+	return client, scopes, true
+}
+
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" || u.Fragment != "" {
+		return false
+	}
+
+	if u.Scheme == "https" {
+		return true
+	}
+
+	host := u.Hostname()
+	return u.Scheme == "http" && (host == "localhost" || host == "127.0.0.1" || host == "::1")
+}
+
+func withQuery(uri string, query url.Values) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+
+	existing := u.Query()
+	for key, values := range query {
+		existing[key] = values
+	}
+
+	u.RawQuery = existing.Encode()
+	return u.String()
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,466 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/config"
+	"github.com/samuelsih/guwu/model"
+	"github.com/samuelsih/guwu/pkg/errs"
+	"github.com/samuelsih/guwu/pkg/securer"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+const testVerifier = "dBjftJeZ4CVP-mJ92K1Ss1M3kYcVvW3jKxXJq0Nv7cAqO4mxk"
+
+var (
+	testDB   *sqlx.DB
+	testUser model.User
+)
+
+func TestMain(m *testing.M) {
+	cleanup, err := setup()
+	securer.SetSecret("0f5297b6f0114171e9de547801b1e8bb929fe1d091e63c6377a392ec1baa3d0b")
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	code := m.Run()
+
+	if err := cleanup(); err != nil {
+		log.Fatalf("error cleaning up: %v", err)
+	}
+
+	os.Exit(code)
+}
+
+type memoryStore struct {
+	mu sync.Mutex
+	kv map[string][]byte
+}
+
+func newDeps() Deps {
+	m := &memoryStore{kv: map[string][]byte{}}
+
+	return Deps{
+		DB: testDB,
+		Identify: func(ctx context.Context, in business.CommonInput) (business.Identity, error) {
+			return business.Identity{User: testUser, SessionID: "session"}, nil
+		},
+		Store: func(ctx context.Context, key string, in any, time int64) error {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			m.kv[key], _ = json.Marshal(in)
+			return nil
+		},
+		Get: func(ctx context.Context, key string, dst any) error {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			data, ok := m.kv[key]
+			if !ok {
+				return errs.E(errs.Op("memoryStore.Get"), errs.KindBadRequest, nil, "unknown input")
+			}
+
+			return json.Unmarshal(data, dst)
+		},
+		Destroy: func(ctx context.Context, key string) error {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			if _, ok := m.kv[key]; !ok {
+				return errors.New("unknown input")
+			}
+
+			delete(m.kv, key)
+			return nil
+		},
+		Exists: func(ctx context.Context, keys ...string) (bool, error) {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			for _, key := range keys {
+				if _, ok := m.kv[key]; ok {
+					return true, nil
+				}
+			}
+
+			return false, nil
+		},
+	}
+}
+
+func challengeOf(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func registerClient(t *testing.T, deps Deps, confidential bool) RegisterClientOutput {
+	t.Helper()
+
+	out := deps.RegisterClient(context.Background(), RegisterClientInput{
+		Name:         "partner app",
+		RedirectURIs: []string{"https://partner.example.com/callback"},
+		Scopes:       []string{business.ScopeFollowsRead, business.ScopePostsWrite},
+		Confidential: confidential,
+	}, business.CommonInput{SessionID: "session"})
+
+	if out.StatusCode != 200 {
+		t.Fatalf("registerClient - expected 200, got %v", out)
+	}
+
+	return out
+}
+
+func authorize(t *testing.T, deps Deps, clientID string) string {
+	t.Helper()
+
+	out := deps.Authorize(context.Background(), AuthorizeInput{
+		ResponseType:        "code",
+		ClientID:            clientID,
+		RedirectURI:         "https://partner.example.com/callback",
+		Scope:               business.ScopePostsWrite,
+		State:               "xyz",
+		CodeChallenge:       challengeOf(testVerifier),
+		CodeChallengeMethod: "S256",
+		Approve:             true,
+	}, business.CommonInput{SessionID: "session"})
+
+	if out.StatusCode != 200 {
+		t.Fatalf("authorize - expected 200, got %v", out)
+	}
+
+	u, err := url.Parse(out.RedirectTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Query().Get("state") != "xyz" || u.Query().Get("code") == "" {
+		t.Fatalf("authorize - unexpected redirect %v", out.RedirectTo)
+	}
+
+	return u.Query().Get("code")
+}
+
+func TestRegisterClient(t *testing.T) {
+	t.Parallel()
+
+	deps := newDeps()
+
+	tests := []struct {
+		name  string
+		input RegisterClientInput
+	}{
+		{"EmptyName", RegisterClientInput{RedirectURIs: []string{"https://a.com/cb"}, Scopes: []string{business.ScopePostsRead}}},
+		{"TooLongName", RegisterClientInput{Name: strings.Repeat("é", 101), RedirectURIs: []string{"https://a.com/cb"}, Scopes: []string{business.ScopePostsRead}}},
+		{"HTTPRedirect", RegisterClientInput{Name: "a", RedirectURIs: []string{"http://a.com/cb"}, Scopes: []string{business.ScopePostsRead}}},
+		{"FragmentRedirect", RegisterClientInput{Name: "a", RedirectURIs: []string{"https://a.com/cb#x"}, Scopes: []string{business.ScopePostsRead}}},
+		{"UnknownScope", RegisterClientInput{Name: "a", RedirectURIs: []string{"https://a.com/cb"}, Scopes: []string{"admin"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := deps.RegisterClient(context.Background(), tt.input, business.CommonInput{SessionID: "session"})
+			if out.StatusCode != 400 {
+				t.Fatalf("TestRegisterClient.%s - expected 400, got %v", tt.name, out)
+			}
+		})
+	}
+
+	t.Run("MultibyteName", func(t *testing.T) {
+		in := RegisterClientInput{Name: strings.Repeat("é", 100), RedirectURIs: []string{"https://a.com/cb"}, Scopes: []string{business.ScopePostsRead}}
+
+		if out := deps.RegisterClient(context.Background(), in, business.CommonInput{SessionID: "session"}); out.StatusCode != 200 {
+			t.Fatalf("TestRegisterClient.MultibyteName - expected 200, got %v", out)
+		}
+	})
+
+	t.Run("Public", func(t *testing.T) {
+		out := registerClient(t, deps, false)
+		if out.ClientSecret != "" || out.Client.Confidential() {
+			t.Fatalf("TestRegisterClient.Public - expected no secret, got %v", out)
+		}
+	})
+
+	t.Run("Confidential", func(t *testing.T) {
+		out := registerClient(t, deps, true)
+		if !strings.HasPrefix(out.ClientSecret, CLIENT_SECRET_PREFIX) {
+			t.Fatalf("TestRegisterClient.Confidential - expected secret, got %v", out)
+		}
+	})
+}
+
+func TestConsent(t *testing.T) {
+	t.Parallel()
+
+	deps := newDeps()
+	client := registerClient(t, deps, false)
+
+	valid := AuthorizeInput{
+		ResponseType:        "code",
+		ClientID:            client.Client.ID,
+		RedirectURI:         "https://partner.example.com/callback",
+		Scope:               business.ScopePostsWrite,
+		CodeChallenge:       challengeOf(testVerifier),
+		CodeChallengeMethod: "S256",
+	}
+
+	out := deps.Consent(context.Background(), valid, business.CommonInput{SessionID: "session"})
+	if out.StatusCode != 200 || out.ClientName != "partner app" || len(out.Scopes) != 1 || out.Scopes[0].Description == "" {
+		t.Fatalf("TestConsent - expected consent data, got %v", out)
+	}
+
+	invalid := map[string]func(in *AuthorizeInput){
+		"UnregisteredRedirect": func(in *AuthorizeInput) { in.RedirectURI = "https://evil.example.com/callback" },
+		"PlainPKCE":            func(in *AuthorizeInput) { in.CodeChallengeMethod = "plain" },
+		"NoPKCE":               func(in *AuthorizeInput) { in.CodeChallenge = "" },
+		"ScopeNotAllowed":      func(in *AuthorizeInput) { in.Scope = business.ScopeFollowsWrite },
+		"TokenResponseType":    func(in *AuthorizeInput) { in.ResponseType = "token" },
+	}
+
+	for name, mutate := range invalid {
+		in := valid
+		mutate(&in)
+
+		out := deps.Consent(context.Background(), in, business.CommonInput{SessionID: "session"})
+		if out.StatusCode != 400 {
+			t.Fatalf("TestConsent.%s - expected 400, got %v", name, out)
+		}
+	}
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	t.Parallel()
+
+	deps := newDeps()
+	client := registerClient(t, deps, true)
+	code := authorize(t, deps, client.Client.ID)
+
+	exchange := TokenInput{
+		GrantType:    "authorization_code",
+		Code:         code,
+		RedirectURI:  "https://partner.example.com/callback",
+		CodeVerifier: testVerifier,
+		ClientID:     client.Client.ID,
+		ClientSecret: client.ClientSecret,
+	}
+
+	t.Run("WrongSecret", func(t *testing.T) {
+		in := exchange
+		in.ClientSecret = "guwu_cs_wrong"
+
+		out := deps.Token(context.Background(), in, business.CommonInput{})
+		if out.StatusCode != 401 || out.Error != "invalid_client" || out.ErrorDescription == "" || out.Msg != "" {
+			t.Fatalf("expected invalid_client, got %v", out)
+		}
+	})
+
+	tokens := deps.Token(context.Background(), exchange, business.CommonInput{})
+	if tokens.StatusCode != 200 || tokens.AccessToken == "" || tokens.RefreshToken == "" || tokens.TokenType != "Bearer" {
+		t.Fatalf("TestAuthorizationCodeFlow.Exchange - expected tokens, got %v", tokens)
+	}
+
+	replay := deps.Token(context.Background(), exchange, business.CommonInput{})
+	if replay.Error != "invalid_grant" {
+		t.Fatalf("TestAuthorizationCodeFlow.Replay - code must be single use, got %v", replay)
+	}
+
+	identity, err := deps.IdentifyAccessToken(context.Background(), tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("TestAuthorizationCodeFlow.Identify - expected nil, got %v", err)
+	}
+
+	if identity.User.ID != testUser.ID || !identity.Can(business.ScopePostsWrite) || identity.Can(business.ScopeFollowsRead) {
+		t.Fatalf("TestAuthorizationCodeFlow.Identify - unexpected identity %v", identity)
+	}
+
+	introspect := deps.Introspect(context.Background(), IntrospectInput{Token: tokens.AccessToken, ClientID: client.Client.ID, ClientSecret: client.ClientSecret}, business.CommonInput{})
+	if !introspect.Active || introspect.Sub != testUser.ID || introspect.Scope != business.ScopePostsWrite {
+		t.Fatalf("TestAuthorizationCodeFlow.Introspect - expected active token, got %v", introspect)
+	}
+
+	refreshed := deps.Token(context.Background(), TokenInput{
+		GrantType:    "refresh_token",
+		RefreshToken: tokens.RefreshToken,
+		ClientID:     client.Client.ID,
+		ClientSecret: client.ClientSecret,
+	}, business.CommonInput{})
+
+	if refreshed.StatusCode != 200 || refreshed.RefreshToken == tokens.RefreshToken {
+		t.Fatalf("TestAuthorizationCodeFlow.Refresh - expected rotated token, got %v", refreshed)
+	}
+
+	reused := deps.Token(context.Background(), TokenInput{
+		GrantType:    "refresh_token",
+		RefreshToken: tokens.RefreshToken,
+		ClientID:     client.Client.ID,
+		ClientSecret: client.ClientSecret,
+	}, business.CommonInput{})
+
+	if reused.Error != "invalid_grant" {
+		t.Fatalf("TestAuthorizationCodeFlow.Reuse - expected invalid_grant, got %v", reused)
+	}
+
+	// reuse revokes the whole family, including the tokens issued by the legit refresh
+	if _, err := deps.IdentifyAccessToken(context.Background(), refreshed.AccessToken); err == nil {
+		t.Fatal("TestAuthorizationCodeFlow.Reuse - access token of the family must be revoked")
+	}
+
+	afterReuse := deps.Token(context.Background(), TokenInput{
+		GrantType:    "refresh_token",
+		RefreshToken: refreshed.RefreshToken,
+		ClientID:     client.Client.ID,
+		ClientSecret: client.ClientSecret,
+	}, business.CommonInput{})
+
+	if afterReuse.Error != "invalid_grant" {
+		t.Fatalf("TestAuthorizationCodeFlow.Reuse - rotated token must be revoked, got %v", afterReuse)
+	}
+}
+
+func TestPKCEMismatch(t *testing.T) {
+	t.Parallel()
+
+	deps := newDeps()
+	client := registerClient(t, deps, false)
+	code := authorize(t, deps, client.Client.ID)
+
+	out := deps.Token(context.Background(), TokenInput{
+		GrantType:    "authorization_code",
+		Code:         code,
+		RedirectURI:  "https://partner.example.com/callback",
+		CodeVerifier: strings.Repeat("a", 43),
+		ClientID:     client.Client.ID,
+	}, business.CommonInput{})
+
+	if out.Error != "invalid_grant" {
+		t.Fatalf("TestPKCEMismatch - expected invalid_grant, got %v", out)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	t.Parallel()
+
+	deps := newDeps()
+	client := registerClient(t, deps, false)
+	code := authorize(t, deps, client.Client.ID)
+
+	tokens := deps.Token(context.Background(), TokenInput{
+		GrantType:    "authorization_code",
+		Code:         code,
+		RedirectURI:  "https://partner.example.com/callback",
+		CodeVerifier: testVerifier,
+		ClientID:     client.Client.ID,
+	}, business.CommonInput{})
+
+	if tokens.StatusCode != 200 {
+		t.Fatalf("TestRevoke - expected tokens, got %v", tokens)
+	}
+
+	out := deps.Revoke(context.Background(), RevokeInput{Token: tokens.AccessToken, ClientID: client.Client.ID}, business.CommonInput{})
+	if out.StatusCode != 200 {
+		t.Fatalf("TestRevoke.AccessToken - expected 200, got %v", out)
+	}
+
+	if _, err := deps.IdentifyAccessToken(context.Background(), tokens.AccessToken); err == nil {
+		t.Fatal("TestRevoke.AccessToken - revoked token must not identify")
+	}
+
+	out = deps.Revoke(context.Background(), RevokeInput{Token: tokens.RefreshToken, ClientID: client.Client.ID}, business.CommonInput{})
+	if out.StatusCode != 200 {
+		t.Fatalf("TestRevoke.RefreshToken - expected 200, got %v", out)
+	}
+
+	refreshed := deps.Token(context.Background(), TokenInput{
+		GrantType:    "refresh_token",
+		RefreshToken: tokens.RefreshToken,
+		ClientID:     client.Client.ID,
+	}, business.CommonInput{})
+
+	if refreshed.Error != "invalid_grant" {
+		t.Fatalf("TestRevoke.RefreshToken - expected invalid_grant, got %v", refreshed)
+	}
+
+	unknown := deps.Revoke(context.Background(), RevokeInput{Token: "whatever", ClientID: client.Client.ID}, business.CommonInput{})
+	if unknown.StatusCode != 200 {
+		t.Fatalf("TestRevoke.Unknown - expected 200, got %v", unknown)
+	}
+}
+
+func setup() (func() error, error) {
+	ctx := context.Background()
+
+	req := testcontainers.ContainerRequest{
+		Image:        "postgres:latest",
+		ExposedPorts: []string{"5432/tcp"},
+		WaitingFor:   wait.ForListeningPort("5432/tcp"),
+		Env: map[string]string{
+			"POSTGRES_DB":       "testdb",
+			"POSTGRES_PASSWORD": "postgres",
+			"POSTGRES_USER":     "postgres",
+		},
+	}
+
+	container, err := testcontainers.GenericContainer(
+		ctx,
+		testcontainers.GenericContainerRequest{
+			ContainerRequest: req,
+			Started:          true,
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	mappedPort, err := container.MappedPort(ctx, "5432")
+	if err != nil {
+		return nil, err
+	}
+
+	hostIP, err := container.Host(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	uri := fmt.Sprintf("postgres://postgres:postgres@%v:%v/testdb?sslmode=disable", hostIP, mappedPort.Port())
+
+	testDB = config.ConnectPostgres(uri)
+	if testDB == nil {
+		return nil, errors.New("cannot connect testGuestDB")
+	}
+
+	if err := config.LoadPostgresExtension(testDB); err != nil {
+		return nil, errors.New("cannot load postgres extension")
+	}
+
+	if err := config.MigrateAll(testDB); err != nil {
+		return nil, err
+	}
+
+	testUser, err = model.InsertUser(ctx, testDB, "oauthowner", "oauthowner@gmail.com", "$2a$07$GsdzeF04uKNmPyEf1R.WUOZF.i9Xhpx6peu3NBMN7NdPe//tWEfY", "en")
+	if err != nil {
+		return nil, err
+	}
+
+	cleanup := func() error {
+		return container.Terminate(ctx)
+	}
+
+	return cleanup, nil
+}
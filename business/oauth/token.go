@@ -0,0 +1,492 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/business/auth"
+	"github.com/samuelsih/guwu/model"
+	"github.com/samuelsih/guwu/pkg/errs"
+	"github.com/samuelsih/guwu/pkg/logger"
+	"github.com/samuelsih/guwu/pkg/securer"
+)
+
+const (
+	ACCESS_TOKEN_DURATION  int64 = 60 * 15
+	REFRESH_TOKEN_DURATION       = 30 * 24 * time.Hour
+	REFRESH_TOKEN_PREFIX         = "guwu_ort_"
+)
+
+var (
+	errInvalidToken  = errors.New("invalid access token")
+	errExpiredToken  = errors.New("expired access token")
+	errRevokedToken  = errors.New("revoked access token")
+	errInvalidClient = errors.New("invalid client")
+)
+
+type accessClaims struct {
+	ID        string   `json:"jti"`
+	UserID    string   `json:"sub"`
+	ClientID  string   `json:"cid"`
+	FamilyID  string   `json:"fam"`
+	Scopes    []string `json:"scp"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+type TokenInput struct {
+	GrantType    string `json:"grant_type"`
+	Code         string `json:"code"`
+	RedirectURI  string `json:"redirect_uri"`
+	CodeVerifier string `json:"code_verifier"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+type TokenOutput struct {
+	business.CommonResponse
+	Error            string `json:"error,omitempty"`
+	ErrorDescription string `json:"error_description,omitempty"`
+	AccessToken      string `json:"access_token,omitempty"`
+	TokenType        string `json:"token_type,omitempty"`
+	ExpiresIn        int64  `json:"expires_in,omitempty"`
+	RefreshToken     string `json:"refresh_token,omitempty"`
+	Scope            string `json:"scope,omitempty"`
+}
+
+// oauthError answers as RFC 6749 section 5.2 does, the description goes out as error_description.
+func (out *TokenOutput) oauthError(status int, code, description string) {
+	out.StatusCode = status
+	out.Error = code
+	out.ErrorDescription = description
+}
+
+func (d *Deps) Token(ctx context.Context, in TokenInput, common business.CommonInput) TokenOutput {
+	var out TokenOutput
+
+	client, err := d.authenticateClient(ctx, in.ClientID, in.ClientSecret)
+	if err != nil {
+		out.oauthError(401, "invalid_client", err.Error())
+		return out
+	}
+
+	switch in.GrantType {
+	case "authorization_code":
+		return d.exchangeCode(ctx, in, client)
+
+	case "refresh_token":
+		return d.refresh(ctx, in, client)
+
+	default:
+		out.oauthError(400, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+		return out
+	}
+}
+
+func (d *Deps) exchangeCode(ctx context.Context, in TokenInput, client model.OAuthClient) TokenOutput {
+	var out TokenOutput
+	var code authCode
+
+	if in.Code == "" || in.CodeVerifier == "" {
+		out.oauthError(400, "invalid_request", "code and code_verifier are required")
+		return out
+	}
+
+	key := CODE_PREFIX + securer.Digest(in.Code)
+
+	if err := d.Get(ctx, key, &code); err != nil {
+		out.oauthError(400, "invalid_grant", "invalid authorization code")
+		return out
+	}
+
+	// codes are single use, whoever destroys it first wins
+	if err := d.Destroy(ctx, key); err != nil {
+		out.oauthError(400, "invalid_grant", "invalid authorization code")
+		return out
+	}
+
+	if code.ClientID != client.ID || code.RedirectURI != in.RedirectURI {
+		out.oauthError(400, "invalid_grant", "authorization code was issued to another client or redirect_uri")
+		return out
+	}
+
+	if !verifyPKCE(in.CodeVerifier, code.CodeChallenge) {
+		out.oauthError(400, "invalid_grant", "code_verifier does not match code_challenge")
+		return out
+	}
+
+	return d.issueTokens(ctx, code.UserID, client.ID, xid.New().String(), code.Scopes)
+}
+
+func (d *Deps) refresh(ctx context.Context, in TokenInput, client model.OAuthClient) TokenOutput {
+	var out TokenOutput
+
+	if in.RefreshToken == "" {
+		out.oauthError(400, "invalid_request", "refresh_token is required")
+		return out
+	}
+
+	current, err := model.FindRefreshToken(ctx, d.DB, securer.Digest(in.RefreshToken))
+	if err != nil {
+		if errs.GetKind(err) == errs.KindBadRequest {
+			out.oauthError(400, "invalid_grant", "invalid refresh token")
+			return out
+		}
+
+		out.SetError(err)
+		return out
+	}
+
+	if current.ClientID != client.ID {
+		out.oauthError(400, "invalid_grant", "refresh token was issued to another client")
+		return out
+	}
+
+	// a rotated token being presented again means it leaked, so the whole family goes
+	if current.RevokedAt.Valid {
+		d.revokeFamily(ctx, current.FamilyID)
+		out.oauthError(400, "invalid_grant", "invalid refresh token")
+		return out
+	}
+
+	if time.Now().After(current.ExpiresAt) {
+		out.oauthError(400, "invalid_grant", "expired refresh token")
+		return out
+	}
+
+	scopes := []string(current.Scopes)
+	if in.Scope != "" {
+		scopes = strings.Fields(in.Scope)
+
+		if !business.Subset(scopes, current.Scopes) {
+			out.oauthError(400, "invalid_scope", "scope exceeds the granted scope")
+			return out
+		}
+	}
+
+	plain, next, err := newRefreshToken(current.UserID, client.ID, current.FamilyID, scopes)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	err = model.RotateRefreshToken(ctx, d.DB, current.ID, next)
+	if err != nil {
+		if errs.GetKind(err) == errs.KindBadRequest {
+			d.revokeFamily(ctx, current.FamilyID)
+			out.oauthError(400, "invalid_grant", "invalid refresh token")
+			return out
+		}
+
+		out.SetError(err)
+		return out
+	}
+
+	out, err = d.accessToken(current.UserID, client.ID, current.FamilyID, scopes)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.RefreshToken = plain
+	return out
+}
+
+func (d *Deps) issueTokens(ctx context.Context, userID, clientID, familyID string, scopes []string) TokenOutput {
+	out, err := d.accessToken(userID, clientID, familyID, scopes)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	plain, refreshToken, err := newRefreshToken(userID, clientID, familyID, scopes)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	if err := model.InsertRefreshToken(ctx, d.DB, refreshToken); err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.RefreshToken = plain
+	return out
+}
+
+func (d *Deps) accessToken(userID, clientID, familyID string, scopes []string) (TokenOutput, error) {
+	var out TokenOutput
+
+	claims := accessClaims{
+		ID:        xid.New().String(),
+		UserID:    userID,
+		ClientID:  clientID,
+		FamilyID:  familyID,
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Unix() + ACCESS_TOKEN_DURATION,
+	}
+
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return out, err
+	}
+
+	sealed, err := securer.Encrypt(data)
+	if err != nil {
+		return out, err
+	}
+
+	out.AccessToken = auth.OAUTH_PREFIX + sealed
+	out.TokenType = "Bearer"
+	out.ExpiresIn = ACCESS_TOKEN_DURATION
+	out.Scope = strings.Join(scopes, " ")
+	out.SetOK()
+
+	return out, nil
+}
+
+// IdentifyAccessToken resolves the user behind an access token issued by Token.
+func (d *Deps) IdentifyAccessToken(ctx context.Context, token string) (business.Identity, error) {
+	claims, err := d.parseAccessToken(ctx, token)
+	if err != nil {
+		return business.Identity{}, err
+	}
+
+	user, err := model.FindUserByID(ctx, d.DB, claims.UserID)
+	if err != nil {
+		return business.Identity{}, err
+	}
+
+	return business.Identity{
+		User:     user,
+		TokenID:  claims.ID,
+		ClientID: claims.ClientID,
+		Scopes:   claims.Scopes,
+	}, nil
+}
+
+func (d *Deps) parseAccessToken(ctx context.Context, token string) (accessClaims, error) {
+	const op = errs.Op("oauth.parseAccessToken")
+	var claims accessClaims
+
+	if !strings.HasPrefix(token, auth.OAUTH_PREFIX) {
+		return claims, errs.E(op, errs.KindUnauthorized, errInvalidToken, "invalid token")
+	}
+
+	data, err := securer.Decrypt(strings.TrimPrefix(token, auth.OAUTH_PREFIX))
+	if err != nil {
+		return claims, errs.E(op, errs.KindUnauthorized, err, "invalid token")
+	}
+
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return claims, errs.E(op, errs.KindUnauthorized, err, "invalid token")
+	}
+
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return claims, errs.E(op, errs.KindUnauthorized, errExpiredToken, "expired token")
+	}
+
+	revoked, err := d.Exists(ctx, REVOKED_PREFIX+claims.ID, REVOKED_PREFIX+claims.FamilyID)
+	if err != nil {
+		return claims, err
+	}
+
+	if revoked {
+		return claims, errs.E(op, errs.KindUnauthorized, errRevokedToken, "invalid token")
+	}
+
+	return claims, nil
+}
+
+type IntrospectInput struct {
+	Token         string `json:"token"`
+	TokenTypeHint string `json:"token_type_hint"`
+	ClientID      string `json:"client_id"`
+	ClientSecret  string `json:"client_secret"`
+}
+
+type IntrospectOutput struct {
+	business.CommonResponse
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+}
+
+// Introspect only answers confidential clients, and only about their own tokens.
+func (d *Deps) Introspect(ctx context.Context, in IntrospectInput, common business.CommonInput) IntrospectOutput {
+	var out IntrospectOutput
+
+	client, err := d.authenticateClient(ctx, in.ClientID, in.ClientSecret)
+	if err != nil || !client.Confidential() {
+		out.RawError(401, errInvalidClient.Error())
+		return out
+	}
+
+	out.SetOK()
+
+	if strings.HasPrefix(in.Token, auth.OAUTH_PREFIX) {
+		claims, err := d.parseAccessToken(ctx, in.Token)
+		if err != nil || claims.ClientID != client.ID {
+			return out
+		}
+
+		out.Active = true
+		out.Scope = strings.Join(claims.Scopes, " ")
+		out.ClientID = claims.ClientID
+		out.Sub = claims.UserID
+		out.Exp = claims.ExpiresAt
+		out.TokenType = "access_token"
+		return out
+	}
+
+	token, err := model.FindRefreshToken(ctx, d.DB, securer.Digest(in.Token))
+	if err != nil || token.ClientID != client.ID || token.RevokedAt.Valid || time.Now().After(token.ExpiresAt) {
+		return out
+	}
+
+	out.Active = true
+	out.Scope = strings.Join(token.Scopes, " ")
+	out.ClientID = token.ClientID
+	out.Sub = token.UserID
+	out.Exp = token.ExpiresAt.Unix()
+	out.TokenType = "refresh_token"
+	return out
+}
+
+type RevokeInput struct {
+	Token         string `json:"token"`
+	TokenTypeHint string `json:"token_type_hint"`
+	ClientID      string `json:"client_id"`
+	ClientSecret  string `json:"client_secret"`
+}
+
+type RevokeOutput struct {
+	business.CommonResponse
+}
+
+// Revoke answers OK for unknown tokens as well, see RFC 7009 section 2.2.
+func (d *Deps) Revoke(ctx context.Context, in RevokeInput, common business.CommonInput) RevokeOutput {
+	var out RevokeOutput
+
+	client, err := d.authenticateClient(ctx, in.ClientID, in.ClientSecret)
+	if err != nil {
+		out.RawError(401, errInvalidClient.Error())
+		return out
+	}
+
+	if strings.HasPrefix(in.Token, auth.OAUTH_PREFIX) {
+		claims, err := d.parseAccessToken(ctx, in.Token)
+		if err == nil && claims.ClientID == client.ID {
+			ttl := claims.ExpiresAt - time.Now().Unix()
+			if err := d.Store(ctx, REVOKED_PREFIX+claims.ID, true, ttl); err != nil {
+				out.SetError(err)
+				return out
+			}
+		}
+
+		out.SetOK()
+		return out
+	}
+
+	token, err := model.FindRefreshToken(ctx, d.DB, securer.Digest(in.Token))
+	if err == nil && token.ClientID == client.ID {
+		d.revokeFamily(ctx, token.FamilyID)
+	}
+
+	out.SetOK()
+	return out
+}
+
+func (d *Deps) authenticateClient(ctx context.Context, clientID, clientSecret string) (model.OAuthClient, error) {
+	const op = errs.Op("oauth.authenticateClient")
+
+	if clientID == "" {
+		return model.OAuthClient{}, errs.E(op, errs.KindUnauthorized, errInvalidClient, "client_id is required")
+	}
+
+	client, err := model.FindOAuthClient(ctx, d.DB, clientID)
+	if err != nil {
+		return client, errs.E(op, errs.KindUnauthorized, err, errInvalidClient.Error())
+	}
+
+	if !client.Confidential() {
+		if clientSecret != "" {
+			return client, errs.E(op, errs.KindUnauthorized, errInvalidClient, errInvalidClient.Error())
+		}
+
+		return client, nil
+	}
+
+	given := securer.Digest(clientSecret)
+	if subtle.ConstantTimeCompare([]byte(given), []byte(client.SecretHash.String)) != 1 {
+		return client, errs.E(op, errs.KindUnauthorized, errInvalidClient, errInvalidClient.Error())
+	}
+
+	return client, nil
+}
+
+// revokeFamily revokes every refresh token of the family, and the access tokens minted from them.
+func (d *Deps) revokeFamily(ctx context.Context, familyID string) {
+	if err := model.RevokeRefreshFamily(ctx, d.DB, familyID); err != nil {
+		logger.Err(err)
+	}
+
+	if err := d.Store(ctx, REVOKED_PREFIX+familyID, true, ACCESS_TOKEN_DURATION); err != nil {
+		logger.Err(err)
+	}
+}
+
+func newRefreshToken(userID, clientID, familyID string, scopes []string) (string, model.OAuthRefreshToken, error) {
+	plain, err := securer.RandomToken(REFRESH_TOKEN_PREFIX, 32)
+	if err != nil {
+		return "", model.OAuthRefreshToken{}, err
+	}
+
+	return plain, model.OAuthRefreshToken{
+		TokenHash: securer.Digest(plain),
+		FamilyID:  familyID,
+		ClientID:  clientID,
+		UserID:    userID,
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Add(REFRESH_TOKEN_DURATION).UTC(),
+	}, nil
+}
+
+func verifyPKCE(verifier, challenge string) bool {
+	if !validPKCEValue(verifier, 43, 128) {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// validPKCEValue checks the unreserved characters of RFC 7636 section 4.1.
+func validPKCEValue(value string, min, max int) bool {
+	if len(value) < min || len(value) > max {
+		return false
+	}
+
+	for _, c := range value {
+		isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isAlnum && c != '-' && c != '.' && c != '_' && c != '~' {
+			return false
+		}
+	}
+
+	return true
+}
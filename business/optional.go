@@ -0,0 +1,48 @@
+package business
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Optional is a field of a JSON Merge Patch (RFC 7386) input.
+// An absent key leaves Set false, null sets Null, any other value is decoded into Value.
+type Optional[T any] struct {
+	Set   bool
+	Null  bool
+	Value T
+}
+
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		o.Null = true
+		return nil
+	}
+
+	return json.Unmarshal(data, &o.Value)
+}
+
+func (o Optional[T]) MarshalJSON() ([]byte, error) {
+	if !o.Set || o.Null {
+		return []byte("null"), nil
+	}
+
+	return json.Marshal(o.Value)
+}
+
+// Present reports whether the key was sent with a non null value.
+func (o Optional[T]) Present() bool {
+	return o.Set && !o.Null
+}
+
+// PatchValue lets request.Validate check the value only when it was sent.
+func (o Optional[T]) PatchValue() (any, bool, bool) {
+	return o.Value, o.Set, o.Null
+}
+
+// SchemaAs documents the field as its value, null removing it.
+func (o Optional[T]) SchemaAs() any {
+	return (*T)(nil)
+}
@@ -0,0 +1,208 @@
+// Package outbox delivers the mails queued in Postgres along with the writes that send them.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samuelsih/guwu/model"
+	limiter "github.com/samuelsih/guwu/pkg/concurrency"
+	"github.com/samuelsih/guwu/pkg/errs"
+	"github.com/samuelsih/guwu/pkg/logger"
+	"github.com/samuelsih/guwu/pkg/mail"
+)
+
+const (
+	MAX_ATTEMPTS    = 8
+	BASE_DELAY      = 30 * time.Second
+	MAX_DELAY       = 6 * time.Hour
+	BATCH_SIZE      = 50
+	LEASE           = 2 * time.Minute
+	DEFAULT_WORKERS = 4
+)
+
+// depth is published as mail_outbox in /admin/vars, refreshed after every delivery.
+var depth = expvar.NewMap("mail_outbox")
+
+type Deps struct {
+	DB *sqlx.DB
+
+	SendEmail func(ctx context.Context, param mail.Param, data any) error
+
+	// Workers bounds the mails sent at once, DEFAULT_WORKERS when zero.
+	Workers int
+}
+
+// Mail turns param and its template data into an outbox entry.
+func Mail(param mail.Param, data any) (model.OutboxMail, error) {
+	const op = errs.Op("outbox.Mail")
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return model.OutboxMail{}, errs.E(op, errs.KindUnexpected, err, "cannot queue mail")
+	}
+
+	var userID model.NullString
+	userID.String, userID.Valid = param.UserID, param.UserID != ""
+
+	return model.OutboxMail{
+		Template: int(param.TemplateTypes),
+		UserID:   userID,
+		Name:     param.Name,
+		Email:    param.Email,
+		Subject:  param.Subject,
+		Locale:   param.Locale,
+		Data:     encoded,
+	}, nil
+}
+
+// Enqueue queues a mail that is not tied to a write, it has the signature of mail.Client.Send.
+func (d *Deps) Enqueue(ctx context.Context, param mail.Param, data any) error {
+	m, err := Mail(param, data)
+	if err != nil {
+		return err
+	}
+
+	return model.EnqueueMail(ctx, d.DB, m)
+}
+
+// Deliver sends the mails that are due, failures are retried with an exponential backoff
+// until MAX_ATTEMPTS, then dead-lettered.
+func (d *Deps) Deliver(ctx context.Context) error {
+	const op = errs.Op("outbox.Deliver")
+
+	mails, err := model.ClaimOutboxMails(ctx, d.DB, BATCH_SIZE, LEASE)
+	if err != nil {
+		return err
+	}
+
+	workers := d.Workers
+	if workers <= 0 {
+		workers = DEFAULT_WORKERS
+	}
+
+	lim := limiter.New(workers)
+
+	for _, m := range mails {
+		m := m
+		lim.GoWithCtx(ctx, func() {
+			d.deliver(ctx, m)
+		})
+	}
+
+	lim.Wait()
+
+	if lim.PanicErr != nil {
+		return errs.E(op, errs.KindUnexpected, lim.PanicErr, "panic while sending mails")
+	}
+
+	return d.RefreshDepth(ctx)
+}
+
+func (d *Deps) deliver(ctx context.Context, m model.OutboxMail) {
+	skip, err := d.unsubscribed(ctx, m)
+	if err == nil && skip {
+		if err := model.MarkOutboxSkipped(ctx, d.DB, m.ID); err != nil {
+			logger.Err(err)
+		}
+
+		return
+	}
+
+	// the templates read fields by name, which a map provides as well as the original struct
+	var data map[string]any
+	if err == nil {
+		err = json.Unmarshal(m.Data, &data)
+	}
+
+	if err == nil {
+		param := mail.Param{
+			Name:          m.Name,
+			Email:         m.Email,
+			Subject:       m.Subject,
+			TemplateTypes: mail.MsgType(m.Template),
+			Locale:        m.Locale,
+			UserID:        m.UserID.String,
+		}
+
+		err = d.SendEmail(ctx, param, data)
+	}
+
+	if err == nil {
+		if err := model.MarkOutboxSent(ctx, d.DB, m.ID); err != nil {
+			logger.Err(err)
+		}
+
+		return
+	}
+
+	attempts := m.Attempts + 1
+	dead := attempts >= MAX_ATTEMPTS
+
+	if err := model.MarkOutboxFailed(ctx, d.DB, m.ID, err.Error(), time.Now().Add(Backoff(attempts)).UTC(), dead); err != nil {
+		logger.Err(err)
+	}
+}
+
+// unsubscribed reports whether the recipient opted out of the category of m since it was queued.
+func (d *Deps) unsubscribed(ctx context.Context, m model.OutboxMail) (bool, error) {
+	category := mail.MsgType(m.Template).Category()
+	if !category.Optional() || !m.UserID.Valid {
+		return false, nil
+	}
+
+	enabled, err := model.EmailEnabled(ctx, d.DB, m.UserID.String, string(category))
+	if err != nil {
+		return false, err
+	}
+
+	return !enabled, nil
+}
+
+// Backoff is the delay before the next attempt, doubling from BASE_DELAY up to MAX_DELAY.
+func Backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	delay := BASE_DELAY << (attempts - 1)
+	if delay <= 0 || delay > MAX_DELAY {
+		return MAX_DELAY
+	}
+
+	return delay
+}
+
+// DeadLetters lists the latest mails that ran out of attempts.
+func (d *Deps) DeadLetters(ctx context.Context, limit int) ([]model.OutboxMail, error) {
+	return model.ListOutboxMails(ctx, d.DB, model.OutboxDead, limit)
+}
+
+// Replay queues dead mails again, all of them when no id is given.
+func (d *Deps) Replay(ctx context.Context, ids ...string) (int64, error) {
+	replayed, err := model.ReplayOutboxMails(ctx, d.DB, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	return replayed, d.RefreshDepth(ctx)
+}
+
+// RefreshDepth publishes the number of mails by status.
+func (d *Deps) RefreshDepth(ctx context.Context) error {
+	counts, err := model.CountOutboxMails(ctx, d.DB)
+	if err != nil {
+		return err
+	}
+
+	for status, count := range counts {
+		v := new(expvar.Int)
+		v.Set(count)
+		depth.Set(status, v)
+	}
+
+	return nil
+}
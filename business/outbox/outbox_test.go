@@ -0,0 +1,211 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samuelsih/guwu/config"
+	"github.com/samuelsih/guwu/model"
+	"github.com/samuelsih/guwu/pkg/mail"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+var testDB *sqlx.DB
+
+func TestMain(m *testing.M) {
+	cleanup, err := setup()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	code := m.Run()
+
+	if err := cleanup(); err != nil {
+		log.Fatalf("error cleaning up: %v", err)
+	}
+
+	os.Exit(code)
+}
+
+func TestDeliver(t *testing.T) {
+	var mu sync.Mutex
+	sent := map[string]any{}
+	failing := true
+
+	deps := Deps{
+		DB: testDB,
+		SendEmail: func(ctx context.Context, param mail.Param, data any) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if failing && param.Email == "flaky@gmail.com" {
+				return errors.New("smtp unavailable")
+			}
+
+			sent[param.Email] = data
+			return nil
+		},
+	}
+
+	for _, email := range []string{"steady@gmail.com", "flaky@gmail.com"} {
+		err := deps.Enqueue(context.Background(), mail.Param{Name: "bob", Email: email, Subject: "Email Verification", TemplateTypes: mail.OTPMsg}, mail.OTPTplData{Username: "bob", OTP: "123456"})
+		if err != nil {
+			t.Fatalf("TestDeliver.Enqueue - expected nil, got %v", err)
+		}
+	}
+
+	if err := deps.Deliver(context.Background()); err != nil {
+		t.Fatalf("TestDeliver.Deliver - expected nil, got %v", err)
+	}
+
+	data, ok := sent["steady@gmail.com"].(map[string]any)
+	if !ok || data["OTP"] != "123456" || data["Username"] != "bob" {
+		t.Fatalf("TestDeliver.Deliver - expected the template data sent, got %v", sent)
+	}
+
+	if steady := findMail(t, "steady@gmail.com"); steady.Status != model.OutboxSent || string(steady.Data) != "{}" {
+		t.Fatalf("TestDeliver.Deliver - expected the template data cleared once sent, got %+v", steady)
+	}
+
+	flaky := findMail(t, "flaky@gmail.com")
+	if flaky.Status != model.OutboxPending || flaky.Attempts != 1 || !flaky.NextAttemptAt.After(time.Now().UTC()) || flaky.LastError.String != "smtp unavailable" {
+		t.Fatalf("TestDeliver.Retry - expected a later attempt, got %+v", flaky)
+	}
+
+	// the last attempt is due now
+	if _, err := testDB.Exec(`UPDATE mail_outbox SET attempts = $1, next_attempt_at = now() WHERE id = $2`, MAX_ATTEMPTS-1, flaky.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := deps.Deliver(context.Background()); err != nil {
+		t.Fatalf("TestDeliver.Deliver - expected nil, got %v", err)
+	}
+
+	dead, err := deps.DeadLetters(context.Background(), 10)
+	if err != nil || len(dead) != 1 || dead[0].ID != flaky.ID {
+		t.Fatalf("TestDeliver.DeadLetters - expected the flaky mail, got %v %v", dead, err)
+	}
+
+	failing = false
+
+	if replayed, err := deps.Replay(context.Background()); err != nil || replayed != 1 {
+		t.Fatalf("TestDeliver.Replay - expected 1 replayed, got %v %v", replayed, err)
+	}
+
+	if err := deps.Deliver(context.Background()); err != nil {
+		t.Fatalf("TestDeliver.Deliver - expected nil, got %v", err)
+	}
+
+	if flaky := findMail(t, "flaky@gmail.com"); flaky.Status != model.OutboxSent {
+		t.Fatalf("TestDeliver.Replay - expected the mail sent, got %+v", flaky)
+	}
+
+	if depth.Get(model.OutboxSent).String() != "2" || depth.Get(model.OutboxDead).String() != "0" {
+		t.Fatalf("TestDeliver.Depth - expected 2 sent and none dead, got %v", depth.String())
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, BASE_DELAY},
+		{2, 2 * BASE_DELAY},
+		{4, 8 * BASE_DELAY},
+		{20, MAX_DELAY},
+		{100, MAX_DELAY},
+	}
+
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Fatalf("TestBackoff - expected %v after %d attempts, got %v", tt.want, tt.attempts, got)
+		}
+	}
+}
+
+func findMail(t *testing.T, email string) model.OutboxMail {
+	t.Helper()
+
+	for _, status := range []string{model.OutboxPending, model.OutboxSent, model.OutboxDead} {
+		mails, err := model.ListOutboxMails(context.Background(), testDB, status, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, m := range mails {
+			if m.Email == email {
+				return m
+			}
+		}
+	}
+
+	t.Fatalf("no mail for %s", email)
+	return model.OutboxMail{}
+}
+
+func setup() (func() error, error) {
+	ctx := context.Background()
+
+	req := testcontainers.ContainerRequest{
+		Image:        "postgres:latest",
+		ExposedPorts: []string{"5432/tcp"},
+		WaitingFor:   wait.ForListeningPort("5432/tcp"),
+		Env: map[string]string{
+			"POSTGRES_DB":       "testdb",
+			"POSTGRES_PASSWORD": "postgres",
+			"POSTGRES_USER":     "postgres",
+		},
+	}
+
+	container, err := testcontainers.GenericContainer(
+		ctx,
+		testcontainers.GenericContainerRequest{
+			ContainerRequest: req,
+			Started:          true,
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	mappedPort, err := container.MappedPort(ctx, "5432")
+	if err != nil {
+		return nil, err
+	}
+
+	hostIP, err := container.Host(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	uri := fmt.Sprintf("postgres://postgres:postgres@%v:%v/testdb?sslmode=disable", hostIP, mappedPort.Port())
+
+	testDB = config.ConnectPostgres(uri)
+	if testDB == nil {
+		return nil, errors.New("cannot connect testDB")
+	}
+
+	if err := config.LoadPostgresExtension(testDB); err != nil {
+		return nil, errors.New("cannot load postgres extension")
+	}
+
+	if err := config.MigrateAll(testDB); err != nil {
+		return nil, err
+	}
+
+	cleanup := func() error {
+		return container.Terminate(ctx)
+	}
+
+	return cleanup, nil
+}
@@ -0,0 +1,323 @@
+package post
+
+import (
+	"context"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/xid"
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/business/event"
+	"github.com/samuelsih/guwu/model"
+	"github.com/samuelsih/guwu/pkg/logger"
+)
+
+const (
+	MAX_DESCRIPTION = 1000
+	DEFAULT_LIMIT   = 20
+	MAX_LIMIT       = 100
+
+	// FANOUT_TIMEOUT bounds streaming a new post to the followers, done after the response.
+	FANOUT_TIMEOUT = 30 * time.Second
+)
+
+type Deps struct {
+	DB       *sqlx.DB
+	Identify func(ctx context.Context, in business.CommonInput) (business.Identity, error)
+
+	// Mentioned notifies the users mentioned in a new post, a failure does not undo the post.
+	Mentioned func(ctx context.Context, actorID, postID, text string) error
+
+	// PublishFollowers streams a new post to the connected clients of the followers of its author,
+	// in the background as an author may have many followers.
+	PublishFollowers func(ctx context.Context, userID, eventType string, data any) error
+}
+
+type PostOutput struct {
+	business.CommonResponse
+	Post model.Post `json:"post"`
+}
+
+type CreateInput struct {
+	Description string `json:"description" validate:"required,max=1000"`
+}
+
+func (d *Deps) Create(ctx context.Context, in CreateInput, common business.CommonInput) PostOutput {
+	var out PostOutput
+
+	if !validDescription(in.Description, &out.CommonResponse) {
+		return out
+	}
+
+	identity, ok := d.writer(ctx, common, &out.CommonResponse)
+	if !ok {
+		return out
+	}
+
+	post, err := model.InsertPost(ctx, d.DB, model.Post{
+		ID:          xid.New().String(),
+		UserID:      identity.User.ID,
+		Description: in.Description,
+	})
+
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	if d.Mentioned != nil {
+		if err := d.Mentioned(ctx, identity.User.ID, post.ID, post.Description); err != nil {
+			logger.Err(err)
+		}
+	}
+
+	if d.PublishFollowers != nil {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), FANOUT_TIMEOUT)
+			defer cancel()
+
+			if err := d.PublishFollowers(ctx, post.UserID, event.TypePost, post); err != nil {
+				logger.Err(err)
+			}
+		}()
+	}
+
+	out.Post = post
+	out.SetOK()
+	return out
+}
+
+type GetInput struct {
+	ID string `url:"id"`
+}
+
+func (d *Deps) Get(ctx context.Context, in GetInput, common business.CommonInput) PostOutput {
+	var out PostOutput
+
+	post, err := model.FindPost(ctx, d.DB, in.ID)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.Post = post
+	out.SetLastModified(post.LastModified())
+	out.SetOK()
+	return out
+}
+
+type ListInput struct {
+	UserID string `url:"id"`
+	Limit  int    `query:"limit" validate:"min=0,max=100"`
+	Offset int    `query:"offset" validate:"min=0"`
+}
+
+type ListOutput struct {
+	business.CommonResponse
+	Posts []model.Post `json:"posts"`
+}
+
+func (d *Deps) List(ctx context.Context, in ListInput, common business.CommonInput) ListOutput {
+	var out ListOutput
+
+	if in.Limit == 0 {
+		in.Limit = DEFAULT_LIMIT
+	}
+
+	if in.Limit < 0 || in.Limit > MAX_LIMIT || in.Offset < 0 {
+		out.RawError(400, "limit must be between 1 and 100 and offset must be positive")
+		return out
+	}
+
+	posts, err := model.ListUserPosts(ctx, d.DB, in.UserID, in.Limit, in.Offset)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.Posts = posts
+	for _, post := range posts {
+		out.SetLastModified(post.LastModified())
+	}
+
+	out.SetOK()
+	return out
+}
+
+type FeedInput struct {
+	Limit  int `query:"limit" validate:"min=0,max=100"`
+	Offset int `query:"offset" validate:"min=0"`
+}
+
+// Feed pages through the posts of the users the current user follows.
+func (d *Deps) Feed(ctx context.Context, in FeedInput, common business.CommonInput) ListOutput {
+	var out ListOutput
+
+	identity, err := business.Authenticated(ctx, common, d.Identify)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	if !identity.Can(business.ScopePostsRead) {
+		out.RawError(403, "token is missing scope "+business.ScopePostsRead)
+		return out
+	}
+
+	if in.Limit == 0 {
+		in.Limit = DEFAULT_LIMIT
+	}
+
+	if in.Limit < 0 || in.Limit > MAX_LIMIT || in.Offset < 0 {
+		out.RawError(400, "limit must be between 1 and 100 and offset must be positive")
+		return out
+	}
+
+	posts, err := model.ListFeedPosts(ctx, d.DB, identity.User.ID, in.Limit, in.Offset)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.Posts = posts
+	for _, post := range posts {
+		out.SetLastModified(post.LastModified())
+	}
+
+	out.SetOK()
+	return out
+}
+
+type ReplaceInput struct {
+	ID          string `json:"-" url:"id"`
+	Description string `json:"description" validate:"required,max=1000"`
+}
+
+// Replace overwrites every editable field of the post.
+func (d *Deps) Replace(ctx context.Context, in ReplaceInput, common business.CommonInput) PostOutput {
+	var out PostOutput
+
+	if !validDescription(in.Description, &out.CommonResponse) {
+		return out
+	}
+
+	identity, ok := d.writer(ctx, common, &out.CommonResponse)
+	if !ok {
+		return out
+	}
+
+	post, err := model.UpdatePost(ctx, d.DB, model.Post{
+		ID:          in.ID,
+		UserID:      identity.User.ID,
+		Description: in.Description,
+	})
+
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.Post = post
+	out.SetOK()
+	return out
+}
+
+type UpdateInput struct {
+	ID          string                    `json:"-" url:"id"`
+	Description business.Optional[string] `json:"description" validate:"max=1000"`
+}
+
+// Update applies a merge patch, only the fields present in the input are changed.
+func (d *Deps) Update(ctx context.Context, in UpdateInput, common business.CommonInput) PostOutput {
+	var out PostOutput
+
+	if in.Description.Null {
+		out.RawError(400, "description cannot be removed")
+		return out
+	}
+
+	if in.Description.Set && !validDescription(in.Description.Value, &out.CommonResponse) {
+		return out
+	}
+
+	identity, ok := d.writer(ctx, common, &out.CommonResponse)
+	if !ok {
+		return out
+	}
+
+	post, err := model.FindPost(ctx, d.DB, in.ID)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	if post.UserID != identity.User.ID {
+		out.RawError(404, "unknown post")
+		return out
+	}
+
+	if in.Description.Present() {
+		post.Description = in.Description.Value
+	}
+
+	post, err = model.UpdatePost(ctx, d.DB, post)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.Post = post
+	out.SetOK()
+	return out
+}
+
+type DeleteInput struct {
+	ID string `url:"id"`
+}
+
+type DeleteOutput struct {
+	business.CommonResponse
+}
+
+func (d *Deps) Delete(ctx context.Context, in DeleteInput, common business.CommonInput) DeleteOutput {
+	var out DeleteOutput
+
+	identity, ok := d.writer(ctx, common, &out.CommonResponse)
+	if !ok {
+		return out
+	}
+
+	err := model.DeletePost(ctx, d.DB, identity.User.ID, in.ID)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.SetOK()
+	return out
+}
+
+func (d *Deps) writer(ctx context.Context, common business.CommonInput, out *business.CommonResponse) (business.Identity, bool) {
+	identity, err := business.Authenticated(ctx, common, d.Identify)
+	if err != nil {
+		out.SetError(err)
+		return identity, false
+	}
+
+	if !identity.Can(business.ScopePostsWrite) {
+		out.RawError(403, "token is missing scope "+business.ScopePostsWrite)
+		return identity, false
+	}
+
+	return identity, true
+}
+
+func validDescription(description string, out *business.CommonResponse) bool {
+	if description == "" || utf8.RuneCountInString(description) > MAX_DESCRIPTION {
+		out.RawError(400, "description is required and must be at most 1000 characters")
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,329 @@
+package post
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/config"
+	"github.com/samuelsih/guwu/model"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+var (
+	testDB    *sqlx.DB
+	testUser  model.User
+	otherUser model.User
+)
+
+func TestMain(m *testing.M) {
+	cleanup, err := setup()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	code := m.Run()
+
+	if err := cleanup(); err != nil {
+		log.Fatalf("error cleaning up: %v", err)
+	}
+
+	os.Exit(code)
+}
+
+func depsAs(user model.User, scopes ...string) Deps {
+	return Deps{
+		DB: testDB,
+		Identify: func(ctx context.Context, in business.CommonInput) (business.Identity, error) {
+			if len(scopes) > 0 {
+				return business.Identity{User: user, TokenID: "token", Scopes: scopes}, nil
+			}
+
+			return business.Identity{User: user, SessionID: "session"}, nil
+		},
+	}
+}
+
+func patchOf(t *testing.T, id, body string) UpdateInput {
+	t.Helper()
+
+	in := UpdateInput{ID: id}
+	if err := json.Unmarshal([]byte(body), &in); err != nil {
+		t.Fatal(err)
+	}
+
+	return in
+}
+
+func TestCreate(t *testing.T) {
+	t.Parallel()
+
+	session := business.CommonInput{SessionID: "session"}
+
+	tests := []struct {
+		name   string
+		deps   Deps
+		common business.CommonInput
+		input  CreateInput
+		want   int
+	}{
+		{"Unauthenticated", depsAs(testUser), business.CommonInput{}, CreateInput{Description: "hello"}, 401},
+		{"EmptyDescription", depsAs(testUser), session, CreateInput{}, 400},
+		{"TooLongDescription", depsAs(testUser), session, CreateInput{Description: strings.Repeat("a", MAX_DESCRIPTION+1)}, 400},
+		{"MultibyteDescription", depsAs(testUser), session, CreateInput{Description: strings.Repeat("😀", MAX_DESCRIPTION)}, 200},
+		{"MissingScope", depsAs(testUser, business.ScopePostsRead), business.CommonInput{AccessToken: "x"}, CreateInput{Description: "hello"}, 403},
+		{"Success", depsAs(testUser), session, CreateInput{Description: "hello"}, 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := tt.deps.Create(context.Background(), tt.input, tt.common)
+			if out.StatusCode != tt.want {
+				t.Fatalf("TestCreate.%s - expected %d, got %v", tt.name, tt.want, out)
+			}
+		})
+	}
+}
+
+func TestCreatePublishesInBackground(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	published := make(chan string, 1)
+
+	deps := depsAs(testUser)
+	deps.PublishFollowers = func(ctx context.Context, userID, eventType string, data any) error {
+		<-release
+		published <- userID
+		return nil
+	}
+
+	out := deps.Create(context.Background(), CreateInput{Description: "for many followers"}, business.CommonInput{SessionID: "session"})
+	if out.StatusCode != 200 {
+		t.Fatalf("TestCreatePublishesInBackground - expected 200 before the fan-out, got %v", out)
+	}
+
+	close(release)
+
+	if userID := <-published; userID != testUser.ID {
+		t.Fatalf("TestCreatePublishesInBackground - expected the post of %s published, got %s", testUser.ID, userID)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	t.Parallel()
+
+	deps := depsAs(testUser)
+	session := business.CommonInput{SessionID: "session"}
+
+	created := deps.Create(context.Background(), CreateInput{Description: "first"}, session)
+	if created.StatusCode != 200 {
+		t.Fatalf("TestUpdate.Create - expected 200, got %v", created)
+	}
+
+	id := created.Post.ID
+
+	t.Run("AbsentFieldIsKept", func(t *testing.T) {
+		out := deps.Update(context.Background(), patchOf(t, id, `{}`), session)
+		if out.StatusCode != 200 || out.Post.Description != "first" || !out.Post.UpdatedAt.Valid {
+			t.Fatalf("expected unchanged description, got %v", out)
+		}
+	})
+
+	t.Run("NullIsRejected", func(t *testing.T) {
+		out := deps.Update(context.Background(), patchOf(t, id, `{"description": null}`), session)
+		if out.StatusCode != 400 {
+			t.Fatalf("expected 400, got %v", out)
+		}
+	})
+
+	t.Run("Value", func(t *testing.T) {
+		out := deps.Update(context.Background(), patchOf(t, id, `{"description": "patched"}`), session)
+		if out.StatusCode != 200 || out.Post.Description != "patched" {
+			t.Fatalf("expected patched description, got %v", out)
+		}
+	})
+
+	t.Run("OtherUser", func(t *testing.T) {
+		other := depsAs(otherUser)
+
+		out := other.Update(context.Background(), patchOf(t, id, `{"description": "stolen"}`), session)
+		if out.StatusCode != 404 {
+			t.Fatalf("expected 404, got %v", out)
+		}
+
+		replaced := other.Replace(context.Background(), ReplaceInput{ID: id, Description: "stolen"}, session)
+		if replaced.StatusCode != 404 {
+			t.Fatalf("expected 404, got %v", replaced)
+		}
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		out := deps.Replace(context.Background(), ReplaceInput{ID: id, Description: "replaced"}, session)
+		if out.StatusCode != 200 || out.Post.Description != "replaced" {
+			t.Fatalf("expected replaced description, got %v", out)
+		}
+	})
+}
+
+func TestListAndDelete(t *testing.T) {
+	t.Parallel()
+
+	deps := depsAs(otherUser)
+	session := business.CommonInput{SessionID: "session"}
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		out := deps.Create(context.Background(), CreateInput{Description: fmt.Sprintf("post %d", i)}, session)
+		if out.StatusCode != 200 {
+			t.Fatalf("TestListAndDelete.Create - expected 200, got %v", out)
+		}
+
+		ids = append(ids, out.Post.ID)
+	}
+
+	page := deps.List(context.Background(), ListInput{UserID: otherUser.ID, Limit: 2}, business.CommonInput{})
+	if page.StatusCode != 200 || len(page.Posts) != 2 {
+		t.Fatalf("TestListAndDelete.List - expected 2 posts, got %v", page)
+	}
+
+	invalid := deps.List(context.Background(), ListInput{UserID: otherUser.ID, Limit: 1000}, business.CommonInput{})
+	if invalid.StatusCode != 400 {
+		t.Fatalf("TestListAndDelete.List - expected 400, got %v", invalid)
+	}
+
+	other := depsAs(testUser)
+
+	if out := other.Delete(context.Background(), DeleteInput{ID: ids[0]}, session); out.StatusCode != 404 {
+		t.Fatalf("TestListAndDelete.Delete - other user expected 404, got %v", out)
+	}
+
+	if out := deps.Delete(context.Background(), DeleteInput{ID: ids[0]}, session); out.StatusCode != 200 {
+		t.Fatalf("TestListAndDelete.Delete - expected 200, got %v", out)
+	}
+
+	if out := deps.Get(context.Background(), GetInput{ID: ids[0]}, business.CommonInput{}); out.StatusCode != 404 {
+		t.Fatalf("TestListAndDelete.Get - expected 404, got %v", out)
+	}
+}
+
+func TestFeed(t *testing.T) {
+	t.Parallel()
+
+	session := business.CommonInput{SessionID: "session"}
+	author := depsAs(otherUser)
+
+	created := author.Create(context.Background(), CreateInput{Description: "for my followers"}, session)
+	if created.StatusCode != 200 {
+		t.Fatalf("TestFeed.Create - expected 200, got %v", created)
+	}
+
+	if err := model.FollowUser(context.Background(), testDB, testUser.ID, otherUser.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	follower := depsAs(testUser)
+
+	if out := follower.Feed(context.Background(), FeedInput{}, business.CommonInput{}); out.StatusCode != 401 {
+		t.Fatalf("TestFeed.Unauthenticated - expected 401, got %v", out)
+	}
+
+	feed := follower.Feed(context.Background(), FeedInput{Limit: 100}, session)
+	if feed.StatusCode != 200 || len(feed.Posts) == 0 {
+		t.Fatalf("TestFeed - expected posts, got %v", feed)
+	}
+
+	for _, post := range feed.Posts {
+		if post.UserID != otherUser.ID {
+			t.Fatalf("TestFeed - expected only followed posts, got %v", post)
+		}
+	}
+
+	if own := author.Feed(context.Background(), FeedInput{}, session); own.StatusCode != 200 || len(own.Posts) != 0 {
+		t.Fatalf("TestFeed - expected empty feed without follows, got %v", own)
+	}
+
+	if err := model.UnfollowUser(context.Background(), testDB, testUser.ID, otherUser.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if out := follower.Feed(context.Background(), FeedInput{}, session); out.StatusCode != 200 || len(out.Posts) != 0 {
+		t.Fatalf("TestFeed.Unfollowed - expected empty feed, got %v", out)
+	}
+}
+
+func setup() (func() error, error) {
+	ctx := context.Background()
+
+	req := testcontainers.ContainerRequest{
+		Image:        "postgres:latest",
+		ExposedPorts: []string{"5432/tcp"},
+		WaitingFor:   wait.ForListeningPort("5432/tcp"),
+		Env: map[string]string{
+			"POSTGRES_DB":       "testdb",
+			"POSTGRES_PASSWORD": "postgres",
+			"POSTGRES_USER":     "postgres",
+		},
+	}
+
+	container, err := testcontainers.GenericContainer(
+		ctx,
+		testcontainers.GenericContainerRequest{
+			ContainerRequest: req,
+			Started:          true,
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	mappedPort, err := container.MappedPort(ctx, "5432")
+	if err != nil {
+		return nil, err
+	}
+
+	hostIP, err := container.Host(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	uri := fmt.Sprintf("postgres://postgres:postgres@%v:%v/testdb?sslmode=disable", hostIP, mappedPort.Port())
+
+	testDB = config.ConnectPostgres(uri)
+	if testDB == nil {
+		return nil, errors.New("cannot connect testGuestDB")
+	}
+
+	if err := config.LoadPostgresExtension(testDB); err != nil {
+		return nil, errors.New("cannot load postgres extension")
+	}
+
+	if err := config.MigrateAll(testDB); err != nil {
+		return nil, err
+	}
+
+	testUser, err = model.InsertUser(ctx, testDB, "poster", "poster@gmail.com", "$2a$07$GsdzeF04uKNmPyEf1R.WUOZF.i9Xhpx6peu3NBMN7NdPe//tWEfY", "en")
+	if err != nil {
+		return nil, err
+	}
+
+	otherUser, err = model.InsertUser(ctx, testDB, "otherposter", "otherposter@gmail.com", "$2a$07$GsdzeF04uKNmPyEf1R.WUOZF.i9Xhpx6peu3NBMN7NdPe//tWEfY", "en")
+	if err != nil {
+		return nil, err
+	}
+
+	cleanup := func() error {
+		return container.Terminate(ctx)
+	}
+
+	return cleanup, nil
+}
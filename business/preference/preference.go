@@ -0,0 +1,267 @@
+// Package preference lets users choose the mail categories they receive and unsubscribe from a mail.
+package preference
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/model"
+	"github.com/samuelsih/guwu/pkg/errs"
+	"github.com/samuelsih/guwu/pkg/mail"
+	"github.com/samuelsih/guwu/pkg/securer"
+)
+
+const UNSUBSCRIBE_PATH = "/unsubscribe"
+
+var errInvalidToken = errors.New("invalid unsubscribe token")
+
+type Deps struct {
+	DB       *sqlx.DB
+	Identify func(ctx context.Context, in business.CommonInput) (business.Identity, error)
+}
+
+// UnsubscribeToken signs userID and category, it does not expire so old mails keep working.
+func UnsubscribeToken(userID string, category mail.Category) (string, error) {
+	return securer.Encrypt([]byte(userID + "\n" + string(category)))
+}
+
+// UnsubscribeURL returns the mail.Client.Unsubscribe building links to UNSUBSCRIBE_PATH of baseURL.
+func UnsubscribeURL(baseURL string) func(userID string, category mail.Category) (string, error) {
+	return func(userID string, category mail.Category) (string, error) {
+		token, err := UnsubscribeToken(userID, category)
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimRight(baseURL, "/") + UNSUBSCRIBE_PATH + "?token=" + url.QueryEscape(token), nil
+	}
+}
+
+func parseToken(token string) (string, mail.Category, error) {
+	const op = errs.Op("preference.parseToken")
+
+	plain, err := securer.Decrypt(token)
+	if err != nil {
+		return "", "", errs.E(op, errs.KindBadRequest, err, errInvalidToken.Error())
+	}
+
+	userID, name, found := strings.Cut(string(plain), "\n")
+	category, ok := mail.ParseCategory(name)
+
+	if !found || !ok || !category.Optional() {
+		return "", "", errs.E(op, errs.KindBadRequest, errInvalidToken, errInvalidToken.Error())
+	}
+
+	return userID, category, nil
+}
+
+type Preference struct {
+	Category string `json:"category"`
+	Enabled  bool   `json:"enabled"`
+	Optional bool   `json:"optional"`
+
+	// Frequency is how often the digest is sent, daily or weekly.
+	Frequency string `json:"frequency,omitempty"`
+}
+
+var frequencies = map[string]bool{model.DigestDaily: true, model.DigestWeekly: true}
+
+type ListOutput struct {
+	business.CommonResponse
+	Preferences []Preference `json:"preferences"`
+}
+
+// List returns every category with the choice of the user, transactional mails are always enabled.
+func (d *Deps) List(ctx context.Context, common business.CommonInput) ListOutput {
+	var out ListOutput
+
+	identity, err := business.Authenticated(ctx, common, d.Identify)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	if !identity.Can(business.ScopeAccountRead) {
+		out.RawError(403, "token is missing scope "+business.ScopeAccountRead)
+		return out
+	}
+
+	stored, err := model.ListEmailPreferences(ctx, d.DB, identity.User.ID)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	enabled := map[string]bool{}
+	for _, p := range stored {
+		enabled[p.Category] = p.Enabled
+		out.SetLastModified(p.UpdatedAt)
+	}
+
+	for _, category := range mail.Categories {
+		p := Preference{Category: string(category), Enabled: true, Optional: category.Optional()}
+
+		if v, ok := enabled[p.Category]; ok && p.Optional {
+			p.Enabled = v
+		}
+
+		if category == mail.DigestCategory {
+			if p.Frequency, err = model.DigestFrequency(ctx, d.DB, identity.User.ID); err != nil {
+				out.SetError(err)
+				return out
+			}
+		}
+
+		out.Preferences = append(out.Preferences, p)
+	}
+
+	out.SetOK()
+	return out
+}
+
+type UpdateInput struct {
+	Category  string `url:"category"`
+	Enabled   *bool  `json:"enabled"`
+	Frequency string `json:"frequency"`
+}
+
+type UpdateOutput struct {
+	business.CommonResponse
+	Preference Preference `json:"preference"`
+}
+
+// Update subscribes or unsubscribes the user of a session from a category,
+// or changes the frequency of the digest.
+func (d *Deps) Update(ctx context.Context, in UpdateInput, common business.CommonInput) UpdateOutput {
+	var out UpdateOutput
+
+	if in.Enabled == nil && in.Frequency == "" {
+		out.RawError(400, "enabled or frequency is required")
+		return out
+	}
+
+	category, ok := optionalCategory(in.Category, &out.CommonResponse)
+	if !ok {
+		return out
+	}
+
+	if in.Frequency != "" && category != mail.DigestCategory {
+		out.RawError(400, "only the digest has a frequency")
+		return out
+	}
+
+	if in.Frequency != "" && !frequencies[in.Frequency] {
+		out.RawError(400, "frequency must be daily or weekly")
+		return out
+	}
+
+	identity, err := business.Authenticated(ctx, common, d.Identify)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	if identity.SessionID == "" {
+		out.RawError(403, "email preferences can only be changed from a session")
+		return out
+	}
+
+	out.Preference = Preference{Category: string(category), Optional: true, Frequency: in.Frequency}
+
+	if in.Enabled != nil {
+		err = model.SetEmailPreference(ctx, d.DB, identity.User.ID, string(category), *in.Enabled)
+		out.Preference.Enabled = *in.Enabled
+	} else {
+		out.Preference.Enabled, err = model.EmailEnabled(ctx, d.DB, identity.User.ID, string(category))
+	}
+
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	if in.Frequency != "" {
+		err = model.SetDigestFrequency(ctx, d.DB, identity.User.ID, in.Frequency)
+	} else if category == mail.DigestCategory {
+		out.Preference.Frequency, err = model.DigestFrequency(ctx, d.DB, identity.User.ID)
+	}
+
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.SetOK()
+	return out
+}
+
+type UnsubscribeInput struct {
+	Token string `query:"token"`
+}
+
+type UnsubscribeOutput struct {
+	business.CommonResponse
+	Preference Preference `json:"preference"`
+}
+
+// Subscription shows the category a token unsubscribes from, without changing it,
+// since mail scanners follow the links they find.
+func (d *Deps) Subscription(ctx context.Context, in UnsubscribeInput, common business.CommonInput) UnsubscribeOutput {
+	var out UnsubscribeOutput
+
+	userID, category, err := parseToken(in.Token)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	enabled, err := model.EmailEnabled(ctx, d.DB, userID, string(category))
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.Preference = Preference{Category: string(category), Enabled: enabled, Optional: true}
+	out.SetOK()
+	return out
+}
+
+// Unsubscribe is the one-click unsubscribe of RFC 8058, the token stands for the user.
+func (d *Deps) Unsubscribe(ctx context.Context, in UnsubscribeInput, common business.CommonInput) UnsubscribeOutput {
+	var out UnsubscribeOutput
+
+	userID, category, err := parseToken(in.Token)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	err = model.SetEmailPreference(ctx, d.DB, userID, string(category), false)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.Preference = Preference{Category: string(category), Enabled: false, Optional: true}
+	out.SetOK()
+	return out
+}
+
+func optionalCategory(name string, out *business.CommonResponse) (mail.Category, bool) {
+	category, ok := mail.ParseCategory(name)
+	if !ok {
+		out.RawError(404, "unknown category "+name)
+		return category, false
+	}
+
+	if !category.Optional() {
+		out.RawError(400, name+" emails cannot be disabled")
+		return category, false
+	}
+
+	return category, true
+}
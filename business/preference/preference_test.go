@@ -0,0 +1,223 @@
+package preference
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/config"
+	"github.com/samuelsih/guwu/model"
+	"github.com/samuelsih/guwu/pkg/mail"
+	"github.com/samuelsih/guwu/pkg/securer"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+var (
+	testDB   *sqlx.DB
+	testUser model.User
+)
+
+func TestMain(m *testing.M) {
+	securer.SetSecret("0f5297b6f0114171e9de547801b1e8bb929fe1d091e63c6377a392ec1baa3d0b")
+
+	cleanup, err := setup()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	code := m.Run()
+
+	if err := cleanup(); err != nil {
+		log.Fatalf("error cleaning up: %v", err)
+	}
+
+	os.Exit(code)
+}
+
+func depsAs(identity business.Identity) Deps {
+	return Deps{
+		DB: testDB,
+		Identify: func(ctx context.Context, in business.CommonInput) (business.Identity, error) {
+			return identity, nil
+		},
+	}
+}
+
+var session = business.CommonInput{SessionID: "session"}
+
+func enabled(out ListOutput, category mail.Category) bool {
+	for _, p := range out.Preferences {
+		if p.Category == string(category) {
+			return p.Enabled
+		}
+	}
+
+	return false
+}
+
+func TestUpdate(t *testing.T) {
+	deps := depsAs(business.Identity{User: testUser, SessionID: "session"})
+	off := false
+
+	list := deps.List(context.Background(), session)
+	if list.StatusCode != 200 || len(list.Preferences) != len(mail.Categories) || !enabled(list, mail.FollowsCategory) {
+		t.Fatalf("TestUpdate.Default - expected every category enabled, got %v", list)
+	}
+
+	tests := []struct {
+		name  string
+		input UpdateInput
+		want  int
+	}{
+		{"MissingEnabled", UpdateInput{Category: "follows"}, 400},
+		{"UnknownCategory", UpdateInput{Category: "ads", Enabled: &off}, 404},
+		{"Transactional", UpdateInput{Category: "transactional", Enabled: &off}, 400},
+		{"Success", UpdateInput{Category: "follows", Enabled: &off}, 200},
+		{"FrequencyNotDigest", UpdateInput{Category: "follows", Frequency: "daily"}, 400},
+		{"UnknownFrequency", UpdateInput{Category: "digest", Frequency: "hourly"}, 400},
+		{"Frequency", UpdateInput{Category: "digest", Frequency: "daily"}, 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := deps.Update(context.Background(), tt.input, session)
+			if out.StatusCode != tt.want {
+				t.Fatalf("TestUpdate.%s - expected %d, got %v", tt.name, tt.want, out)
+			}
+		})
+	}
+
+	list = deps.List(context.Background(), session)
+	if enabled(list, mail.FollowsCategory) || !enabled(list, mail.DigestCategory) || !enabled(list, mail.TransactionalCategory) {
+		t.Fatalf("TestUpdate.List - expected only follows disabled, got %v", list)
+	}
+
+	for _, p := range list.Preferences {
+		if (p.Category == "digest") != (p.Frequency == "daily") {
+			t.Fatalf("TestUpdate.Frequency - expected a daily digest only, got %v", list)
+		}
+	}
+
+	t.Run("WithToken", func(t *testing.T) {
+		tokenDeps := depsAs(business.Identity{User: testUser, TokenID: "123", Scopes: business.Scopes})
+
+		out := tokenDeps.Update(context.Background(), UpdateInput{Category: "digest", Enabled: &off}, business.CommonInput{AccessToken: "guwu_pat_x"})
+		if out.StatusCode != 403 {
+			t.Fatalf("TestUpdate.WithToken - expected 403, got %v", out)
+		}
+	})
+}
+
+func TestUnsubscribe(t *testing.T) {
+	deps := depsAs(business.Identity{})
+
+	token, err := UnsubscribeToken(testUser.ID, mail.DigestCategory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := deps.Subscription(context.Background(), UnsubscribeInput{Token: token}, business.CommonInput{})
+	if out.StatusCode != 200 || out.Preference.Category != "digest" {
+		t.Fatalf("TestUnsubscribe.Subscription - expected the digest preference, got %v", out)
+	}
+
+	out = deps.Unsubscribe(context.Background(), UnsubscribeInput{Token: token}, business.CommonInput{})
+	if out.StatusCode != 200 || out.Preference.Enabled {
+		t.Fatalf("TestUnsubscribe.Unsubscribe - expected digest disabled, got %v", out)
+	}
+
+	if on, _ := model.EmailEnabled(context.Background(), testDB, testUser.ID, "digest"); on {
+		t.Fatal("TestUnsubscribe.Stored - expected digest disabled")
+	}
+
+	transactional, _ := UnsubscribeToken(testUser.ID, mail.TransactionalCategory)
+
+	invalid := []string{"", "garbage", token[:len(token)-2], transactional}
+
+	for _, token := range invalid {
+		if out := deps.Unsubscribe(context.Background(), UnsubscribeInput{Token: token}, business.CommonInput{}); out.StatusCode != 400 {
+			t.Fatalf("TestUnsubscribe.Invalid - expected 400 for %q, got %v", token, out)
+		}
+	}
+}
+
+func TestUnsubscribeURL(t *testing.T) {
+	link, err := UnsubscribeURL("https://guwu.example/")(testUser.ID, mail.FollowsCategory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const prefix = "https://guwu.example/unsubscribe?token="
+	if len(link) <= len(prefix) || link[:len(prefix)] != prefix {
+		t.Fatalf("unexpected link %s", link)
+	}
+}
+
+func setup() (func() error, error) {
+	ctx := context.Background()
+
+	req := testcontainers.ContainerRequest{
+		Image:        "postgres:latest",
+		ExposedPorts: []string{"5432/tcp"},
+		WaitingFor:   wait.ForListeningPort("5432/tcp"),
+		Env: map[string]string{
+			"POSTGRES_DB":       "testdb",
+			"POSTGRES_PASSWORD": "postgres",
+			"POSTGRES_USER":     "postgres",
+		},
+	}
+
+	container, err := testcontainers.GenericContainer(
+		ctx,
+		testcontainers.GenericContainerRequest{
+			ContainerRequest: req,
+			Started:          true,
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	mappedPort, err := container.MappedPort(ctx, "5432")
+	if err != nil {
+		return nil, err
+	}
+
+	hostIP, err := container.Host(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	uri := fmt.Sprintf("postgres://postgres:postgres@%v:%v/testdb?sslmode=disable", hostIP, mappedPort.Port())
+
+	testDB = config.ConnectPostgres(uri)
+	if testDB == nil {
+		return nil, errors.New("cannot connect testGuestDB")
+	}
+
+	if err := config.LoadPostgresExtension(testDB); err != nil {
+		return nil, errors.New("cannot load postgres extension")
+	}
+
+	if err := config.MigrateAll(testDB); err != nil {
+		return nil, err
+	}
+
+	testUser, err = model.InsertUser(ctx, testDB, "subscriber", "subscriber@gmail.com", "$2a$07$GsdzeF04uKNmPyEf1R.WUOZF.i9Xhpx6peu3NBMN7NdPe//tWEfY", "en")
+	if err != nil {
+		return nil, err
+	}
+
+	cleanup := func() error {
+		return container.Terminate(ctx)
+	}
+
+	return cleanup, nil
+}
@@ -0,0 +1,66 @@
+package business
+
+const (
+	ScopeAccountRead        = "account:read"
+	ScopeFollowsRead        = "follows:read"
+	ScopeFollowsWrite       = "follows:write"
+	ScopePostsRead          = "posts:read"
+	ScopePostsWrite         = "posts:write"
+	ScopeNotificationsRead  = "notifications:read"
+	ScopeNotificationsWrite = "notifications:write"
+	ScopeEventsRead         = "events:read"
+)
+
+var Scopes = []string{
+	ScopeAccountRead,
+	ScopeFollowsRead,
+	ScopeFollowsWrite,
+	ScopePostsRead,
+	ScopePostsWrite,
+	ScopeNotificationsRead,
+	ScopeNotificationsWrite,
+	ScopeEventsRead,
+}
+
+var ScopeDescriptions = map[string]string{
+	ScopeAccountRead:        "Read your username and email",
+	ScopeFollowsRead:        "See who you follow",
+	ScopeFollowsWrite:       "Follow and unfollow users on your behalf",
+	ScopePostsRead:          "Read posts",
+	ScopePostsWrite:         "Create and edit posts on your behalf",
+	ScopeNotificationsRead:  "See your notifications",
+	ScopeNotificationsWrite: "Mark your notifications as read",
+	ScopeEventsRead:         "Receive your notifications, follows and new posts as they happen",
+}
+
+// UnknownScope returns the first scope that is not part of Scopes.
+func UnknownScope(scopes []string) (string, bool) {
+	for _, scope := range scopes {
+		if !hasScope(Scopes, scope) {
+			return scope, true
+		}
+	}
+
+	return "", false
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Subset reports whether every scope of scopes is part of allowed.
+func Subset(scopes, allowed []string) bool {
+	for _, scope := range scopes {
+		if !hasScope(allowed, scope) {
+			return false
+		}
+	}
+
+	return true
+}
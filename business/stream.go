@@ -0,0 +1,20 @@
+package business
+
+import "context"
+
+// Event is pushed to a client over a stream, ID lets it resume after a reconnection.
+type Event struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+// StreamFunc sends events until ctx is done or send fails, the client is gone then.
+type StreamFunc func(ctx context.Context, send func(Event) error) error
+
+// Stream runs from LastEventID on. The client is told that id before any event,
+// so it resumes from there even when the connection drops before the first one.
+type Stream struct {
+	LastEventID string
+	Run         StreamFunc
+}
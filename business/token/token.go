@@ -0,0 +1,165 @@
+package token
+
+import (
+	"context"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/business/auth"
+	"github.com/samuelsih/guwu/model"
+	"github.com/samuelsih/guwu/pkg/securer"
+)
+
+const (
+	MAX_TOKEN_NAME  = 100
+	MAX_EXPIRY_DAYS = 365
+	TOKEN_BYTES     = 32
+)
+
+type Deps struct {
+	DB       *sqlx.DB
+	Identify func(ctx context.Context, in business.CommonInput) (business.Identity, error)
+}
+
+type CreateInput struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"min=0,max=365"`
+}
+
+type CreateOutput struct {
+	business.CommonResponse
+	Token       string            `json:"token"`
+	AccessToken model.AccessToken `json:"access_token"`
+}
+
+func (d *Deps) Create(ctx context.Context, in CreateInput, common business.CommonInput) CreateOutput {
+	var out CreateOutput
+
+	if in.Name == "" || utf8.RuneCountInString(in.Name) > MAX_TOKEN_NAME {
+		out.RawError(400, "name is required and must be at most 100 characters")
+		return out
+	}
+
+	if len(in.Scopes) == 0 {
+		out.RawError(400, "at least one scope is required")
+		return out
+	}
+
+	if scope, unknown := business.UnknownScope(in.Scopes); unknown {
+		out.RawError(400, "unknown scope "+scope)
+		return out
+	}
+
+	if in.ExpiresInDays < 0 || in.ExpiresInDays > MAX_EXPIRY_DAYS {
+		out.RawError(400, "expires_in_days must be between 0 and 365")
+		return out
+	}
+
+	identity, ok := d.sessionIdentity(ctx, common, &out.CommonResponse)
+	if !ok {
+		return out
+	}
+
+	plain, err := securer.RandomToken(auth.PAT_PREFIX, TOKEN_BYTES)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	token := model.AccessToken{
+		UserID:    identity.User.ID,
+		Name:      in.Name,
+		TokenHash: securer.Digest(plain),
+		Scopes:    in.Scopes,
+	}
+
+	if in.ExpiresInDays > 0 {
+		token.ExpiresAt.Time = time.Now().UTC().AddDate(0, 0, in.ExpiresInDays)
+		token.ExpiresAt.Valid = true
+	}
+
+	token, err = model.InsertAccessToken(ctx, d.DB, token)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.Token = plain
+	out.AccessToken = token
+	out.SetOK()
+	return out
+}
+
+type ListOutput struct {
+	business.CommonResponse
+	AccessTokens []model.AccessToken `json:"access_tokens"`
+}
+
+func (d *Deps) List(ctx context.Context, common business.CommonInput) ListOutput {
+	var out ListOutput
+
+	identity, ok := d.sessionIdentity(ctx, common, &out.CommonResponse)
+	if !ok {
+		return out
+	}
+
+	tokens, err := model.ListAccessTokens(ctx, d.DB, identity.User.ID)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.AccessTokens = tokens
+	out.SetOK()
+	return out
+}
+
+type RevokeInput struct {
+	ID string `json:"id" url:"id" validate:"required"`
+}
+
+type RevokeOutput struct {
+	business.CommonResponse
+}
+
+func (d *Deps) Revoke(ctx context.Context, in RevokeInput, common business.CommonInput) RevokeOutput {
+	var out RevokeOutput
+
+	if in.ID == "" {
+		out.RawError(400, "id is required")
+		return out
+	}
+
+	identity, ok := d.sessionIdentity(ctx, common, &out.CommonResponse)
+	if !ok {
+		return out
+	}
+
+	err := model.DeleteAccessToken(ctx, d.DB, identity.User.ID, in.ID)
+	if err != nil {
+		out.SetError(err)
+		return out
+	}
+
+	out.SetOK()
+	return out
+}
+
+// sessionIdentity only accepts session cookies, a leaked token must not be able to mint new ones.
+func (d *Deps) sessionIdentity(ctx context.Context, common business.CommonInput, out *business.CommonResponse) (business.Identity, bool) {
+	identity, err := business.Authenticated(ctx, common, d.Identify)
+	if err != nil {
+		out.SetError(err)
+		return identity, false
+	}
+
+	if identity.SessionID == "" {
+		out.RawError(403, "personal access tokens can only be managed with a session")
+		return identity, false
+	}
+
+	return identity, true
+}
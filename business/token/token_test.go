@@ -0,0 +1,205 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/business/auth"
+	"github.com/samuelsih/guwu/config"
+	"github.com/samuelsih/guwu/model"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+var (
+	testDB   *sqlx.DB
+	testUser model.User
+)
+
+func TestMain(m *testing.M) {
+	cleanup, err := setup()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	code := m.Run()
+
+	if err := cleanup(); err != nil {
+		log.Fatalf("error cleaning up: %v", err)
+	}
+
+	os.Exit(code)
+}
+
+func sessionDeps() Deps {
+	return Deps{
+		DB: testDB,
+		Identify: func(ctx context.Context, in business.CommonInput) (business.Identity, error) {
+			return business.Identity{User: testUser, SessionID: "session"}, nil
+		},
+	}
+}
+
+func TestCreate(t *testing.T) {
+	t.Parallel()
+
+	deps := sessionDeps()
+
+	tests := []struct {
+		name  string
+		input CreateInput
+		want  int
+	}{
+		{"EmptyName", CreateInput{Scopes: []string{business.ScopePostsRead}}, 400},
+		{"EmptyScopes", CreateInput{Name: "ci"}, 400},
+		{"TooLongName", CreateInput{Name: strings.Repeat("a", 101), Scopes: []string{business.ScopePostsRead}}, 400},
+		{"MultibyteName", CreateInput{Name: strings.Repeat("é", 100), Scopes: []string{business.ScopePostsRead}}, 200},
+		{"UnknownScope", CreateInput{Name: "ci", Scopes: []string{"admin"}}, 400},
+		{"TooLongExpiry", CreateInput{Name: "ci", Scopes: []string{business.ScopePostsRead}, ExpiresInDays: 1000}, 400},
+		{"Success", CreateInput{Name: "ci", Scopes: []string{business.ScopePostsRead}, ExpiresInDays: 30}, 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := deps.Create(context.Background(), tt.input, business.CommonInput{SessionID: "session"})
+			if out.StatusCode != tt.want {
+				t.Fatalf("TestCreate.%s - expected %d, got %v", tt.name, tt.want, out)
+			}
+		})
+	}
+
+	t.Run("WithToken", func(t *testing.T) {
+		tokenDeps := Deps{
+			DB: testDB,
+			Identify: func(ctx context.Context, in business.CommonInput) (business.Identity, error) {
+				return business.Identity{User: testUser, TokenID: "123", Scopes: business.Scopes}, nil
+			},
+		}
+
+		out := tokenDeps.Create(context.Background(), CreateInput{Name: "ci", Scopes: []string{business.ScopePostsRead}}, business.CommonInput{AccessToken: "x"})
+		if out.StatusCode != 403 {
+			t.Fatalf("TestCreate.WithToken - expected 403, got %v", out)
+		}
+	})
+}
+
+func TestTokenLifecycle(t *testing.T) {
+	t.Parallel()
+
+	deps := sessionDeps()
+	authDeps := auth.Deps{DB: testDB}
+
+	created := deps.Create(context.Background(), CreateInput{Name: "script", Scopes: []string{business.ScopeFollowsWrite}}, business.CommonInput{SessionID: "session"})
+	if created.StatusCode != 200 || created.Token == "" {
+		t.Fatalf("TestTokenLifecycle.Create - expected 200, got %v", created)
+	}
+
+	identity, err := authDeps.Identify(context.Background(), business.CommonInput{AccessToken: created.Token})
+	if err != nil {
+		t.Fatalf("TestTokenLifecycle.Identify - expected nil, got %v", err)
+	}
+
+	if identity.User.ID != testUser.ID || !identity.Can(business.ScopeFollowsWrite) || identity.Can(business.ScopePostsWrite) {
+		t.Fatalf("TestTokenLifecycle.Identify - unexpected identity %v", identity)
+	}
+
+	list := deps.List(context.Background(), business.CommonInput{SessionID: "session"})
+	if list.StatusCode != 200 {
+		t.Fatalf("TestTokenLifecycle.List - expected 200, got %v", list)
+	}
+
+	var found model.AccessToken
+	for _, token := range list.AccessTokens {
+		if token.ID == created.AccessToken.ID {
+			found = token
+		}
+	}
+
+	if !found.LastUsedAt.Valid {
+		t.Fatalf("TestTokenLifecycle.List - expected last_used_at to be set, got %v", found)
+	}
+
+	revoked := deps.Revoke(context.Background(), RevokeInput{ID: created.AccessToken.ID}, business.CommonInput{SessionID: "session"})
+	if revoked.StatusCode != 200 {
+		t.Fatalf("TestTokenLifecycle.Revoke - expected 200, got %v", revoked)
+	}
+
+	if _, err := authDeps.Identify(context.Background(), business.CommonInput{AccessToken: created.Token}); err == nil {
+		t.Fatal("TestTokenLifecycle.Identify - revoked token must not identify")
+	}
+
+	again := deps.Revoke(context.Background(), RevokeInput{ID: created.AccessToken.ID}, business.CommonInput{SessionID: "session"})
+	if again.StatusCode != 404 {
+		t.Fatalf("TestTokenLifecycle.Revoke - expected 404, got %v", again)
+	}
+}
+
+func setup() (func() error, error) {
+	ctx := context.Background()
+
+	req := testcontainers.ContainerRequest{
+		Image:        "postgres:latest",
+		ExposedPorts: []string{"5432/tcp"},
+		WaitingFor:   wait.ForListeningPort("5432/tcp"),
+		Env: map[string]string{
+			"POSTGRES_DB":       "testdb",
+			"POSTGRES_PASSWORD": "postgres",
+			"POSTGRES_USER":     "postgres",
+		},
+	}
+
+	container, err := testcontainers.GenericContainer(
+		ctx,
+		testcontainers.GenericContainerRequest{
+			ContainerRequest: req,
+			Started:          true,
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	mappedPort, err := container.MappedPort(ctx, "5432")
+	if err != nil {
+		return nil, err
+	}
+
+	hostIP, err := container.Host(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	uri := fmt.Sprintf("postgres://postgres:postgres@%v:%v/testdb?sslmode=disable", hostIP, mappedPort.Port())
+
+	testDB = config.ConnectPostgres(uri)
+	if testDB == nil {
+		return nil, errors.New("cannot connect testGuestDB")
+	}
+
+	if err := config.LoadPostgresExtension(testDB); err != nil {
+		return nil, errors.New("cannot load postgres extension")
+	}
+
+	if err := config.MigrateAll(testDB); err != nil {
+		return nil, err
+	}
+
+	testUser, err = model.InsertUser(ctx, testDB, "tokenowner", "tokenowner@gmail.com", "$2a$07$GsdzeF04uKNmPyEf1R.WUOZF.i9Xhpx6peu3NBMN7NdPe//tWEfY", "en")
+	if err != nil {
+		return nil, err
+	}
+
+	cleanup := func() error {
+		return container.Terminate(ctx)
+	}
+
+	return cleanup, nil
+}
@@ -0,0 +1,173 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/samuelsih/guwu/business/auth"
+	"github.com/samuelsih/guwu/business/follow"
+	"github.com/samuelsih/guwu/business/post"
+	"github.com/samuelsih/guwu/business/token"
+	"github.com/samuelsih/guwu/pkg/request"
+)
+
+func (c *Client) Register(ctx context.Context, in auth.RegisterInput) (auth.RegisterOutput, error) {
+	var out auth.RegisterOutput
+	err := c.call(ctx, "client.Register", http.MethodPost, "/register", nil, in, &out)
+	return out, err
+}
+
+// Login keeps the session, the next calls are authenticated with it unless a token is set.
+func (c *Client) Login(ctx context.Context, in auth.LoginInput) (auth.LoginOutput, error) {
+	var out auth.LoginOutput
+	err := c.call(ctx, "client.Login", http.MethodPost, "/login", nil, in, &out)
+	return out, err
+}
+
+func (c *Client) Logout(ctx context.Context) (auth.LogoutOutput, error) {
+	var out auth.LogoutOutput
+	err := c.call(ctx, "client.Logout", http.MethodDelete, "/logout", nil, nil, &out)
+	return out, err
+}
+
+func (c *Client) WhoAmI(ctx context.Context) (auth.PersonalOut, error) {
+	var out auth.PersonalOut
+	err := c.call(ctx, "client.WhoAmI", http.MethodGet, "/whoami", nil, nil, &out)
+	return out, err
+}
+
+func (c *Client) Follow(ctx context.Context, in follow.FollowIn) (follow.FollowOut, error) {
+	var out follow.FollowOut
+	err := c.call(ctx, "client.Follow", http.MethodPost, "/follow", nil, in, &out)
+	return out, err
+}
+
+func (c *Client) Unfollow(ctx context.Context, userID string) (follow.UnfollowOut, error) {
+	var out follow.UnfollowOut
+	err := c.call(ctx, "client.Unfollow", http.MethodDelete, "/follow/"+url.PathEscape(userID), nil, nil, &out)
+	return out, err
+}
+
+func (c *Client) CreateToken(ctx context.Context, in token.CreateInput) (token.CreateOutput, error) {
+	var out token.CreateOutput
+	err := c.call(ctx, "client.CreateToken", http.MethodPost, "/tokens", nil, in, &out)
+	return out, err
+}
+
+func (c *Client) ListTokens(ctx context.Context) (token.ListOutput, error) {
+	var out token.ListOutput
+	err := c.call(ctx, "client.ListTokens", http.MethodGet, "/tokens", nil, nil, &out)
+	return out, err
+}
+
+func (c *Client) RevokeToken(ctx context.Context, id string) (token.RevokeOutput, error) {
+	var out token.RevokeOutput
+	err := c.call(ctx, "client.RevokeToken", http.MethodDelete, "/tokens/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+func (c *Client) CreatePost(ctx context.Context, in post.CreateInput) (post.PostOutput, error) {
+	var out post.PostOutput
+	err := c.call(ctx, "client.CreatePost", http.MethodPost, "/posts", nil, in, &out)
+	return out, err
+}
+
+func (c *Client) GetPost(ctx context.Context, id string) (post.PostOutput, error) {
+	var out post.PostOutput
+	err := c.call(ctx, "client.GetPost", http.MethodGet, "/posts/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+// ListUserPosts pages through the posts of a user, a zero limit takes the server default.
+func (c *Client) ListUserPosts(ctx context.Context, userID string, limit, offset int) (post.ListOutput, error) {
+	var out post.ListOutput
+	err := c.call(ctx, "client.ListUserPosts", http.MethodGet, "/users/"+url.PathEscape(userID)+"/posts", pageQuery(limit, offset), nil, &out)
+	return out, err
+}
+
+// Feed pages through the posts of the followed users, a zero limit takes the server default.
+func (c *Client) Feed(ctx context.Context, limit, offset int) (post.ListOutput, error) {
+	var out post.ListOutput
+	err := c.call(ctx, "client.Feed", http.MethodGet, "/feed", pageQuery(limit, offset), nil, &out)
+	return out, err
+}
+
+func (c *Client) ReplacePost(ctx context.Context, id string, in post.ReplaceInput) (post.PostOutput, error) {
+	var out post.PostOutput
+	err := c.call(ctx, "client.ReplacePost", http.MethodPut, "/posts/"+url.PathEscape(id), nil, in, &out)
+	return out, err
+}
+
+// UpdatePost sends only the fields of in that are set.
+func (c *Client) UpdatePost(ctx context.Context, id string, in post.UpdateInput) (post.PostOutput, error) {
+	var out post.PostOutput
+	err := c.call(ctx, "client.UpdatePost", http.MethodPatch, "/posts/"+url.PathEscape(id), nil, in, &out)
+	return out, err
+}
+
+func (c *Client) DeletePost(ctx context.Context, id string) (post.DeleteOutput, error) {
+	var out post.DeleteOutput
+	err := c.call(ctx, "client.DeletePost", http.MethodDelete, "/posts/"+url.PathEscape(id), nil, nil, &out)
+	return out, err
+}
+
+func pageQuery(limit, offset int) url.Values {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	if offset > 0 {
+		query.Set("offset", strconv.Itoa(offset))
+	}
+
+	return query
+}
+
+// mergePatch encodes in as a JSON Merge Patch, leaving out the patch fields that are not set.
+func mergePatch(in any) ([]byte, error) {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(in))
+	if v.Kind() != reflect.Struct {
+		return data, nil
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		patch, ok := v.Field(i).Interface().(request.PatchField)
+		if !ok {
+			continue
+		}
+
+		if _, set, _ := patch.PatchValue(); set {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" {
+			name = field.Name
+		}
+
+		delete(fields, name)
+	}
+
+	return json.Marshal(fields)
+}
@@ -0,0 +1,291 @@
+// Package client calls the guwu HTTP API with the input and output types of the business packages.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samuelsih/guwu/pkg/errs"
+	"github.com/samuelsih/guwu/pkg/request"
+)
+
+const (
+	DEFAULT_MAX_RETRIES = 3
+	DEFAULT_BACKOFF     = 200 * time.Millisecond
+	MAX_BACKOFF         = 5 * time.Second
+
+	sessionCookie = "sid"
+)
+
+var errEmptyBaseURL = errors.New("base url is required")
+
+type Config struct {
+	BaseURL    string
+	HTTPClient *http.Client
+
+	// Token is a personal access token or an OAuth access token sent as bearer,
+	// without one the client uses the session of Login.
+	Token string
+
+	// MaxRetries and Backoff apply to idempotent calls failing on the network or with 502, 503 or 504.
+	// A negative MaxRetries disables retries.
+	MaxRetries int
+	Backoff    time.Duration
+}
+
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	maxRetries int
+	backoff    time.Duration
+
+	mu      sync.RWMutex
+	token   string
+	session string
+}
+
+func New(cfg Config) (*Client, error) {
+	if cfg.BaseURL == "" {
+		return nil, errEmptyBaseURL
+	}
+
+	baseURL, err := url.Parse(strings.TrimSuffix(cfg.BaseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url: %w", err)
+	}
+
+	c := &Client{
+		baseURL:    baseURL,
+		httpClient: cfg.HTTPClient,
+		maxRetries: cfg.MaxRetries,
+		backoff:    cfg.Backoff,
+		token:      cfg.Token,
+	}
+
+	if c.httpClient == nil {
+		c.httpClient = http.DefaultClient
+	}
+
+	if c.maxRetries == 0 {
+		c.maxRetries = DEFAULT_MAX_RETRIES
+	}
+
+	if c.backoff <= 0 {
+		c.backoff = DEFAULT_BACKOFF
+	}
+
+	return c, nil
+}
+
+// SetToken switches the client to bearer authentication.
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = token
+}
+
+// Session returns the encrypted session id kept since Login, to be restored with SetSession.
+func (c *Client) Session() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.session
+}
+
+func (c *Client) SetSession(session string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.session = session
+}
+
+// call sends in as the body, when not nil, and decodes the response into out.
+func (c *Client) call(ctx context.Context, op errs.Op, method, path string, query url.Values, in, out any) error {
+	var body []byte
+	var contentType string
+
+	if in != nil {
+		var err error
+
+		body, contentType, err = encodeBody(method, in)
+		if err != nil {
+			return errs.E(op, errs.KindBadRequest, err, "cannot encode request")
+		}
+	}
+
+	endpoint := c.baseURL.JoinPath(path)
+	endpoint.RawQuery = query.Encode()
+
+	res, err := c.send(ctx, method, endpoint.String(), body, contentType)
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot reach guwu")
+	}
+
+	defer res.Body.Close()
+
+	c.keepSession(res)
+
+	if res.StatusCode >= 400 {
+		return decodeError(op, res)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return errs.E(op, errs.KindUnexpected, err, "cannot decode response")
+	}
+
+	return nil
+}
+
+// send retries idempotent requests with an exponential backoff and jitter.
+func (c *Client) send(ctx context.Context, method, endpoint string, body []byte, contentType string) (*http.Response, error) {
+	retries := 0
+	if idempotent(method) && c.maxRetries > 0 {
+		retries = c.maxRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Accept", "application/json, application/problem+json")
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		c.authorize(req)
+
+		res, err := c.httpClient.Do(req)
+		if attempt >= retries || !retryable(res, err) {
+			return res, err
+		}
+
+		if res != nil {
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(c.delay(attempt)):
+		}
+	}
+}
+
+func (c *Client) delay(attempt int) time.Duration {
+	backoff := c.backoff << attempt
+	if backoff <= 0 || backoff > MAX_BACKOFF {
+		backoff = MAX_BACKOFF
+	}
+
+	// full jitter keeps retrying clients from hitting the server together
+	return time.Duration(rand.Int63n(int64(backoff)) + 1)
+}
+
+func (c *Client) authorize(req *http.Request) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		return
+	}
+
+	if c.session != "" {
+		req.AddCookie(&http.Cookie{Name: sessionCookie, Value: c.session})
+	}
+}
+
+// keepSession follows the sid cookie set on login, sliding renewals and logout.
+func (c *Client) keepSession(res *http.Response) {
+	for _, cookie := range res.Cookies() {
+		if cookie.Name != sessionCookie {
+			continue
+		}
+
+		if cookie.MaxAge < 0 || cookie.Value == "" {
+			c.SetSession("")
+			continue
+		}
+
+		c.SetSession(cookie.Value)
+	}
+}
+
+// decodeError maps problem details, or the legacy {code, message} envelope, to an errs.Error of the status kind.
+// Validation failures are wrapped as a *request.ValidationError.
+func decodeError(op errs.Op, res *http.Response) error {
+	var body struct {
+		Title   string               `json:"title"`
+		Detail  string               `json:"detail"`
+		Message string               `json:"message"`
+		Errors  []request.FieldError `json:"errors"`
+	}
+
+	_ = json.NewDecoder(res.Body).Decode(&body)
+
+	message := body.Detail
+	if message == "" {
+		message = body.Message
+	}
+
+	if message == "" {
+		message = http.StatusText(res.StatusCode)
+	}
+
+	var err error = errors.New(message)
+	if len(body.Errors) > 0 {
+		err = &request.ValidationError{Fields: body.Errors}
+	}
+
+	return errs.E(op, res.StatusCode, err, message)
+}
+
+func encodeBody(method string, in any) ([]byte, string, error) {
+	if method == http.MethodPatch {
+		body, err := mergePatch(in)
+		return body, "application/merge-patch+json", err
+	}
+
+	body, err := json.Marshal(in)
+	return body, "application/json", err
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+
+	return false
+}
+
+func retryable(res *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	switch res.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
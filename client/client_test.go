@@ -0,0 +1,211 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/business/auth"
+	"github.com/samuelsih/guwu/business/post"
+	"github.com/samuelsih/guwu/pkg/errs"
+	"github.com/samuelsih/guwu/pkg/request"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	c, err := New(Config{BaseURL: server.URL, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestSession(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "encrypted", MaxAge: 60})
+			json.NewEncoder(w).Encode(map[string]any{"code": 200, "message": "OK"})
+
+		case "/whoami":
+			cookie, err := r.Cookie("sid")
+			if err != nil || cookie.Value != "encrypted" {
+				w.WriteHeader(401)
+				return
+			}
+
+			json.NewEncoder(w).Encode(map[string]any{"code": 200, "username": "bob"})
+
+		case "/logout":
+			http.SetCookie(w, &http.Cookie{Name: "sid", MaxAge: -1})
+			json.NewEncoder(w).Encode(map[string]any{"code": 200})
+		}
+	})
+
+	if _, err := c.Login(context.Background(), auth.LoginInput{Email: "bob@mail.com", Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	who, err := c.WhoAmI(context.Background())
+	if err != nil || who.Username != "bob" {
+		t.Fatalf("expected bob, got %v %v", who, err)
+	}
+
+	if _, err := c.Logout(context.Background()); err != nil || c.Session() != "" {
+		t.Fatalf("expected the session dropped, got %q %v", c.Session(), err)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer guwu_pat_123" {
+			w.WriteHeader(401)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{"code": 200, "username": "token"})
+	})
+
+	c.SetToken("guwu_pat_123")
+
+	if who, err := c.WhoAmI(context.Background()); err != nil || who.Username != "token" {
+		t.Fatalf("expected token, got %v %v", who, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		status      int
+		body        string
+		message     string
+		fields      int
+	}{
+		{"Problem", "application/problem+json", 404, `{"type":"/problems/not-found","title":"Not Found","status":404,"detail":"post not found"}`, "post not found", 0},
+		{"Validation", "application/problem+json", 400, `{"status":400,"detail":"description is required","errors":[{"field":"description","rule":"required","message":"description is required"}]}`, "description is required", 1},
+		{"Legacy", "application/json", 403, `{"code":403,"message":"token is missing scope posts:write"}`, "token is missing scope posts:write", 0},
+		{"Empty", "text/plain", 500, ``, "Internal Server Error", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			})
+
+			_, err := c.CreatePost(context.Background(), post.CreateInput{})
+
+			var e *errs.Error
+			if !errors.As(err, &e) || e.Kind != tt.status || e.Error() != tt.message {
+				t.Fatalf("expected kind %d %q, got %v", tt.status, tt.message, err)
+			}
+
+			var validationErr *request.ValidationError
+			if errors.As(e.Err, &validationErr) != (tt.fields > 0) {
+				t.Fatalf("expected %d field errors, got %v", tt.fields, e.Err)
+			}
+		})
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var calls int32
+
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{"code": 200})
+	})
+
+	if _, err := c.GetPost(context.Background(), "1"); err != nil || atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("expected success on the third call, got %d calls %v", calls, err)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+
+	if _, err := c.CreatePost(context.Background(), post.CreateInput{Description: "hi"}); errs.GetKind(err) != 503 || atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("expected POST not retried, got %d calls %v", calls, err)
+	}
+}
+
+func TestUpdatePostMergePatch(t *testing.T) {
+	var got map[string]any
+	var contentType string
+
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&got)
+		json.NewEncoder(w).Encode(map[string]any{"code": 200})
+	})
+
+	if _, err := c.UpdatePost(context.Background(), "1", post.UpdateInput{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if contentType != "application/merge-patch+json" || len(got) != 0 {
+		t.Fatalf("expected an empty merge patch, got %s %v", contentType, got)
+	}
+
+	in := post.UpdateInput{Description: business.Optional[string]{Set: true, Value: "edited"}}
+	if _, err := c.UpdatePost(context.Background(), "1", in); err != nil {
+		t.Fatal(err)
+	}
+
+	if got["description"] != "edited" {
+		t.Fatalf("expected the description sent, got %v", got)
+	}
+}
+
+func TestFollows(t *testing.T) {
+	var method, path, query string
+
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		method, path, query = r.Method, r.URL.Path, r.URL.RawQuery
+
+		if r.URL.Path == "/feed" {
+			json.NewEncoder(w).Encode(map[string]any{"code": 200, "posts": []map[string]any{{"id": "p1", "user_id": "u1"}}})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{"code": 200})
+	})
+
+	if _, err := c.Unfollow(context.Background(), "u1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if method != http.MethodDelete || path != "/follow/u1" {
+		t.Fatalf("expected DELETE /follow/u1, got %s %s", method, path)
+	}
+
+	feed, err := c.Feed(context.Background(), 10, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if method != http.MethodGet || path != "/feed" || query != "limit=10&offset=20" {
+		t.Fatalf("expected GET /feed?limit=10&offset=20, got %s %s?%s", method, path, query)
+	}
+
+	if len(feed.Posts) != 1 || feed.Posts[0].ID != "p1" {
+		t.Fatalf("unexpected feed %v", feed)
+	}
+}
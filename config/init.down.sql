@@ -1,2 +1,11 @@
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS email_digests;
+DROP TABLE IF EXISTS email_preferences;
+DROP TABLE IF EXISTS mail_outbox;
+DROP TABLE IF EXISTS user_follows;
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS oauth_refresh_tokens;
+DROP TABLE IF EXISTS oauth_clients;
+DROP TABLE IF EXISTS personal_access_tokens;
 DROP TABLE IF EXISTS posts;
 DROP TABLE IF EXISTS users;
\ No newline at end of file
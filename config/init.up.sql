@@ -2,21 +2,33 @@ DROP TABLE IF EXISTS posts cascade;
 DROP TABLE IF EXISTS users cascade;
 DROP TABLE IF EXISTS posts cascade;
 DROP TABLE IF EXISTS user_follows cascade;
+DROP TABLE IF EXISTS personal_access_tokens cascade;
+DROP TABLE IF EXISTS oauth_clients cascade;
+DROP TABLE IF EXISTS oauth_refresh_tokens cascade;
+DROP TABLE IF EXISTS user_identities cascade;
+DROP TABLE IF EXISTS mail_outbox cascade;
+DROP TABLE IF EXISTS email_preferences cascade;
+DROP TABLE IF EXISTS email_digests cascade;
+DROP TABLE IF EXISTS notifications cascade;
 
 CREATE TABLE IF NOT EXISTS users (
     id varchar(100) not null primary key default uuid_generate_v4(),
     username varchar(255) not null,
     email varchar(255) not null unique,
-    password varchar(255) not null,
+    password varchar(255) default null,
+    bio varchar(500) default null,
+    locale varchar(35) not null default 'en',
+    is_admin boolean not null default false,
     created_at timestamp not null default now(),
-    updated_at timestamp default null
+    updated_at timestamp default null,
+    deletion_scheduled_at timestamp default null
 );
 
 CREATE TABLE IF NOT EXISTS posts (
     id varchar(100) not null primary key,
     user_id varchar(100) not null,
     description text not null,
-    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
     created_at timestamp not null default now(),
     updated_at timestamp default null
 );
@@ -25,6 +37,112 @@ CREATE TABLE IF NOT EXISTS user_follows (
     user_id varchar(100) not null,
     user_follow_id varchar(100) not null,
     created_at timestamp not null default now(),
-    FOREIGN KEY (user_id) REFERENCES users(id),
-    FOREIGN KEY (user_follow_id) REFERENCES users(id)
-);
\ No newline at end of file
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_follow_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+    id varchar(100) not null primary key default uuid_generate_v4(),
+    user_id varchar(100) not null,
+    name varchar(255) not null,
+    token_hash varchar(64) not null unique,
+    scopes text[] not null default '{}',
+    expires_at timestamp default null,
+    last_used_at timestamp default null,
+    created_at timestamp not null default now(),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id varchar(100) not null primary key default uuid_generate_v4(),
+    user_id varchar(100) not null,
+    name varchar(255) not null,
+    secret_hash varchar(64) default null,
+    redirect_uris text[] not null,
+    scopes text[] not null,
+    created_at timestamp not null default now(),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS oauth_refresh_tokens (
+    id varchar(100) not null primary key default uuid_generate_v4(),
+    token_hash varchar(64) not null unique,
+    family_id varchar(100) not null,
+    client_id varchar(100) not null,
+    user_id varchar(100) not null,
+    scopes text[] not null,
+    expires_at timestamp not null,
+    revoked_at timestamp default null,
+    created_at timestamp not null default now(),
+    FOREIGN KEY (client_id) REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS oauth_refresh_tokens_family_idx ON oauth_refresh_tokens(family_id);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id varchar(100) not null primary key default uuid_generate_v4(),
+    user_id varchar(100) not null,
+    provider varchar(100) not null,
+    subject varchar(255) not null,
+    email varchar(255) not null default '',
+    created_at timestamp not null default now(),
+    UNIQUE (provider, subject),
+    UNIQUE (user_id, provider),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS mail_outbox (
+    id varchar(100) not null primary key default uuid_generate_v4(),
+    template int not null,
+    user_id varchar(100) default null,
+    recipient_name varchar(255) not null,
+    recipient_email varchar(255) not null,
+    locale varchar(35) not null default 'en',
+    subject varchar(255) not null,
+    data jsonb not null default '{}',
+    status varchar(20) not null default 'pending',
+    attempts int not null default 0,
+    last_error text default null,
+    next_attempt_at timestamp not null default now(),
+    locked_until timestamp default null,
+    created_at timestamp not null default now(),
+    sent_at timestamp default null,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS mail_outbox_due_idx ON mail_outbox(status, next_attempt_at);
+
+CREATE TABLE IF NOT EXISTS email_preferences (
+    user_id varchar(100) not null,
+    category varchar(50) not null,
+    enabled boolean not null,
+    updated_at timestamp not null default now(),
+    PRIMARY KEY (user_id, category),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS email_digests (
+    user_id varchar(100) not null primary key,
+    frequency varchar(10) not null default 'weekly',
+    last_sent_at timestamp default null,
+    updated_at timestamp not null default now(),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id varchar(100) not null primary key,
+    user_id varchar(100) not null,
+    type varchar(20) not null,
+    subject_id varchar(100) not null default '',
+    actor_id varchar(100) not null,
+    actor_ids text[] not null,
+    read_at timestamp default null,
+    created_at timestamp not null default now(),
+    updated_at timestamp not null default now(),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS notifications_user_idx ON notifications(user_id, updated_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS notifications_group_idx ON notifications(user_id, type, subject_id) WHERE read_at IS NULL;
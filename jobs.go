@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samuelsih/guwu/business/digest"
+	"github.com/samuelsih/guwu/business/outbox"
+	"github.com/samuelsih/guwu/pkg/logger"
+	"github.com/samuelsih/guwu/pkg/redis"
+)
+
+const (
+	purgeAccountsInterval = 1 * time.Hour
+	deliverMailInterval   = 5 * time.Second
+	sendDigestInterval    = 15 * time.Minute
+	deadLetterListLimit   = 100
+)
+
+type jobFunc func(ctx context.Context) error
+
+type job struct {
+	name     string
+	interval time.Duration
+	run      jobFunc
+}
+
+func loadJobs(ctx context.Context, deps Dependencies) {
+	for _, j := range jobs(deps) {
+		runEvery(ctx, j.name, j.interval, j.run)
+	}
+}
+
+// jobs lists the background work of the server, purging accounts revokes their sessions too.
+func jobs(deps Dependencies) []job {
+	authDeps := sessionDeps(deps.DB, redis.NewClient(deps.Redis))
+
+	outboxDeps := outbox.Deps{
+		DB:        deps.DB,
+		SendEmail: deps.Mailer.Send,
+	}
+
+	digestDeps := digest.Deps{
+		DB: deps.DB,
+	}
+
+	return []job{
+		{name: "purge deleted accounts", interval: purgeAccountsInterval, run: authDeps.PurgeDeletedAccounts},
+		{name: "deliver mails", interval: deliverMailInterval, run: outboxDeps.Deliver},
+		{name: "send digests", interval: sendDigestInterval, run: digestDeps.Send},
+	}
+}
+
+func runEvery(ctx context.Context, name string, interval time.Duration, job jobFunc) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			runJob(ctx, name, job)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// runJob keeps a panicking job from taking the server down, it runs again at the next tick.
+func runJob(ctx context.Context, name string, job jobFunc) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("panic on job %s: %v", name, r)
+		}
+	}()
+
+	if err := job(ctx); err != nil {
+		logger.Errorf("error on job %s: %v", name, err)
+	}
+}
+
+// runOutboxCommand prints the dead-lettered mails, or replays them when replay is "all" or a comma separated list of ids.
+func runOutboxCommand(ctx context.Context, db *sqlx.DB, replay string) error {
+	deps := outbox.Deps{DB: db}
+
+	if replay == "" {
+		mails, err := deps.DeadLetters(ctx, deadLetterListLimit)
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		for _, m := range mails {
+			if err := enc.Encode(m); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	var ids []string
+	if replay != "all" {
+		ids = strings.Split(replay, ",")
+	}
+
+	replayed, err := deps.Replay(ctx, ids...)
+	if err != nil {
+		return err
+	}
+
+	logger.SysInfof("replayed %d mails", replayed)
+	return nil
+}
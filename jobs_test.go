@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/samuelsih/guwu/business/auth"
+	"github.com/samuelsih/guwu/config"
+	"github.com/samuelsih/guwu/model"
+	"github.com/samuelsih/guwu/pkg/redis"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+func TestPurgeJobRevokesSessions(t *testing.T) {
+	ctx := context.Background()
+	deps := setupJobDeps(t)
+	rdb := redis.NewClient(deps.Redis)
+
+	user, err := model.InsertUser(ctx, deps.DB, "purged", "purged@gmail.com", "", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rdb.SetJSON(ctx, "purged-session", user, int64(auth.SESS_MAX_AGE)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rdb.AddMember(ctx, auth.SESS_INDEX_PREFIX+user.ID, "purged-session", int64(auth.SESS_MAX_AGE)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := model.ScheduleUserDeletion(ctx, deps.DB, user.ID, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	var purge jobFunc
+	for _, j := range jobs(deps) {
+		if j.name == "purge deleted accounts" {
+			purge = j.run
+		}
+	}
+
+	if purge == nil {
+		t.Fatal("expected a purge job")
+	}
+
+	if err := purge(ctx); err != nil {
+		t.Fatalf("expected the purge to succeed, got %v", err)
+	}
+
+	if exists, err := rdb.Exists(ctx, "purged-session"); err != nil || exists {
+		t.Fatalf("expected the session of the purged user destroyed, got %v %v", exists, err)
+	}
+}
+
+// setupJobDeps starts the Postgres and Redis the jobs run against.
+func setupJobDeps(t *testing.T) Dependencies {
+	t.Helper()
+
+	ctx := context.Background()
+
+	postgres, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "postgres:latest",
+			ExposedPorts: []string{"5432/tcp"},
+			WaitingFor:   wait.ForListeningPort("5432/tcp"),
+			Env: map[string]string{
+				"POSTGRES_DB":       "testdb",
+				"POSTGRES_PASSWORD": "postgres",
+				"POSTGRES_USER":     "postgres",
+			},
+		},
+		Started: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { postgres.Terminate(ctx) })
+
+	redisContainer, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "redis",
+			ExposedPorts: []string{"6379/tcp"},
+			WaitingFor:   wait.ForLog("* Ready to accept connections"),
+		},
+		Started: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { redisContainer.Terminate(ctx) })
+
+	pgPort, err := postgres.MappedPort(ctx, "5432")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pgHost, err := postgres.Host(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := config.ConnectPostgres(fmt.Sprintf("postgres://postgres:postgres@%v:%v/testdb?sslmode=disable", pgHost, pgPort.Port()))
+	if db == nil {
+		t.Fatal("cannot connect to postgres")
+	}
+
+	if err := config.LoadPostgresExtension(db); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := config.MigrateAll(db); err != nil {
+		t.Fatal(err)
+	}
+
+	redisPort, err := redisContainer.MappedPort(ctx, "6379")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	redisHost, err := redisContainer.Host(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rdb := config.NewRedis(fmt.Sprintf("%s:%s", redisHost, redisPort.Port()), "")
+	if rdb == nil {
+		t.Fatal("cannot connect to redis")
+	}
+
+	t.Cleanup(rdb.Close)
+
+	return Dependencies{DB: db, Redis: rdb}
+}
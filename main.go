@@ -1,18 +1,33 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
 	"github.com/go-chi/chi/v5"
+	"github.com/samuelsih/guwu/business/preference"
 	"github.com/samuelsih/guwu/config"
 	"github.com/samuelsih/guwu/pkg/env"
 	"github.com/samuelsih/guwu/pkg/logger"
 	"github.com/samuelsih/guwu/pkg/mail"
+	"github.com/samuelsih/guwu/pkg/notification"
+	"github.com/samuelsih/guwu/pkg/oidc"
+	"github.com/samuelsih/guwu/pkg/password"
 	"github.com/samuelsih/guwu/pkg/securer"
+	pr "github.com/samuelsih/guwu/presentation"
 )
 
 var (
 	debug     = flag.Bool("debug", false, "set log level to debug")
 	remigrate = flag.Bool("fresh", false, "drop all table and migrate")
+
+	outboxDead   = flag.Bool("outbox-dead", false, "print the dead-lettered mails and exit")
+	outboxReplay = flag.String("outbox-replay", "", "requeue the dead-lettered mails, all or comma separated ids, and exit")
 )
 
 type EnvConfig struct {
@@ -27,6 +42,48 @@ type EnvConfig struct {
 	MailPassword  string `env:"MAIL_PASSWORD" default:""`
 	MailEmail     string `env:"MAIL_EMAIL" default:"info@company.com"`
 	TOTPSecret    string `env:"TOTP_SECRET" default:"4S62BZNFXXSZLCRO"`
+
+	// MailTemplateDir holds files replacing the embedded mail templates of the same path.
+	MailTemplateDir string `env:"MAIL_TEMPLATE_DIR" default:""`
+	// MailDriver is smtp, file (a maildir at MailDir), memory or log.
+	MailDriver string `env:"MAIL_DRIVER" default:"smtp"`
+	MailDir    string `env:"MAIL_DIR" default:"mails"`
+
+	// DKIM signs the mails when DKIMDomain is set, with DKIMPrivateKey or else the PEM file at DKIMKeyFile.
+	// DKIMHeaders are the comma separated headers to sign, mail.DefaultDKIMHeaders when empty.
+	DKIMDomain     string `env:"DKIM_DOMAIN" default:""`
+	DKIMSelector   string `env:"DKIM_SELECTOR" default:"guwu"`
+	DKIMPrivateKey string `env:"DKIM_PRIVATE_KEY" default:""`
+	DKIMKeyFile    string `env:"DKIM_KEY_FILE" default:""`
+	DKIMHeaders    string `env:"DKIM_HEADERS" default:""`
+
+	// NotificationDrivers are the comma separated push providers: pusher, webhook, memory or log.
+	// Every one of them is sent NotificationRetries times at most, waiting NotificationRetryDelayMS then twice as long.
+	NotificationDrivers       string `env:"NOTIFICATION_DRIVERS" default:""`
+	NotificationRetries       int    `env:"NOTIFICATION_RETRIES" default:"3"`
+	NotificationRetryDelayMS  int    `env:"NOTIFICATION_RETRY_DELAY_MS" default:"500"`
+	PusherInstanceID          string `env:"PUSHER_INSTANCE_ID" default:""`
+	PusherSecretKey           string `env:"PUSHER_SECRET_KEY" default:""`
+	PusherBaseURL             string `env:"PUSHER_BASE_URL" default:""`
+	NotificationWebhookURL    string `env:"NOTIFICATION_WEBHOOK_URL" default:""`
+	NotificationWebhookSecret string `env:"NOTIFICATION_WEBHOOK_SECRET" default:""`
+
+	// PublicURL is where the API is reached from outside, the links of the mails start with it.
+	PublicURL string `env:"PUBLIC_URL" default:"http://localhost:8080"`
+
+	PasswordAlgorithm string `env:"PASSWORD_ALGORITHM" default:"argon2id"`
+	Argon2Memory      int    `env:"ARGON2_MEMORY" default:"65536"`
+	Argon2Iterations  int    `env:"ARGON2_ITERATIONS" default:"3"`
+	Argon2Parallelism int    `env:"ARGON2_PARALLELISM" default:"2"`
+	BcryptCost        int    `env:"BCRYPT_COST" default:"10"`
+
+	// OIDC_PROVIDERS is a comma separated list of names, each one configured with
+	// OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID and OIDC_<NAME>_CLIENT_SECRET.
+	OIDCProviders   string `env:"OIDC_PROVIDERS" default:""`
+	OIDCRedirectURL string `env:"OIDC_REDIRECT_URL" default:"http://localhost:3000/auth/callback"`
+
+	// ERROR_FORMAT is problem for RFC 7807 bodies, or legacy for the former {code, message} envelope.
+	ErrorFormat string `env:"ERROR_FORMAT" default:"problem"`
 }
 
 func main() {
@@ -42,14 +99,48 @@ func main() {
 	}
 
 	db := config.ConnectPostgres(e.Dsn)
+
+	if *outboxDead || *outboxReplay != "" {
+		if err := runOutboxCommand(context.Background(), db, *outboxReplay); err != nil {
+			logger.SysFatal("error on outbox: %v", err)
+		}
+
+		return
+	}
+
 	securer.SetSecret(e.SecretKey)
+
+	if err := password.SetConfig(passwordConfig(e)); err != nil {
+		logger.SysFatal("error password config: " + err.Error())
+	}
+
+	pr.SetLegacyErrors(e.ErrorFormat == "legacy")
+
 	redisDB := config.NewRedis(e.RedisHost, e.RedisPassword)
 
-	mailer, err := mail.NewClient(e.MailHost, e.MailPort, e.MailEmail, e.MailPassword, e.MailUsername, e.MailEmail)
+	templates, err := mail.NewRegistry(e.MailTemplateDir)
+	if err != nil {
+		logger.SysFatal("error mail templates: " + err.Error())
+	}
+
+	sender, err := mailSender(e)
 	if err != nil {
 		logger.SysFatal("error mailer: " + err.Error())
 	}
 
+	mailer := mail.NewClient(sender, e.MailUsername, e.MailEmail, templates)
+	mailer.Unsubscribe = preference.UnsubscribeURL(e.PublicURL)
+
+	mailer.DKIM, err = dkimSigner(e)
+	if err != nil {
+		logger.SysFatal("error dkim: " + err.Error())
+	}
+
+	pusher, err := pushProvider(e)
+	if err != nil {
+		logger.SysFatal("error notification: " + err.Error())
+	}
+
 	router := chi.NewRouter()
 
 	if *remigrate {
@@ -64,10 +155,120 @@ func main() {
 	}
 
 	deps := Dependencies{
-		DB:     db,
-		Redis:  redisDB,
-		Mailer: mailer,
+		DB:        db,
+		Redis:     redisDB,
+		Mailer:    mailer,
+		Providers: oidcProviders(e),
+		Push:      pusher,
 	}
 
 	RunServer(router, ":"+e.Port, deps)
 }
+
+func mailSender(e EnvConfig) (mail.Sender, error) {
+	switch e.MailDriver {
+	case "smtp":
+		return mail.NewSMTPSender(e.MailHost, e.MailPort, e.MailEmail, e.MailPassword)
+	case "file":
+		return mail.NewFileSender(e.MailDir)
+	case "memory":
+		return mail.NewMemorySender(), nil
+	case "log":
+		return mail.LogSender{}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", e.MailDriver)
+	}
+}
+
+func dkimSigner(e EnvConfig) (*mail.DKIMSigner, error) {
+	if e.DKIMDomain == "" {
+		return nil, nil
+	}
+
+	var headers []string
+	if e.DKIMHeaders != "" {
+		headers = strings.Split(e.DKIMHeaders, ",")
+	}
+
+	if e.DKIMPrivateKey != "" {
+		return mail.NewDKIMSigner(e.DKIMDomain, e.DKIMSelector, []byte(e.DKIMPrivateKey), headers)
+	}
+
+	return mail.LoadDKIMSigner(e.DKIMDomain, e.DKIMSelector, e.DKIMKeyFile, headers)
+}
+
+// pushProvider fans out to the NotificationDrivers, it is nil without any.
+func pushProvider(e EnvConfig) (notification.Provider, error) {
+	if e.NotificationDrivers == "" {
+		return nil, nil
+	}
+
+	delay := time.Duration(e.NotificationRetryDelayMS) * time.Millisecond
+	providers := notification.Fanout{}
+
+	for _, driver := range strings.Split(e.NotificationDrivers, ",") {
+		var p notification.Provider
+
+		switch driver = strings.TrimSpace(driver); driver {
+		case "pusher":
+			beams, err := notification.NewPusher(e.PusherInstanceID, e.PusherSecretKey, e.PusherBaseURL)
+			if err != nil {
+				return nil, err
+			}
+
+			p = beams
+		case "webhook":
+			if e.NotificationWebhookURL == "" {
+				return nil, errors.New("webhook driver without NOTIFICATION_WEBHOOK_URL")
+			}
+
+			p = notification.NewWebhook(e.NotificationWebhookURL, e.NotificationWebhookSecret)
+		case "memory":
+			p = notification.NewMemoryProvider()
+		case "log":
+			p = notification.LogProvider{}
+		default:
+			return nil, fmt.Errorf("unknown notification driver %q", driver)
+		}
+
+		providers[driver] = notification.WithRetry(p, e.NotificationRetries, delay)
+	}
+
+	return providers, nil
+}
+
+func passwordConfig(e EnvConfig) password.Config {
+	cfg := password.DefaultConfig
+
+	cfg.Algorithm = e.PasswordAlgorithm
+	cfg.Argon2.Memory = uint32(e.Argon2Memory)
+	cfg.Argon2.Iterations = uint32(e.Argon2Iterations)
+	cfg.Argon2.Parallelism = uint8(e.Argon2Parallelism)
+	cfg.BcryptCost = e.BcryptCost
+
+	return cfg
+}
+
+func oidcProviders(e EnvConfig) map[string]*oidc.Provider {
+	providers := map[string]*oidc.Provider{}
+
+	for _, name := range strings.Split(e.OIDCProviders, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		providers[name] = oidc.New(oidc.Config{
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  e.OIDCRedirectURL,
+		}, nil)
+
+		logger.SysInfof("OIDC provider %s enabled", name)
+	}
+
+	return providers
+}
@@ -0,0 +1,115 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/samuelsih/guwu/pkg/errs"
+)
+
+type AccessToken struct {
+	ID         string         `db:"id" json:"id"`
+	UserID     string         `db:"user_id" json:"-"`
+	Name       string         `db:"name" json:"name"`
+	TokenHash  string         `db:"token_hash" json:"-"`
+	Scopes     pq.StringArray `db:"scopes" json:"scopes"`
+	ExpiresAt  NullTime       `db:"expires_at" json:"expires_at"`
+	LastUsedAt NullTime       `db:"last_used_at" json:"last_used_at"`
+	CreatedAt  time.Time      `db:"created_at" json:"created_at"`
+}
+
+func InsertAccessToken(ctx context.Context, db *sqlx.DB, token AccessToken) (AccessToken, error) {
+	query := `
+		INSERT INTO personal_access_tokens(user_id, name, token_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, user_id, name, token_hash, scopes, expires_at, last_used_at, created_at;
+	`
+	const op = errs.Op("access_token.Insert")
+	var result AccessToken
+
+	err := db.GetContext(ctx, &result, query, token.UserID, token.Name, token.TokenHash, token.Scopes, token.ExpiresAt)
+	if err != nil {
+		return result, errs.E(op, errs.KindUnexpected, err, "cannot create token")
+	}
+
+	return result, nil
+}
+
+func ListAccessTokens(ctx context.Context, db *sqlx.DB, userID string) ([]AccessToken, error) {
+	query := `
+		SELECT id, user_id, name, token_hash, scopes, expires_at, last_used_at, created_at
+		FROM personal_access_tokens WHERE user_id = $1 ORDER BY created_at DESC
+	`
+	const op = errs.Op("access_token.List")
+	tokens := []AccessToken{}
+
+	err := db.SelectContext(ctx, &tokens, query, userID)
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "cannot get tokens")
+	}
+
+	return tokens, nil
+}
+
+func DeleteAccessToken(ctx context.Context, db *sqlx.DB, userID, id string) error {
+	query := `DELETE FROM personal_access_tokens WHERE id = $1 AND user_id = $2`
+	const op = errs.Op("access_token.Delete")
+
+	res, err := db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot revoke token")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot revoke token")
+	}
+
+	if affected == 0 {
+		return errs.E(op, errs.KindNotFound, sql.ErrNoRows, "unknown token")
+	}
+
+	return nil
+}
+
+// FindUserByAccessToken returns the owner of an unexpired token and records its usage.
+func FindUserByAccessToken(ctx context.Context, db *sqlx.DB, tokenHash string) (User, AccessToken, error) {
+	query := `
+		SELECT id, user_id, name, token_hash, scopes, expires_at, last_used_at, created_at
+		FROM personal_access_tokens
+		WHERE token_hash = $1 AND (expires_at IS NULL OR expires_at > now())
+	`
+	const op = errs.Op("access_token.FindUser")
+	var token AccessToken
+
+	err := db.GetContext(ctx, &token, query, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, token, errs.E(op, errs.KindUnauthorized, err, "invalid token")
+		}
+
+		return User{}, token, errs.E(op, errs.KindUnexpected, err, "cannot get token")
+	}
+
+	user, err := FindUserByID(ctx, db, token.UserID)
+	if err != nil {
+		return user, token, errs.E(op, errs.GetKind(err), err, err.Error())
+	}
+
+	// only write once a minute so that busy clients don't update the row on every request
+	touch := `
+		UPDATE personal_access_tokens SET last_used_at = now()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute')
+	`
+
+	_, err = db.ExecContext(ctx, touch, token.ID)
+	if err != nil {
+		return user, token, errs.E(op, errs.KindUnexpected, err, "cannot get token")
+	}
+
+	return user, token, nil
+}
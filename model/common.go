@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -21,6 +22,20 @@ func (t NullTime) MarshalJSON() ([]byte, error) {
 	return t.Time.MarshalJSON()
 }
 
+// Or returns the time, or fallback when it is null.
+func (t NullTime) Or(fallback time.Time) time.Time {
+	if !t.Valid {
+		return fallback
+	}
+
+	return t.Time
+}
+
+// SchemaAs documents NullTime as a nullable date-time.
+func (t NullTime) SchemaAs() any {
+	return (*time.Time)(nil)
+}
+
 func (t *NullTime) UnmarshalJSON(data []byte) error {
 	if bytes.Equal(data, []byte("null")) {
 		t.Valid = false
@@ -47,6 +62,11 @@ func (s NullString) MarshalJSON() ([]byte, error) {
 	return json.Marshal(s.String)
 }
 
+// SchemaAs documents NullString as a nullable string.
+func (s NullString) SchemaAs() any {
+	return (*string)(nil)
+}
+
 func (s *NullString) UnmarshalJSON(data []byte) error {
 	if bytes.Equal(data, []byte("null")) {
 		s.Valid = false
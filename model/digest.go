@@ -0,0 +1,232 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samuelsih/guwu/pkg/errs"
+)
+
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+
+	// DigestDefault is the frequency of the users who never chose one.
+	DigestDefault = DigestWeekly
+)
+
+var errDigestSent = errors.New("digest already sent")
+
+// DigestRecipient is a user due for a digest of the activity since Since,
+// LastSentAt is empty until the first digest.
+type DigestRecipient struct {
+	UserID     string    `db:"id"`
+	Username   string    `db:"username"`
+	Email      string    `db:"email"`
+	Locale     string    `db:"locale"`
+	Frequency  string    `db:"frequency"`
+	Since      time.Time `db:"since"`
+	LastSentAt NullTime  `db:"last_sent_at"`
+}
+
+// DigestPost is a post along with the username of its author.
+type DigestPost struct {
+	ID          string    `db:"id"`
+	Username    string    `db:"username"`
+	Description string    `db:"description"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+// DigestFrequency returns the frequency chosen by userID, DigestDefault when none.
+func DigestFrequency(ctx context.Context, db *sqlx.DB, userID string) (string, error) {
+	query := `SELECT frequency FROM email_digests WHERE user_id = $1`
+	const op = errs.Op("digest.Frequency")
+	var frequency string
+
+	err := db.GetContext(ctx, &frequency, query, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DigestDefault, nil
+	}
+
+	if err != nil {
+		return "", errs.E(op, errs.KindUnexpected, err, "cannot get digest frequency")
+	}
+
+	return frequency, nil
+}
+
+func SetDigestFrequency(ctx context.Context, db *sqlx.DB, userID, frequency string) error {
+	query := `
+		INSERT INTO email_digests(user_id, frequency)
+		SELECT id, $2 FROM users WHERE id = $1
+		ON CONFLICT (user_id) DO UPDATE SET frequency = EXCLUDED.frequency, updated_at = now()
+	`
+	const op = errs.Op("digest.SetFrequency")
+
+	res, err := db.ExecContext(ctx, query, userID, frequency)
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot update digest frequency")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot update digest frequency")
+	}
+
+	if affected == 0 {
+		return errs.E(op, errs.KindBadRequest, sql.ErrNoRows, "unknown user")
+	}
+
+	return nil
+}
+
+// DueDigests lists up to limit users subscribed to the digest whose last one, or their signup,
+// is older than their frequency at now.
+func DueDigests(ctx context.Context, db *sqlx.DB, now time.Time, limit int) ([]DigestRecipient, error) {
+	query := `
+		SELECT u.id, u.username, u.email, u.locale, d.last_sent_at,
+			COALESCE(d.frequency, $3) AS frequency,
+			COALESCE(d.last_sent_at, u.created_at) AS since
+		FROM users u
+		LEFT JOIN email_digests d ON d.user_id = u.id
+		LEFT JOIN email_preferences p ON p.user_id = u.id AND p.category = 'digest'
+		WHERE u.deletion_scheduled_at IS NULL AND COALESCE(p.enabled, true)
+			AND COALESCE(d.last_sent_at, u.created_at) <= $1::timestamp - CASE COALESCE(d.frequency, $3)
+				WHEN 'daily' THEN interval '1 day' ELSE interval '7 days' END
+		ORDER BY since
+		LIMIT $2
+	`
+	const op = errs.Op("digest.Due")
+	recipients := []DigestRecipient{}
+
+	err := db.SelectContext(ctx, &recipients, query, now, limit, DigestDefault)
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "cannot get due digests")
+	}
+
+	return recipients, nil
+}
+
+// RecordDigest moves the last digest of r to sentAt along with queueing mails. Nothing is written
+// and it returns false when another worker recorded one since r was read, so each digest is sent once.
+func RecordDigest(ctx context.Context, db *sqlx.DB, r DigestRecipient, sentAt time.Time, mails ...OutboxMail) (bool, error) {
+	query := `
+		INSERT INTO email_digests(user_id, frequency, last_sent_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET last_sent_at = EXCLUDED.last_sent_at
+		WHERE email_digests.last_sent_at IS NOT DISTINCT FROM $4
+	`
+	const op = errs.Op("digest.Record")
+	recorded := true
+
+	err := withMails(ctx, db, mails, func(q sqlx.ExtContext) error {
+		res, err := q.ExecContext(ctx, query, r.UserID, r.Frequency, sentAt, r.LastSentAt)
+		if err != nil {
+			return errs.E(op, errs.KindUnexpected, err, "cannot record digest")
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return errs.E(op, errs.KindUnexpected, err, "cannot record digest")
+		}
+
+		if affected == 0 {
+			// rolls the mails back
+			recorded = false
+			return errDigestSent
+		}
+
+		return nil
+	})
+
+	if !recorded {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// NewFollowers returns the number of users following userID since since and the usernames
+// of the latest limit ones.
+func NewFollowers(ctx context.Context, db *sqlx.DB, userID string, since time.Time, limit int) (int, []string, error) {
+	query := `
+		SELECT u.username, count(*) OVER () AS total FROM user_follows f
+		JOIN users u ON u.id = f.user_id
+		WHERE f.user_follow_id = $1 AND f.created_at > $2
+		ORDER BY f.created_at DESC
+		LIMIT $3
+	`
+	const op = errs.Op("digest.NewFollowers")
+
+	var rows []struct {
+		Username string `db:"username"`
+		Total    int    `db:"total"`
+	}
+
+	err := db.SelectContext(ctx, &rows, query, userID, since, limit)
+	if err != nil {
+		return 0, nil, errs.E(op, errs.KindUnexpected, err, "cannot get followers")
+	}
+
+	if len(rows) == 0 {
+		return 0, nil, nil
+	}
+
+	usernames := make([]string, 0, len(rows))
+	for _, row := range rows {
+		usernames = append(usernames, row.Username)
+	}
+
+	return rows[0].Total, usernames, nil
+}
+
+// Mentions returns the latest posts of other users written since since with @username as a whole word,
+// so @bob matches neither @bobby nor foo@bob.com. The username is escaped before joining the pattern.
+func Mentions(ctx context.Context, db *sqlx.DB, userID, username string, since time.Time, limit int) ([]DigestPost, error) {
+	query := `
+		SELECT p.id, u.username, p.description, p.created_at FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.user_id <> $1 AND p.created_at > $3
+			AND p.description ~* ('(^|[^[:alnum:]_])@' || regexp_replace($2::text, '([^[:alnum:]_])', '\\\1', 'g') || '([^[:alnum:]_]|$)')
+		ORDER BY p.created_at DESC
+		LIMIT $4
+	`
+	const op = errs.Op("digest.Mentions")
+	posts := []DigestPost{}
+
+	err := db.SelectContext(ctx, &posts, query, userID, username, since, limit)
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "cannot get mentions")
+	}
+
+	return posts, nil
+}
+
+// FollowedPosts returns the top posts written since since by the users userID follows.
+// Posts have no reactions yet, so the top ones are the authors' latest, one per author first.
+func FollowedPosts(ctx context.Context, db *sqlx.DB, userID string, since time.Time, limit int) ([]DigestPost, error) {
+	query := `
+		SELECT id, username, description, created_at FROM (
+			SELECT p.id, u.username, p.description, p.created_at,
+				row_number() OVER (PARTITION BY p.user_id ORDER BY p.created_at DESC) AS rank
+			FROM posts p
+			JOIN user_follows f ON f.user_follow_id = p.user_id AND f.user_id = $1
+			JOIN users u ON u.id = p.user_id
+			WHERE p.created_at > $2
+		) ranked
+		ORDER BY rank, created_at DESC
+		LIMIT $3
+	`
+	const op = errs.Op("digest.FollowedPosts")
+	posts := []DigestPost{}
+
+	err := db.SelectContext(ctx, &posts, query, userID, since, limit)
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "cannot get posts")
+	}
+
+	return posts, nil
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samuelsih/guwu/pkg/errs"
+)
+
+// EmailPreference is the choice of a user about a mail category.
+// A category without a row is enabled.
+type EmailPreference struct {
+	Category  string    `db:"category" json:"category"`
+	Enabled   bool      `db:"enabled" json:"enabled"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+func ListEmailPreferences(ctx context.Context, db *sqlx.DB, userID string) ([]EmailPreference, error) {
+	query := `SELECT category, enabled, updated_at FROM email_preferences WHERE user_id = $1 ORDER BY category`
+	const op = errs.Op("email_preference.List")
+	preferences := []EmailPreference{}
+
+	err := db.SelectContext(ctx, &preferences, query, userID)
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "cannot get email preferences")
+	}
+
+	return preferences, nil
+}
+
+// SetEmailPreference stores the choice of the user about category.
+func SetEmailPreference(ctx context.Context, db *sqlx.DB, userID, category string, enabled bool) error {
+	query := `
+		INSERT INTO email_preferences(user_id, category, enabled)
+		SELECT id, $2, $3 FROM users WHERE id = $1
+		ON CONFLICT (user_id, category) DO UPDATE SET enabled = EXCLUDED.enabled, updated_at = now()
+	`
+	const op = errs.Op("email_preference.Set")
+
+	res, err := db.ExecContext(ctx, query, userID, category, enabled)
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot update email preferences")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot update email preferences")
+	}
+
+	if affected == 0 {
+		return errs.E(op, errs.KindBadRequest, sql.ErrNoRows, "unknown user")
+	}
+
+	return nil
+}
+
+// EmailEnabled reports whether userID still receives the mails of category.
+func EmailEnabled(ctx context.Context, db sqlx.QueryerContext, userID, category string) (bool, error) {
+	query := `SELECT enabled FROM email_preferences WHERE user_id = $1 AND category = $2`
+	const op = errs.Op("email_preference.Enabled")
+	var enabled bool
+
+	err := sqlx.GetContext(ctx, db, &enabled, query, userID, category)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	}
+
+	if err != nil {
+		return false, errs.E(op, errs.KindUnexpected, err, "cannot get email preferences")
+	}
+
+	return enabled, nil
+}
@@ -0,0 +1,129 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/samuelsih/guwu/pkg/errs"
+)
+
+const (
+	NotificationFollow  = "follow"
+	NotificationMention = "mention"
+	NotificationLike    = "like"
+	NotificationReply   = "reply"
+)
+
+// NotificationEvent is something ActorID did that UserID hears about,
+// SubjectID is the post it is about, empty for a follow.
+type NotificationEvent struct {
+	UserID    string
+	ActorID   string
+	Type      string
+	SubjectID string
+}
+
+// Notification groups the unread events of a type about the same subject,
+// ActorID is the latest of ActorCount distinct actors.
+type Notification struct {
+	ID            string    `db:"id" json:"id"`
+	Type          string    `db:"type" json:"type"`
+	SubjectID     string    `db:"subject_id" json:"subject_id,omitempty"`
+	ActorID       string    `db:"actor_id" json:"actor_id"`
+	ActorUsername string    `db:"actor_username" json:"actor_username"`
+	ActorCount    int       `db:"actor_count" json:"actor_count"`
+	ReadAt        NullTime  `db:"read_at" json:"read_at,omitempty"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// RecordNotification adds e to the unread notification of its group, or stores it as id.
+func RecordNotification(ctx context.Context, db *sqlx.DB, id string, e NotificationEvent) error {
+	query := `
+		WITH grouped AS (
+			UPDATE notifications SET
+				actor_id = $4,
+				actor_ids = CASE WHEN $4::text = ANY(actor_ids) THEN actor_ids ELSE array_append(actor_ids, $4::text) END,
+				updated_at = now()
+			WHERE id = (
+				SELECT id FROM notifications
+				WHERE user_id = $2 AND type = $3 AND subject_id = $5 AND read_at IS NULL
+				ORDER BY updated_at DESC
+				LIMIT 1
+				FOR UPDATE
+			)
+			RETURNING id
+		)
+		INSERT INTO notifications(id, user_id, type, subject_id, actor_id, actor_ids)
+		SELECT $1, $2, $3, $5, $4, ARRAY[$4::text]
+		WHERE NOT EXISTS (SELECT 1 FROM grouped)
+	`
+	const op = errs.Op("notification.Record")
+
+	_, err := db.ExecContext(ctx, query, id, e.UserID, e.Type, e.ActorID, e.SubjectID)
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot record notification")
+	}
+
+	return nil
+}
+
+// ListNotifications returns up to limit notifications of userID, latest first, updated before
+// the notification at beforeTime and beforeID when beforeID is set.
+func ListNotifications(ctx context.Context, db *sqlx.DB, userID string, beforeTime time.Time, beforeID string, limit int) ([]Notification, error) {
+	query := `
+		SELECT n.id, n.type, n.subject_id, n.actor_id, u.username AS actor_username,
+			cardinality(n.actor_ids) AS actor_count, n.read_at, n.created_at, n.updated_at
+		FROM notifications n
+		JOIN users u ON u.id = n.actor_id
+		WHERE n.user_id = $1 AND ($3 = '' OR (n.updated_at, n.id) < ($2::timestamp, $3))
+		ORDER BY n.updated_at DESC, n.id DESC
+		LIMIT $4
+	`
+	const op = errs.Op("notification.List")
+	notifications := []Notification{}
+
+	err := db.SelectContext(ctx, &notifications, query, userID, beforeTime, beforeID, limit)
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "cannot get notifications")
+	}
+
+	return notifications, nil
+}
+
+func CountUnreadNotifications(ctx context.Context, db *sqlx.DB, userID string) (int, error) {
+	query := `SELECT count(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`
+	const op = errs.Op("notification.CountUnread")
+	var count int
+
+	err := db.GetContext(ctx, &count, query, userID)
+	if err != nil {
+		return 0, errs.E(op, errs.KindUnexpected, err, "cannot count notifications")
+	}
+
+	return count, nil
+}
+
+// MarkNotifications marks the notifications of userID among ids read or unread, every one of them
+// when ids is empty. A notification read already keeps the time it was first read.
+func MarkNotifications(ctx context.Context, db *sqlx.DB, userID string, ids []string, read bool) (int64, error) {
+	query := `
+		UPDATE notifications SET read_at = CASE WHEN $3 THEN COALESCE(read_at, now()) ELSE NULL END
+		WHERE user_id = $1 AND (cardinality($2::text[]) = 0 OR id = ANY($2::text[]))
+	`
+	const op = errs.Op("notification.Mark")
+
+	res, err := db.ExecContext(ctx, query, userID, pq.Array(ids), read)
+	if err != nil {
+		return 0, errs.E(op, errs.KindUnexpected, err, "cannot update notifications")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, errs.E(op, errs.KindUnexpected, err, "cannot update notifications")
+	}
+
+	return affected, nil
+}
@@ -0,0 +1,165 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/samuelsih/guwu/pkg/errs"
+)
+
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+type OAuthClient struct {
+	ID           string         `db:"id" json:"client_id"`
+	UserID       string         `db:"user_id" json:"-"`
+	Name         string         `db:"name" json:"name"`
+	SecretHash   NullString     `db:"secret_hash" json:"-"`
+	RedirectURIs pq.StringArray `db:"redirect_uris" json:"redirect_uris"`
+	Scopes       pq.StringArray `db:"scopes" json:"scopes"`
+	CreatedAt    time.Time      `db:"created_at" json:"created_at"`
+}
+
+// Confidential clients authenticate with a secret, public clients only rely on PKCE.
+func (c OAuthClient) Confidential() bool {
+	return c.SecretHash.Valid
+}
+
+type OAuthRefreshToken struct {
+	ID        string         `db:"id"`
+	TokenHash string         `db:"token_hash"`
+	FamilyID  string         `db:"family_id"`
+	ClientID  string         `db:"client_id"`
+	UserID    string         `db:"user_id"`
+	Scopes    pq.StringArray `db:"scopes"`
+	ExpiresAt time.Time      `db:"expires_at"`
+	RevokedAt NullTime       `db:"revoked_at"`
+	CreatedAt time.Time      `db:"created_at"`
+}
+
+func InsertOAuthClient(ctx context.Context, db *sqlx.DB, client OAuthClient) (OAuthClient, error) {
+	query := `
+		INSERT INTO oauth_clients(user_id, name, secret_hash, redirect_uris, scopes)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, user_id, name, secret_hash, redirect_uris, scopes, created_at;
+	`
+	const op = errs.Op("oauth.InsertClient")
+	var result OAuthClient
+
+	err := db.GetContext(ctx, &result, query, client.UserID, client.Name, client.SecretHash, client.RedirectURIs, client.Scopes)
+	if err != nil {
+		return result, errs.E(op, errs.KindUnexpected, err, "cannot register client")
+	}
+
+	return result, nil
+}
+
+func FindOAuthClient(ctx context.Context, db *sqlx.DB, id string) (OAuthClient, error) {
+	query := `SELECT id, user_id, name, secret_hash, redirect_uris, scopes, created_at FROM oauth_clients WHERE id = $1`
+	const op = errs.Op("oauth.FindClient")
+	var client OAuthClient
+
+	err := db.GetContext(ctx, &client, query, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return client, errs.E(op, errs.KindBadRequest, err, "unknown client")
+		}
+
+		return client, errs.E(op, errs.KindUnexpected, err, "cannot get client")
+	}
+
+	return client, nil
+}
+
+func InsertRefreshToken(ctx context.Context, db *sqlx.DB, token OAuthRefreshToken) error {
+	query := `
+		INSERT INTO oauth_refresh_tokens(token_hash, family_id, client_id, user_id, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	const op = errs.Op("oauth.InsertRefreshToken")
+
+	_, err := db.ExecContext(ctx, query, token.TokenHash, token.FamilyID, token.ClientID, token.UserID, token.Scopes, token.ExpiresAt)
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot issue token")
+	}
+
+	return nil
+}
+
+func FindRefreshToken(ctx context.Context, db *sqlx.DB, tokenHash string) (OAuthRefreshToken, error) {
+	query := `
+		SELECT id, token_hash, family_id, client_id, user_id, scopes, expires_at, revoked_at, created_at
+		FROM oauth_refresh_tokens WHERE token_hash = $1
+	`
+	const op = errs.Op("oauth.FindRefreshToken")
+	var token OAuthRefreshToken
+
+	err := db.GetContext(ctx, &token, query, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return token, errs.E(op, errs.KindBadRequest, err, "invalid refresh token")
+		}
+
+		return token, errs.E(op, errs.KindUnexpected, err, "cannot get refresh token")
+	}
+
+	return token, nil
+}
+
+// RotateRefreshToken revokes old and stores next in the same family.
+// It returns ErrRefreshTokenReused when old has already been rotated or revoked.
+func RotateRefreshToken(ctx context.Context, db *sqlx.DB, oldID string, next OAuthRefreshToken) error {
+	const op = errs.Op("oauth.RotateRefreshToken")
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot rotate token")
+	}
+
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE oauth_refresh_tokens SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL`, oldID)
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot rotate token")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot rotate token")
+	}
+
+	if affected == 0 {
+		return errs.E(op, errs.KindBadRequest, ErrRefreshTokenReused, "invalid refresh token")
+	}
+
+	query := `
+		INSERT INTO oauth_refresh_tokens(token_hash, family_id, client_id, user_id, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	_, err = tx.ExecContext(ctx, query, next.TokenHash, next.FamilyID, next.ClientID, next.UserID, next.Scopes, next.ExpiresAt)
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot rotate token")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot rotate token")
+	}
+
+	return nil
+}
+
+func RevokeRefreshFamily(ctx context.Context, db *sqlx.DB, familyID string) error {
+	query := `UPDATE oauth_refresh_tokens SET revoked_at = now() WHERE family_id = $1 AND revoked_at IS NULL`
+	const op = errs.Op("oauth.RevokeRefreshFamily")
+
+	_, err := db.ExecContext(ctx, query, familyID)
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot revoke token")
+	}
+
+	return nil
+}
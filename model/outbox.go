@@ -0,0 +1,235 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/samuelsih/guwu/pkg/errs"
+)
+
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxDead    = "dead"
+
+	// OutboxSkipped mails were not sent, their recipient unsubscribed in the meantime.
+	OutboxSkipped = "skipped"
+)
+
+// OutboxMail is an email waiting to be delivered by the outbox worker.
+// Data holds the template data as JSON.
+type OutboxMail struct {
+	ID            string          `db:"id" json:"id"`
+	Template      int             `db:"template" json:"template"`
+	UserID        NullString      `db:"user_id" json:"user_id"`
+	Name          string          `db:"recipient_name" json:"recipient_name"`
+	Email         string          `db:"recipient_email" json:"recipient_email"`
+	Subject       string          `db:"subject" json:"subject"`
+	Locale        string          `db:"locale" json:"locale"`
+	Data          json.RawMessage `db:"data" json:"data"`
+	Status        string          `db:"status" json:"status"`
+	Attempts      int             `db:"attempts" json:"attempts"`
+	LastError     NullString      `db:"last_error" json:"last_error"`
+	NextAttemptAt time.Time       `db:"next_attempt_at" json:"next_attempt_at"`
+	CreatedAt     time.Time       `db:"created_at" json:"created_at"`
+	SentAt        NullTime        `db:"sent_at" json:"sent_at"`
+}
+
+const outboxColumns = `id, template, user_id, recipient_name, recipient_email, locale, subject, data, status, attempts, last_error, next_attempt_at, created_at, sent_at`
+
+// EnqueueMail stores mails on their own, writes sending mails should pass them along instead
+// so both are committed together.
+func EnqueueMail(ctx context.Context, db *sqlx.DB, mails ...OutboxMail) error {
+	return withMails(ctx, db, mails, func(sqlx.ExtContext) error { return nil })
+}
+
+// withMails runs write then enqueues mails, in a single transaction when there is any mail.
+func withMails(ctx context.Context, db *sqlx.DB, mails []OutboxMail, write func(q sqlx.ExtContext) error) error {
+	const op = errs.Op("outbox.withMails")
+
+	if len(mails) == 0 {
+		return write(db)
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "unexpected error.")
+	}
+
+	defer tx.Rollback()
+
+	if err := write(tx); err != nil {
+		return err
+	}
+
+	for _, mail := range mails {
+		if err := insertOutboxMail(ctx, tx, mail); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "unexpected error.")
+	}
+
+	return nil
+}
+
+func insertOutboxMail(ctx context.Context, db sqlx.ExecerContext, mail OutboxMail) error {
+	query := `
+		INSERT INTO mail_outbox(template, user_id, recipient_name, recipient_email, locale, subject, data)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7)
+	`
+	const op = errs.Op("outbox.insert")
+
+	data := string(mail.Data)
+	if data == "" {
+		data = "{}"
+	}
+
+	_, err := db.ExecContext(ctx, query, mail.Template, mail.UserID.String, mail.Name, mail.Email, mail.Locale, mail.Subject, data)
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot queue mail")
+	}
+
+	return nil
+}
+
+// ClaimOutboxMails locks up to limit due mails for lease, other workers skip them until it ends.
+func ClaimOutboxMails(ctx context.Context, db *sqlx.DB, limit int, lease time.Duration) ([]OutboxMail, error) {
+	query := `
+		UPDATE mail_outbox SET locked_until = now() + $2 * interval '1 second'
+		WHERE id IN (
+			SELECT id FROM mail_outbox
+			WHERE status = 'pending' AND next_attempt_at <= now() AND (locked_until IS NULL OR locked_until < now())
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + outboxColumns
+	const op = errs.Op("outbox.Claim")
+	mails := []OutboxMail{}
+
+	err := db.SelectContext(ctx, &mails, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "cannot claim mails")
+	}
+
+	return mails, nil
+}
+
+// MarkOutboxSent also clears the template data, it may hold secrets like one-time codes.
+func MarkOutboxSent(ctx context.Context, db *sqlx.DB, id string) error {
+	query := `
+		UPDATE mail_outbox SET status = 'sent', data = '{}', attempts = attempts + 1, sent_at = now(), locked_until = NULL
+		WHERE id = $1
+	`
+	const op = errs.Op("outbox.MarkSent")
+
+	if _, err := db.ExecContext(ctx, query, id); err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot update mail")
+	}
+
+	return nil
+}
+
+func MarkOutboxSkipped(ctx context.Context, db *sqlx.DB, id string) error {
+	query := `UPDATE mail_outbox SET status = 'skipped', locked_until = NULL WHERE id = $1`
+	const op = errs.Op("outbox.MarkSkipped")
+
+	if _, err := db.ExecContext(ctx, query, id); err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot update mail")
+	}
+
+	return nil
+}
+
+// MarkOutboxFailed records a failed attempt, the mail is retried at next or dead-lettered when dead is set.
+func MarkOutboxFailed(ctx context.Context, db *sqlx.DB, id, reason string, next time.Time, dead bool) error {
+	query := `
+		UPDATE mail_outbox
+		SET status = $2, attempts = attempts + 1, last_error = $3, next_attempt_at = $4, locked_until = NULL
+		WHERE id = $1
+	`
+	const op = errs.Op("outbox.MarkFailed")
+
+	status := OutboxPending
+	if dead {
+		status = OutboxDead
+	}
+
+	if _, err := db.ExecContext(ctx, query, id, status, reason, next); err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot update mail")
+	}
+
+	return nil
+}
+
+func ListOutboxMails(ctx context.Context, db *sqlx.DB, status string, limit int) ([]OutboxMail, error) {
+	query := `SELECT ` + outboxColumns + ` FROM mail_outbox WHERE status = $1 ORDER BY created_at DESC LIMIT $2`
+	const op = errs.Op("outbox.List")
+	mails := []OutboxMail{}
+
+	err := db.SelectContext(ctx, &mails, query, status, limit)
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "cannot list mails")
+	}
+
+	return mails, nil
+}
+
+// ReplayOutboxMails puts dead mails back in the queue with fresh attempts, every dead mail when ids is empty.
+func ReplayOutboxMails(ctx context.Context, db *sqlx.DB, ids []string) (int64, error) {
+	query := `
+		UPDATE mail_outbox SET status = 'pending', attempts = 0, next_attempt_at = now(), locked_until = NULL
+		WHERE status = 'dead' AND (cardinality($1::text[]) = 0 OR id = ANY($1))
+	`
+	const op = errs.Op("outbox.Replay")
+
+	res, err := db.ExecContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return 0, errs.E(op, errs.KindUnexpected, err, "cannot replay mails")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, errs.E(op, errs.KindUnexpected, err, "cannot replay mails")
+	}
+
+	return affected, nil
+}
+
+// CountOutboxMails returns the number of mails by status.
+func CountOutboxMails(ctx context.Context, db *sqlx.DB) (map[string]int64, error) {
+	query := `SELECT status, count(*) FROM mail_outbox GROUP BY status`
+	const op = errs.Op("outbox.Count")
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "cannot count mails")
+	}
+
+	defer rows.Close()
+
+	counts := map[string]int64{OutboxPending: 0, OutboxSent: 0, OutboxDead: 0, OutboxSkipped: 0}
+
+	for rows.Next() {
+		var status string
+		var count int64
+
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, errs.E(op, errs.KindUnexpected, err, "cannot count mails")
+		}
+
+		counts[status] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "cannot count mails")
+	}
+
+	return counts, nil
+}
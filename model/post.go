@@ -0,0 +1,134 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samuelsih/guwu/pkg/errs"
+)
+
+type Post struct {
+	ID          string    `db:"id" json:"id"`
+	UserID      string    `db:"user_id" json:"user_id"`
+	Description string    `db:"description" json:"description"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   NullTime  `db:"updated_at" json:"updated_at,omitempty"`
+}
+
+// LastModified is when the post was last written.
+func (p Post) LastModified() time.Time {
+	return p.UpdatedAt.Or(p.CreatedAt)
+}
+
+func InsertPost(ctx context.Context, db *sqlx.DB, post Post) (Post, error) {
+	query := `
+		INSERT INTO posts(id, user_id, description)
+		VALUES ($1, $2, $3)
+		RETURNING id, user_id, description, created_at, updated_at;
+	`
+	const op = errs.Op("post.Insert")
+	var result Post
+
+	err := db.GetContext(ctx, &result, query, post.ID, post.UserID, post.Description)
+	if err != nil {
+		return result, errs.E(op, errs.KindUnexpected, err, "cannot create post")
+	}
+
+	return result, nil
+}
+
+func FindPost(ctx context.Context, db *sqlx.DB, id string) (Post, error) {
+	query := `SELECT id, user_id, description, created_at, updated_at FROM posts WHERE id = $1`
+	const op = errs.Op("post.Find")
+	var post Post
+
+	err := db.GetContext(ctx, &post, query, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return post, errs.E(op, errs.KindNotFound, err, "unknown post")
+		}
+
+		return post, errs.E(op, errs.KindUnexpected, err, "cannot get post")
+	}
+
+	return post, nil
+}
+
+func ListUserPosts(ctx context.Context, db *sqlx.DB, userID string, limit, offset int) ([]Post, error) {
+	query := `
+		SELECT id, user_id, description, created_at, updated_at FROM posts
+		WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2 OFFSET $3
+	`
+	const op = errs.Op("post.ListByUser")
+	posts := []Post{}
+
+	err := db.SelectContext(ctx, &posts, query, userID, limit, offset)
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "cannot get posts")
+	}
+
+	return posts, nil
+}
+
+// ListFeedPosts returns the posts of the users followed by userID, newest first.
+func ListFeedPosts(ctx context.Context, db *sqlx.DB, userID string, limit, offset int) ([]Post, error) {
+	query := `
+		SELECT p.id, p.user_id, p.description, p.created_at, p.updated_at FROM posts p
+		JOIN user_follows f ON f.user_follow_id = p.user_id
+		WHERE f.user_id = $1 ORDER BY p.created_at DESC, p.id DESC LIMIT $2 OFFSET $3
+	`
+	const op = errs.Op("post.ListFeed")
+	posts := []Post{}
+
+	err := db.SelectContext(ctx, &posts, query, userID, limit, offset)
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "cannot get feed")
+	}
+
+	return posts, nil
+}
+
+// UpdatePost saves post when it belongs to its user and returns the stored row.
+func UpdatePost(ctx context.Context, db *sqlx.DB, post Post) (Post, error) {
+	query := `
+		UPDATE posts SET description = $1, updated_at = now() WHERE id = $2 AND user_id = $3
+		RETURNING id, user_id, description, created_at, updated_at
+	`
+	const op = errs.Op("post.Update")
+	var result Post
+
+	err := db.GetContext(ctx, &result, query, post.Description, post.ID, post.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return result, errs.E(op, errs.KindNotFound, err, "unknown post")
+		}
+
+		return result, errs.E(op, errs.KindUnexpected, err, "cannot update post")
+	}
+
+	return result, nil
+}
+
+func DeletePost(ctx context.Context, db *sqlx.DB, userID, id string) error {
+	query := `DELETE FROM posts WHERE id = $1 AND user_id = $2`
+	const op = errs.Op("post.Delete")
+
+	res, err := db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot delete post")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot delete post")
+	}
+
+	if affected == 0 {
+		return errs.E(op, errs.KindNotFound, sql.ErrNoRows, "unknown post")
+	}
+
+	return nil
+}
@@ -5,12 +5,14 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/samuelsih/guwu/pkg/errs"
+	"github.com/samuelsih/guwu/pkg/password"
 	"github.com/samuelsih/guwu/pkg/pgerr"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type User struct {
@@ -18,12 +20,21 @@ type User struct {
 	Username  string     `db:"username" json:"username"`
 	Email     string     `db:"email" json:"email"`
 	Password  NullString `db:"password" json:"-"`
+	Bio       NullString `db:"bio" json:"bio"`
+	Locale    string     `db:"locale" json:"locale"`
 	CreatedAt time.Time  `db:"created_at" json:"created_at"`
 	UpdatedAt NullTime   `db:"updated_at" json:"updated_at,omitempty"`
+
+	DeletionScheduledAt NullTime `db:"deletion_scheduled_at" json:"deletion_scheduled_at,omitempty"`
+}
+
+// LastModified is when the user was last written.
+func (u User) LastModified() time.Time {
+	return u.UpdatedAt.Or(u.CreatedAt)
 }
 
 func FindUserByEmail(ctx context.Context, db *sqlx.DB, email string) (User, error) {
-	query := `SELECT id, username, email, password, created_at, updated_at FROM users WHERE email = $1`
+	query := `SELECT id, username, email, password, bio, locale, created_at, updated_at, deletion_scheduled_at FROM users WHERE email = $1`
 	const op = errs.Op("user.FindByEmail")
 	var user User
 
@@ -44,41 +55,257 @@ func FindUserByEmail(ctx context.Context, db *sqlx.DB, email string) (User, erro
 	return user, nil
 }
 
-func CheckUserPassword(userPassword, incomingPassword string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(userPassword), []byte(incomingPassword))
-	return err == nil
+func FindUserByID(ctx context.Context, db *sqlx.DB, id string) (User, error) {
+	query := `SELECT id, username, email, password, bio, locale, created_at, updated_at, deletion_scheduled_at FROM users WHERE id = $1`
+	const op = errs.Op("user.FindByID")
+	var user User
+
+	err := db.GetContext(ctx, &user, query, id)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user, errs.E(op, errs.KindBadRequest, err, "unknown user")
+		}
+
+		return user, errs.E(op, errs.KindUnexpected, err, "cannot get user")
+	}
+
+	return user, nil
+}
+
+// IsAdmin reports whether the user holds the admin role, it is only granted in the database.
+func IsAdmin(ctx context.Context, db *sqlx.DB, id string) (bool, error) {
+	query := `SELECT is_admin FROM users WHERE id = $1`
+	const op = errs.Op("user.IsAdmin")
+	var admin bool
+
+	err := db.GetContext(ctx, &admin, query, id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, errs.E(op, errs.KindUnexpected, err, "cannot get user")
+	}
+
+	return admin, nil
+}
+
+// FindUserIDsByUsernames returns the ids of the active users named one of usernames, ignoring case.
+func FindUserIDsByUsernames(ctx context.Context, db *sqlx.DB, usernames []string) ([]string, error) {
+	query := `
+		SELECT id FROM users
+		WHERE lower(username) = ANY($1::text[]) AND deletion_scheduled_at IS NULL
+	`
+	const op = errs.Op("user.FindIDsByUsernames")
+	ids := []string{}
+
+	lowered := make([]string, 0, len(usernames))
+	for _, username := range usernames {
+		lowered = append(lowered, strings.ToLower(username))
+	}
+
+	err := db.SelectContext(ctx, &ids, query, pq.Array(lowered))
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "cannot get users")
+	}
+
+	return ids, nil
+}
+
+// CheckUserPassword reports whether incomingPassword matches and whether the stored hash is outdated.
+func CheckUserPassword(userPassword, incomingPassword string) (match bool, needsRehash bool) {
+	match, needsRehash, err := password.Verify(userPassword, incomingPassword)
+	if err != nil {
+		return false, false
+	}
+
+	return match, needsRehash
 }
 
-func InsertUser(ctx context.Context, db *sqlx.DB, username, email, password string) (User, error) {
+// InsertUser creates the user, mails are queued in the same transaction.
+func InsertUser(ctx context.Context, db *sqlx.DB, username, email, password, locale string, mails ...OutboxMail) (User, error) {
 	query := `
-		INSERT INTO users(username, email, password)
-		VALUES ($1, $2, $3)
-		RETURNING id, username, email, created_at;
+		INSERT INTO users(username, email, password, locale)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, username, email, locale, created_at;
 	`
 	const op = errs.Op("user.Insert")
 	var user User
 
-	err := db.QueryRowContext(ctx, query, username, email, password).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt)
+	err := withMails(ctx, db, mails, func(q sqlx.ExtContext) error {
+		err := q.QueryRowxContext(ctx, query, username, email, password, locale).Scan(&user.ID, &user.Username, &user.Email, &user.Locale, &user.CreatedAt)
+		if err == nil {
+			return nil
+		}
 
-	if err != nil {
 		if column, e := pgerr.UniqueColumn(err); e != nil {
 			clientMsg := fmt.Sprintf("%v already taken, please take another %v", column, column)
-			return user, errs.E(op, errs.KindBadRequest, e, clientMsg)
+			return errs.E(op, errs.KindBadRequest, e, clientMsg)
 		}
 
-		return user, errs.E(op, errs.KindUnexpected, err, "unexpected error.")
-	}
+		return errs.E(op, errs.KindUnexpected, err, "unexpected error.")
+	})
 
-	return user, nil
+	return user, err
 }
 
-func HashPassword(password string) (string, error) {
+func HashPassword(plain string) (string, error) {
 	const op = errs.Op("user.HashPassword")
 
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashed, err := password.Hash(plain)
+	if err != nil {
+		return "", errs.E(op, errs.GetKind(err), err, err.Error())
+	}
+
+	return hashed, nil
+}
+
+func UpdateUserPassword(ctx context.Context, db *sqlx.DB, userID, hashedPassword string) error {
+	query := `UPDATE users SET password = $1, updated_at = now() WHERE id = $2`
+	const op = errs.Op("user.UpdatePassword")
+
+	res, err := db.ExecContext(ctx, query, hashedPassword, userID)
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot update password")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot update password")
+	}
+
+	if affected == 0 {
+		return errs.E(op, errs.KindBadRequest, sql.ErrNoRows, "unknown user")
+	}
+
+	return nil
+}
+
+// UpdateUserEmail changes the email of the user, mails are queued in the same transaction.
+func UpdateUserEmail(ctx context.Context, db *sqlx.DB, userID, email string, mails ...OutboxMail) error {
+	query := `UPDATE users SET email = $1, updated_at = now() WHERE id = $2`
+	const op = errs.Op("user.UpdateEmail")
+
+	return withMails(ctx, db, mails, func(q sqlx.ExtContext) error {
+		res, err := q.ExecContext(ctx, query, email, userID)
+		if err != nil {
+			if column, e := pgerr.UniqueColumn(err); e != nil {
+				clientMsg := fmt.Sprintf("%v already taken, please take another %v", column, column)
+				return errs.E(op, errs.KindBadRequest, e, clientMsg)
+			}
+
+			return errs.E(op, errs.KindUnexpected, err, "cannot update email")
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return errs.E(op, errs.KindUnexpected, err, "cannot update email")
+		}
+
+		if affected == 0 {
+			return errs.E(op, errs.KindBadRequest, sql.ErrNoRows, "unknown user")
+		}
+
+		return nil
+	})
+}
+
+// UpdateUserProfile saves the editable profile fields of user and returns the stored row.
+func UpdateUserProfile(ctx context.Context, db *sqlx.DB, user User) (User, error) {
+	query := `
+		UPDATE users SET username = $1, bio = $2, locale = $3, updated_at = now() WHERE id = $4
+		RETURNING id, username, email, password, bio, locale, created_at, updated_at, deletion_scheduled_at
+	`
+	const op = errs.Op("user.UpdateProfile")
+	var result User
+
+	err := db.GetContext(ctx, &result, query, user.Username, user.Bio, user.Locale, user.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return result, errs.E(op, errs.KindBadRequest, err, "unknown user")
+		}
+
+		return result, errs.E(op, errs.KindUnexpected, err, "cannot update profile")
+	}
+
+	return result, nil
+}
+
+// ScheduleUserDeletion marks the user to be purged at, mails are queued in the same transaction.
+func ScheduleUserDeletion(ctx context.Context, db *sqlx.DB, userID string, at time.Time, mails ...OutboxMail) error {
+	query := `UPDATE users SET deletion_scheduled_at = $1, updated_at = now() WHERE id = $2`
+	const op = errs.Op("user.ScheduleDeletion")
+
+	return withMails(ctx, db, mails, func(q sqlx.ExtContext) error {
+		if _, err := q.ExecContext(ctx, query, at, userID); err != nil {
+			return errs.E(op, errs.KindUnexpected, err, "cannot delete account")
+		}
+
+		return nil
+	})
+}
+
+func CancelUserDeletion(ctx context.Context, db *sqlx.DB, userID string) error {
+	query := `
+		UPDATE users SET deletion_scheduled_at = NULL, updated_at = now()
+		WHERE id = $1 AND deletion_scheduled_at IS NOT NULL
+	`
+	const op = errs.Op("user.CancelDeletion")
+
+	res, err := db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot restore account")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot restore account")
+	}
+
+	if affected == 0 {
+		return errs.E(op, errs.KindBadRequest, sql.ErrNoRows, "account is not scheduled for deletion")
+	}
+
+	return nil
+}
+
+// PurgeScheduledUsers removes every user whose deletion is due, along with their follows and posts,
+// and returns their ids.
+func PurgeScheduledUsers(ctx context.Context, db *sqlx.DB, now time.Time) ([]string, error) {
+	const op = errs.Op("user.PurgeScheduled")
+
+	tx, err := db.BeginTxx(ctx, nil)
 	if err != nil {
-		return "", errs.E(op, errs.KindUnexpected, err, "unexpected error.")
+		return nil, errs.E(op, errs.KindUnexpected, err, "cannot purge users")
+	}
+
+	defer tx.Rollback()
+
+	var ids []string
+
+	err = tx.SelectContext(ctx, &ids, `SELECT id FROM users WHERE deletion_scheduled_at <= $1 FOR UPDATE`, now)
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "cannot purge users")
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	// queued mails tied by user_id cascade, the verification mail only knows the address
+	queries := []string{
+		`DELETE FROM mail_outbox WHERE recipient_email IN (SELECT email FROM users WHERE id = ANY($1))`,
+		`DELETE FROM user_follows WHERE user_id = ANY($1) OR user_follow_id = ANY($1)`,
+		`DELETE FROM posts WHERE user_id = ANY($1)`,
+		`DELETE FROM users WHERE id = ANY($1)`,
+	}
+
+	for _, q := range queries {
+		if _, err := tx.ExecContext(ctx, q, pq.Array(ids)); err != nil {
+			return nil, errs.E(op, errs.KindUnexpected, err, "cannot purge users")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "cannot purge users")
 	}
 
-	return string(hashed), nil
+	return ids, nil
 }
@@ -34,7 +34,7 @@ func FollowUser(ctx context.Context, db *sqlx.DB, userID string, userWantsToFoll
 }
 
 func UnfollowUser(ctx context.Context, db *sqlx.DB, userID string, userWantsToUnfollow string) error {
-	q := `DELETE FROM user_follow WHERE user_id = $1 AND user_follow_id = $2`
+	q := `DELETE FROM user_follows WHERE user_id = $1 AND user_follow_id = $2`
 	const op = errs.Op("user_follow.UnfollowUser")
 
 	_, err := db.ExecContext(ctx, q, userID, userWantsToUnfollow)
@@ -48,3 +48,18 @@ func UnfollowUser(ctx context.Context, db *sqlx.DB, userID string, userWantsToUn
 
 	return nil
 }
+
+// FollowerIDs returns the ids of the users following userID.
+func FollowerIDs(ctx context.Context, db *sqlx.DB, userID string) ([]string, error) {
+	q := `SELECT user_id FROM user_follows WHERE user_follow_id = $1`
+	const op = errs.Op("user_follow.FollowerIDs")
+
+	var ids []string
+
+	err := db.SelectContext(ctx, &ids, q, userID)
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "cannot find the followers.")
+	}
+
+	return ids, nil
+}
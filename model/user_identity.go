@@ -0,0 +1,153 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/samuelsih/guwu/pkg/errs"
+	"github.com/samuelsih/guwu/pkg/pgerr"
+)
+
+// UserIdentity links a user to an account at an external OpenID Connect provider.
+type UserIdentity struct {
+	ID        string    `db:"id" json:"id"`
+	UserID    string    `db:"user_id" json:"-"`
+	Provider  string    `db:"provider" json:"provider"`
+	Subject   string    `db:"subject" json:"-"`
+	Email     string    `db:"email" json:"email"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+func FindUserByIdentity(ctx context.Context, db *sqlx.DB, provider, subject string) (User, error) {
+	query := `
+		SELECT u.id, u.username, u.email, u.password, u.bio, u.locale, u.created_at, u.updated_at, u.deletion_scheduled_at
+		FROM user_identities i JOIN users u ON u.id = i.user_id
+		WHERE i.provider = $1 AND i.subject = $2
+	`
+	const op = errs.Op("user_identity.FindUser")
+	var user User
+
+	err := db.GetContext(ctx, &user, query, provider, subject)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user, errs.E(op, errs.KindNotFound, err, "unknown identity")
+		}
+
+		return user, errs.E(op, errs.KindUnexpected, err, "cannot get user")
+	}
+
+	return user, nil
+}
+
+func InsertUserIdentity(ctx context.Context, db *sqlx.DB, identity UserIdentity) (UserIdentity, error) {
+	const op = errs.Op("user_identity.Insert")
+
+	result, err := insertUserIdentity(ctx, db, identity)
+	if err != nil {
+		return result, errs.E(op, errs.GetKind(err), err, err.Error())
+	}
+
+	return result, nil
+}
+
+// InsertSocialUser creates a user without password together with its first identity.
+func InsertSocialUser(ctx context.Context, db *sqlx.DB, username, email string, identity UserIdentity) (User, error) {
+	query := `
+		INSERT INTO users(username, email)
+		VALUES ($1, $2)
+		RETURNING id, username, email, password, bio, locale, created_at, updated_at, deletion_scheduled_at;
+	`
+	const op = errs.Op("user_identity.InsertSocialUser")
+	var user User
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return user, errs.E(op, errs.KindUnexpected, err, "unexpected error.")
+	}
+
+	defer tx.Rollback()
+
+	err = tx.GetContext(ctx, &user, query, username, email)
+	if err != nil {
+		if column, e := pgerr.UniqueColumn(err); e != nil {
+			clientMsg := fmt.Sprintf("%v already taken, please take another %v", column, column)
+			return user, errs.E(op, errs.KindBadRequest, e, clientMsg)
+		}
+
+		return user, errs.E(op, errs.KindUnexpected, err, "unexpected error.")
+	}
+
+	identity.UserID = user.ID
+
+	if _, err := insertUserIdentity(ctx, tx, identity); err != nil {
+		return user, errs.E(op, errs.GetKind(err), err, err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return user, errs.E(op, errs.KindUnexpected, err, "unexpected error.")
+	}
+
+	return user, nil
+}
+
+func insertUserIdentity(ctx context.Context, db sqlx.QueryerContext, identity UserIdentity) (UserIdentity, error) {
+	query := `
+		INSERT INTO user_identities(user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, user_id, provider, subject, email, created_at;
+	`
+	const op = errs.Op("user_identity.insert")
+	var result UserIdentity
+
+	err := sqlx.GetContext(ctx, db, &result, query, identity.UserID, identity.Provider, identity.Subject, identity.Email)
+	if err != nil {
+		if _, e := pgerr.UniqueColumn(err); e != nil {
+			return result, errs.E(op, errs.KindBadRequest, e, "this provider account is already linked")
+		}
+
+		return result, errs.E(op, errs.KindUnexpected, err, "cannot link account")
+	}
+
+	return result, nil
+}
+
+func ListUserIdentities(ctx context.Context, db *sqlx.DB, userID string) ([]UserIdentity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, email, created_at
+		FROM user_identities WHERE user_id = $1 ORDER BY created_at
+	`
+	const op = errs.Op("user_identity.List")
+	identities := []UserIdentity{}
+
+	err := db.SelectContext(ctx, &identities, query, userID)
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "cannot get linked accounts")
+	}
+
+	return identities, nil
+}
+
+func DeleteUserIdentity(ctx context.Context, db *sqlx.DB, userID, provider string) error {
+	query := `DELETE FROM user_identities WHERE user_id = $1 AND provider = $2`
+	const op = errs.Op("user_identity.Delete")
+
+	res, err := db.ExecContext(ctx, query, userID, provider)
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot unlink account")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cannot unlink account")
+	}
+
+	if affected == 0 {
+		return errs.E(op, errs.KindNotFound, sql.ErrNoRows, "provider is not linked")
+	}
+
+	return nil
+}
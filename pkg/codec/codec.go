@@ -0,0 +1,220 @@
+// Package codec lists the media types the API speaks and negotiates between them.
+//
+// MessagePack and CBOR are transcoded through JSON, so the json tags and the
+// MarshalJSON / UnmarshalJSON methods of the business types apply to every encoding.
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	JSON_MEDIA_TYPE    = "application/json"
+	MSGPACK_MEDIA_TYPE = "application/msgpack"
+	CBOR_MEDIA_TYPE    = "application/cbor"
+)
+
+type Codec struct {
+	// Name is how errors refer to the encoding, e.g. "JSON".
+	Name      string
+	MediaType string
+
+	marshal   func(v any) ([]byte, error)
+	unmarshal func(data []byte, v any) error
+}
+
+var (
+	JSON = Codec{Name: "JSON", MediaType: JSON_MEDIA_TYPE}
+
+	MessagePack = Codec{
+		Name:      "MessagePack",
+		MediaType: MSGPACK_MEDIA_TYPE,
+		marshal:   msgpack.Marshal,
+		unmarshal: msgpack.Unmarshal,
+	}
+
+	CBOR = Codec{
+		Name:      "CBOR",
+		MediaType: CBOR_MEDIA_TYPE,
+		marshal:   cbor.Marshal,
+		unmarshal: cborDecMode.Unmarshal,
+	}
+
+	// Codecs are in order of preference when the client accepts several equally.
+	Codecs = []Codec{JSON, MessagePack, CBOR}
+
+	cborDecMode, _ = cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]any{})}.DecMode()
+
+	ErrNotAcceptable = errors.New("none of the accepted media types can be produced")
+)
+
+// Binary reports whether c is transcoded through JSON.
+func (c Codec) Binary() bool {
+	return c.marshal != nil
+}
+
+// Marshal encodes v as its JSON document would be, in the encoding of c.
+func (c Codec) Marshal(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || !c.Binary() {
+		return data, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	return c.marshal(numbers(doc))
+}
+
+// ToJSON turns a document of c into JSON, to be decoded with the JSON rules.
+func (c Codec) ToJSON(data []byte) ([]byte, error) {
+	if !c.Binary() {
+		return data, nil
+	}
+
+	var doc any
+	if err := c.unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("body contains badly-formed %s", c.Name)
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("body contains %s values without a JSON equivalent", c.Name)
+	}
+
+	return out, nil
+}
+
+// ForContentType returns the codec of a Content-Type header, JSON when it is empty.
+func ForContentType(contentType string) (Codec, bool) {
+	if contentType == "" {
+		return JSON, true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return Codec{}, false
+	}
+
+	for _, c := range Codecs {
+		if c.MediaType == mediaType {
+			return c, true
+		}
+	}
+
+	return Codec{}, false
+}
+
+// Negotiate picks the codec the Accept header prefers, JSON when the header is empty.
+func Negotiate(accept string) (Codec, error) {
+	if strings.TrimSpace(accept) == "" {
+		return JSON, nil
+	}
+
+	type candidate struct {
+		codec Codec
+		q     float64
+	}
+
+	var candidates []candidate
+
+	for _, c := range Codecs {
+		if q := quality(accept, c.MediaType); q > 0 {
+			candidates = append(candidates, candidate{c, q})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return Codec{}, ErrNotAcceptable
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+
+	return candidates[0].codec, nil
+}
+
+// quality is the weight the Accept header gives to mediaType, the most specific range wins.
+// application/problem+json counts as JSON since clients accepting errors as problems expect JSON.
+func quality(accept, mediaType string) float64 {
+	q, specificity := 0.0, -1
+	mainType, _, _ := strings.Cut(mediaType, "/")
+
+	for _, part := range strings.Split(accept, ",") {
+		name, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		var s int
+		switch {
+		case name == mediaType || (mediaType == JSON_MEDIA_TYPE && strings.HasSuffix(name, "+json")):
+			s = 2
+		case name == mainType+"/*":
+			s = 1
+		case name == "*/*":
+			s = 0
+		default:
+			continue
+		}
+
+		if s < specificity {
+			continue
+		}
+
+		weight := 1.0
+		if value, ok := params["q"]; ok {
+			if weight, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+
+		if s > specificity || weight > q {
+			q, specificity = weight, s
+		}
+	}
+
+	return q
+}
+
+// numbers turns the json.Number of doc into integers where they fit, floats otherwise.
+func numbers(doc any) any {
+	switch v := doc.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+
+		f, _ := v.Float64()
+		return f
+
+	case map[string]any:
+		for key, value := range v {
+			v[key] = numbers(value)
+		}
+
+	case []any:
+		for i, value := range v {
+			v[i] = numbers(value)
+		}
+	}
+
+	return doc
+}
@@ -0,0 +1,86 @@
+package codec
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+		err    error
+	}{
+		{"", JSON_MEDIA_TYPE, nil},
+		{"*/*", JSON_MEDIA_TYPE, nil},
+		{"application/json, application/problem+json", JSON_MEDIA_TYPE, nil},
+		{"application/msgpack", MSGPACK_MEDIA_TYPE, nil},
+		{"application/json;q=0.5, application/cbor", CBOR_MEDIA_TYPE, nil},
+		{"application/*, application/json;q=0", MSGPACK_MEDIA_TYPE, nil},
+		{"text/html", "", ErrNotAcceptable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			got, err := Negotiate(tt.accept)
+			if err != tt.err || got.MediaType != tt.want {
+				t.Fatalf("expected %q %v, got %q %v", tt.want, tt.err, got.MediaType, err)
+			}
+		})
+	}
+}
+
+type document struct {
+	Name    string    `json:"name"`
+	Count   int64     `json:"count"`
+	Created time.Time `json:"created_at"`
+	Skipped string    `json:"skipped,omitempty"`
+}
+
+func TestMarshalFollowsJSON(t *testing.T) {
+	in := document{Name: "bob", Count: 1 << 60, Created: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+
+	for _, c := range []Codec{MessagePack, CBOR} {
+		t.Run(c.Name, func(t *testing.T) {
+			data, err := c.Marshal(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got map[string]any
+			if c.MediaType == MSGPACK_MEDIA_TYPE {
+				err = msgpack.Unmarshal(data, &got)
+			} else {
+				err = cbor.Unmarshal(data, &got)
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got["name"] != "bob" || got["created_at"] != "2026-01-02T03:04:05Z" || len(got) != 3 {
+				t.Fatalf("expected the JSON fields, got %v", got)
+			}
+
+			body, err := c.ToJSON(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var out document
+			if err := json.Unmarshal(body, &out); err != nil || out != in {
+				t.Fatalf("expected %+v back, got %+v %v", in, out, err)
+			}
+		})
+	}
+}
+
+func TestToJSONMalformed(t *testing.T) {
+	if _, err := MessagePack.ToJSON([]byte{0xc1}); err == nil || err.Error() != "body contains badly-formed MessagePack" {
+		t.Fatalf("expected a malformed body, got %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package mail
+
+// Category groups the mails a user can opt out of together.
+type Category string
+
+const (
+	// TransactionalCategory are the mails about the account itself, they are always sent.
+	TransactionalCategory Category = "transactional"
+	FollowsCategory       Category = "follows"
+	DigestCategory        Category = "digest"
+)
+
+var Categories = []Category{TransactionalCategory, FollowsCategory, DigestCategory}
+
+// templateCategories maps the non transactional types to their category.
+var templateCategories = map[MsgType]Category{
+	DigestMsg: DigestCategory,
+}
+
+// Category is the category of m, TransactionalCategory unless mapped otherwise.
+func (m MsgType) Category() Category {
+	if c, ok := templateCategories[m]; ok {
+		return c
+	}
+
+	return TransactionalCategory
+}
+
+// Optional reports whether users may unsubscribe from c.
+func (c Category) Optional() bool {
+	return c != TransactionalCategory
+}
+
+func ParseCategory(name string) (Category, bool) {
+	for _, c := range Categories {
+		if string(c) == name {
+			return c, true
+		}
+	}
+
+	return "", false
+}
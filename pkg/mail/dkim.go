@@ -0,0 +1,261 @@
+package mail
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/samuelsih/guwu/pkg/errs"
+)
+
+const DKIM_HEADER = "DKIM-Signature"
+
+// DefaultDKIMHeaders are the headers signed when the signer is given none,
+// the ones missing from a message are left out of its signature.
+var DefaultDKIMHeaders = []string{
+	"From", "To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type",
+	"List-Unsubscribe", "List-Unsubscribe-Post",
+}
+
+var errDKIMKey = errors.New("dkim key must be a PEM encoded RSA or Ed25519 private key")
+
+// DKIMSigner signs messages for Domain with the key published at Selector._domainkey.Domain,
+// using the relaxed/relaxed canonicalization of RFC 6376.
+type DKIMSigner struct {
+	Domain   string
+	Selector string
+	Headers  []string
+
+	key       crypto.Signer
+	algorithm string
+	hash      crypto.Hash
+	now       func() time.Time
+}
+
+// NewDKIMSigner parses keyPEM, a PKCS#1 RSA key or a PKCS#8 RSA or Ed25519 key.
+// DefaultDKIMHeaders are signed when headers is empty.
+func NewDKIMSigner(domain, selector string, keyPEM []byte, headers []string) (*DKIMSigner, error) {
+	const op = errs.Op("mail.NewDKIMSigner")
+
+	if domain == "" || selector == "" {
+		return nil, errs.E(op, errs.KindUnexpected, errDKIMKey, "dkim domain and selector are required")
+	}
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errs.E(op, errs.KindUnexpected, errDKIMKey, errDKIMKey.Error())
+	}
+
+	var key any
+	var err error
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, errDKIMKey.Error())
+	}
+
+	s := &DKIMSigner{Domain: domain, Selector: selector, Headers: headers, now: time.Now}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		s.key, s.algorithm, s.hash = k, "rsa-sha256", crypto.SHA256
+	case ed25519.PrivateKey:
+		// RFC 8463, the pure Ed25519 signature is over the sha256 of the headers
+		s.key, s.algorithm, s.hash = k, "ed25519-sha256", crypto.Hash(0)
+	default:
+		return nil, errs.E(op, errs.KindUnexpected, errDKIMKey, errDKIMKey.Error())
+	}
+
+	if len(s.Headers) == 0 {
+		s.Headers = DefaultDKIMHeaders
+	}
+
+	return s, nil
+}
+
+// LoadDKIMSigner reads the key of NewDKIMSigner from keyFile.
+func LoadDKIMSigner(domain, selector, keyFile string, headers []string) (*DKIMSigner, error) {
+	const op = errs.Op("mail.LoadDKIMSigner")
+
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "cannot read dkim key")
+	}
+
+	return NewDKIMSigner(domain, selector, keyPEM, headers)
+}
+
+// Sign returns the value of the DKIM-Signature header of the raw message,
+// folded to be written as is in front of the other headers.
+func (s *DKIMSigner) Sign(raw []byte) (string, error) {
+	const op = errs.Op("mail.DKIMSigner.Sign")
+
+	headers, body := splitMessage(raw)
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+
+	var names []string
+	var signed bytes.Buffer
+
+	used := map[string]int{}
+	for _, name := range s.Headers {
+		key := strings.ToLower(strings.TrimSpace(name))
+
+		// the same header signed twice takes the occurrences from the bottom up
+		field, ok := lastHeader(headers, key, used[key])
+		if !ok {
+			continue
+		}
+
+		used[key]++
+		names = append(names, key)
+		signed.WriteString(relaxedHeader(field))
+		signed.WriteString("\r\n")
+	}
+
+	tags := []string{
+		"v=1",
+		"a=" + s.algorithm,
+		"c=relaxed/relaxed",
+		"d=" + s.Domain,
+		"s=" + s.Selector,
+		fmt.Sprintf("t=%d", s.now().Unix()),
+		"h=" + strings.Join(names, ":"),
+		"bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]),
+	}
+
+	value := strings.Join(tags, ";\r\n\t") + ";\r\n\tb="
+
+	// the signature header is hashed last, without its own signature nor trailing CRLF
+	signed.WriteString(relaxedHeader(DKIM_HEADER + ": " + value))
+
+	digest := sha256.Sum256(signed.Bytes())
+
+	sig, err := s.key.Sign(rand.Reader, digest[:], s.hash)
+	if err != nil {
+		return "", errs.E(op, errs.KindUnexpected, err, "cannot sign message")
+	}
+
+	return value + foldBase64(base64.StdEncoding.EncodeToString(sig)), nil
+}
+
+// splitMessage returns the header fields, unfolded lines kept with their continuation, and the body.
+func splitMessage(raw []byte) ([]string, []byte) {
+	head, body, found := bytes.Cut(raw, []byte("\r\n\r\n"))
+	if !found {
+		body = nil
+	}
+
+	var fields []string
+	for _, line := range strings.Split(string(head), "\r\n") {
+		if len(fields) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			fields[len(fields)-1] += "\r\n" + line
+			continue
+		}
+
+		fields = append(fields, line)
+	}
+
+	return fields, body
+}
+
+// lastHeader returns the field named key skipping the skip last ones.
+func lastHeader(fields []string, key string, skip int) (string, bool) {
+	for i := len(fields) - 1; i >= 0; i-- {
+		name, _, _ := strings.Cut(fields[i], ":")
+		if strings.ToLower(strings.TrimSpace(name)) != key {
+			continue
+		}
+
+		if skip == 0 {
+			return fields[i], true
+		}
+
+		skip--
+	}
+
+	return "", false
+}
+
+// relaxedHeader canonicalizes a header field, RFC 6376 section 3.4.2.
+func relaxedHeader(field string) string {
+	name, value, _ := strings.Cut(field, ":")
+
+	value = strings.NewReplacer("\r\n", "").Replace(value)
+
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.TrimSpace(collapseWSP(value))
+}
+
+// relaxedBody canonicalizes a body, RFC 6376 section 3.4.4.
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(collapseWSP(line), " ")
+	}
+
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// collapseWSP replaces every run of spaces and tabs by a single space.
+func collapseWSP(s string) string {
+	var b strings.Builder
+	space := false
+
+	for _, r := range s {
+		if r == ' ' || r == '\t' {
+			space = true
+			continue
+		}
+
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+
+		b.WriteRune(r)
+	}
+
+	if space {
+		b.WriteByte(' ')
+	}
+
+	return b.String()
+}
+
+func foldBase64(s string) string {
+	const width = 72
+
+	var parts []string
+	for len(s) > width {
+		parts = append(parts, s[:width])
+		s = s[width:]
+	}
+
+	return strings.Join(append(parts, s), "\r\n\t")
+}
@@ -0,0 +1,215 @@
+package mail
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRelaxedCanonicalization(t *testing.T) {
+	// RFC 6376 section 3.4.5
+	fields, body := splitMessage([]byte("A: X\r\nB : Y\t\r\n\tZ  \r\n\r\n C \r\nD \t E\r\n\r\n\r\n"))
+
+	var headers []string
+	for _, f := range fields {
+		headers = append(headers, relaxedHeader(f))
+	}
+
+	if got := strings.Join(headers, "\r\n"); got != "a:X\r\nb:Y Z" {
+		t.Fatalf("relaxedHeader() = %q", got)
+	}
+
+	if got := string(relaxedBody(body)); got != " C\r\nD E\r\n" {
+		t.Fatalf("relaxedBody() = %q", got)
+	}
+
+	if got := relaxedBody([]byte("\r\n\r\n")); len(got) != 0 {
+		t.Fatalf("expected an empty body, got %q", got)
+	}
+}
+
+func TestDKIMSigner(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		key    []byte
+		public crypto.PublicKey
+	}{
+		{"RSA", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), &rsaKey.PublicKey},
+		{"Ed25519", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), edPublic},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, err := NewDKIMSigner("gmail.com", "guwu", tt.key, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c := newTestClient(NewMemorySender())
+			c.DKIM = signer
+
+			raw := renderRaw(t, c)
+
+			tags := verifyDKIM(t, raw, tt.public)
+			if tags["d"] != "gmail.com" || tags["s"] != "guwu" || tags["h"] != "from:to:subject:date:message-id:mime-version:content-type" {
+				t.Fatalf("unexpected tags: %v", tags)
+			}
+
+			tampered := bytes.Replace(raw, []byte("1234"), []byte("9999"), 1)
+			if bodyHash(tampered) == tags["bh"] {
+				t.Fatal("expected the body hash to change with the body")
+			}
+		})
+	}
+}
+
+func TestDKIMSignerHeaders(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := NewDKIMSigner("gmail.com", "guwu", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), []string{"From", "Subject", "X-Missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestClient(NewMemorySender())
+	c.DKIM = signer
+
+	tags := verifyDKIM(t, renderRaw(t, c), key.Public())
+	if tags["h"] != "from:subject" {
+		t.Fatalf("expected the configured headers present in the message, got %q", tags["h"])
+	}
+}
+
+func TestNewDKIMSignerInvalidKey(t *testing.T) {
+	if _, err := NewDKIMSigner("gmail.com", "guwu", []byte("not a key"), nil); err == nil {
+		t.Fatal("expected an error for a key that is not PEM")
+	}
+
+	block := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("garbage")})
+	if _, err := NewDKIMSigner("gmail.com", "guwu", block, nil); err == nil {
+		t.Fatal("expected an error for an invalid key")
+	}
+}
+
+func renderRaw(t *testing.T, c Client) []byte {
+	t.Helper()
+
+	m, err := c.Render(Param{Name: "Foo", Email: "foo@gmail.com", TemplateTypes: OTPMsg}, OTPTplData{Username: "Agus", OTP: "1234"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := m.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var raw bytes.Buffer
+	if _, err := msg.WriteTo(&raw); err != nil {
+		t.Fatal(err)
+	}
+
+	return raw.Bytes()
+}
+
+func bodyHash(raw []byte) string {
+	_, body := splitMessage(raw)
+	sum := sha256.Sum256(relaxedBody(body))
+
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// verifyDKIM checks the signature of raw the way a receiving server does and returns its tags.
+func verifyDKIM(t *testing.T, raw []byte, public crypto.PublicKey) map[string]string {
+	t.Helper()
+
+	fields, _ := splitMessage(raw)
+
+	field, ok := lastHeader(fields, "dkim-signature", 0)
+	if !ok {
+		t.Fatalf("message is not signed:\n%s", raw)
+	}
+
+	_, value, _ := strings.Cut(field, ":")
+
+	tags := map[string]string{}
+	for _, tag := range strings.Split(value, ";") {
+		k, v, _ := strings.Cut(tag, "=")
+		tags[strings.TrimSpace(k)] = strings.Join(strings.Fields(v), "")
+	}
+
+	if tags["bh"] != bodyHash(raw) {
+		t.Fatalf("body hash %q does not match the body", tags["bh"])
+	}
+
+	var signed bytes.Buffer
+	used := map[string]int{}
+
+	for _, name := range strings.Split(tags["h"], ":") {
+		f, ok := lastHeader(fields, name, used[name])
+		if !ok {
+			t.Fatalf("signed header %q is missing", name)
+		}
+
+		used[name]++
+		signed.WriteString(relaxedHeader(f) + "\r\n")
+	}
+
+	// the signature header is hashed with an empty b= tag
+	loc := regexp.MustCompile(`;\s*b=`).FindStringIndex(field)
+	signed.WriteString(relaxedHeader(field[:loc[1]]))
+
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := sha256.Sum256(signed.Bytes())
+
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, digest[:], sig) {
+			err = rsa.ErrVerification
+		}
+	}
+
+	if err != nil {
+		t.Fatalf("signature does not verify: %v\n%s", err, raw)
+	}
+
+	return tags
+}
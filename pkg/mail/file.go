@@ -0,0 +1,61 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/samuelsih/guwu/pkg/errs"
+)
+
+// FileSender writes every message as an .eml file in the maildir at Dir,
+// so a mail client can open what would have been sent.
+type FileSender struct {
+	Dir string
+
+	seq atomic.Uint64
+}
+
+// NewFileSender creates the tmp, new and cur directories of the maildir.
+func NewFileSender(dir string) (*FileSender, error) {
+	const op = errs.Op("mail.NewFileSender")
+
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, errs.E(op, errs.KindUnexpected, err, "cannot create maildir")
+		}
+	}
+
+	return &FileSender{Dir: dir}, nil
+}
+
+// Send writes the message in tmp then moves it to new, readers never see a partial file.
+func (s *FileSender) Send(ctx context.Context, m Message) error {
+	const op = errs.Op("mail.FileSender.Send")
+
+	if err := ctx.Err(); err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cant send message")
+	}
+
+	msg, err := m.build()
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d.%d_%d.guwu.eml", time.Now().UnixNano(), os.Getpid(), s.seq.Add(1))
+	tmp := filepath.Join(s.Dir, "tmp", name)
+
+	if err := msg.WriteToFile(tmp); err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cant write message")
+	}
+
+	if err := os.Rename(tmp, filepath.Join(s.Dir, "new", name)); err != nil {
+		os.Remove(tmp)
+		return errs.E(op, errs.KindUnexpected, err, "cant write message")
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSender(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "maildir")
+
+	sender, err := NewFileSender(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileClient := newTestClient(sender)
+
+	p := Param{Name: "Foo", Email: "foo@gmail.com", TemplateTypes: OTPMsg, Locale: "id"}
+
+	for i := 0; i < 2; i++ {
+		if err := fileClient.Send(context.Background(), p, OTPTplData{Username: "Agus", OTP: "1234"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := os.ReadDir(filepath.Join(dir, "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 2 {
+		t.Fatalf("expected 2 messages in new, got %d", len(files))
+	}
+
+	if tmp, _ := os.ReadDir(filepath.Join(dir, "tmp")); len(tmp) != 0 {
+		t.Fatalf("expected tmp to be empty, got %d files", len(tmp))
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "new", files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"To: \"Foo\" <foo@gmail.com>", "Subject: Verifikasi Email", "text/plain", "text/html"} {
+		if !strings.Contains(string(content), want) {
+			t.Fatalf("message misses %q:\n%s", want, content)
+		}
+	}
+}
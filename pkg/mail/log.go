@@ -0,0 +1,17 @@
+package mail
+
+import (
+	"context"
+
+	"github.com/samuelsih/guwu/pkg/logger"
+)
+
+// LogSender only logs the messages, the text body is logged in debug mode.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, m Message) error {
+	logger.SysInfof("mail %v to %s <%s>: %s", m.Template, m.ToName, m.ToEmail, m.Subject)
+	logger.Debug(m.Text)
+
+	return nil
+}
@@ -1,11 +1,12 @@
 package mail
 
 import (
+	"bytes"
 	"context"
-	_ "embed"
-	"errors"
-	ht "html/template"
-	tt "text/template"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	netmail "net/mail"
 
 	"github.com/samuelsih/guwu/pkg/errs"
 	"github.com/wneessen/go-mail"
@@ -13,30 +14,42 @@ import (
 
 type MsgType int
 
-var (
-	//go:embed otp.html
-	otpHTML string
-
-	//go:embed otp.txt
-	otpTxt string
-)
-
 const (
 	OTPMsg MsgType = iota
 	RecoverPasswdMsg
+	EmailChangedMsg
+	AccountDeletionMsg
+	DigestMsg
+
+	// msgTypeCount stays last, NewRegistry checks every type before it has templates.
+	msgTypeCount
 )
 
+// Client renders the templates of a Registry and delivers them through a Sender.
 type Client struct {
-	client      *mail.Client
+	sender      Sender
 	senderName  string
 	senderEmail string
+	templates   *Registry
+
+	// Unsubscribe returns the one-click unsubscribe URL of userID from category,
+	// mails of an optional category carry it when set.
+	Unsubscribe func(userID string, category Category) (string, error)
+
+	// DKIM signs every message when set.
+	DKIM *DKIMSigner
 }
 
+// Param addresses a mail. Subject is used when the template does not define one,
+// Locale picks the template variant and falls back to DEFAULT_LOCALE,
+// UserID identifies the recipient to unsubscribe.
 type Param struct {
 	Name          string
 	Email         string
 	Subject       string
 	TemplateTypes MsgType
+	Locale        string
+	UserID        string
 }
 
 type OTPTplData struct {
@@ -49,83 +62,193 @@ type RecoverPasswdTplData struct {
 	GeneratedLink string
 }
 
-func NewClient(host string, port int, username, password, senderName, senderEmail string) (Client, error) {
-	const op = errs.Op("mail.NewClient")
+type EmailChangedTplData struct {
+	Username string
+	NewEmail string
+}
 
-	client, err := mail.NewClient(host,
-		mail.WithPort(port),
-		mail.WithTLSPolicy(mail.TLSOpportunistic),
-		mail.WithSMTPAuth(mail.SMTPAuthPlain),
-		mail.WithUsername(username),
-		mail.WithPassword(password),
-	)
+type AccountDeletionTplData struct {
+	Username string
+	DeleteAt string
+}
 
-	if err != nil {
-		return Client{}, errs.E(op, errs.KindUnexpected, err, "unexpected server error")
-	}
+// DigestTplData is the activity since the last digest, Frequency is daily or weekly.
+type DigestTplData struct {
+	Username      string
+	Frequency     string
+	FollowerCount int
+	Followers     []string
+	Mentions      []DigestPost
+	Posts         []DigestPost
+}
+
+type DigestPost struct {
+	Username string
+	Excerpt  string
+}
+
+// Message is a rendered mail handed to a Sender.
+type Message struct {
+	FromName  string
+	FromEmail string
+	ToName    string
+	ToEmail   string
+	Subject   string
+	HTML      string
+	Text      string
+
+	Template MsgType
+	Locale   string
 
-	return Client{client: client, senderName: senderName, senderEmail: senderEmail}, nil
+	// UnsubscribeURL is sent as List-Unsubscribe when set.
+	UnsubscribeURL string
+
+	dkim *DKIMSigner
+}
+
+// Sender delivers rendered messages, see the SMTP, file, memory and log drivers.
+type Sender interface {
+	Send(ctx context.Context, m Message) error
 }
 
+func NewClient(sender Sender, senderName, senderEmail string, templates *Registry) Client {
+	return Client{sender: sender, senderName: senderName, senderEmail: senderEmail, templates: templates}
+}
+
+// Send renders the template of param with tplData and hands it to the sender.
 func (c Client) Send(ctx context.Context, param Param, tplData any) error {
 	const op = errs.Op("mail.Send")
 
-	htpl, txtpl, err := getTemplateFromType(param.TemplateTypes)
+	m, err := c.Render(param, tplData)
 	if err != nil {
 		return errs.E(op, errs.GetKind(err), err, "cannot generate message")
 	}
 
-	m := mail.NewMsg()
+	if err := c.sender.Send(ctx, m); err != nil {
+		return errs.E(op, errs.GetKind(err), err, "cant send message")
+	}
 
-	if err := m.FromFormat(c.senderName, c.senderEmail); err != nil {
-		return errs.E(op, errs.KindUnexpected, err, "unexpected error")
+	return nil
+}
+
+// Render builds the message Send would deliver.
+func (c Client) Render(param Param, tplData any) (Message, error) {
+	const op = errs.Op("mail.Render")
+
+	if _, err := netmail.ParseAddress(param.Email); err != nil {
+		return Message{}, errs.E(op, errs.KindUnexpected, err, "unexpected error to format")
 	}
 
-	if err := m.AddToFormat(param.Name, param.Email); err != nil {
-		return errs.E(op, errs.KindUnexpected, err, "unexpected error to format")
+	tpl, err := c.templates.Lookup(param.TemplateTypes, param.Locale)
+	if err != nil {
+		return Message{}, err
 	}
 
-	m.Subject(param.Subject)
-	m.SetMessageID()
-	m.SetDate()
+	view := View{Data: tplData}
 
-	if err := m.SetBodyHTMLTemplate(htpl, tplData); err != nil {
-		return errs.E(op, errs.KindUnexpected, err, "can't set body email")
+	if category := param.TemplateTypes.Category(); category.Optional() && param.UserID != "" && c.Unsubscribe != nil {
+		if view.UnsubscribeURL, err = c.Unsubscribe(param.UserID, category); err != nil {
+			return Message{}, errs.E(op, errs.GetKind(err), err, "can't set unsubscribe link")
+		}
 	}
 
-	if err := m.AddAlternativeTextTemplate(txtpl, tplData); err != nil {
-		return errs.E(op, errs.KindUnexpected, err, "can't set body text")
+	subject, html, text, err := tpl.render(view)
+	if err != nil {
+		return Message{}, errs.E(op, errs.KindUnexpected, err, "can't set body email")
 	}
 
-	if err := c.client.DialAndSendWithContext(ctx, m); err != nil {
-		return errs.E(op, errs.KindUnexpected, err, "cant send message")
+	if subject == "" {
+		subject = param.Subject
 	}
 
-	return nil
+	return Message{
+		FromName:  c.senderName,
+		FromEmail: c.senderEmail,
+		ToName:    param.Name,
+		ToEmail:   param.Email,
+		Subject:   subject,
+		HTML:      html,
+		Text:      text,
+		Template:  param.TemplateTypes,
+		Locale:    param.Locale,
+
+		UnsubscribeURL: view.UnsubscribeURL,
+
+		dkim: c.DKIM,
+	}, nil
+}
+
+// Templates is the registry the client renders.
+func (c Client) Templates() *Registry {
+	return c.templates
 }
 
+// Close releases the sender when it holds a connection.
 func (c *Client) Close() error {
-	return c.client.Close()
+	if closer, ok := c.sender.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
 }
 
-func getTemplateFromType(msgType MsgType) (*ht.Template, *tt.Template, error) {
-	const op = errs.Op("mail.getTemplateFromType")
+// build turns m into a MIME message for the drivers writing one.
+func (m Message) build() (*mail.Msg, error) {
+	const op = errs.Op("mail.build")
 
-	switch msgType {
-	case OTPMsg:
-		htpl, err := ht.New("htmltpl").Parse(otpHTML)
-		if err != nil {
-			return nil, nil, errs.E(op, errs.KindUnexpected, err, "unexpected error generating html")
-		}
+	// a fixed boundary keeps the body signed by DKIM the same as the one written
+	boundary, err := newBoundary()
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "unexpected error")
+	}
 
-		txtpl, err := tt.New("texttpl").Parse(otpTxt)
-		if err != nil {
-			return nil, nil, errs.E(op, errs.KindUnexpected, err, "unexpected error generating txt")
-		}
+	msg := mail.NewMsg(mail.WithBoundary(boundary))
+
+	if err := msg.FromFormat(m.FromName, m.FromEmail); err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "unexpected error")
+	}
+
+	if err := msg.AddToFormat(m.ToName, m.ToEmail); err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "unexpected error to format")
+	}
+
+	msg.Subject(m.Subject)
+	msg.SetMessageID()
+	msg.SetDate()
+
+	// RFC 8058, the link is POSTed to without the user opening the mail
+	if m.UnsubscribeURL != "" {
+		msg.SetGenHeader("List-Unsubscribe", "<"+m.UnsubscribeURL+">")
+		msg.SetGenHeader("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	}
 
-		return htpl, txtpl, nil
+	msg.SetBodyString(mail.TypeTextHTML, m.HTML)
+	msg.AddAlternativeString(mail.TypeTextPlain, m.Text)
 
-	default:
-		return nil, nil, errs.E(op, errs.KindUnexpected, errors.New("unknown template"), "unexpected error generating message")
+	if m.dkim == nil {
+		return msg, nil
 	}
+
+	var raw bytes.Buffer
+	if _, err := msg.WriteTo(&raw); err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "cannot write message")
+	}
+
+	signature, err := m.dkim.Sign(raw.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	msg.SetGenHeaderPreformatted(DKIM_HEADER, signature)
+
+	return msg, nil
+}
+
+func newBoundary() (string, error) {
+	b := make([]byte, 30)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
 }
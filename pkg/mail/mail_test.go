@@ -3,26 +3,25 @@ package mail
 import (
 	"context"
 	"log"
-	"os"
-	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/samuelsih/guwu/pkg/errs"
-	"github.com/testcontainers/testcontainers-go"
-	"github.com/testcontainers/testcontainers-go/wait"
 )
 
-var client Client
+var (
+	sent   = NewMemorySender()
+	client = newTestClient(sent)
+)
 
-func TestMain(m *testing.M) {
-	if err := setup(); err != nil {
-		log.Fatal("err client: ", err)
+func newTestClient(sender Sender) Client {
+	templates, err := NewRegistry("")
+	if err != nil {
+		log.Fatal("err templates: ", err)
 	}
 
-	code := m.Run()
-
-	os.Exit(code)
+	return NewClient(sender, "Guwu", "info@gmail.com", templates)
 }
 
 func TestSend(t *testing.T) {
@@ -46,6 +45,16 @@ func TestSend(t *testing.T) {
 		e := err.(*errs.Error)
 		t.Fatalf("success err is not nil: %v", e.Err)
 	}
+
+	found := sent.To("foo@gmail.com")
+	if len(found) == 0 {
+		t.Fatal("no mail sent to foo@gmail.com")
+	}
+
+	m := found[len(found)-1]
+	if m.Template != OTPMsg || m.Subject != "Email Verification" || !strings.Contains(m.Text, "1234") || !strings.Contains(m.HTML, "1234") {
+		t.Fatalf("unexpected message: %+v", m)
+	}
 }
 
 func TestSendMany(t *testing.T) {
@@ -95,6 +104,15 @@ func TestSendMany(t *testing.T) {
 			t.Fatalf("success err is not nil: %v", e.Err)
 		}
 	}
+
+	found := sent.To("tina.tester@example.com")
+	if len(found) == 0 {
+		t.Fatal("no mail sent to tina.tester@example.com")
+	}
+
+	if m := found[len(found)-1]; !strings.Contains(m.Text, "4567") {
+		t.Fatalf("mail of tina has the otp of another recipient: %q", m.Text)
+	}
 }
 
 func TestContextCancellation(t *testing.T) {
@@ -171,38 +189,51 @@ func TestFailParam(t *testing.T) {
 	})
 }
 
-func setup() error {
-	ctx := context.Background()
+func TestUnsubscribe(t *testing.T) {
+	templateCategories[EmailChangedMsg] = FollowsCategory
+	defer delete(templateCategories, EmailChangedMsg)
 
-	req := testcontainers.ContainerRequest{
-		Image:        "mailhog/mailhog:latest",
-		ExposedPorts: []string{"1025/tcp"},
-		WaitingFor:   wait.ForListeningPort("1025/tcp"),
+	c := newTestClient(NewMemorySender())
+	c.Unsubscribe = func(userID string, category Category) (string, error) {
+		return "https://example.com/unsubscribe?token=" + userID + "." + string(category), nil
 	}
 
-	container, err := testcontainers.GenericContainer(
-		ctx,
-		testcontainers.GenericContainerRequest{
-			ContainerRequest: req,
-			Started:          true,
-		},
-	)
+	data := EmailChangedTplData{Username: "Agus", NewEmail: "agus@gmail.com"}
+	link := "https://example.com/unsubscribe?token=1.follows"
 
+	m, err := c.Render(Param{Email: "foo@gmail.com", TemplateTypes: EmailChangedMsg, UserID: "1"}, data)
 	if err != nil {
-		return err
+		t.Fatal(err)
 	}
 
-	mappedPort, err := container.MappedPort(ctx, "1025")
-	if err != nil {
-		return err
+	if m.UnsubscribeURL != link || !strings.Contains(m.Text, link) || !strings.Contains(m.HTML, link) {
+		t.Fatalf("expected the unsubscribe link in the message, got %+v", m)
 	}
-	port, _ := strconv.Atoi(mappedPort.Port())
 
-	hostIP, err := container.Host(ctx)
+	msg, err := m.build()
 	if err != nil {
-		return err
+		t.Fatal(err)
+	}
+
+	var raw strings.Builder
+	if _, err := msg.WriteTo(&raw); err != nil {
+		t.Fatal(err)
 	}
 
-	client, err = NewClient(hostIP, port, "info@gmail.com", "", "Guwu", "info@gmail.com")
-	return err
+	for _, want := range []string{"List-Unsubscribe: <" + link + ">", "List-Unsubscribe-Post: List-Unsubscribe=One-Click"} {
+		if !strings.Contains(raw.String(), want) {
+			t.Fatalf("message misses %q:\n%s", want, raw.String())
+		}
+	}
+
+	t.Run("transactional", func(t *testing.T) {
+		m, err := c.Render(Param{Email: "foo@gmail.com", TemplateTypes: OTPMsg, UserID: "1"}, OTPTplData{Username: "Agus", OTP: "1234"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if m.UnsubscribeURL != "" || strings.Contains(m.Text, "Unsubscribe") {
+			t.Fatalf("transactional mails cannot be unsubscribed from, got %+v", m)
+		}
+	})
 }
@@ -0,0 +1,35 @@
+// Package mailtest provides assertions on the messages recorded by a mail.MemorySender.
+package mailtest
+
+import (
+	"testing"
+
+	"github.com/samuelsih/guwu/pkg/mail"
+)
+
+// ExpectSent fails tb unless the last message to email is of msgType, and returns it.
+func ExpectSent(tb testing.TB, s *mail.MemorySender, email string, msgType mail.MsgType) mail.Message {
+	tb.Helper()
+
+	found := s.To(email)
+	if len(found) == 0 {
+		tb.Fatalf("no mail sent to %s", email)
+		return mail.Message{}
+	}
+
+	last := found[len(found)-1]
+	if last.Template != msgType {
+		tb.Fatalf("last mail to %s is %v, want %v", email, last.Template, msgType)
+	}
+
+	return last
+}
+
+// ExpectNone fails tb when any message was recorded.
+func ExpectNone(tb testing.TB, s *mail.MemorySender) {
+	tb.Helper()
+
+	if messages := s.Messages(); len(messages) != 0 {
+		tb.Fatalf("expected no mail, got %d, the first to %s", len(messages), messages[0].ToEmail)
+	}
+}
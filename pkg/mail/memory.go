@@ -0,0 +1,57 @@
+package mail
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// MemorySender records the messages instead of sending them, for tests.
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+func (s *MemorySender) Send(ctx context.Context, m Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = append(s.messages, m)
+	return nil
+}
+
+// Messages returns a copy of the recorded messages, oldest first.
+func (s *MemorySender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Message(nil), s.messages...)
+}
+
+// To returns the messages sent to email.
+func (s *MemorySender) To(email string) []Message {
+	var found []Message
+
+	for _, m := range s.Messages() {
+		if strings.EqualFold(m.ToEmail, email) {
+			found = append(found, m)
+		}
+	}
+
+	return found
+}
+
+func (s *MemorySender) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = nil
+}
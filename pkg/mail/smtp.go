@@ -0,0 +1,61 @@
+package mail
+
+import (
+	"context"
+
+	"github.com/samuelsih/guwu/pkg/errs"
+	"github.com/wneessen/go-mail"
+)
+
+// SMTPSender delivers messages to an SMTP server. A go-mail client holds a single
+// connection, so every Send dials its own and concurrent sends do not share it.
+type SMTPSender struct {
+	host string
+	opts []mail.Option
+}
+
+func NewSMTPSender(host string, port int, username, password string) (*SMTPSender, error) {
+	const op = errs.Op("mail.NewSMTPSender")
+
+	opts := []mail.Option{
+		mail.WithPort(port),
+		mail.WithTLSPolicy(mail.TLSOpportunistic),
+		mail.WithSMTPAuth(mail.SMTPAuthPlain),
+		mail.WithUsername(username),
+		mail.WithPassword(password),
+	}
+
+	// built once so invalid options fail at startup rather than on the first mail
+	if _, err := mail.NewClient(host, opts...); err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "unexpected server error")
+	}
+
+	return &SMTPSender{host: host, opts: opts}, nil
+}
+
+func (s *SMTPSender) Send(ctx context.Context, m Message) error {
+	const op = errs.Op("mail.SMTPSender.Send")
+
+	msg, err := m.build()
+	if err != nil {
+		return err
+	}
+
+	client, err := mail.NewClient(s.host, s.opts...)
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cant send message")
+	}
+
+	if err := client.DialAndSendWithContext(ctx, msg); err != nil {
+		// the connection is only closed by a successful send
+		client.Close()
+		return errs.E(op, errs.KindUnexpected, err, "cant send message")
+	}
+
+	return nil
+}
+
+// Close has nothing to release, the connections are closed by Send.
+func (s *SMTPSender) Close() error {
+	return nil
+}
@@ -0,0 +1,110 @@
+package mail
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/samuelsih/guwu/pkg/errs"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+func TestSMTPSender(t *testing.T) {
+	sender := setupSMTP(t)
+	defer sender.Close()
+
+	smtpClient := newTestClient(sender)
+
+	p := Param{
+		Name:          "Foo",
+		Email:         "foo@gmail.com",
+		Subject:       "Hello",
+		TemplateTypes: OTPMsg,
+	}
+
+	tplData := OTPTplData{
+		Username: "Agus",
+		OTP:      "1234",
+	}
+
+	t.Run("send", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := smtpClient.Send(ctx, p, tplData); err != nil {
+			e := err.(*errs.Error)
+			t.Fatalf("success err is not nil: %v", e.Err)
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		errc := make(chan error, 8)
+		for i := 0; i < cap(errc); i++ {
+			go func() { errc <- smtpClient.Send(ctx, p, tplData) }()
+		}
+
+		for i := 0; i < cap(errc); i++ {
+			if err := <-errc; err != nil {
+				t.Fatalf("concurrent send err is not nil: %v", err)
+			}
+		}
+	})
+
+	t.Run("context cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+		defer cancel()
+
+		if err := smtpClient.Send(ctx, p, tplData); err == nil {
+			t.Fatal("context deadline not hit")
+		}
+	})
+}
+
+func setupSMTP(t *testing.T) *SMTPSender {
+	t.Helper()
+
+	ctx := context.Background()
+
+	req := testcontainers.ContainerRequest{
+		Image:        "mailhog/mailhog:latest",
+		ExposedPorts: []string{"1025/tcp"},
+		WaitingFor:   wait.ForListeningPort("1025/tcp"),
+	}
+
+	container, err := testcontainers.GenericContainer(
+		ctx,
+		testcontainers.GenericContainerRequest{
+			ContainerRequest: req,
+			Started:          true,
+		},
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { container.Terminate(ctx) })
+
+	mappedPort, err := container.MappedPort(ctx, "1025")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.Atoi(mappedPort.Port())
+
+	hostIP, err := container.Host(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender, err := NewSMTPSender(hostIP, port, "info@gmail.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sender
+}
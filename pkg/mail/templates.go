@@ -0,0 +1,414 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	ht "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	tt "text/template"
+
+	"github.com/samuelsih/guwu/pkg/errs"
+)
+
+// DEFAULT_LOCALE is the locale of the templates at the root of the templates directory,
+// every other locale lives in a directory named after it and falls back to the root.
+const DEFAULT_LOCALE = "en"
+
+const PARTIALS_DIR = "partials"
+
+//go:embed templates
+var embedded embed.FS
+
+var errUnknownTemplate = errors.New("unknown template")
+
+var templateNames = map[MsgType]string{
+	OTPMsg:             "otp",
+	RecoverPasswdMsg:   "recover_password",
+	EmailChangedMsg:    "email_changed",
+	AccountDeletionMsg: "account_deletion",
+	DigestMsg:          "digest",
+}
+
+// samples are the template data of the previews, every template must render its sample.
+var samples = map[MsgType]any{
+	OTPMsg:             OTPTplData{Username: "Jane", OTP: "123456"},
+	RecoverPasswdMsg:   RecoverPasswdTplData{Username: "Jane", GeneratedLink: "https://example.com/recover?token=sample"},
+	EmailChangedMsg:    EmailChangedTplData{Username: "Jane", NewEmail: "jane.new@example.com"},
+	AccountDeletionMsg: AccountDeletionTplData{Username: "Jane", DeleteAt: "Mon, 02 Jan 2006 15:04:05 UTC"},
+	DigestMsg: DigestTplData{
+		Username:      "Jane",
+		Frequency:     "weekly",
+		FollowerCount: 2,
+		Followers:     []string{"John", "Tina"},
+		Mentions:      []DigestPost{{Username: "John", Excerpt: "Lunch with @Jane today"}},
+		Posts:         []DigestPost{{Username: "Tina", Excerpt: "Shipped the new release"}},
+	},
+}
+
+// MsgTypes lists every message type.
+func MsgTypes() []MsgType {
+	types := make([]MsgType, 0, int(msgTypeCount))
+	for msg := MsgType(0); msg < msgTypeCount; msg++ {
+		types = append(types, msg)
+	}
+
+	return types
+}
+
+// ParseMsgType is the MsgType named name, see MsgType.String.
+func ParseMsgType(name string) (MsgType, bool) {
+	for msg, n := range templateNames {
+		if n == name {
+			return msg, true
+		}
+	}
+
+	return 0, false
+}
+
+// Sample returns example template data for msg.
+func Sample(msg MsgType) (any, bool) {
+	data, ok := samples[msg]
+	return data, ok
+}
+
+func (m MsgType) String() string {
+	if name, ok := templateNames[m]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("MsgType(%d)", int(m))
+}
+
+// View is what the layouts render, the message templates only see Data.
+type View struct {
+	Data any
+
+	// UnsubscribeURL is set for the mails of an optional category.
+	UnsubscribeURL string
+}
+
+// Template is the HTML and text variants of a message, both rendered inside the layout of their locale.
+type Template struct {
+	HTML *ht.Template
+	Text *tt.Template
+}
+
+// Subject renders the subject defined by the text variant, empty when it defines none.
+func (t Template) Subject(data any) (string, error) {
+	subject := t.Text.Lookup("subject")
+	if subject == nil {
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	if err := subject.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// render executes both variants and the subject of t.
+func (t Template) render(v View) (subject, html, text string, err error) {
+	if subject, err = t.Subject(v.Data); err != nil {
+		return "", "", "", err
+	}
+
+	var htmlBuf, textBuf bytes.Buffer
+
+	if err := t.HTML.Execute(&htmlBuf, v); err != nil {
+		return "", "", "", err
+	}
+
+	if err := t.Text.Execute(&textBuf, v); err != nil {
+		return "", "", "", err
+	}
+
+	return subject, htmlBuf.String(), textBuf.String(), nil
+}
+
+// Registry holds every template parsed once, by locale.
+type Registry struct {
+	locales map[string]map[MsgType]Template
+}
+
+// NewRegistry parses the embedded templates. Files in overrideDir, laid out the same way,
+// replace the embedded ones so a deployment can rebrand the mails without a rebuild.
+// It fails unless every MsgType has both variants in the default locale.
+func NewRegistry(overrideDir string) (*Registry, error) {
+	const op = errs.Op("mail.NewRegistry")
+
+	base, err := fs.Sub(embedded, "templates")
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "cannot read templates")
+	}
+
+	src := layers{base}
+	if overrideDir != "" {
+		src = layers{os.DirFS(overrideDir), base}
+	}
+
+	locales, err := src.dirs(".")
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "cannot read templates")
+	}
+
+	r := &Registry{locales: map[string]map[MsgType]Template{}}
+
+	for _, locale := range append([]string{DEFAULT_LOCALE}, locales...) {
+		if locale == PARTIALS_DIR {
+			continue
+		}
+
+		templates, err := src.parseLocale(locale)
+		if err != nil {
+			return nil, errs.E(op, errs.KindUnexpected, err, err.Error())
+		}
+
+		r.locales[strings.ToLower(locale)] = templates
+	}
+
+	for _, msg := range MsgTypes() {
+		if _, ok := r.locales[DEFAULT_LOCALE][msg]; !ok {
+			err := fmt.Errorf("%v: missing %v templates", errUnknownTemplate, msg)
+			return nil, errs.E(op, errs.KindUnexpected, err, err.Error())
+		}
+	}
+
+	if err := r.renderSamples(); err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, err.Error())
+	}
+
+	return r, nil
+}
+
+// renderSamples executes every template with its sample, an override naming a field
+// the data does not have fails here rather than when the mail is sent.
+func (r *Registry) renderSamples() error {
+	for locale, templates := range r.locales {
+		for msg, tpl := range templates {
+			data, ok := Sample(msg)
+			if !ok {
+				return fmt.Errorf("missing sample data for %v", msg)
+			}
+
+			view := View{Data: data}
+			if msg.Category().Optional() {
+				view.UnsubscribeURL = "https://example.com/unsubscribe"
+			}
+
+			if _, _, _, err := tpl.render(view); err != nil {
+				return fmt.Errorf("locale %s: %w", locale, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Lookup finds the template of msg for locale, trying its base language then the default locale.
+func (r *Registry) Lookup(msg MsgType, locale string) (Template, error) {
+	const op = errs.Op("mail.Lookup")
+
+	for _, candidate := range localeCandidates(locale) {
+		if t, ok := r.locales[candidate][msg]; ok {
+			return t, nil
+		}
+	}
+
+	return Template{}, errs.E(op, errs.KindUnexpected, errUnknownTemplate, "unexpected error generating message")
+}
+
+// Locales lists the locales having a template for msg, sorted.
+func (r *Registry) Locales(msg MsgType) []string {
+	var locales []string
+
+	for locale, templates := range r.locales {
+		if _, ok := templates[msg]; ok {
+			locales = append(locales, locale)
+		}
+	}
+
+	sort.Strings(locales)
+	return locales
+}
+
+// localeCandidates turns "pt_BR" into pt-br, pt then the default locale.
+func localeCandidates(locale string) []string {
+	locale = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+
+	var candidates []string
+
+	if locale != "" {
+		candidates = append(candidates, locale)
+
+		if i := strings.Index(locale, "-"); i > 0 {
+			candidates = append(candidates, locale[:i])
+		}
+	}
+
+	return append(candidates, DEFAULT_LOCALE)
+}
+
+// layers reads a file from the first file system having it.
+type layers []fs.FS
+
+func (l layers) read(name string) (string, bool, error) {
+	for _, fsys := range l {
+		b, err := fs.ReadFile(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return "", false, err
+		}
+
+		return string(b), true, nil
+	}
+
+	return "", false, nil
+}
+
+func (l layers) entries(dir string, wantDir bool) ([]string, error) {
+	seen := map[string]bool{}
+	var names []string
+
+	for _, fsys := range l {
+		entries, err := fs.ReadDir(fsys, dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range entries {
+			if e.IsDir() == wantDir && !seen[e.Name()] {
+				seen[e.Name()] = true
+				names = append(names, e.Name())
+			}
+		}
+	}
+
+	return names, nil
+}
+
+func (l layers) dirs(dir string) ([]string, error) {
+	return l.entries(dir, true)
+}
+
+// sources returns the layout, the shared partials then those of the locale, for ext.
+func (l layers) sources(dir, ext string) ([]string, error) {
+	layout, ok, err := l.read(path.Join(dir, "layout"+ext))
+	if err == nil && !ok {
+		layout, ok, err = l.read("layout" + ext)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("missing layout%s", ext)
+	}
+
+	srcs := []string{layout}
+
+	partialDirs := []string{PARTIALS_DIR}
+	if dir != "." {
+		partialDirs = append(partialDirs, path.Join(dir, PARTIALS_DIR))
+	}
+
+	for _, partialDir := range partialDirs {
+		files, err := l.entries(partialDir, false)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range files {
+			if path.Ext(name) != ext {
+				continue
+			}
+
+			partial, _, err := l.read(path.Join(partialDir, name))
+			if err != nil {
+				return nil, err
+			}
+
+			srcs = append(srcs, partial)
+		}
+	}
+
+	return srcs, nil
+}
+
+// parseLocale parses the messages of locale, a message needs both variants or none.
+func (l layers) parseLocale(locale string) (map[MsgType]Template, error) {
+	dir := locale
+	if locale == DEFAULT_LOCALE {
+		dir = "."
+	}
+
+	htmlSrcs, err := l.sources(dir, ".html")
+	if err != nil {
+		return nil, fmt.Errorf("locale %s: %w", locale, err)
+	}
+
+	txtSrcs, err := l.sources(dir, ".txt")
+	if err != nil {
+		return nil, fmt.Errorf("locale %s: %w", locale, err)
+	}
+
+	templates := map[MsgType]Template{}
+
+	for msg, name := range templateNames {
+		html, hasHTML, err := l.read(path.Join(dir, name+".html"))
+		if err != nil {
+			return nil, err
+		}
+
+		txt, hasTxt, err := l.read(path.Join(dir, name+".txt"))
+		if err != nil {
+			return nil, err
+		}
+
+		if !hasHTML && !hasTxt {
+			continue
+		}
+
+		if hasHTML != hasTxt {
+			return nil, fmt.Errorf("locale %s: %s needs both html and txt variants", locale, name)
+		}
+
+		h := ht.New(name + ".html").Option("missingkey=error")
+		for _, src := range append(htmlSrcs, html) {
+			if _, err := h.Parse(src); err != nil {
+				return nil, fmt.Errorf("locale %s: %w", locale, err)
+			}
+		}
+
+		t := tt.New(name + ".txt").Option("missingkey=error")
+		for _, src := range append(txtSrcs, txt) {
+			if _, err := t.Parse(src); err != nil {
+				return nil, fmt.Errorf("locale %s: %w", locale, err)
+			}
+		}
+
+		if h.Lookup("content") == nil || t.Lookup("content") == nil {
+			return nil, fmt.Errorf("locale %s: %s does not define content", locale, name)
+		}
+
+		templates[msg] = Template{HTML: h, Text: t}
+	}
+
+	return templates, nil
+}
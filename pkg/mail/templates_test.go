@@ -0,0 +1,219 @@
+package mail
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func render(t *testing.T, tpl Template, data any) (string, string, string) {
+	t.Helper()
+
+	subject, html, txt, err := tpl.render(View{Data: data})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+
+	return subject, html, txt
+}
+
+func TestRegistry(t *testing.T) {
+	r, err := NewRegistry("")
+	if err != nil {
+		t.Fatalf("embedded templates: %v", err)
+	}
+
+	data := OTPTplData{Username: "Agus", OTP: "1234"}
+
+	tests := []struct {
+		locale  string
+		subject string
+		text    string
+	}{
+		{"", "Email Verification", "This is your OTP 1234"},
+		{"fr", "Email Verification", "This is your OTP 1234"},
+		{"id", "Verifikasi Email", "Ini kode OTP kamu 1234"},
+		{"id_ID", "Verifikasi Email", "Ini kode OTP kamu 1234"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			tpl, err := r.Lookup(OTPMsg, tt.locale)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			subject, html, txt := render(t, tpl, data)
+
+			if subject != tt.subject {
+				t.Fatalf("subject = %q, want %q", subject, tt.subject)
+			}
+
+			if !strings.Contains(txt, tt.text) || !strings.Contains(txt, "Guwu") {
+				t.Fatalf("text misses the content or the footer: %q", txt)
+			}
+
+			if !strings.Contains(html, "<title>") || !strings.Contains(html, "1234") {
+				t.Fatalf("html is not rendered in the layout: %q", html)
+			}
+		})
+	}
+
+	t.Run("recover password falls back to the default locale", func(t *testing.T) {
+		if _, err := r.Lookup(RecoverPasswdMsg, "id"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("locales", func(t *testing.T) {
+		if got := r.Locales(OTPMsg); len(got) != 2 || got[0] != "en" || got[1] != "id" {
+			t.Fatalf("Locales(OTPMsg) = %v, want [en id]", got)
+		}
+
+		if got := r.Locales(RecoverPasswdMsg); len(got) != 1 {
+			t.Fatalf("Locales(RecoverPasswdMsg) = %v, want [en]", got)
+		}
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		if _, err := r.Lookup(msgTypeCount, ""); err == nil {
+			t.Fatal("unknown type should result error")
+		}
+	})
+
+	t.Run("missing field", func(t *testing.T) {
+		tpl, _ := r.Lookup(OTPMsg, "")
+
+		if _, _, _, err := tpl.render(View{Data: map[string]any{"Username": "Agus"}}); err == nil {
+			t.Fatal("missing key should result error")
+		}
+	})
+}
+
+func TestRegistryOverride(t *testing.T) {
+	write := func(t *testing.T, dir, name, content string) {
+		t.Helper()
+
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("replaces embedded files", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, dir, "partials/footer.txt", `{{define "footer"}}Acme Inc.{{end}}`)
+		write(t, dir, "otp.txt", `{{define "content"}}Code: {{.OTP}}{{end}}`)
+
+		r, err := NewRegistry(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tpl, _ := r.Lookup(OTPMsg, "")
+		subject, html, txt := render(t, tpl, OTPTplData{Username: "Agus", OTP: "1234"})
+
+		if subject != "" {
+			t.Fatalf("overridden text defines no subject, got %q", subject)
+		}
+
+		if !strings.Contains(txt, "Code: 1234") || !strings.Contains(txt, "Acme Inc.") {
+			t.Fatalf("override not applied: %q", txt)
+		}
+
+		if !strings.Contains(html, "This is your OTP 1234") {
+			t.Fatalf("html should stay embedded: %q", html)
+		}
+	})
+
+	t.Run("adds a locale", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, dir, "pt-BR/otp.html", `{{define "title"}}OTP{{end}}{{define "content"}}Olá {{.Username}}{{end}}`)
+		write(t, dir, "pt-BR/otp.txt", `{{define "content"}}Olá {{.Username}}{{end}}`)
+
+		r, err := NewRegistry(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tpl, _ := r.Lookup(OTPMsg, "pt-br")
+		if _, _, txt := render(t, tpl, OTPTplData{Username: "Agus"}); !strings.Contains(txt, "Olá Agus") {
+			t.Fatalf("locale not used: %q", txt)
+		}
+	})
+
+	t.Run("variant without its pair", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, dir, "de/otp.html", `{{define "title"}}OTP{{end}}{{define "content"}}Hallo{{end}}`)
+
+		if _, err := NewRegistry(dir); err == nil {
+			t.Fatal("missing text variant should result error")
+		}
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, dir, "otp.txt", `{{define "content"}}{{.Code}}{{end}}`)
+
+		if _, err := NewRegistry(dir); err == nil {
+			t.Fatal("template not rendering its sample should result error")
+		}
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, dir, "otp.html", `{{define "content"}}{{.OTP}`)
+
+		if _, err := NewRegistry(dir); err == nil {
+			t.Fatal("invalid template should result error")
+		}
+	})
+}
+
+func TestDigestTemplate(t *testing.T) {
+	registry, err := NewRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl, err := registry.Lookup(DigestMsg, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the outbox hands the data back decoded from JSON
+	encoded, err := json.Marshal(samples[DigestMsg])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data map[string]any
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		t.Fatal(err)
+	}
+
+	subject, html, txt := render(t, tpl, data)
+	if subject != "Your weekly digest" {
+		t.Fatalf("unexpected subject %q", subject)
+	}
+
+	for _, want := range []string{"2 new followers: John, Tina", "John: Lunch with @Jane today", "Tina: Shipped the new release"} {
+		if !strings.Contains(txt, want) {
+			t.Fatalf("text misses %q:\n%s", want, txt)
+		}
+	}
+
+	if !strings.Contains(html, "this week") {
+		t.Fatalf("unexpected html:\n%s", html)
+	}
+
+	_, _, txt = render(t, tpl, DigestTplData{Username: "Jane", Frequency: "daily", Posts: []DigestPost{{Username: "Tina", Excerpt: "hi"}}})
+	if strings.Contains(txt, "followers") || strings.Contains(txt, "Mentions") || !strings.Contains(txt, "today") {
+		t.Fatalf("expected only the posts, got:\n%s", txt)
+	}
+}
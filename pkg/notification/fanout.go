@@ -0,0 +1,110 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samuelsih/guwu/pkg/errs"
+)
+
+// Fanout sends every message to all of its providers at once, keyed by name for the errors.
+type Fanout map[string]Provider
+
+func (f Fanout) Send(ctx context.Context, m Message, userIDs ...string) error {
+	const op = errs.Op("notification.Fanout.Send")
+
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var wg sync.WaitGroup
+	results := make([]error, len(names))
+
+	for i, name := range names {
+		wg.Add(1)
+
+		go func(i int, p Provider) {
+			defer wg.Done()
+			results[i] = p.Send(ctx, m, userIDs...)
+		}(i, f[name])
+	}
+
+	wg.Wait()
+
+	var failed []string
+	kind := errs.KindBadRequest
+
+	for i, err := range results {
+		if err == nil {
+			continue
+		}
+
+		failed = append(failed, names[i]+": "+cause(err).Error())
+
+		if errs.GetKind(err) != errs.KindBadRequest {
+			kind = errs.KindUnexpected
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+
+	return errs.E(op, kind, errors.New(strings.Join(failed, "; ")), "cant send notification to user")
+}
+
+// Retry sends again on errors that are not permanent, Attempts times at most,
+// waiting Delay before the second attempt and twice as long before each next one.
+type Retry struct {
+	Provider Provider
+	Attempts int
+	Delay    time.Duration
+}
+
+func WithRetry(p Provider, attempts int, delay time.Duration) Retry {
+	return Retry{Provider: p, Attempts: attempts, Delay: delay}
+}
+
+func (r Retry) Send(ctx context.Context, m Message, userIDs ...string) error {
+	const op = errs.Op("notification.Retry.Send")
+
+	delay := r.Delay
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		err = r.Provider.Send(ctx, m, userIDs...)
+		if err == nil || errs.GetKind(err) == errs.KindBadRequest || attempt >= r.Attempts {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errs.E(op, errs.KindUnexpected, err, "cant send notification to user")
+		case <-timer.C:
+		}
+
+		delay *= 2
+	}
+}
+
+// cause is the innermost error, errs.Error only tells its client message.
+func cause(err error) error {
+	for {
+		e, ok := err.(*errs.Error)
+		if !ok || e.Err == nil {
+			return err
+		}
+
+		err = e.Err
+	}
+}
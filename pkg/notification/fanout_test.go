@@ -0,0 +1,95 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samuelsih/guwu/pkg/errs"
+)
+
+// flaky fails its first sends with kind, as many as failures.
+type flaky struct {
+	failures int
+	kind     errs.Kind
+	calls    int
+}
+
+func (f *flaky) Send(ctx context.Context, m Message, userIDs ...string) error {
+	f.calls++
+
+	if f.calls <= f.failures {
+		return errs.E("flaky.Send", f.kind, errors.New("flaked"), "cant send notification to user")
+	}
+
+	return nil
+}
+
+func TestFanout_Send(t *testing.T) {
+	t.Run("every provider", func(t *testing.T) {
+		a, b := NewMemoryProvider(), NewMemoryProvider()
+
+		if err := (Fanout{"a": a, "b": b}).Send(context.Background(), message, "1"); err != nil {
+			t.Fatal(err)
+		}
+
+		expectSent(t, a, "1")
+		expectSent(t, b, "1")
+	})
+
+	t.Run("failed provider", func(t *testing.T) {
+		ok := NewMemoryProvider()
+
+		err := (Fanout{"ok": ok, "broken": &flaky{failures: 1, kind: errs.KindUnexpected}}).Send(context.Background(), message, "1")
+		if err == nil {
+			t.Fatal("err must be not nil")
+		}
+
+		e := err.(*errs.Error)
+		if !strings.Contains(e.Err.Error(), "broken: flaked") || e.Kind != errs.KindUnexpected {
+			t.Fatalf("unexpected err: %v", e.Err)
+		}
+
+		expectSent(t, ok, "1")
+	})
+}
+
+func TestRetry_Send(t *testing.T) {
+	tests := []struct {
+		name      string
+		provider  *flaky
+		attempts  int
+		wantErr   bool
+		wantCalls int
+	}{
+		{name: "succeeds after failures", provider: &flaky{failures: 2, kind: errs.KindUnexpected}, attempts: 3, wantCalls: 3},
+		{name: "gives up", provider: &flaky{failures: 5, kind: errs.KindUnexpected}, attempts: 3, wantErr: true, wantCalls: 3},
+		{name: "permanent error", provider: &flaky{failures: 5, kind: errs.KindBadRequest}, attempts: 3, wantErr: true, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := WithRetry(tt.provider, tt.attempts, time.Millisecond).Send(context.Background(), message, "1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.provider.calls != tt.wantCalls {
+				t.Fatalf("expected %d calls, got %d", tt.wantCalls, tt.provider.calls)
+			}
+		})
+	}
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		p := &flaky{failures: 5, kind: errs.KindUnexpected}
+
+		if err := WithRetry(p, 3, time.Hour).Send(ctx, message, "1"); err == nil || p.calls != 1 {
+			t.Fatalf("expected one call and an err, got %d calls and %v", p.calls, err)
+		}
+	})
+}
@@ -0,0 +1,23 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/samuelsih/guwu/pkg/logger"
+)
+
+// LogProvider only logs the messages, the data is logged in debug mode.
+type LogProvider struct{}
+
+func (LogProvider) Send(ctx context.Context, m Message, userIDs ...string) error {
+	if err := checkUserIDs("notification.LogProvider.Send", userIDs); err != nil {
+		return err
+	}
+
+	logger.SysInfof("notification to %s: %s: %s", strings.Join(userIDs, ","), m.Title, m.Body)
+	logger.Debug(fmt.Sprint(m.Data))
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package notification
+
+import (
+	"context"
+	"sync"
+)
+
+// Sent is a message recorded by MemoryProvider.
+type Sent struct {
+	UserIDs []string
+	Message Message
+}
+
+// MemoryProvider records the messages instead of sending them, for tests.
+type MemoryProvider struct {
+	mu   sync.Mutex
+	sent []Sent
+}
+
+func NewMemoryProvider() *MemoryProvider {
+	return &MemoryProvider{}
+}
+
+func (p *MemoryProvider) Send(ctx context.Context, m Message, userIDs ...string) error {
+	const op = "notification.MemoryProvider.Send"
+
+	if err := checkUserIDs(op, userIDs); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.sent = append(p.sent, Sent{UserIDs: append([]string(nil), userIDs...), Message: m})
+	return nil
+}
+
+// Sent returns a copy of the recorded messages, oldest first.
+func (p *MemoryProvider) Sent() []Sent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]Sent(nil), p.sent...)
+}
+
+// To returns the messages sent to userID.
+func (p *MemoryProvider) To(userID string) []Message {
+	var messages []Message
+
+	for _, s := range p.Sent() {
+		for _, id := range s.UserIDs {
+			if id == userID {
+				messages = append(messages, s.Message)
+				break
+			}
+		}
+	}
+
+	return messages
+}
+
+func (p *MemoryProvider) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.sent = nil
+}
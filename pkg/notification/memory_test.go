@@ -0,0 +1,24 @@
+package notification
+
+import "testing"
+
+// expectSent fails tb unless a message was sent to userID and returns the latest one.
+func expectSent(tb testing.TB, p *MemoryProvider, userID string) Message {
+	tb.Helper()
+
+	messages := p.To(userID)
+	if len(messages) == 0 {
+		tb.Fatalf("expected a notification to %s, got %d notifications", userID, len(p.Sent()))
+	}
+
+	return messages[len(messages)-1]
+}
+
+// expectNone fails tb when anything was sent.
+func expectNone(tb testing.TB, p *MemoryProvider) {
+	tb.Helper()
+
+	if sent := p.Sent(); len(sent) != 0 {
+		tb.Fatalf("expected no notification, got %d", len(sent))
+	}
+}
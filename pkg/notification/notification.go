@@ -1,8 +1,10 @@
+// Package notification pushes messages to the devices of users through one or more providers.
 package notification
 
 import (
+	"context"
 	"errors"
-	pusher "github.com/pusher/push-notifications-go"
+
 	"github.com/samuelsih/guwu/pkg/errs"
 )
 
@@ -10,54 +12,37 @@ var (
 	EmptyUserIDsErr = errors.New("empty users ID")
 )
 
-type Config struct {
-	instance pusher.PushNotifications
-}
-
-type Msg map[string]any
+// Message is what a user sees, Payload shapes it for every platform.
+type Message struct {
+	Title string
+	Body  string
 
-func New(instanceID, secretKey string) (Config, error) {
-	const op = errs.Op("notifications.New")
+	// URL is opened when the notification is clicked.
+	URL   string
+	Icon  string
+	Badge int
+	Sound string
 
-	instance, err := pusher.New(instanceID, secretKey)
-	if err != nil {
-		return Config{}, errs.E(op, errs.KindUnexpected, err, "unexpected internal server error")
-	}
-
-	return Config{
-		instance: instance,
-	}, nil
+	// Data is handed to the application along with the notification.
+	Data map[string]any
 }
 
-func (c Config) Send(msg Msg, userIDs ...string) error {
-	const op = errs.Op("notifications.Send")
-
-	if len(userIDs) == 0 || userIDs == nil {
-		return errs.E(op, errs.KindUnexpected, EmptyUserIDsErr, "unexpected users")
-	}
+// Provider delivers a message to the devices of userIDs. Errors of kind errs.KindBadRequest
+// are permanent, the others are worth retrying.
+type Provider interface {
+	Send(ctx context.Context, m Message, userIDs ...string) error
+}
 
-	req := map[string]any{
-		"web": map[string]any{
-			"notification": msg,
-		},
+func checkUserIDs(op errs.Op, userIDs []string) error {
+	if len(userIDs) == 0 {
+		return errs.E(op, errs.KindBadRequest, EmptyUserIDsErr, "unexpected users")
 	}
 
-	_, err := c.instance.PublishToUsers(userIDs, req)
-	if err != nil {
-		return errs.E(op, errs.KindUnexpected, err, "cant send notification to user")
+	for _, id := range userIDs {
+		if id == "" {
+			return errs.E(op, errs.KindBadRequest, EmptyUserIDsErr, "unexpected users")
+		}
 	}
 
 	return nil
 }
-
-func (c Config) GenerateToken(userID string) (map[string]any, error) {
-	const op = errs.Op("notifications.GenerateToken")
-
-	token, err := c.instance.GenerateToken(userID)
-	if err != nil {
-		return nil, errs.E(op, errs.KindUnexpected, err, "can't authorize users")
-	}
-
-	return token, nil
-
-}
@@ -1,98 +1,71 @@
 package notification
 
 import (
-	"log"
-	"os"
+	"context"
+	"encoding/json"
 	"testing"
 )
 
-var c Config
+var message = Message{
+	Title: "New follower",
+	Body:  "jane followed you",
+	URL:   "https://guwu.app/jane",
+	Badge: 3,
+	Sound: "default",
+	Data:  map[string]any{"type": "follow", "count": 2},
+}
 
-const (
-	//https://github.com/pusher/push-notifications-go/blob/764224c311b854e5a272f8601b98957448a71995/push_notification_integration_test.go#L16
-	instanceTest = "9aa32e04-a212-44ab-a592-9aeba66e46ac"
+func TestMessage_Payload(t *testing.T) {
+	t.Run("every platform", func(t *testing.T) {
+		encoded, err := json.Marshal(message.Payload())
+		if err != nil {
+			t.Fatal(err)
+		}
 
-	//https://github.com/pusher/push-notifications-go/blob/764224c311b854e5a272f8601b98957448a71995/push_notification_integration_test.go#L17
-	secretKeyTest = "188C879D394E09FDECC04606A126FAE2125FEABD24A2D12C6AC969AE1CEE2AEC"
-)
+		want := `{"web":{"notification":{"title":"New follower","body":"jane followed you","deep_link":"https://guwu.app/jane"},"data":{"count":2,"type":"follow"}},` +
+			`"apns":{"aps":{"alert":{"title":"New follower","body":"jane followed you"},"badge":3,"sound":"default"},"data":{"count":2,"type":"follow"}},` +
+			`"fcm":{"notification":{"title":"New follower","body":"jane followed you","sound":"default","click_action":"https://guwu.app/jane"},"data":{"count":"2","type":"follow"}}}`
 
-func TestMain(m *testing.M) {
-	cfg, err := New(instanceTest, secretKeyTest)
-	if err != nil {
-		log.Fatal(err)
-	}
+		if string(encoded) != want {
+			t.Fatalf("unexpected payload:\n%s\nwant:\n%s", encoded, want)
+		}
+	})
 
-	c = cfg
+	t.Run("some platforms", func(t *testing.T) {
+		p := Message{Title: "hi"}.Payload(APNs)
 
-	code := m.Run()
+		if p.Web != nil || p.FCM != nil || p.APNs == nil {
+			t.Fatalf("unexpected payload: %+v", p)
+		}
 
-	os.Exit(code)
+		if p.APNs.APS.Badge != nil {
+			t.Fatalf("badge must be omitted, got %d", *p.APNs.APS.Badge)
+		}
+	})
 }
 
-func TestNew(t *testing.T) {
-	_, err := New("", "")
+func TestMemoryProvider(t *testing.T) {
+	p := NewMemoryProvider()
+	ctx := context.Background()
 
-	if err == nil {
-		log.Fatal("err must be not nil")
+	if err := p.Send(ctx, message); err == nil {
+		t.Fatal("err must be not nil on empty users")
 	}
-}
 
-func TestConfig_Send(t *testing.T) {
-	type args struct {
-		msg    Msg
-		userID []string
-	}
-	tests := []struct {
-		name    string
-		args    args
-		wantErr bool
-	}{
-		{
-			name: "happy path",
-			args: args{
-				msg:    map[string]any{"msg": "hello world"},
-				userID: []string{"123123123123"},
-			},
-			wantErr: false,
-		},
+	expectNone(t, p)
 
-		{
-			name: "empty users id",
-			args: args{
-				msg:    map[string]any{"msg": "asoyy"},
-				userID: nil,
-			},
-			wantErr: true,
-		},
+	if err := p.Send(ctx, message, "1", "2"); err != nil {
+		t.Fatal(err)
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if err := c.Send(tt.args.msg, tt.args.userID...); (err != nil) != tt.wantErr {
-				t.Errorf("Send() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
+	if m := expectSent(t, p, "2"); m.Title != message.Title {
+		t.Fatalf("unexpected message: %+v", m)
 	}
-}
-
-func TestConfig_GenerateToken(t *testing.T) {
-	t.Run("happy path", func(t *testing.T) {
-		userID := "123123123"
-
-		token, err := c.GenerateToken(userID)
-		if err != nil {
-			t.Fatal(err)
-		}
 
-		if _, ok := token["token"]; !ok {
-			t.Fatal("generated token is empty")
-		}
-	})
+	if len(p.To("3")) != 0 {
+		t.Fatal("nothing was sent to 3")
+	}
 
-	t.Run("empty user id", func(t *testing.T) {
-		_, err := c.GenerateToken("")
-		if err == nil {
-			t.Fatal("error must be not nil")
-		}
-	})
+	p.Reset()
+	expectNone(t, p)
 }
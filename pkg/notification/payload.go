@@ -0,0 +1,128 @@
+package notification
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type Platform string
+
+const (
+	Web  Platform = "web"
+	APNs Platform = "apns"
+	FCM  Platform = "fcm"
+)
+
+var Platforms = []Platform{Web, APNs, FCM}
+
+// Payload is the body of a publish request of Pusher Beams, the webhook sends the same.
+type Payload struct {
+	Web  *WebPayload  `json:"web,omitempty"`
+	APNs *APNsPayload `json:"apns,omitempty"`
+	FCM  *FCMPayload  `json:"fcm,omitempty"`
+}
+
+type WebPayload struct {
+	Notification WebNotification `json:"notification"`
+	Data         map[string]any  `json:"data,omitempty"`
+}
+
+type WebNotification struct {
+	Title    string `json:"title"`
+	Body     string `json:"body"`
+	DeepLink string `json:"deep_link,omitempty"`
+	Icon     string `json:"icon,omitempty"`
+}
+
+type APNsPayload struct {
+	APS  APS            `json:"aps"`
+	Data map[string]any `json:"data,omitempty"`
+}
+
+type APS struct {
+	Alert APSAlert `json:"alert"`
+	Badge *int     `json:"badge,omitempty"`
+	Sound string   `json:"sound,omitempty"`
+}
+
+type APSAlert struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// FCMPayload carries Data as strings, the only values FCM accepts.
+type FCMPayload struct {
+	Notification FCMNotification   `json:"notification"`
+	Data         map[string]string `json:"data,omitempty"`
+}
+
+type FCMNotification struct {
+	Title       string `json:"title"`
+	Body        string `json:"body"`
+	Icon        string `json:"icon,omitempty"`
+	Sound       string `json:"sound,omitempty"`
+	ClickAction string `json:"click_action,omitempty"`
+}
+
+// Payload shapes m for platforms, every one of Platforms when none is given.
+func (m Message) Payload(platforms ...Platform) Payload {
+	if len(platforms) == 0 {
+		platforms = Platforms
+	}
+
+	var p Payload
+
+	for _, platform := range platforms {
+		switch platform {
+		case Web:
+			p.Web = &WebPayload{
+				Notification: WebNotification{Title: m.Title, Body: m.Body, DeepLink: m.URL, Icon: m.Icon},
+				Data:         m.Data,
+			}
+
+		case APNs:
+			p.APNs = &APNsPayload{
+				APS:  APS{Alert: APSAlert{Title: m.Title, Body: m.Body}, Sound: m.Sound},
+				Data: m.Data,
+			}
+
+			if m.Badge > 0 {
+				badge := m.Badge
+				p.APNs.APS.Badge = &badge
+			}
+
+		case FCM:
+			p.FCM = &FCMPayload{
+				Notification: FCMNotification{Title: m.Title, Body: m.Body, Icon: m.Icon, Sound: m.Sound, ClickAction: m.URL},
+				Data:         stringData(m.Data),
+			}
+		}
+	}
+
+	return p
+}
+
+// stringData keeps strings as they are and encodes the other values as JSON.
+func stringData(data map[string]any) map[string]string {
+	if len(data) == 0 {
+		return nil
+	}
+
+	result := make(map[string]string, len(data))
+
+	for k, v := range data {
+		if s, ok := v.(string); ok {
+			result[k] = s
+			continue
+		}
+
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			encoded = []byte(fmt.Sprint(v))
+		}
+
+		result[k] = string(encoded)
+	}
+
+	return result
+}
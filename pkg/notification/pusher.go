@@ -0,0 +1,75 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+
+	pusher "github.com/pusher/push-notifications-go"
+	"github.com/samuelsih/guwu/pkg/errs"
+)
+
+// PusherProvider publishes to the users of a Pusher Beams instance.
+type PusherProvider struct {
+	instance pusher.PushNotifications
+
+	// Platforms are the payloads published, every one of Platforms when empty.
+	Platforms []Platform
+}
+
+// NewPusher connects to the Beams instance instanceID, baseURL replaces the Beams API when set.
+func NewPusher(instanceID, secretKey, baseURL string) (*PusherProvider, error) {
+	const op = errs.Op("notification.NewPusher")
+
+	var options []pusher.Option
+	if baseURL != "" {
+		options = append(options, pusher.WithCustomBaseURL(baseURL))
+	}
+
+	instance, err := pusher.New(instanceID, secretKey, options...)
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "unexpected internal server error")
+	}
+
+	return &PusherProvider{instance: instance}, nil
+}
+
+func (p *PusherProvider) Send(ctx context.Context, m Message, userIDs ...string) error {
+	const op = errs.Op("notification.PusherProvider.Send")
+
+	if err := checkUserIDs(op, userIDs); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cant send notification to user")
+	}
+
+	// the client takes a map and adds the users to it
+	encoded, err := json.Marshal(m.Payload(p.Platforms...))
+	if err != nil {
+		return errs.E(op, errs.KindBadRequest, err, "cant send notification to user")
+	}
+
+	var req map[string]any
+	if err := json.Unmarshal(encoded, &req); err != nil {
+		return errs.E(op, errs.KindBadRequest, err, "cant send notification to user")
+	}
+
+	if _, err := p.instance.PublishToUsers(userIDs, req); err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cant send notification to user")
+	}
+
+	return nil
+}
+
+// GenerateToken authenticates userID to the Beams SDK of its devices.
+func (p *PusherProvider) GenerateToken(userID string) (map[string]any, error) {
+	const op = errs.Op("notification.PusherProvider.GenerateToken")
+
+	token, err := p.instance.GenerateToken(userID)
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "can't authorize users")
+	}
+
+	return token, nil
+}
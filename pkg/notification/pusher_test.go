@@ -0,0 +1,139 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	//https://github.com/pusher/push-notifications-go/blob/764224c311b854e5a272f8601b98957448a71995/push_notification_integration_test.go#L16
+	instanceTest = "9aa32e04-a212-44ab-a592-9aeba66e46ac"
+
+	//https://github.com/pusher/push-notifications-go/blob/764224c311b854e5a272f8601b98957448a71995/push_notification_integration_test.go#L17
+	secretKeyTest = "188C879D394E09FDECC04606A126FAE2125FEABD24A2D12C6AC969AE1CEE2AEC"
+)
+
+// beams stands in for the publish API of Pusher Beams and records the last request.
+func beams(t *testing.T, status int) (*httptest.Server, *map[string]any) {
+	var got map[string]any
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/publish_api/v1/instances/"+instanceTest+"/publishes/users" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+
+		if r.Header.Get("Authorization") != "Bearer "+secretKeyTest {
+			t.Errorf("unexpected authorization %q", r.Header.Get("Authorization"))
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+
+		w.WriteHeader(status)
+
+		if status == http.StatusOK {
+			w.Write([]byte(`{"publishId":"pubid-1"}`))
+			return
+		}
+
+		w.Write([]byte(`{"error":"Internal Server Error","description":"down"}`))
+	}))
+
+	t.Cleanup(srv.Close)
+
+	return srv, &got
+}
+
+func TestNewPusher(t *testing.T) {
+	_, err := NewPusher("", "", "")
+
+	if err == nil {
+		t.Fatal("err must be not nil")
+	}
+}
+
+func TestPusherProvider_Send(t *testing.T) {
+	t.Run("happy path", func(t *testing.T) {
+		srv, got := beams(t, http.StatusOK)
+
+		p, err := NewPusher(instanceTest, secretKeyTest, srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p.Platforms = []Platform{Web}
+
+		if err := p.Send(context.Background(), message, "123123123123"); err != nil {
+			t.Fatal(err)
+		}
+
+		users, _ := (*got)["users"].([]any)
+		if len(users) != 1 || users[0] != "123123123123" {
+			t.Fatalf("unexpected users: %v", (*got)["users"])
+		}
+
+		web, _ := (*got)["web"].(map[string]any)
+		notification, _ := web["notification"].(map[string]any)
+
+		if notification["title"] != message.Title || notification["deep_link"] != message.URL {
+			t.Fatalf("unexpected web payload: %v", web)
+		}
+
+		if _, ok := (*got)["apns"]; ok {
+			t.Fatal("apns must be omitted")
+		}
+	})
+
+	t.Run("server error", func(t *testing.T) {
+		srv, _ := beams(t, http.StatusInternalServerError)
+
+		p, err := NewPusher(instanceTest, secretKeyTest, srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := p.Send(context.Background(), message, "123123123123"); err == nil {
+			t.Fatal("err must be not nil")
+		}
+	})
+
+	t.Run("empty users id", func(t *testing.T) {
+		p, err := NewPusher(instanceTest, secretKeyTest, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := p.Send(context.Background(), message); err == nil {
+			t.Fatal("err must be not nil")
+		}
+	})
+}
+
+func TestPusherProvider_GenerateToken(t *testing.T) {
+	p, err := NewPusher(instanceTest, secretKeyTest, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("happy path", func(t *testing.T) {
+		token, err := p.GenerateToken("123123123")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := token["token"]; !ok {
+			t.Fatal("generated token is empty")
+		}
+	})
+
+	t.Run("empty user id", func(t *testing.T) {
+		_, err := p.GenerateToken("")
+		if err == nil {
+			t.Fatal("error must be not nil")
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/samuelsih/guwu/pkg/errs"
+)
+
+const (
+	SIGNATURE_HEADER = "X-Guwu-Signature"
+	WEBHOOK_TIMEOUT  = 10 * time.Second
+)
+
+// WebhookProvider POSTs the Beams publish request to URL, so any HTTP server can stand in for Beams.
+// The body is signed with Secret in SIGNATURE_HEADER when set.
+type WebhookProvider struct {
+	URL    string
+	Secret string
+	Client *http.Client
+
+	// Platforms are the payloads sent, every one of Platforms when empty.
+	Platforms []Platform
+}
+
+type webhookRequest struct {
+	Users []string `json:"users"`
+	Payload
+}
+
+func NewWebhook(url, secret string) *WebhookProvider {
+	return &WebhookProvider{URL: url, Secret: secret, Client: &http.Client{Timeout: WEBHOOK_TIMEOUT}}
+}
+
+// Send fails permanently on a 4xx response, except 408 and 429 which are retried along with 5xx.
+func (w *WebhookProvider) Send(ctx context.Context, m Message, userIDs ...string) error {
+	const op = errs.Op("notification.WebhookProvider.Send")
+
+	if err := checkUserIDs(op, userIDs); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(webhookRequest{Users: userIDs, Payload: m.Payload(w.Platforms...)})
+	if err != nil {
+		return errs.E(op, errs.KindBadRequest, err, "cant send notification to user")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return errs.E(op, errs.KindBadRequest, err, "cant send notification to user")
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if w.Secret != "" {
+		req.Header.Set(SIGNATURE_HEADER, Sign(w.Secret, body))
+	}
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "cant send notification to user")
+	}
+
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+
+	kind := errs.KindUnexpected
+	if res.StatusCode < 500 && res.StatusCode != http.StatusRequestTimeout && res.StatusCode != http.StatusTooManyRequests {
+		kind = errs.KindBadRequest
+	}
+
+	return errs.E(op, kind, fmt.Errorf("webhook responded %s", res.Status), "cant send notification to user")
+}
+
+// Sign is the value of SIGNATURE_HEADER for body, receivers compare it to their own.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,71 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/samuelsih/guwu/pkg/errs"
+)
+
+func TestWebhookProvider_Send(t *testing.T) {
+	t.Run("happy path", func(t *testing.T) {
+		var got webhookRequest
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+
+			if r.Header.Get(SIGNATURE_HEADER) != Sign("secret", body) {
+				t.Errorf("unexpected signature %q", r.Header.Get(SIGNATURE_HEADER))
+			}
+
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Error(err)
+			}
+		}))
+		defer srv.Close()
+
+		if err := NewWebhook(srv.URL, "secret").Send(context.Background(), message, "1", "2"); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got.Users) != 2 || got.Web == nil || got.APNs == nil || got.FCM == nil {
+			t.Fatalf("unexpected request: %+v", got)
+		}
+
+		if got.FCM.Data["count"] != "2" || got.APNs.APS.Alert.Body != message.Body {
+			t.Fatalf("unexpected payload: %+v %+v", got.FCM, got.APNs)
+		}
+	})
+
+	tests := []struct {
+		name     string
+		status   int
+		wantKind errs.Kind
+	}{
+		{name: "bad request is permanent", status: http.StatusBadRequest, wantKind: errs.KindBadRequest},
+		{name: "too many requests is retried", status: http.StatusTooManyRequests, wantKind: errs.KindUnexpected},
+		{name: "server error is retried", status: http.StatusBadGateway, wantKind: errs.KindUnexpected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			err := NewWebhook(srv.URL, "").Send(context.Background(), message, "1")
+			if err == nil {
+				t.Fatal("err must be not nil")
+			}
+
+			if kind := errs.GetKind(err); kind != tt.wantKind {
+				t.Fatalf("expected kind %d, got %d", tt.wantKind, kind)
+			}
+		})
+	}
+}
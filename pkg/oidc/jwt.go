@@ -0,0 +1,365 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samuelsih/guwu/pkg/errs"
+)
+
+const (
+	clockSkew       = time.Minute
+	keyRefreshLimit = time.Minute
+)
+
+var (
+	ErrMalformedToken   = errors.New("malformed token")
+	ErrUnsupportedAlg   = errors.New("unsupported signing algorithm")
+	ErrUnknownKey       = errors.New("unknown signing key")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrInvalidClaims    = errors.New("invalid claims")
+)
+
+// Claims are the id token claims the application relies on.
+type Claims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          Audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	Expiry            int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     Bool     `json:"email_verified"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// Audience accepts both the single string and the array form of aud.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+
+	*a = many
+	return nil
+}
+
+// Bool accepts both true and "true", some providers send email_verified as a string.
+type Bool bool
+
+func (v *Bool) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	*v = Bool(s == "true")
+	return nil
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the signature of rawIDToken against the provider keys and validates its claims.
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (Claims, error) {
+	const op = errs.Op("oidc.Verify")
+	var claims Claims
+
+	if _, err := p.Discover(ctx); err != nil {
+		return claims, err
+	}
+
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return claims, errs.E(op, errs.KindUnauthorized, ErrMalformedToken, "invalid id token")
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return claims, errs.E(op, errs.KindUnauthorized, ErrMalformedToken, "invalid id token")
+	}
+
+	hash, ok := algHash[h.Alg]
+	if !ok {
+		return claims, errs.E(op, errs.KindUnauthorized, ErrUnsupportedAlg, "invalid id token")
+	}
+
+	key, err := p.keys.find(ctx, h.Kid)
+	if err != nil {
+		return claims, errs.E(op, errs.KindUnauthorized, err, "invalid id token")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, errs.E(op, errs.KindUnauthorized, ErrMalformedToken, "invalid id token")
+	}
+
+	if err := verifySignature(h.Alg, hash, key, parts[0]+"."+parts[1], signature); err != nil {
+		return claims, errs.E(op, errs.KindUnauthorized, err, "invalid id token")
+	}
+
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return claims, errs.E(op, errs.KindUnauthorized, ErrMalformedToken, "invalid id token")
+	}
+
+	if err := p.validClaims(claims, nonce, time.Now()); err != nil {
+		return claims, errs.E(op, errs.KindUnauthorized, err, "invalid id token")
+	}
+
+	return claims, nil
+}
+
+func (p *Provider) validClaims(claims Claims, nonce string, now time.Time) error {
+	if strings.TrimSuffix(claims.Issuer, "/") != p.config.Issuer {
+		return fmt.Errorf("%w: iss", ErrInvalidClaims)
+	}
+
+	if claims.Subject == "" {
+		return fmt.Errorf("%w: sub", ErrInvalidClaims)
+	}
+
+	if !contains(claims.Audience, p.config.ClientID) {
+		return fmt.Errorf("%w: aud", ErrInvalidClaims)
+	}
+
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID {
+		return fmt.Errorf("%w: azp", ErrInvalidClaims)
+	}
+
+	if claims.Expiry == 0 || now.Add(-clockSkew).After(time.Unix(claims.Expiry, 0)) {
+		return fmt.Errorf("%w: exp", ErrInvalidClaims)
+	}
+
+	if claims.IssuedAt != 0 && time.Unix(claims.IssuedAt, 0).After(now.Add(clockSkew)) {
+		return fmt.Errorf("%w: iat", ErrInvalidClaims)
+	}
+
+	if claims.Nonce != nonce {
+		return fmt.Errorf("%w: nonce", ErrInvalidClaims)
+	}
+
+	return nil
+}
+
+var algHash = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+}
+
+func verifySignature(alg string, hash crypto.Hash, key crypto.PublicKey, signed string, signature []byte) error {
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return ErrUnsupportedAlg
+		}
+
+		if err := rsa.VerifyPKCS1v15(k, hash, digest, signature); err != nil {
+			return ErrInvalidSignature
+		}
+
+		return nil
+
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return ErrUnsupportedAlg
+		}
+
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return ErrInvalidSignature
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+
+		if !ecdsa.Verify(k, digest, r, s) {
+			return ErrInvalidSignature
+		}
+
+		return nil
+	}
+
+	return ErrUnsupportedAlg
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type keySet struct {
+	fetch func(ctx context.Context, dst any) error
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+func newKeySet(fetch func(ctx context.Context, dst any) error) *keySet {
+	return &keySet{fetch: fetch}
+}
+
+// find returns the key identified by kid, refreshing the set once when the provider rotated its keys.
+func (k *keySet) find(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if key, ok := k.lookup(kid); ok {
+		return key, nil
+	}
+
+	if !k.fetchedAt.IsZero() && time.Since(k.fetchedAt) < keyRefreshLimit {
+		return nil, ErrUnknownKey
+	}
+
+	if err := k.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	if key, ok := k.lookup(kid); ok {
+		return key, nil
+	}
+
+	return nil, ErrUnknownKey
+}
+
+func (k *keySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(k.keys) == 1 {
+		for _, key := range k.keys {
+			return key, true
+		}
+	}
+
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+func (k *keySet) refresh(ctx context.Context) error {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := k.fetch(ctx, &set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+
+		keys[jwk.Kid] = key
+	}
+
+	k.keys = keys
+	k.fetchedAt = time.Now()
+	return nil
+}
+
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, ErrUnsupportedAlg
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, ErrUnknownKey
+		}
+
+		return key, nil
+	}
+
+	return nil, ErrUnsupportedAlg
+}
+
+func decodeSegment(segment string, dst any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, dst)
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
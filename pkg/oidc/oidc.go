@@ -0,0 +1,249 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samuelsih/guwu/pkg/errs"
+)
+
+const (
+	discoveryPath = "/.well-known/openid-configuration"
+	maxBodySize   = 1 << 20
+)
+
+var (
+	ErrIssuerMismatch = errors.New("issuer mismatch")
+	ErrTokenEndpoint  = errors.New("token endpoint error")
+	ErrNoIDToken      = errors.New("token response has no id_token")
+)
+
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Metadata is the subset of the discovery document the provider needs.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider talks to one external OpenID Connect provider.
+// Discovery and keys are loaded lazily so an unreachable provider does not prevent the server from starting.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu       sync.Mutex
+	metadata *Metadata
+	keys     *keySet
+}
+
+func New(config Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	if len(config.Scopes) == 0 {
+		config.Scopes = DefaultScopes
+	}
+
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+
+	return &Provider{
+		config: config,
+		client: client,
+	}
+}
+
+// Discover fetches the discovery document once and caches it.
+func (p *Provider) Discover(ctx context.Context) (Metadata, error) {
+	const op = errs.Op("oidc.Discover")
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return *p.metadata, nil
+	}
+
+	var metadata Metadata
+
+	if err := p.getJSON(ctx, p.config.Issuer+discoveryPath, &metadata); err != nil {
+		return metadata, errs.E(op, errs.KindUnexpected, err, "cannot reach identity provider")
+	}
+
+	if strings.TrimSuffix(metadata.Issuer, "/") != p.config.Issuer {
+		return metadata, errs.E(op, errs.KindUnexpected, ErrIssuerMismatch, "cannot reach identity provider")
+	}
+
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return metadata, errs.E(op, errs.KindUnexpected, errors.New("incomplete discovery document"), "cannot reach identity provider")
+	}
+
+	p.metadata = &metadata
+	p.keys = newKeySet(func(ctx context.Context, dst any) error {
+		return p.getJSON(ctx, metadata.JWKSURI, dst)
+	})
+
+	return metadata, nil
+}
+
+// AuthCodeURL returns where the user must be sent to authenticate with the provider.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	metadata, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return metadata.AuthorizationEndpoint + sep + query.Encode(), nil
+}
+
+// Authenticate exchanges code for tokens and returns the verified claims of the id token.
+func (p *Provider) Authenticate(ctx context.Context, code, codeVerifier, nonce string) (Claims, error) {
+	rawIDToken, err := p.exchange(ctx, code, codeVerifier)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	return p.Verify(ctx, rawIDToken, nonce)
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (p *Provider) exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	const op = errs.Op("oidc.exchange")
+
+	metadata, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.config.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errs.E(op, errs.KindUnexpected, err, "cannot reach identity provider")
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return "", errs.E(op, errs.KindUnexpected, err, "cannot reach identity provider")
+	}
+
+	defer res.Body.Close()
+
+	var body tokenResponse
+
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxBodySize)).Decode(&body); err != nil {
+		return "", errs.E(op, errs.KindUnexpected, err, "cannot reach identity provider")
+	}
+
+	if res.StatusCode != http.StatusOK || body.Error != "" {
+		err := fmt.Errorf("%w: %d %s %s", ErrTokenEndpoint, res.StatusCode, body.Error, body.ErrorDescription)
+
+		// 4xx means the code or the verifier was rejected, which is the caller's fault
+		if res.StatusCode >= 400 && res.StatusCode < 500 {
+			return "", errs.E(op, errs.KindBadRequest, err, "authorization code was rejected by the identity provider")
+		}
+
+		return "", errs.E(op, errs.KindUnexpected, err, "cannot reach identity provider")
+	}
+
+	if body.IDToken == "" {
+		return "", errs.E(op, errs.KindUnexpected, ErrNoIDToken, "cannot reach identity provider")
+	}
+
+	return body.IDToken, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, endpoint string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %d", endpoint, res.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(res.Body, maxBodySize)).Decode(dst)
+}
+
+// NewPKCE returns a random code verifier and its S256 challenge.
+func NewPKCE() (verifier string, challenge string, err error) {
+	const op = errs.Op("oidc.NewPKCE")
+
+	b := make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", "", errs.E(op, errs.KindUnexpected, err, "internal error")
+	}
+
+	verifier = base64.RawURLEncoding.EncodeToString(b)
+	return verifier, S256(verifier), nil
+}
+
+func S256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
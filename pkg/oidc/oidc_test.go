@@ -0,0 +1,183 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/samuelsih/guwu/pkg/errs"
+	"github.com/samuelsih/guwu/pkg/oidc/oidctest"
+)
+
+const redirectURL = "https://guwu.example.com/auth/callback"
+
+func newTestProvider(t *testing.T) (*Provider, *oidctest.Server) {
+	t.Helper()
+
+	server := oidctest.NewServer("guwu", "secret")
+	t.Cleanup(server.Close)
+
+	provider := New(Config{
+		Issuer:       server.Issuer(),
+		ClientID:     "guwu",
+		ClientSecret: "secret",
+		RedirectURL:  redirectURL,
+	}, server.Client())
+
+	return provider, server
+}
+
+func TestAuthenticate(t *testing.T) {
+	t.Parallel()
+
+	provider, server := newTestProvider(t)
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", "nonce", challenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+
+	u, _ := url.Parse(authURL)
+	if u.Query().Get("redirect_uri") != redirectURL || u.Query().Get("scope") != "openid email profile" {
+		t.Fatalf("AuthCodeURL() unexpected url %v", authURL)
+	}
+
+	user := oidctest.User{Subject: "123", Email: "social@gmail.com", EmailVerified: true, Name: "Social"}
+
+	t.Run("WrongVerifier", func(t *testing.T) {
+		code, err := server.Login(authURL, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = provider.Authenticate(context.Background(), code, "wrong", "nonce")
+		if errs.GetKind(err) != errs.KindBadRequest {
+			t.Fatalf("Authenticate() expected bad request, got %v", err)
+		}
+	})
+
+	t.Run("WrongNonce", func(t *testing.T) {
+		code, err := server.Login(authURL, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = provider.Authenticate(context.Background(), code, verifier, "other")
+		if errs.GetKind(err) != errs.KindUnauthorized {
+			t.Fatalf("Authenticate() expected unauthorized, got %v", err)
+		}
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		code, err := server.Login(authURL, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		claims, err := provider.Authenticate(context.Background(), code, verifier, "nonce")
+		if err != nil {
+			t.Fatalf("Authenticate() error = %v", err)
+		}
+
+		if claims.Subject != "123" || claims.Email != "social@gmail.com" || !claims.EmailVerified {
+			t.Fatalf("Authenticate() unexpected claims %v", claims)
+		}
+	})
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	provider, server := newTestProvider(t)
+	now := time.Now()
+
+	valid := func() map[string]any {
+		return map[string]any{
+			"iss":   server.Issuer(),
+			"sub":   "123",
+			"aud":   "guwu",
+			"exp":   now.Add(time.Minute).Unix(),
+			"iat":   now.Unix(),
+			"nonce": "nonce",
+		}
+	}
+
+	tests := []struct {
+		name   string
+		token  func() string
+		reason error
+	}{
+		{"Valid", func() string { return server.Sign(valid()) }, nil},
+		{"AudienceArray", func() string {
+			c := valid()
+			c["aud"] = []string{"other", "guwu"}
+			c["azp"] = "guwu"
+			return server.Sign(c)
+		}, nil},
+		{"Malformed", func() string { return "a.b" }, ErrMalformedToken},
+		{"ForeignKey", func() string { return server.SignWithForeignKey(valid()) }, ErrInvalidSignature},
+		{"WrongIssuer", func() string {
+			c := valid()
+			c["iss"] = "https://evil.example.com"
+			return server.Sign(c)
+		}, ErrInvalidClaims},
+		{"WrongAudience", func() string {
+			c := valid()
+			c["aud"] = "other"
+			return server.Sign(c)
+		}, ErrInvalidClaims},
+		{"MissingAuthorizedParty", func() string {
+			c := valid()
+			c["aud"] = []string{"other", "guwu"}
+			return server.Sign(c)
+		}, ErrInvalidClaims},
+		{"Expired", func() string {
+			c := valid()
+			c["exp"] = now.Add(-time.Hour).Unix()
+			return server.Sign(c)
+		}, ErrInvalidClaims},
+		{"WrongNonce", func() string {
+			c := valid()
+			c["nonce"] = "other"
+			return server.Sign(c)
+		}, ErrInvalidClaims},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.Verify(context.Background(), tt.token(), "nonce")
+
+			if tt.reason == nil {
+				if err != nil {
+					t.Fatalf("Verify() error = %v", err)
+				}
+
+				return
+			}
+
+			var e *errs.Error
+			if !errors.As(err, &e) || !errors.Is(e.Err, tt.reason) {
+				t.Fatalf("Verify() expected %v, got %v", tt.reason, err)
+			}
+		})
+	}
+}
+
+func TestDiscoverIssuerMismatch(t *testing.T) {
+	t.Parallel()
+
+	server := oidctest.NewServer("guwu", "secret")
+	defer server.Close()
+
+	provider := New(Config{Issuer: server.Issuer() + "/other", ClientID: "guwu"}, server.Client())
+
+	if _, err := provider.Discover(context.Background()); err == nil {
+		t.Fatal("Discover() expected error for unreachable issuer")
+	}
+}
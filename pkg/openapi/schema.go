@@ -0,0 +1,218 @@
+package openapi
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samuelsih/guwu/pkg/request"
+)
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+)
+
+// Aliased is implemented by types encoded as another type, such as nullable or optional wrappers.
+// SchemaAs returns a value of the encoded type, a pointer standing for a nullable one.
+type Aliased interface {
+	SchemaAs() any
+}
+
+// Generator reflects Go types into schemas, named structs become shared components.
+type Generator struct {
+	schemas map[string]*Schema
+}
+
+func NewGenerator() *Generator {
+	return &Generator{schemas: map[string]*Schema{}}
+}
+
+// Schemas returns the components collected so far.
+func (g *Generator) Schemas() map[string]*Schema {
+	return g.schemas
+}
+
+func (g *Generator) Schema(t reflect.Type) *Schema {
+	if t.Implements(reflect.TypeOf((*Aliased)(nil)).Elem()) {
+		alias := reflect.Zero(t).Interface().(Aliased).SchemaAs()
+		return g.Schema(reflect.TypeOf(alias))
+	}
+
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return nullable(g.Schema(t.Elem()))
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+
+		return &Schema{Type: "array", Items: g.Schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.Schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+
+		name := ComponentName(t)
+		if _, ok := g.schemas[name]; !ok {
+			// registered before walking the fields so recursive types end on the ref
+			g.schemas[name] = &Schema{}
+			*g.schemas[name] = *g.object(t)
+		}
+
+		return Ref(name)
+	}
+
+	return &Schema{}
+}
+
+// ComponentName names the schema of t after its package and type, as in auth.LoginInput.
+func ComponentName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+
+	name := t.Name()
+	if pkg != "" {
+		name = pkg + "." + name
+	}
+
+	return unsafeNameChars.ReplaceAllString(name, "_")
+}
+
+// object follows encoding/json: embedded structs are flattened and the json tag names the property.
+// Fields only read from the url or the query are left to the parameters.
+func (g *Generator) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	g.fields(t, schema)
+	return schema
+}
+
+func (g *Generator) fields(t reflect.Type, schema *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		jsonTag := field.Tag.Get("json")
+		name, _, _ := strings.Cut(jsonTag, ",")
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			g.fields(field.Type, schema)
+			continue
+		}
+
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+
+		if jsonTag == "" && (field.Tag.Get("url") != "" || field.Tag.Get("query") != "") {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		tag := field.Tag.Get("validate")
+		property := g.Schema(field.Type)
+		ApplyRules(property, tag)
+
+		schema.Properties[name] = property
+
+		if hasRequired(tag) {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// ApplyRules translates the rules of a validate tag, see request.Validate, into schema keywords.
+func ApplyRules(schema *Schema, tag string) {
+	if schema.Ref != "" || tag == "" {
+		return
+	}
+
+	typ, _ := schema.Type.(string)
+	if types, ok := schema.Type.([]string); ok && len(types) > 0 {
+		typ = types[0]
+	}
+
+	for _, rule := range request.SplitRules(tag) {
+		key, param, _ := strings.Cut(rule, "=")
+
+		switch key {
+		case "min", "max":
+			n, err := strconv.Atoi(param)
+			if err != nil {
+				continue
+			}
+
+			bound := bounds(schema, typ, key == "min")
+			if bound != nil {
+				*bound = &n
+			}
+
+		case "email", "uuid":
+			schema.Format = key
+
+		case "oneof":
+			schema.Enum = strings.Fields(param)
+
+		case "regex":
+			schema.Pattern = param
+		}
+	}
+}
+
+func bounds(schema *Schema, typ string, min bool) **int {
+	switch {
+	case typ == "string" && min:
+		return &schema.MinLength
+	case typ == "string":
+		return &schema.MaxLength
+	case typ == "array" && min:
+		return &schema.MinItems
+	case typ == "array":
+		return &schema.MaxItems
+	case (typ == "integer" || typ == "number") && min:
+		return &schema.Minimum
+	case typ == "integer" || typ == "number":
+		return &schema.Maximum
+	}
+
+	return nil
+}
+
+func hasRequired(tag string) bool {
+	for _, rule := range request.SplitRules(tag) {
+		if rule == "required" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// nullable allows null next to the type, a component stays a plain ref.
+func nullable(schema *Schema) *Schema {
+	if typ, ok := schema.Type.(string); ok {
+		schema.Type = []string{typ, "null"}
+	}
+
+	return schema
+}
@@ -0,0 +1,73 @@
+package openapi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type nullString struct{}
+
+func (nullString) SchemaAs() any { return (*string)(nil) }
+
+type base struct {
+	ID string `json:"id"`
+}
+
+type node struct {
+	base
+	Name     string            `json:"name" validate:"required,max=10"`
+	Email    string            `json:"email,omitempty" validate:"email"`
+	Sort     string            `json:"sort" validate:"oneof=asc desc"`
+	Tags     []string          `json:"tags" validate:"min=1"`
+	Limit    int               `json:"limit" validate:"min=0,max=100"`
+	Bio      nullString        `json:"bio"`
+	Born     time.Time         `json:"born"`
+	Labels   map[string]string `json:"labels"`
+	Children []node            `json:"children"`
+	Page     int               `query:"page"`
+	Secret   string            `json:"-"`
+}
+
+func TestGenerator(t *testing.T) {
+	gen := NewGenerator()
+
+	ref := gen.Schema(reflect.TypeOf(node{}))
+	if ref.Ref != "#/components/schemas/openapi.node" {
+		t.Fatalf("expected a ref, got %+v", ref)
+	}
+
+	schema := gen.Schemas()["openapi.node"]
+
+	if _, ok := schema.Properties["id"]; !ok {
+		t.Fatalf("expected the embedded fields flattened, got %v", schema.Properties)
+	}
+
+	for _, skipped := range []string{"Page", "page", "Secret", "-"} {
+		if _, ok := schema.Properties[skipped]; ok {
+			t.Fatalf("expected %s skipped", skipped)
+		}
+	}
+
+	if len(schema.Required) != 1 || schema.Required[0] != "name" {
+		t.Fatalf("expected name required, got %v", schema.Required)
+	}
+
+	checks := map[string]func(s *Schema) bool{
+		"name":     func(s *Schema) bool { return s.Type == "string" && *s.MaxLength == 10 },
+		"email":    func(s *Schema) bool { return s.Format == "email" },
+		"sort":     func(s *Schema) bool { return reflect.DeepEqual(s.Enum, []string{"asc", "desc"}) },
+		"tags":     func(s *Schema) bool { return s.Type == "array" && *s.MinItems == 1 },
+		"limit":    func(s *Schema) bool { return s.Type == "integer" && *s.Minimum == 0 && *s.Maximum == 100 },
+		"bio":      func(s *Schema) bool { return reflect.DeepEqual(s.Type, []string{"string", "null"}) },
+		"born":     func(s *Schema) bool { return s.Format == "date-time" },
+		"labels":   func(s *Schema) bool { return s.AdditionalProperties.Type == "string" },
+		"children": func(s *Schema) bool { return s.Items.Ref == ref.Ref },
+	}
+
+	for name, check := range checks {
+		if !check(schema.Properties[name]) {
+			t.Fatalf("unexpected schema for %s: %+v", name, schema.Properties[name])
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/samuelsih/guwu/pkg/errs"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+// bcrypt silently ignores every byte after the 72nd
+const bcryptMaxLength = 72
+
+// stored hashes choose their own cost, these bound the work a forged one can ask for
+const (
+	argon2MaxMemory     = 1 << 20 // KiB
+	argon2MaxIterations = 64
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown password algorithm")
+	ErrInvalidHash      = errors.New("invalid password hash")
+	ErrInvalidParams    = errors.New("invalid password params")
+	ErrPasswordTooLong  = errors.New("password is too long")
+)
+
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+type Config struct {
+	Algorithm  string
+	Argon2     Argon2Params
+	BcryptCost int
+}
+
+var DefaultConfig = Config{
+	Algorithm: Argon2id,
+	Argon2: Argon2Params{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+	},
+	BcryptCost: bcrypt.DefaultCost,
+}
+
+var (
+	current = DefaultConfig
+	once    sync.Once
+)
+
+// SetConfig replaces DefaultConfig for Hash and Verify. Only the first call has effect.
+func SetConfig(cfg Config) error {
+	const op = errs.Op("password.SetConfig")
+
+	if err := cfg.validate(); err != nil {
+		return errs.E(op, errs.KindUnexpected, err, err.Error())
+	}
+
+	once.Do(func() {
+		current = cfg
+	})
+
+	return nil
+}
+
+// Hash encodes password with the configured algorithm.
+// Argon2id hashes use the PHC string format, bcrypt hashes keep their modular crypt format.
+func Hash(password string) (string, error) {
+	return current.Hash(password)
+}
+
+// Verify reports whether password matches encoded and whether encoded
+// was produced with an algorithm or params other than the configured ones.
+func Verify(encoded, password string) (match bool, needsRehash bool, err error) {
+	return current.Verify(encoded, password)
+}
+
+func (c Config) Hash(password string) (string, error) {
+	const op = errs.Op("password.Hash")
+
+	switch c.Algorithm {
+	case Argon2id:
+		salt := make([]byte, c.Argon2.SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", errs.E(op, errs.KindUnexpected, err, "unexpected error.")
+		}
+
+		key := argon2.IDKey([]byte(password), salt, c.Argon2.Iterations, c.Argon2.Memory, c.Argon2.Parallelism, c.Argon2.KeyLength)
+
+		return encodeArgon2(c.Argon2, salt, key), nil
+
+	case Bcrypt:
+		if len(password) > bcryptMaxLength {
+			return "", errs.E(op, errs.KindBadRequest, ErrPasswordTooLong, fmt.Sprintf("password must not be longer than %d bytes", bcryptMaxLength))
+		}
+
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), c.BcryptCost)
+		if err != nil {
+			return "", errs.E(op, errs.KindUnexpected, err, "unexpected error.")
+		}
+
+		return string(hashed), nil
+
+	default:
+		return "", errs.E(op, errs.KindUnexpected, ErrUnknownAlgorithm, "unexpected error.")
+	}
+}
+
+func (c Config) Verify(encoded, password string) (bool, bool, error) {
+	const op = errs.Op("password.Verify")
+
+	switch algorithmOf(encoded) {
+	case Argon2id:
+		params, salt, key, err := decodeArgon2(encoded)
+		if err != nil {
+			return false, false, errs.E(op, errs.KindUnexpected, err, "unexpected error.")
+		}
+
+		other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return false, false, nil
+		}
+
+		return true, c.Algorithm != Argon2id || params != c.Argon2, nil
+
+	case Bcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+
+		if err != nil {
+			return false, false, errs.E(op, errs.KindUnexpected, err, "unexpected error.")
+		}
+
+		cost, err := bcrypt.Cost([]byte(encoded))
+		if err != nil {
+			return false, false, errs.E(op, errs.KindUnexpected, err, "unexpected error.")
+		}
+
+		return true, c.Algorithm != Bcrypt || cost != c.BcryptCost, nil
+
+	default:
+		return false, false, errs.E(op, errs.KindUnexpected, ErrInvalidHash, "unexpected error.")
+	}
+}
+
+func (c Config) validate() error {
+	switch c.Algorithm {
+	case Argon2id:
+		if !c.Argon2.valid() {
+			return ErrInvalidParams
+		}
+
+	case Bcrypt:
+		if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+			return ErrInvalidParams
+		}
+
+	default:
+		return ErrUnknownAlgorithm
+	}
+
+	return nil
+}
+
+func algorithmOf(encoded string) string {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return Argon2id
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return Bcrypt
+	default:
+		return ""
+	}
+}
+
+func (p Argon2Params) valid() bool {
+	return p.Parallelism >= 1 &&
+		p.Iterations >= 1 && p.Iterations <= argon2MaxIterations &&
+		p.Memory >= 8*uint32(p.Parallelism) && p.Memory <= argon2MaxMemory &&
+		p.SaltLength >= 8 && p.KeyLength >= 16
+}
+
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func encodeArgon2(p Argon2Params, salt, key []byte) string {
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		Argon2id,
+		argon2.Version,
+		p.Memory,
+		p.Iterations,
+		p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func decodeArgon2(encoded string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	if version != argon2.Version {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+
+	// argon2.IDKey panics without parallelism
+	if !p.valid() {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	return p, salt, key, nil
+}
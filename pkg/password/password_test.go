@@ -0,0 +1,169 @@
+package password
+
+import (
+	"strings"
+	"testing"
+)
+
+var testArgon2 = Config{
+	Algorithm: Argon2id,
+	Argon2: Argon2Params{
+		Memory:      1024,
+		Iterations:  1,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	},
+	BcryptCost: 4,
+}
+
+var testBcrypt = Config{
+	Algorithm:  Bcrypt,
+	Argon2:     testArgon2.Argon2,
+	BcryptCost: 4,
+}
+
+func TestHashVerify(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		cfg    Config
+		prefix string
+	}{
+		{"argon2id", testArgon2, "$argon2id$v=19$m=1024,t=1,p=1$"},
+		{"bcrypt", testBcrypt, "$2a$04$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hashed, err := tt.cfg.Hash("Secret123!")
+			if err != nil {
+				t.Fatalf("Hash() err = %v", err)
+			}
+
+			if !strings.HasPrefix(hashed, tt.prefix) {
+				t.Fatalf("Hash() = %v, want prefix %v", hashed, tt.prefix)
+			}
+
+			match, rehash, err := tt.cfg.Verify(hashed, "Secret123!")
+			if err != nil || !match || rehash {
+				t.Fatalf("Verify() = %v %v %v, want true false nil", match, rehash, err)
+			}
+
+			match, _, err = tt.cfg.Verify(hashed, "Secret123?")
+			if err != nil || match {
+				t.Fatalf("Verify() wrong password = %v %v, want false nil", match, err)
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	t.Parallel()
+
+	fromBcrypt, err := testBcrypt.Hash("Secret123!")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromArgon2, err := testArgon2.Hash("Secret123!")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stronger := testArgon2
+	stronger.Argon2.Iterations = 2
+
+	costlier := testBcrypt
+	costlier.BcryptCost = 5
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		encoded string
+		want    bool
+	}{
+		{"bcrypt to argon2id", testArgon2, fromBcrypt, true},
+		{"argon2id to bcrypt", testBcrypt, fromArgon2, true},
+		{"argon2id params changed", stronger, fromArgon2, true},
+		{"bcrypt cost changed", costlier, fromBcrypt, true},
+		{"argon2id up to date", testArgon2, fromArgon2, false},
+		{"bcrypt up to date", testBcrypt, fromBcrypt, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, rehash, err := tt.cfg.Verify(tt.encoded, "Secret123!")
+			if err != nil || !match {
+				t.Fatalf("Verify() = %v %v, want true nil", match, err)
+			}
+
+			if rehash != tt.want {
+				t.Fatalf("Verify() needsRehash = %v, want %v", rehash, tt.want)
+			}
+		})
+	}
+}
+
+func TestBcryptTooLong(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("a", 73)
+
+	if _, err := testBcrypt.Hash(long); err == nil {
+		t.Fatal("bcrypt must reject password longer than 72 bytes")
+	}
+
+	hashed, err := testArgon2.Hash(long)
+	if err != nil {
+		t.Fatalf("argon2id must accept long password, got %v", err)
+	}
+
+	match, _, _ := testArgon2.Verify(hashed, long[:72])
+	if match {
+		t.Fatal("argon2id must not truncate password")
+	}
+}
+
+func TestVerifyInvalidHash(t *testing.T) {
+	t.Parallel()
+
+	for _, encoded := range []string{"", "plain", "$argon2id$v=19$m=1,t=1$abc$abc", "$argon2id$v=18$m=1024,t=1,p=1$abc$abc"} {
+		if _, _, err := testArgon2.Verify(encoded, "x"); err == nil {
+			t.Fatalf("Verify(%q) must return error", encoded)
+		}
+	}
+}
+
+func TestVerifyInvalidArgon2Params(t *testing.T) {
+	t.Parallel()
+
+	salt, key := make([]byte, 16), make([]byte, 32)
+
+	for _, p := range []Argon2Params{
+		{Memory: 1024, Iterations: 1, Parallelism: 0},
+		{Memory: 1024, Iterations: 0, Parallelism: 1},
+		{Memory: 4, Iterations: 1, Parallelism: 1},
+		{Memory: argon2MaxMemory + 1, Iterations: 1, Parallelism: 1},
+		{Memory: 1024, Iterations: argon2MaxIterations + 1, Parallelism: 1},
+	} {
+		encoded := encodeArgon2(p, salt, key)
+
+		if _, _, err := testArgon2.Verify(encoded, "x"); err == nil {
+			t.Fatalf("Verify(%q) must return error", encoded)
+		}
+	}
+}
+
+func TestSetConfigInvalid(t *testing.T) {
+	t.Parallel()
+
+	if err := SetConfig(Config{Algorithm: "md5"}); err == nil {
+		t.Fatal("unknown algorithm must be rejected")
+	}
+
+	if err := SetConfig(Config{Algorithm: Bcrypt, BcryptCost: 100}); err == nil {
+		t.Fatal("invalid bcrypt cost must be rejected")
+	}
+}
@@ -84,6 +84,27 @@ func (r *Client) SetJSON(ctx context.Context, key string, value any, time int64)
 	return nil
 }
 
+// SetJSONIfAbsent stores value only when key does not exist yet, reporting whether it did.
+func (r *Client) SetJSONIfAbsent(ctx context.Context, key string, value any, time int64) (bool, error) {
+	const op = errs.Op("redis_wrapper.SetJSONIfAbsent")
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, errs.E(op, errs.KindUnexpected, err, "cannot marshal")
+	}
+
+	err = r.Pool.Do(ctx, r.Pool.B().Set().Key(key).Value(string(data)).Nx().ExSeconds(time).Build()).Error()
+	if rueidis.IsRedisNil(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, errs.E(op, errs.KindUnexpected, err, "internal error")
+	}
+
+	return true, nil
+}
+
 func (r *Client) Destroy(ctx context.Context, key string) error {
 	deleted, err := r.Pool.Do(ctx, r.Pool.B().Del().Key(key).Build()).ToInt64()
 	if err != nil {
@@ -96,3 +117,75 @@ func (r *Client) Destroy(ctx context.Context, key string) error {
 
 	return nil
 }
+
+func (r *Client) AddMember(ctx context.Context, key, member string, time int64) error {
+	const op = errs.Op("redis_wrapper.AddMember")
+
+	for _, resp := range r.Pool.DoMulti(ctx,
+		r.Pool.B().Sadd().Key(key).Member(member).Build(),
+		r.Pool.B().Expire().Key(key).Seconds(time).Build(),
+	) {
+		if err := resp.Error(); err != nil {
+			return errs.E(op, errs.KindUnexpected, err, "internal error")
+		}
+	}
+
+	return nil
+}
+
+func (r *Client) RemoveMember(ctx context.Context, key, member string) error {
+	const op = errs.Op("redis_wrapper.RemoveMember")
+
+	err := r.Pool.Do(ctx, r.Pool.B().Srem().Key(key).Member(member).Build()).Error()
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "internal error")
+	}
+
+	return nil
+}
+
+func (r *Client) Members(ctx context.Context, key string) ([]string, error) {
+	const op = errs.Op("redis_wrapper.Members")
+
+	members, err := r.Pool.Do(ctx, r.Pool.B().Smembers().Key(key).Build()).AsStrSlice()
+	if err != nil {
+		return nil, errs.E(op, errs.KindUnexpected, err, "internal error")
+	}
+
+	return members, nil
+}
+
+// Exists reports whether any of keys exists.
+func (r *Client) Exists(ctx context.Context, keys ...string) (bool, error) {
+	const op = errs.Op("redis_wrapper.Exists")
+
+	count, err := r.Pool.Do(ctx, r.Pool.B().Exists().Key(keys...).Build()).ToInt64()
+	if err != nil {
+		return false, errs.E(op, errs.KindUnexpected, err, "internal error")
+	}
+
+	return count > 0, nil
+}
+
+// TTL returns the seconds left before key expires, negative when key is missing or never expires.
+func (r *Client) TTL(ctx context.Context, key string) (int64, error) {
+	const op = errs.Op("redis_wrapper.TTL")
+
+	ttl, err := r.Pool.Do(ctx, r.Pool.B().Ttl().Key(key).Build()).ToInt64()
+	if err != nil {
+		return 0, errs.E(op, errs.KindUnexpected, err, "internal error")
+	}
+
+	return ttl, nil
+}
+
+func (r *Client) Expire(ctx context.Context, key string, time int64) error {
+	const op = errs.Op("redis_wrapper.Expire")
+
+	err := r.Pool.Do(ctx, r.Pool.B().Expire().Key(key).Seconds(time).Build()).Error()
+	if err != nil {
+		return errs.E(op, errs.KindUnexpected, err, "internal error")
+	}
+
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/samuelsih/guwu/config"
 	"github.com/testcontainers/testcontainers-go"
@@ -110,6 +111,163 @@ func TestDestroy(t *testing.T) {
 	})
 }
 
+func TestMembers(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	for _, member := range []string{"a", "b", "c"} {
+		if err := client.AddMember(ctx, "set", member, 100); err != nil {
+			t.Fatalf("AddMember: expected err is nil, got %v", err)
+		}
+	}
+
+	if err := client.RemoveMember(ctx, "set", "b"); err != nil {
+		t.Fatalf("RemoveMember: expected err is nil, got %v", err)
+	}
+
+	members, err := client.Members(ctx, "set")
+	if err != nil {
+		t.Fatalf("Members: expected err is nil, got %v", err)
+	}
+
+	if len(members) != 2 {
+		t.Fatalf("Members: expected 2 members, got %v", members)
+	}
+
+	members, err = client.Members(ctx, "unknown_set")
+	if err != nil || len(members) != 0 {
+		t.Fatalf("Members: expected empty set, got %v %v", members, err)
+	}
+}
+
+func TestExists(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	if err := client.Set(ctx, "exists", "yes", 100); err != nil {
+		t.Fatalf("Set: expected err is nil, got %v", err)
+	}
+
+	ok, err := client.Exists(ctx, "exists_not", "exists")
+	if err != nil || !ok {
+		t.Fatalf("Exists: expected true, got %v %v", ok, err)
+	}
+
+	ok, err = client.Exists(ctx, "exists_not")
+	if err != nil || ok {
+		t.Fatalf("Exists: expected false, got %v %v", ok, err)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	if err := client.Set(ctx, "sliding", "yes", 100); err != nil {
+		t.Fatalf("Set: expected err is nil, got %v", err)
+	}
+
+	if err := client.Expire(ctx, "sliding", 1000); err != nil {
+		t.Fatalf("Expire: expected err is nil, got %v", err)
+	}
+
+	ttl, err := client.TTL(ctx, "sliding")
+	if err != nil || ttl <= 100 {
+		t.Fatalf("TTL: expected more than 100, got %v %v", ttl, err)
+	}
+
+	ttl, err = client.TTL(ctx, "sliding_not")
+	if err != nil || ttl >= 0 {
+		t.Fatalf("TTL: expected negative, got %v %v", ttl, err)
+	}
+}
+
+func TestSetJSONIfAbsent(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	ok, err := client.SetJSONIfAbsent(ctx, "absent", map[string]string{"state": "first"}, 100)
+	if err != nil || !ok {
+		t.Fatalf("SetJSONIfAbsent: expected true, got %v %v", ok, err)
+	}
+
+	ok, err = client.SetJSONIfAbsent(ctx, "absent", map[string]string{"state": "second"}, 100)
+	if err != nil || ok {
+		t.Fatalf("SetJSONIfAbsent: expected false, got %v %v", ok, err)
+	}
+
+	var got map[string]string
+	if err := client.GetJSON(ctx, "absent", &got); err != nil || got["state"] != "first" {
+		t.Fatalf("GetJSON: expected first, got %v %v", got, err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	last, err := client.LastID(ctx, "events")
+	if err != nil || last != "0-0" {
+		t.Fatalf("LastID: expected 0-0, got %v %v", last, err)
+	}
+
+	published := make(chan string, 2)
+	subCtx, unsubscribe := context.WithCancel(ctx)
+	defer unsubscribe()
+
+	go client.Subscribe(subCtx, "events", func(message string) {
+		published <- message
+	})
+
+	// the subscription is not confirmed, wait for it to be there
+	time.Sleep(100 * time.Millisecond)
+
+	first, err := client.Append(ctx, "events", "events", 10, 100, "one")
+	if err != nil {
+		t.Fatalf("Append: expected err is nil, got %v", err)
+	}
+
+	second, err := client.Append(ctx, "events", "events", 10, 100, "two")
+	if err != nil {
+		t.Fatalf("Append: expected err is nil, got %v", err)
+	}
+
+	for _, want := range []string{first, second} {
+		select {
+		case got := <-published:
+			if got != want {
+				t.Fatalf("Subscribe: expected %s, got %s", want, got)
+			}
+		case <-ctx.Done():
+			t.Fatal("Subscribe: nothing published")
+		}
+	}
+
+	entries, err := client.Range(ctx, "events", first, 10)
+	if err != nil || len(entries) != 1 || entries[0].ID != second || entries[0].Value != "two" {
+		t.Fatalf("Range: expected the second entry, got %v %v", entries, err)
+	}
+
+	entries, err = client.Range(ctx, "events", "", 10)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("Range: expected both entries, got %v %v", entries, err)
+	}
+
+	if last, err = client.LastID(ctx, "events"); err != nil || last != second {
+		t.Fatalf("LastID: expected %s, got %v %v", second, last, err)
+	}
+
+	if _, err := client.Range(ctx, "events", "nope", 10); err == nil {
+		t.Fatal("Range: expected err on invalid id")
+	}
+}
+
 func setup() error {
 	req := testcontainers.ContainerRequest{
 		Image:        "redis",
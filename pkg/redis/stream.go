@@ -0,0 +1,132 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/rueian/rueidis"
+	"github.com/samuelsih/guwu/pkg/errs"
+)
+
+var ErrInvalidStreamID = errors.New("invalid stream id")
+
+// StreamEntry is a value appended to a stream, its ID orders it.
+type StreamEntry struct {
+	ID    string
+	Value string
+}
+
+// Append adds value to the stream key, trimmed to about maxLen entries and kept time seconds
+// after the last append, then publishes the id of the entry on channel.
+func (r *Client) Append(ctx context.Context, key, channel string, maxLen, time int64, value string) (string, error) {
+	const op = errs.Op("redis_wrapper.Append")
+
+	resps := r.Pool.DoMulti(ctx,
+		r.Pool.B().Xadd().Key(key).Maxlen().Almost().Threshold(strconv.FormatInt(maxLen, 10)).Id("*").FieldValue().FieldValue("value", value).Build(),
+		r.Pool.B().Expire().Key(key).Seconds(time).Build(),
+	)
+
+	id, err := resps[0].ToString()
+	if err != nil {
+		return "", errs.E(op, errs.KindUnexpected, err, "internal error")
+	}
+
+	if err := resps[1].Error(); err != nil {
+		return "", errs.E(op, errs.KindUnexpected, err, "internal error")
+	}
+
+	if err := r.Pool.Do(ctx, r.Pool.B().Publish().Channel(channel).Message(id).Build()).Error(); err != nil {
+		return "", errs.E(op, errs.KindUnexpected, err, "internal error")
+	}
+
+	return id, nil
+}
+
+// Range returns up to count entries of the stream key following the id after, oldest first.
+func (r *Client) Range(ctx context.Context, key, after string, count int64) ([]StreamEntry, error) {
+	const op = errs.Op("redis_wrapper.Range")
+
+	start, err := nextStreamID(after)
+	if err != nil {
+		return nil, errs.E(op, errs.KindBadRequest, err, ErrInvalidStreamID.Error())
+	}
+
+	entries, err := r.Pool.Do(ctx, r.Pool.B().Xrange().Key(key).Start(start).End("+").Count(count).Build()).AsXRange()
+	if err != nil && !rueidis.IsRedisNil(err) {
+		return nil, errs.E(op, errs.KindUnexpected, err, "internal error")
+	}
+
+	result := make([]StreamEntry, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, StreamEntry{ID: e.ID, Value: e.FieldValues["value"]})
+	}
+
+	return result, nil
+}
+
+// LastID returns the id of the latest entry of the stream key, 0-0 when it is empty.
+func (r *Client) LastID(ctx context.Context, key string) (string, error) {
+	const op = errs.Op("redis_wrapper.LastID")
+
+	entries, err := r.Pool.Do(ctx, r.Pool.B().Xrevrange().Key(key).End("+").Start("-").Count(1).Build()).AsXRange()
+	if err != nil && !rueidis.IsRedisNil(err) {
+		return "", errs.E(op, errs.KindUnexpected, err, "internal error")
+	}
+
+	if len(entries) == 0 {
+		return "0-0", nil
+	}
+
+	return entries[0].ID, nil
+}
+
+// Subscribe calls fn with every message published on channel until ctx is done.
+func (r *Client) Subscribe(ctx context.Context, channel string, fn func(message string)) error {
+	const op = errs.Op("redis_wrapper.Subscribe")
+
+	err := r.Pool.Receive(ctx, r.Pool.B().Subscribe().Channel(channel).Build(), func(msg rueidis.PubSubMessage) {
+		fn(msg.Message)
+	})
+
+	if err != nil && ctx.Err() == nil {
+		return errs.E(op, errs.KindUnexpected, err, "internal error")
+	}
+
+	return nil
+}
+
+// ValidStreamID reports whether id is a complete stream id, as in 1526919030474-55.
+func ValidStreamID(id string) bool {
+	_, err := nextStreamID(id)
+	return err == nil && id != ""
+}
+
+// nextStreamID is the smallest id following id, the exclusive ranges of Redis 6.2 done by hand.
+func nextStreamID(id string) (string, error) {
+	if id == "" {
+		return "-", nil
+	}
+
+	ms, seq, found := strings.Cut(id, "-")
+	if !found {
+		return "", ErrInvalidStreamID
+	}
+
+	msValue, err := strconv.ParseUint(ms, 10, 64)
+	if err != nil {
+		return "", ErrInvalidStreamID
+	}
+
+	seqValue, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return "", ErrInvalidStreamID
+	}
+
+	if seqValue == ^uint64(0) {
+		return strconv.FormatUint(msValue+1, 10) + "-0", nil
+	}
+
+	return ms + "-" + strconv.FormatUint(seqValue+1, 10), nil
+}
@@ -0,0 +1,57 @@
+package request
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DecodeForm decodes an application/x-www-form-urlencoded body into the string fields of dst,
+// matching form keys against the json tags so the same input type serves both encodings.
+func DecodeForm(w http.ResponseWriter, r *http.Request, dst any) error {
+	maxBytes := 1_048_576 //1MB
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	if err := r.ParseForm(); err != nil {
+		if strings.Contains(err.Error(), "request body too large") {
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+		}
+
+		return fmt.Errorf("body contains badly-formed form")
+	}
+
+	if len(r.PostForm) == 0 {
+		return fmt.Errorf("body must not be empty")
+	}
+
+	values := make(map[string]string, len(r.PostForm))
+
+	for key, value := range r.PostForm {
+		if len(value) > 1 {
+			return fmt.Errorf("body contains duplicate key %s", key)
+		}
+
+		values[key] = value[0]
+	}
+
+	b, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("can't unmarshal this request")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		if strings.HasPrefix(err.Error(), "json: unknown field ") {
+			fieldName := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+			return fmt.Errorf("body contains unknown key %s", fieldName)
+		}
+
+		return fmt.Errorf("body contains incorrect type for form field")
+	}
+
+	return nil
+}
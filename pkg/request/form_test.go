@@ -0,0 +1,61 @@
+package request
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_DecodeForm(t *testing.T) {
+	type tokenReq struct {
+		GrantType string `json:"grant_type"`
+		Code      string `json:"code"`
+	}
+
+	newRequest := func(body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+
+	t.Run("success", func(t *testing.T) {
+		var dst tokenReq
+
+		err := DecodeForm(httptest.NewRecorder(), newRequest("grant_type=authorization_code&code=abc%2B1"), &dst)
+		if err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+
+		if dst.GrantType != "authorization_code" || dst.Code != "abc+1" {
+			t.Fatalf("unexpected result %v", dst)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		var dst tokenReq
+
+		err := DecodeForm(httptest.NewRecorder(), newRequest(""), &dst)
+		if err == nil || err.Error() != "body must not be empty" {
+			t.Fatalf("expected %v, got %v", "body must not be empty", err)
+		}
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		var dst tokenReq
+
+		err := DecodeForm(httptest.NewRecorder(), newRequest("scope=a"), &dst)
+		if err == nil || !strings.HasPrefix(err.Error(), "body contains unknown key") {
+			t.Fatalf("expected %v, got %v", "body contains unknown key", err)
+		}
+	})
+
+	t.Run("duplicate key", func(t *testing.T) {
+		var dst tokenReq
+
+		err := DecodeForm(httptest.NewRecorder(), newRequest("code=a&code=b"), &dst)
+		if err == nil || !strings.HasPrefix(err.Error(), "body contains duplicate key") {
+			t.Fatalf("expected %v, got %v", "body contains duplicate key", err)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package request
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+)
+
+const (
+	urlTagName   = "url"
+	queryTagName = "query"
+)
+
+// ParamError reports a url or query parameter that cannot be converted to the type of its field.
+type ParamError struct {
+	Source string
+	Name   string
+	Reason string
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("invalid %s parameter %s: %s", e.Source, e.Name, e.Reason)
+}
+
+// DecodeParams fills the fields of dst tagged with `url` from urlParam and the ones tagged with `query` from query.
+// Parameters that are absent leave their field untouched, so defaults can be set before decoding.
+func DecodeParams(dst any, urlParam func(key string) string, query url.Values) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+
+	return decodeParams(v.Elem(), urlParam, query)
+}
+
+func decodeParams(v reflect.Value, urlParam func(key string) string, query url.Values) error {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+
+		if field.Anonymous && value.Kind() == reflect.Struct {
+			if err := decodeParams(value, urlParam, query); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if !value.CanSet() {
+			continue
+		}
+
+		if name, ok := field.Tag.Lookup(urlTagName); ok {
+			raw := urlParam(name)
+			if raw == "" {
+				continue
+			}
+
+			if err := setParam(value, []string{raw}); err != nil {
+				return &ParamError{Source: "url", Name: name, Reason: err.Error()}
+			}
+		}
+
+		if name, ok := field.Tag.Lookup(queryTagName); ok {
+			raw, exist := query[name]
+			if !exist || len(raw) == 0 {
+				continue
+			}
+
+			if err := setParam(value, raw); err != nil {
+				return &ParamError{Source: "query", Name: name, Reason: err.Error()}
+			}
+		}
+	}
+
+	return nil
+}
+
+func setParam(value reflect.Value, raw []string) error {
+	if value.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(value.Type(), len(raw), len(raw))
+
+		for i, r := range raw {
+			if err := setScalar(slice.Index(i), r); err != nil {
+				return err
+			}
+		}
+
+		value.Set(slice)
+		return nil
+	}
+
+	if len(raw) > 1 {
+		return fmt.Errorf("must be given once")
+	}
+
+	return setScalar(value, raw[0])
+}
+
+func setScalar(value reflect.Value, raw string) error {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("must be a boolean")
+		}
+
+		value.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+
+		value.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a positive integer")
+		}
+
+		value.SetUint(n)
+
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(raw, value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a number")
+		}
+
+		value.SetFloat(n)
+
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package request
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+type pagination struct {
+	Limit  int  `query:"limit"`
+	Offset uint `query:"offset"`
+}
+
+type listInput struct {
+	pagination
+	UserID string   `url:"id" json:"id"`
+	Draft  bool     `query:"draft"`
+	Tags   []string `query:"tag"`
+	Ignore string
+}
+
+func Test_DecodeParams(t *testing.T) {
+	urlParams := map[string]string{"id": "u-1"}
+	lookup := func(key string) string { return urlParams[key] }
+
+	tests := []struct {
+		name    string
+		query   string
+		wantErr string
+		check   func(in listInput) bool
+	}{
+		{"Defaults", "", "", func(in listInput) bool {
+			return in.UserID == "u-1" && in.Limit == 20 && in.Offset == 0 && !in.Draft
+		}},
+		{"Typed", "limit=5&offset=10&draft=true&tag=a&tag=b", "", func(in listInput) bool {
+			return in.Limit == 5 && in.Offset == 10 && in.Draft && len(in.Tags) == 2 && in.Tags[1] == "b"
+		}},
+		{"InvalidInt", "limit=five", "invalid query parameter limit: must be an integer", nil},
+		{"NegativeUint", "offset=-1", "invalid query parameter offset: must be a positive integer", nil},
+		{"InvalidBool", "draft=maybe", "invalid query parameter draft: must be a boolean", nil},
+		{"Repeated", "limit=1&limit=2", "invalid query parameter limit: must be given once", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			in := listInput{pagination: pagination{Limit: 20}}
+
+			err := DecodeParams(&in, lookup, query)
+
+			if tt.wantErr != "" {
+				var paramErr *ParamError
+				if !errors.As(err, &paramErr) || err.Error() != tt.wantErr {
+					t.Fatalf("expected %q, got %v", tt.wantErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if !tt.check(in) {
+				t.Fatalf("unexpected result %+v", in)
+			}
+		})
+	}
+}
+
+func Test_DecodeParamsNotStruct(t *testing.T) {
+	var m map[string]any
+
+	if err := DecodeParams(&m, func(string) string { return "" }, nil); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package request
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,13 +9,43 @@ import (
 	"log"
 	"net/http"
 	"strings"
+
+	"github.com/samuelsih/guwu/pkg/codec"
 )
 
 func Decode(w http.ResponseWriter, r *http.Request, dst any) error {
+	return DecodeAs(w, r, dst, codec.JSON)
+}
+
+// DecodeAs decodes a body encoded with c into dst, with the size limit and error classification of JSON.
+func DecodeAs(w http.ResponseWriter, r *http.Request, dst any, c codec.Codec) error {
 	maxBytes := 1_048_576 //1MB
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
 
-	dec := json.NewDecoder(r.Body)
+	var body io.Reader = r.Body
+
+	if c.Binary() {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			if err.Error() == "http: request body too large" {
+				return fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+			}
+
+			return errors.New("can't read this request")
+		}
+
+		if len(b) == 0 {
+			return errors.New("body must not be empty")
+		}
+
+		if b, err = c.ToJSON(b); err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(b)
+	}
+
+	dec := json.NewDecoder(body)
 	dec.DisallowUnknownFields()
 
 	err := dec.Decode(dst)
@@ -25,16 +56,16 @@ func Decode(w http.ResponseWriter, r *http.Request, dst any) error {
 
 		switch {
 		case errors.As(err, &syntaxError):
-			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+			return fmt.Errorf("body contains badly-formed %s (at character %d)", c.Name, syntaxError.Offset)
 
 		case errors.Is(err, io.ErrUnexpectedEOF):
-			return errors.New("body contains badly-formed JSON")
+			return fmt.Errorf("body contains badly-formed %s", c.Name)
 
 		case errors.As(err, &unmarshalTypeError):
 			if unmarshalTypeError.Field != "" {
-				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+				return fmt.Errorf("body contains incorrect %s type for field %q", c.Name, unmarshalTypeError.Field)
 			}
-			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+			return fmt.Errorf("body contains incorrect %s type (at character %d)", c.Name, unmarshalTypeError.Offset)
 
 		case errors.Is(err, io.EOF):
 			return errors.New("body must not be empty")
@@ -58,8 +89,32 @@ func Decode(w http.ResponseWriter, r *http.Request, dst any) error {
 
 	err = dec.Decode(&struct{}{})
 	if err != io.EOF {
-		return errors.New("body must only contain a single JSON value")
+		return fmt.Errorf("body must only contain a single %s value", c.Name)
 	}
 
 	return nil
 }
+
+// DecodeMergePatch decodes a JSON Merge Patch (RFC 7386) document into dst.
+// A patch that is not an object would replace the whole resource, so it is rejected.
+func DecodeMergePatch(w http.ResponseWriter, r *http.Request, dst any) error {
+	maxBytes := 1_048_576 //1MB
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		if err.Error() == "http: request body too large" {
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+		}
+
+		return errors.New("can't read this request")
+	}
+
+	trimmed := bytes.TrimSpace(b)
+	if len(trimmed) > 0 && trimmed[0] != '{' {
+		return errors.New("merge patch must be a JSON object")
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	return Decode(w, r, dst)
+}
@@ -1,6 +1,7 @@
 package request
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,6 +11,9 @@ import (
 	"testing"
 
 	_ "embed"
+
+	"github.com/samuelsih/guwu/pkg/codec"
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 //go:embed sample.txt
@@ -178,3 +182,84 @@ func Test_SingleJSONValue(t *testing.T) {
 		t.Fatalf("expected %v, got %v", "body must only contain a single JSON value", err)
 	}
 }
+
+func Test_DecodeMergePatch(t *testing.T) {
+	type patch struct {
+		Name *string `json:"name"`
+	}
+
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"Object", `{"name": null}`, ""},
+		{"Array", `[{"name": "bob"}]`, "merge patch must be a JSON object"},
+		{"Scalar", `"bob"`, "merge patch must be a JSON object"},
+		{"UnknownKey", `{"age": 1}`, "body contains unknown key age"},
+		{"Empty", ``, "body must not be empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			var dst patch
+			err := DecodeMergePatch(w, r, &dst)
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("expected nil, got %v", err)
+				}
+
+				return
+			}
+
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func Test_DecodeAs(t *testing.T) {
+	type someData struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+
+	tests := []struct {
+		name string
+		body map[string]any
+		err  string
+	}{
+		{"Success", map[string]any{"name": "bob", "age": 14}, ""},
+		{"UnknownKey", map[string]any{"name": "bob", "nickname": "b"}, "body contains unknown key nickname"},
+		{"IncorrectType", map[string]any{"age": "old"}, `body contains incorrect MessagePack type for field "age"`},
+		{"TooLarge", map[string]any{"name": strings.Repeat("a", 1_048_577)}, "body must not be larger than 1048576 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := msgpack.Marshal(tt.body)
+			if err != nil {
+				t.Fatalf("Unable to marshal: %v", err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+			w := httptest.NewRecorder()
+
+			var dst someData
+
+			err = DecodeAs(w, r, &dst, codec.MessagePack)
+			if tt.err == "" && (err != nil || dst.Name != "bob" || dst.Age != 14) {
+				t.Fatalf("expected bob, got %+v %v", dst, err)
+			}
+
+			if tt.err != "" && (err == nil || err.Error() != tt.err) {
+				t.Fatalf("expected %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package request
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const validateTagName = "validate"
+
+var (
+	uuidRegex  = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	regexCache sync.Map
+)
+
+// FieldError is one failed rule of one field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError aggregates every failed rule of an input.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Fields) == 1 {
+		return e.Fields[0].Message
+	}
+
+	return fmt.Sprintf("%s (and %d more errors)", e.Fields[0].Message, len(e.Fields)-1)
+}
+
+// PatchField is implemented by merge patch fields such as business.Optional,
+// an absent field is only checked by required, a present one is validated through its value.
+type PatchField interface {
+	PatchValue() (value any, set bool, null bool)
+}
+
+// Validate checks the `validate` tags of dst, a comma separated list of
+// required, min=n, max=n, email, uuid, oneof=a b c and regex=pattern. regex must come last.
+// It returns a *ValidationError listing every failed rule, or an error for a malformed tag.
+func Validate(dst any) error {
+	v := reflect.ValueOf(dst)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var fields []FieldError
+
+	if err := validateStruct(v, "", &fields); err != nil {
+		return err
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+
+	return nil
+}
+
+func validateStruct(v reflect.Value, prefix string, fields *[]FieldError) error {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+
+		if field.Anonymous && value.Kind() == reflect.Struct {
+			if err := validateStruct(value, prefix, fields); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		name := prefix + fieldName(field)
+		tag := field.Tag.Get(validateTagName)
+
+		if patch, ok := value.Interface().(PatchField); ok {
+			inner, set, null := patch.PatchValue()
+
+			if !set || null {
+				if hasRule(tag, "required") {
+					*fields = append(*fields, FieldError{Field: name, Rule: "required", Message: name + " is required"})
+				}
+
+				continue
+			}
+
+			value = reflect.ValueOf(inner)
+		}
+
+		if tag != "" && tag != "-" {
+			if err := validateField(value, name, tag, fields); err != nil {
+				return err
+			}
+		}
+
+		if value.Kind() == reflect.Struct && value.Type().PkgPath() != "time" {
+			if err := validateStruct(value, name+".", fields); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateField(value reflect.Value, name, tag string, fields *[]FieldError) error {
+	rules := SplitRules(tag)
+
+	// the other rules are meaningless on an empty optional field
+	if isZero(value) {
+		if hasRule(tag, "required") {
+			*fields = append(*fields, FieldError{Field: name, Rule: "required", Message: name + " is required"})
+		}
+
+		return nil
+	}
+
+	for _, rule := range rules {
+		key, param, _ := strings.Cut(rule, "=")
+
+		var failed bool
+		var message string
+
+		switch key {
+		case "required":
+			continue
+
+		case "min", "max":
+			n, err := strconv.Atoi(param)
+			if err != nil {
+				return fmt.Errorf("field %s: rule %s needs an integer", name, key)
+			}
+
+			size, unit, ok := sizeOf(value)
+			if !ok {
+				return fmt.Errorf("field %s: rule %s is not supported on %s", name, key, value.Type())
+			}
+
+			if key == "min" {
+				failed, message = size < float64(n), fmt.Sprintf("%s must be at least %d%s", name, n, unit)
+			} else {
+				failed, message = size > float64(n), fmt.Sprintf("%s must be at most %d%s", name, n, unit)
+			}
+
+		case "email":
+			_, err := mail.ParseAddress(stringOf(value))
+			failed, message = err != nil, name+" must be a valid email"
+
+		case "uuid":
+			failed, message = !uuidRegex.MatchString(stringOf(value)), name+" must be a valid uuid"
+
+		case "oneof":
+			options := strings.Fields(param)
+			failed, message = !contains(options, stringOf(value)), fmt.Sprintf("%s must be one of %s", name, strings.Join(options, ", "))
+
+		case "regex":
+			re, err := compile(param)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", name, err)
+			}
+
+			failed, message = !re.MatchString(stringOf(value)), name+" has an invalid format"
+
+		default:
+			return fmt.Errorf("field %s: unknown validation rule %s", name, key)
+		}
+
+		if failed {
+			*fields = append(*fields, FieldError{Field: name, Rule: key, Message: message})
+		}
+	}
+
+	return nil
+}
+
+// SplitRules splits a validate tag on commas, except inside the regex rule which takes the rest of the tag.
+func SplitRules(tag string) []string {
+	var rules []string
+
+	for tag != "" {
+		if strings.HasPrefix(tag, "regex=") {
+			return append(rules, tag)
+		}
+
+		rule, rest, _ := strings.Cut(tag, ",")
+		rules = append(rules, strings.TrimSpace(rule))
+		tag = rest
+	}
+
+	return rules
+}
+
+func hasRule(tag, rule string) bool {
+	for _, r := range SplitRules(tag) {
+		if r == rule {
+			return true
+		}
+	}
+
+	return false
+}
+
+func fieldName(field reflect.StructField) string {
+	for _, key := range []string{"json", urlTagName, queryTagName} {
+		name, _, _ := strings.Cut(field.Tag.Get(key), ",")
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+
+	return field.Name
+}
+
+func isZero(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+	}
+
+	return value.IsZero()
+}
+
+func sizeOf(value reflect.Value) (float64, string, bool) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), " characters", true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(value.Len()), " items", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), "", true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), "", true
+	}
+
+	return 0, "", false
+}
+
+func stringOf(value reflect.Value) string {
+	if value.Kind() == reflect.String {
+		return value.String()
+	}
+
+	return fmt.Sprint(value.Interface())
+}
+
+func compile(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	regexCache.Store(pattern, re)
+	return re, nil
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,139 @@
+package request
+
+import (
+	"errors"
+	"testing"
+)
+
+type patchField struct {
+	set, null bool
+	value     string
+}
+
+func (p patchField) PatchValue() (any, bool, bool) {
+	return p.value, p.set, p.null
+}
+
+type address struct {
+	City string `json:"city" validate:"required"`
+}
+
+type validateInput struct {
+	Email   string     `json:"email" validate:"required,email"`
+	Name    string     `json:"name" validate:"min=3,max=5"`
+	ID      string     `url:"id" validate:"uuid"`
+	Sort    string     `query:"sort" validate:"oneof=asc desc"`
+	Code    string     `json:"code" validate:"regex=^[a-z]{2,3}$"`
+	Tags    []string   `json:"tags" validate:"max=2"`
+	Limit   int        `json:"limit" validate:"min=0,max=100"`
+	Bio     patchField `json:"bio" validate:"max=3"`
+	Address address    `json:"address"`
+}
+
+func validInput() validateInput {
+	return validateInput{
+		Email:   "user@mail.com",
+		ID:      "0b7d6c1e-4f3a-4d5e-9a1b-2c3d4e5f6a7b",
+		Address: address{City: "Jakarta"},
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(in *validateInput)
+		want   []FieldError
+	}{
+		{"Valid", func(in *validateInput) {}, nil},
+		{"Required", func(in *validateInput) { in.Email = "" }, []FieldError{
+			{Field: "email", Rule: "required", Message: "email is required"},
+		}},
+		{"Email", func(in *validateInput) { in.Email = "not an email" }, []FieldError{
+			{Field: "email", Rule: "email", Message: "email must be a valid email"},
+		}},
+		{"MinMaxString", func(in *validateInput) { in.Name = "ab" }, []FieldError{
+			{Field: "name", Rule: "min", Message: "name must be at least 3 characters"},
+		}},
+		{"MaxRunes", func(in *validateInput) { in.Name = "ééééé" }, nil},
+		{"UUID", func(in *validateInput) { in.ID = "123" }, []FieldError{
+			{Field: "id", Rule: "uuid", Message: "id must be a valid uuid"},
+		}},
+		{"OneOf", func(in *validateInput) { in.Sort = "up" }, []FieldError{
+			{Field: "sort", Rule: "oneof", Message: "sort must be one of asc, desc"},
+		}},
+		{"Regex", func(in *validateInput) { in.Code = "abcd" }, []FieldError{
+			{Field: "code", Rule: "regex", Message: "code has an invalid format"},
+		}},
+		{"RegexWithComma", func(in *validateInput) { in.Code = "abc" }, nil},
+		{"MaxSlice", func(in *validateInput) { in.Tags = []string{"a", "b", "c"} }, []FieldError{
+			{Field: "tags", Rule: "max", Message: "tags must be at most 2 items"},
+		}},
+		{"MaxInt", func(in *validateInput) { in.Limit = 101 }, []FieldError{
+			{Field: "limit", Rule: "max", Message: "limit must be at most 100"},
+		}},
+		{"PatchAbsent", func(in *validateInput) { in.Bio = patchField{} }, nil},
+		{"PatchPresent", func(in *validateInput) { in.Bio = patchField{set: true, value: "long"} }, []FieldError{
+			{Field: "bio", Rule: "max", Message: "bio must be at most 3 characters"},
+		}},
+		{"Nested", func(in *validateInput) { in.Address.City = "" }, []FieldError{
+			{Field: "address.city", Rule: "required", Message: "address.city is required"},
+		}},
+		{"Aggregated", func(in *validateInput) { in.Email = ""; in.Sort = "up" }, []FieldError{
+			{Field: "email", Rule: "required", Message: "email is required"},
+			{Field: "sort", Rule: "oneof", Message: "sort must be one of asc, desc"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := validInput()
+			tt.modify(&in)
+
+			err := Validate(&in)
+
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("expected ValidationError, got %v", err)
+			}
+
+			if len(validationErr.Fields) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, validationErr.Fields)
+			}
+
+			for i := range tt.want {
+				if validationErr.Fields[i] != tt.want[i] {
+					t.Fatalf("expected %v, got %v", tt.want[i], validationErr.Fields[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_ValidationErrorMessage(t *testing.T) {
+	err := &ValidationError{Fields: []FieldError{{Message: "a is required"}, {Message: "b is required"}}}
+
+	if err.Error() != "a is required (and 1 more errors)" {
+		t.Fatalf("unexpected message %q", err.Error())
+	}
+}
+
+func Test_ValidateUnknownRule(t *testing.T) {
+	in := struct {
+		Name string `json:"name" validate:"shiny"`
+	}{Name: "x"}
+
+	err := Validate(&in)
+
+	var validationErr *ValidationError
+	if err == nil || errors.As(err, &validationErr) {
+		t.Fatalf("expected a plain error, got %v", err)
+	}
+}
@@ -0,0 +1,24 @@
+package response
+
+import (
+	"net/http"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// ProblemDetails is an RFC 7807 error body.
+type ProblemDetails struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Errors   any    `json:"errors,omitempty"`
+}
+
+func Problem(w http.ResponseWriter, problem ProblemDetails) error {
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+
+	return encode(w, problem)
+}
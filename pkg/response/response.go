@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+
+	"github.com/samuelsih/guwu/pkg/codec"
 )
 
 func JSON(w http.ResponseWriter, status int, data any) error {
@@ -19,24 +21,51 @@ func JSONWithHeaders(w http.ResponseWriter, status int, data any, headers http.H
 		w.Header()[key] = value
 	}
 
-	var valueErr *json.UnsupportedValueError
-	var typeErr *json.UnsupportedTypeError
+	return encode(w, data)
+}
 
-	enc := json.NewEncoder(w)
+// Encode writes data in the encoding negotiated with the client.
+func Encode(w http.ResponseWriter, status int, c codec.Codec, data any) error {
+	if !c.Binary() {
+		w.Header().Add("Vary", "Accept")
+		return JSON(w, status, data)
+	}
 
-	err := enc.Encode(data)
+	body, err := c.Marshal(data)
 	if err != nil {
-		switch {
-		case errors.As(err, &valueErr):
-			return fmt.Errorf("unsupported value for this response %w", err)
+		return classify(err)
+	}
+
+	w.Header().Set("Content-Type", c.MediaType)
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+
+	_, err = w.Write(body)
+	return err
+}
 
-		case errors.As(err, &typeErr):
-			return fmt.Errorf("unsupported type for this response %w", err)
+func encode(w http.ResponseWriter, data any) error {
+	enc := json.NewEncoder(w)
 
-		default:
-			return fmt.Errorf("can't encode the response: %w", err)
-		}
+	if err := enc.Encode(data); err != nil {
+		return classify(err)
 	}
 
 	return nil
 }
+
+func classify(err error) error {
+	var valueErr *json.UnsupportedValueError
+	var typeErr *json.UnsupportedTypeError
+
+	switch {
+	case errors.As(err, &valueErr):
+		return fmt.Errorf("unsupported value for this response %w", err)
+
+	case errors.As(err, &typeErr):
+		return fmt.Errorf("unsupported type for this response %w", err)
+
+	default:
+		return fmt.Errorf("can't encode the response: %w", err)
+	}
+}
@@ -68,3 +68,25 @@ func Test_JSONWithHeaders_MustFail(t *testing.T) {
 		t.Fatalf("expect %v, got %v", nil, err)
 	}
 }
+
+func Test_Problem(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	err := Problem(w, ProblemDetails{Type: "/problems/not-found", Title: "Not Found", Status: 404})
+	if err != nil {
+		t.Fatalf("expect %v, got %v", nil, err)
+	}
+
+	if w.Code != 404 || w.Header().Get("Content-Type") != ProblemContentType {
+		t.Fatalf("expect 404 %s, got %d %s", ProblemContentType, w.Code, w.Header().Get("Content-Type"))
+	}
+
+	var got map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := got["errors"]; ok || got["title"] != "Not Found" {
+		t.Fatalf("unexpected body %v", got)
+	}
+}
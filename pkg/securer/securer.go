@@ -2,7 +2,9 @@ package securer
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"sync"
 
@@ -56,3 +58,23 @@ func Decrypt(input string) ([]byte, error) {
 
 	return nil, errs.E(op, errs.KindBadRequest, err, "invalid data")
 }
+
+// RandomToken returns prefix followed by n random bytes encoded as url safe base64.
+func RandomToken(prefix string, n int) (string, error) {
+	const op = errs.Op("securer.RandomToken")
+
+	b := make([]byte, n)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", errs.E(op, errs.KindUnexpected, err, "internal error")
+	}
+
+	return prefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Digest returns the hex encoded sha256 of input, used to store tokens without keeping them readable.
+func Digest(input string) string {
+	sum := sha256.Sum256([]byte(input))
+	return hex.EncodeToString(sum[:])
+}
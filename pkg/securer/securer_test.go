@@ -7,6 +7,7 @@ import (
 	"log"
 	"math/big"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -57,6 +58,28 @@ func TestEncodeDecodeFails(t *testing.T) {
 	}
 }
 
+func TestRandomToken(t *testing.T) {
+	t.Parallel()
+
+	a, err := RandomToken("pfx_", 32)
+	if err != nil {
+		t.Fatalf("Err should nil, got %v", err)
+	}
+
+	b, err := RandomToken("pfx_", 32)
+	if err != nil {
+		t.Fatalf("Err should nil, got %v", err)
+	}
+
+	if a == b || !strings.HasPrefix(a, "pfx_") || len(a) != len("pfx_")+43 {
+		t.Fatalf("unexpected tokens %v %v", a, b)
+	}
+
+	if Digest(a) == Digest(b) || Digest(a) != Digest(a) || len(Digest(a)) != 64 {
+		t.Fatalf("unexpected digest %v %v", Digest(a), Digest(b))
+	}
+}
+
 func generateKey() {
 	b, _ := hex.DecodeString("9732070617373776f726420746f206120736563726574")
 
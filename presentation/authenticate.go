@@ -0,0 +1,46 @@
+package presentation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	b "github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/pkg/errs"
+)
+
+// Authenticator resolves the identity behind the credentials of a request,
+// its errors carry the response status as errs kind.
+type Authenticator func(ctx context.Context, in b.CommonInput) (b.Identity, error)
+
+var (
+	authenticate Authenticator
+
+	errNoAuthenticator = errors.New("no authenticator configured")
+)
+
+// SetAuthenticator sets how the routes with Opts.RequireUser resolve their user.
+func SetAuthenticator(fn Authenticator) {
+	authenticate = fn
+}
+
+// authenticateUser sets the identity of commonInput, renewing the session cookie when its expiry was extended.
+func authenticateUser(w http.ResponseWriter, r *http.Request, commonInput *b.CommonInput) error {
+	const op = errs.Op("presentation.authenticateUser")
+
+	if authenticate == nil {
+		return errs.E(op, errs.KindUnexpected, errNoAuthenticator, errNoAuthenticator.Error())
+	}
+
+	identity, err := authenticate(r.Context(), *commonInput)
+	if err != nil {
+		return err
+	}
+
+	if identity.SessionMaxAge > 0 {
+		setSessionCookie(w, "sid", commonInput.SessionID, identity.SessionMaxAge)
+	}
+
+	commonInput.Identity = &identity
+	return nil
+}
@@ -0,0 +1,93 @@
+package presentation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	b "github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/model"
+	"github.com/samuelsih/guwu/pkg/errs"
+	"github.com/samuelsih/guwu/pkg/response"
+)
+
+type whoamiOutput struct {
+	b.CommonResponse
+	Username string `json:"username"`
+}
+
+func TestRequireUser(t *testing.T) {
+	SetAuthenticator(func(ctx context.Context, in b.CommonInput) (b.Identity, error) {
+		switch in.SessionID {
+		case "fresh":
+			return b.Identity{User: model.User{Username: "fresh"}, SessionID: "1"}, nil
+		case "old":
+			return b.Identity{User: model.User{Username: "old"}, SessionID: "2", SessionMaxAge: 60}, nil
+		}
+
+		return b.Identity{}, errs.E("test.authenticate", errs.KindUnauthorized, errors.New("unknown session"), "invalid or expired credentials")
+	})
+	defer SetAuthenticator(nil)
+
+	handler := Get(func(ctx context.Context, common b.CommonInput) whoamiOutput {
+		var out whoamiOutput
+		user, _ := common.User()
+		out.Username = user.Username
+		out.SetOK()
+		return out
+	}, RequireUserOpts)
+
+	tests := []struct {
+		name       string
+		cookie     string
+		status     int
+		username   string
+		wantCookie bool
+	}{
+		{"MissingCredentials", "", 401, "", false},
+		{"UnknownSession", "unknown", 401, "", false},
+		{"Authenticated", "fresh", 200, "fresh", false},
+		{"SlidingSession", "old", 200, "old", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "sid", Value: tt.cookie})
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+
+			if tt.status != 200 {
+				if w.Header().Get("Content-Type") != response.ProblemContentType {
+					t.Fatalf("expected problem details, got %s", w.Header().Get("Content-Type"))
+				}
+
+				return
+			}
+
+			var got whoamiOutput
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Username != tt.username {
+				t.Fatalf("expected %s, got %s", tt.username, got.Username)
+			}
+
+			cookies := w.Result().Cookies()
+			if renewed := len(cookies) == 1 && cookies[0].Value == tt.cookie && cookies[0].MaxAge == 60; renewed != tt.wantCookie {
+				t.Fatalf("expected renewed cookie %v, got %v", tt.wantCookie, cookies)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package presentation
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	b "github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/pkg/codec"
+	"github.com/samuelsih/guwu/pkg/securer"
+)
+
+// writeCacheable is writeOutput for reads, successful outputs get validators
+// and conditional requests matching them get 304 without a body.
+func writeCacheable(w http.ResponseWriter, r *http.Request, out b.CommonOutput, opts Opts, op string) {
+	res := out.CommonRes()
+
+	if res.StatusCode != http.StatusOK {
+		writeOutput(w, r, out, opts, op)
+		return
+	}
+
+	c, _ := codec.Negotiate(r.Header.Get("Accept"))
+
+	body, err := c.Marshal(out)
+	if err != nil {
+		log.Printf("%s: %v", op, err)
+		writeOutput(w, r, out, opts, op)
+		return
+	}
+
+	// the media type is part of the tag, each encoding is its own representation
+	version := res.Version
+	if version == "" {
+		version = string(body)
+	}
+
+	etag := `"` + securer.Digest(c.MediaType + "\n" + version)[:32] + `"`
+
+	header := w.Header()
+	header.Set("ETag", etag)
+	header.Add("Vary", "Accept")
+
+	if opts.RequireUser || opts.GetSessionCookie {
+		header.Add("Vary", "Authorization, Cookie")
+	}
+
+	if opts.CacheControl != "" {
+		header.Set("Cache-Control", opts.CacheControl)
+	}
+
+	if !res.LastModified.IsZero() {
+		header.Set("Last-Modified", res.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, res.LastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	header.Set("Content-Type", c.MediaType)
+	w.WriteHeader(res.StatusCode)
+
+	if _, err := w.Write(body); err != nil {
+		log.Printf("%s: %v", op, err)
+	}
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since when there is none, as RFC 9110 orders them.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || lastModified.IsZero() {
+		return false
+	}
+
+	return !lastModified.Truncate(time.Second).After(since)
+}
@@ -0,0 +1,86 @@
+package presentation
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	b "github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/pkg/codec"
+)
+
+type articleOutput struct {
+	b.CommonResponse
+	Title string `json:"title"`
+}
+
+func TestConditionalGet(t *testing.T) {
+	updatedAt := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	title := "first"
+	version := ""
+
+	r := chi.NewRouter()
+	NewAPI(r).Get("/article", Get(func(ctx context.Context, common b.CommonInput) articleOutput {
+		var out articleOutput
+		out.Title = title
+		out.SetVersion(version)
+		out.SetLastModified(updatedAt)
+		out.SetOK()
+		return out
+	}, Opts{CacheControl: "public, no-cache"}))
+
+	get := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/article", nil)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := get(nil)
+	etag := first.Header().Get("ETag")
+
+	if first.Code != 200 || etag == "" || first.Header().Get("Cache-Control") != "public, no-cache" {
+		t.Fatalf("expected validators, got %d %v", first.Code, first.Header())
+	}
+
+	if first.Header().Get("Last-Modified") != "Fri, 01 May 2026 10:00:00 GMT" {
+		t.Fatalf("expected Last-Modified from updated_at, got %q", first.Header().Get("Last-Modified"))
+	}
+
+	if w := get(map[string]string{"If-None-Match": `"other", ` + etag}); w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("ETag") != etag {
+		t.Fatalf("expected 304 for a matching tag, got %d %q", w.Code, w.Body.String())
+	}
+
+	if w := get(map[string]string{"If-None-Match": etag, "Accept": codec.MSGPACK_MEDIA_TYPE}); w.Code != 200 || w.Header().Get("ETag") == etag {
+		t.Fatalf("expected another tag for another encoding, got %d %s", w.Code, w.Header().Get("ETag"))
+	}
+
+	if w := get(map[string]string{"If-Modified-Since": "Fri, 01 May 2026 10:00:00 GMT"}); w.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 when not modified since, got %d", w.Code)
+	}
+
+	if w := get(map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": "Fri, 01 May 2026 10:00:00 GMT"}); w.Code != 200 {
+		t.Fatalf("expected If-None-Match to take precedence, got %d", w.Code)
+	}
+
+	title = "second"
+
+	if w := get(map[string]string{"If-None-Match": etag}); w.Code != 200 || w.Header().Get("ETag") == etag {
+		t.Fatalf("expected a new tag once the body changed, got %d %s", w.Code, w.Header().Get("ETag"))
+	}
+
+	version = "7"
+	versioned := get(nil).Header().Get("ETag")
+	title = "third"
+
+	if w := get(map[string]string{"If-None-Match": versioned}); w.Code != http.StatusNotModified {
+		t.Fatalf("expected the handler version to drive the tag, got %d", w.Code)
+	}
+}
@@ -0,0 +1,87 @@
+package presentation
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/go-chi/chi/v5"
+	b "github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/pkg/codec"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type greetOutput struct {
+	b.CommonResponse
+	Greeting string `json:"greeting"`
+}
+
+func TestContentNegotiation(t *testing.T) {
+	calls := 0
+
+	r := chi.NewRouter()
+	NewAPI(r).Post("/greet", Post(func(ctx context.Context, in signupInput, common b.CommonInput) greetOutput {
+		var out greetOutput
+		calls++
+		out.Greeting = "hi " + in.Email
+		out.SetOK()
+		return out
+	}, OnlyDecodeOpts))
+
+	msgpackBody, _ := msgpack.Marshal(map[string]string{"email": "bob@mail.com"})
+	cborBody, _ := cbor.Marshal(map[string]string{"email": "bob@mail.com"})
+
+	tests := []struct {
+		name        string
+		contentType string
+		accept      string
+		body        []byte
+		status      int
+		wantType    string
+	}{
+		{"JSON", "application/json", "", []byte(`{"email": "bob@mail.com"}`), 200, codec.JSON_MEDIA_TYPE},
+		{"MessagePack", codec.MSGPACK_MEDIA_TYPE, codec.MSGPACK_MEDIA_TYPE, msgpackBody, 200, codec.MSGPACK_MEDIA_TYPE},
+		{"CBOR", codec.CBOR_MEDIA_TYPE, codec.CBOR_MEDIA_TYPE, cborBody, 200, codec.CBOR_MEDIA_TYPE},
+		{"Mixed", codec.CBOR_MEDIA_TYPE, "application/json", cborBody, 200, codec.JSON_MEDIA_TYPE},
+		{"MalformedMessagePack", codec.MSGPACK_MEDIA_TYPE, "", []byte{0xc1}, 400, "application/problem+json"},
+		{"NotAcceptable", "application/json", "text/html", []byte(`{"email": "bob@mail.com"}`), 406, "application/problem+json"},
+		{"UnsupportedMediaType", "application/xml", "", []byte(`<email>bob@mail.com</email>`), 415, "application/problem+json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = 0
+
+			req := httptest.NewRequest(http.MethodPost, "/greet", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status || w.Header().Get("Content-Type") != tt.wantType {
+				t.Fatalf("expected %d %s, got %d %s: %s", tt.status, tt.wantType, w.Code, w.Header().Get("Content-Type"), w.Body.String())
+			}
+
+			if tt.status >= 400 {
+				if calls != 0 {
+					t.Fatalf("expected the handler skipped, got %d calls", calls)
+				}
+
+				return
+			}
+
+			c, _ := codec.ForContentType(tt.wantType)
+
+			body, err := c.ToJSON(w.Body.Bytes())
+			if err != nil || !bytes.Contains(body, []byte(`"greeting":"hi bob@mail.com"`)) {
+				t.Fatalf("expected the greeting, got %s %v", body, err)
+			}
+		})
+	}
+}
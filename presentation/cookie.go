@@ -3,6 +3,9 @@ package presentation
 import (
 	"fmt"
 	"net/http"
+	"strings"
+
+	b "github.com/samuelsih/guwu/business"
 )
 
 func getSessionCookie(r *http.Request) (string, error) {
@@ -14,6 +17,27 @@ func getSessionCookie(r *http.Request) (string, error) {
 	return cookie.Value, nil
 }
 
+func getBearerToken(r *http.Request) (string, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", fmt.Errorf("unknown session")
+	}
+
+	return strings.TrimSpace(token), nil
+}
+
+// getCredential fills the session id from the cookie, or the access token from the Authorization header.
+func getCredential(r *http.Request, commonInput *b.CommonInput) error {
+	token, err := getBearerToken(r)
+	if err == nil {
+		commonInput.AccessToken = token
+		return nil
+	}
+
+	commonInput.SessionID, err = getSessionCookie(r)
+	return err
+}
+
 func setSessionCookie(w http.ResponseWriter, cookieName, cookieValue string, maxAge int) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     cookieName,
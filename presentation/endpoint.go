@@ -0,0 +1,90 @@
+package presentation
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/samuelsih/guwu/pkg/codec"
+)
+
+var (
+	bodyMediaTypes  = []string{codec.JSON_MEDIA_TYPE, codec.MSGPACK_MEDIA_TYPE, codec.CBOR_MEDIA_TYPE, "application/x-www-form-urlencoded"}
+	patchMediaTypes = []string{"application/merge-patch+json", "application/json"}
+)
+
+// Endpoint is a handler along with the types it reads and writes, as described in the API document.
+type Endpoint struct {
+	http.HandlerFunc
+
+	Input  reflect.Type
+	Output reflect.Type
+	Opts   Opts
+
+	// MediaTypes are the accepted request bodies, none when the body is not decoded.
+	MediaTypes []string
+
+	// EventStream responds with Server-Sent Events of Output, see Stream.
+	EventStream bool
+}
+
+func newEndpoint[inType any, outType any](opts Opts, mediaTypes []string, handler http.HandlerFunc) Endpoint {
+	endpoint := Endpoint{
+		HandlerFunc: handler,
+		Input:       reflect.TypeOf((*inType)(nil)).Elem(),
+		Output:      reflect.TypeOf((*outType)(nil)).Elem(),
+		Opts:        opts,
+	}
+
+	if opts.DecodeRequestBody {
+		endpoint.MediaTypes = mediaTypes
+	}
+
+	return endpoint
+}
+
+type Route struct {
+	Method   string
+	Path     string
+	Endpoint Endpoint
+}
+
+// API mounts endpoints on a router and records them for the API document.
+type API struct {
+	router chi.Router
+	routes []Route
+}
+
+func NewAPI(router chi.Router) *API {
+	return &API{router: router}
+}
+
+func (a *API) Get(path string, endpoint Endpoint) {
+	a.handle(http.MethodGet, path, endpoint)
+}
+
+func (a *API) Post(path string, endpoint Endpoint) {
+	a.handle(http.MethodPost, path, endpoint)
+}
+
+func (a *API) Put(path string, endpoint Endpoint) {
+	a.handle(http.MethodPut, path, endpoint)
+}
+
+func (a *API) Patch(path string, endpoint Endpoint) {
+	a.handle(http.MethodPatch, path, endpoint)
+}
+
+func (a *API) Delete(path string, endpoint Endpoint) {
+	a.handle(http.MethodDelete, path, endpoint)
+}
+
+// Routes returns the endpoints in the order they were mounted.
+func (a *API) Routes() []Route {
+	return a.routes
+}
+
+func (a *API) handle(method, path string, endpoint Endpoint) {
+	a.router.Method(method, path, endpoint.HandlerFunc)
+	a.routes = append(a.routes, Route{Method: method, Path: path, Endpoint: endpoint})
+}
@@ -0,0 +1,213 @@
+package presentation
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	b "github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/pkg/securer"
+)
+
+const (
+	IDEMPOTENCY_HEADER   = "Idempotency-Key"
+	IDEMPOTENCY_REPLAYED = "Idempotent-Replayed"
+
+	// IDEMPOTENCY_TTL is how long a response is replayed, IDEMPOTENCY_LOCK_TTL bounds a request
+	// in flight so a crashed one does not hold its key for the whole day.
+	IDEMPOTENCY_TTL      int64 = 60 * 60 * 24
+	IDEMPOTENCY_LOCK_TTL int64 = 60
+
+	idempotencyKeyMaxLen = 255
+	idempotencyBodyLimit = 1_048_576
+)
+
+var (
+	errIdempotencyKeyTooLong = errors.New("Idempotency-Key must be at most 255 characters")
+	errIdempotencyInFlight   = errors.New("a request with this Idempotency-Key is still in progress")
+	errIdempotencyMismatch   = errors.New("Idempotency-Key was already used with another request")
+	errIdempotencyAnonymous  = errors.New("Idempotency-Key requires an authenticated request")
+)
+
+// IdempotencyStore keeps the responses of POST requests sent with an Idempotency-Key.
+type IdempotencyStore struct {
+	SetIfAbsent func(ctx context.Context, key string, value any, time int64) (bool, error)
+	Set         func(ctx context.Context, key string, value any, time int64) error
+	Get         func(ctx context.Context, key string, dst any) error
+	Destroy     func(ctx context.Context, key string) error
+}
+
+var idempotencyStore *IdempotencyStore
+
+// idempotencyHeaders are the headers kept with a response, cookies belong to the first caller only.
+var idempotencyHeaders = []string{"Content-Type"}
+
+// SetIdempotencyStore enables the Idempotency-Key header on Post routes.
+func SetIdempotencyStore(store IdempotencyStore) {
+	idempotencyStore = &store
+}
+
+type idempotencyRecord struct {
+	Fingerprint string      `json:"fingerprint"`
+	Done        bool        `json:"done"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// idempotent claims the Idempotency-Key of r for the caller of commonInput.
+// When the key was seen before it responds itself, replaying the stored response, and returns false.
+// Otherwise the returned writer records the response, to be kept with the returned finish.
+func idempotent(w http.ResponseWriter, r *http.Request, commonInput b.CommonInput, op string) (http.ResponseWriter, func(), bool) {
+	key := r.Header.Get(IDEMPOTENCY_HEADER)
+	if idempotencyStore == nil || key == "" {
+		return w, func() {}, true
+	}
+
+	if len(key) > idempotencyKeyMaxLen {
+		writeError(w, r, http.StatusBadRequest, errIdempotencyKeyTooLong, op)
+		return w, nil, false
+	}
+
+	scope, ok := idempotencyScope(commonInput)
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, errIdempotencyAnonymous, op)
+		return w, nil, false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, idempotencyBodyLimit+1))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err, op)
+		return w, nil, false
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	ctx := r.Context()
+	storeKey := "idempotency_" + securer.Digest(scope+":"+key)
+	fingerprint := securer.Digest(r.Method + " " + r.URL.RequestURI() + "\n" + string(body))
+
+	claimed, err := idempotencyStore.SetIfAbsent(ctx, storeKey, idempotencyRecord{Fingerprint: fingerprint}, IDEMPOTENCY_LOCK_TTL)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err, op)
+		return w, nil, false
+	}
+
+	if !claimed {
+		replayIdempotent(w, r, storeKey, fingerprint, op)
+		return w, nil, false
+	}
+
+	recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+
+	// finish is deferred, it sees the panics of the handler before they unwind further
+	finish := func() {
+		panicked := recover()
+
+		// server errors and handlers that failed to respond are not kept so the client can retry them
+		if panicked != nil || !recorder.wrote || recorder.status >= 500 {
+			if err := idempotencyStore.Destroy(context.Background(), storeKey); err != nil {
+				log.Printf("%s: %v", op, err)
+			}
+
+			if panicked != nil {
+				panic(panicked)
+			}
+
+			return
+		}
+
+		record := idempotencyRecord{
+			Fingerprint: fingerprint,
+			Done:        true,
+			Status:      recorder.status,
+			Header:      http.Header{},
+			Body:        recorder.body.Bytes(),
+		}
+
+		for _, name := range idempotencyHeaders {
+			if values := w.Header().Values(name); len(values) > 0 {
+				record.Header[name] = values
+			}
+		}
+
+		if err := idempotencyStore.Set(context.Background(), storeKey, record, IDEMPOTENCY_TTL); err != nil {
+			log.Printf("%s: %v", op, err)
+		}
+	}
+
+	return recorder, finish, true
+}
+
+func replayIdempotent(w http.ResponseWriter, r *http.Request, storeKey, fingerprint, op string) {
+	var record idempotencyRecord
+
+	// the key may expire between the claim and this read, the client retries either way
+	if err := idempotencyStore.Get(r.Context(), storeKey, &record); err != nil {
+		writeError(w, r, http.StatusConflict, errIdempotencyInFlight, op)
+		return
+	}
+
+	if record.Fingerprint != fingerprint {
+		writeError(w, r, http.StatusUnprocessableEntity, errIdempotencyMismatch, op)
+		return
+	}
+
+	if !record.Done {
+		writeError(w, r, http.StatusConflict, errIdempotencyInFlight, op)
+		return
+	}
+
+	for _, name := range idempotencyHeaders {
+		for _, value := range record.Header.Values(name) {
+			w.Header().Add(name, value)
+		}
+	}
+
+	w.Header().Set(IDEMPOTENCY_REPLAYED, "true")
+	w.WriteHeader(record.Status)
+
+	if _, err := w.Write(record.Body); err != nil {
+		log.Printf("%s: %v", op, err)
+	}
+}
+
+// idempotencyScope keeps the keys of each user apart. Anonymous callers have no scope,
+// unrelated clients would otherwise collide on the same simple keys.
+func idempotencyScope(commonInput b.CommonInput) (string, bool) {
+	if user, ok := commonInput.User(); ok {
+		return "user:" + user.ID, true
+	}
+
+	if commonInput.AccessToken != "" {
+		return "token:" + commonInput.AccessToken, true
+	}
+
+	if commonInput.SessionID != "" {
+		return "session:" + commonInput.SessionID, true
+	}
+
+	return "", false
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	wrote  bool
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.wrote = true
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(p []byte) (int, error) {
+	rec.wrote = true
+	rec.body.Write(p)
+	return rec.ResponseWriter.Write(p)
+}
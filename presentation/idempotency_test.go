@@ -0,0 +1,267 @@
+package presentation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	b "github.com/samuelsih/guwu/business"
+)
+
+type memoryIdempotency struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (m *memoryIdempotency) store() IdempotencyStore {
+	set := func(ctx context.Context, key string, value any, time int64) error {
+		data, err := json.Marshal(value)
+		m.data[key] = data
+		return err
+	}
+
+	return IdempotencyStore{
+		SetIfAbsent: func(ctx context.Context, key string, value any, time int64) (bool, error) {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			if _, ok := m.data[key]; ok {
+				return false, nil
+			}
+
+			return true, set(ctx, key, value, time)
+		},
+		Set: func(ctx context.Context, key string, value any, time int64) error {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			return set(ctx, key, value, time)
+		},
+		Get: func(ctx context.Context, key string, dst any) error {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			data, ok := m.data[key]
+			if !ok {
+				return errors.New("unknown key")
+			}
+
+			return json.Unmarshal(data, dst)
+		},
+		Destroy: func(ctx context.Context, key string) error {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			delete(m.data, key)
+			return nil
+		},
+	}
+}
+
+type countOutput struct {
+	b.CommonResponse
+	Calls int `json:"calls"`
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	memory := &memoryIdempotency{data: map[string][]byte{}}
+	SetIdempotencyStore(memory.store())
+	defer func() { idempotencyStore = nil }()
+
+	calls := 0
+	failing := true
+
+	r := chi.NewRouter()
+	api := NewAPI(r)
+	api.Post("/signup", Post(func(ctx context.Context, in signupInput, common b.CommonInput) countOutput {
+		var out countOutput
+		calls++
+		out.Calls = calls
+		out.SetOK()
+		return out
+	}, GetSessionWithDecodeOpts))
+	api.Post("/unstable", Post(func(ctx context.Context, in signupInput, common b.CommonInput) countOutput {
+		var out countOutput
+		if failing {
+			out.StatusCode = http.StatusServiceUnavailable
+			out.Msg = "try again"
+			return out
+		}
+
+		out.SetOK()
+		return out
+	}, GetSessionWithDecodeOpts))
+
+	api.Post("/subscribe", Post(func(ctx context.Context, in signupInput, common b.CommonInput) countOutput {
+		var out countOutput
+		calls++
+		out.SetOK()
+		return out
+	}, OnlyDecodeOpts))
+
+	send := func(path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set(IDEMPOTENCY_HEADER, key)
+		req.AddCookie(&http.Cookie{Name: "sid", Value: "bob-session"})
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := send("/signup", "k1", `{"email": "bob@mail.com"}`)
+	replay := send("/signup", "k1", `{"email": "bob@mail.com"}`)
+
+	if first.Code != 200 || replay.Code != 200 || calls != 1 {
+		t.Fatalf("expected a single call, got %d %d after %d calls", first.Code, replay.Code, calls)
+	}
+
+	if replay.Body.String() != first.Body.String() || replay.Header().Get(IDEMPOTENCY_REPLAYED) != "true" {
+		t.Fatalf("expected the first response replayed, got %s %v", replay.Body.String(), replay.Header())
+	}
+
+	if w := send("/signup", "k1", `{"email": "alice@mail.com"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for another body, got %d", w.Code)
+	}
+
+	if w := send("/signup", "k2", `{"email": "bob@mail.com"}`); w.Code != 200 || calls != 2 {
+		t.Fatalf("expected another key to run, got %d after %d calls", w.Code, calls)
+	}
+
+	if w := send("/unstable", "k3", `{"email": "bob@mail.com"}`); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+
+	failing = false
+
+	if w := send("/unstable", "k3", `{"email": "bob@mail.com"}`); w.Code != 200 || w.Header().Get(IDEMPOTENCY_REPLAYED) != "" {
+		t.Fatalf("expected a server error not kept, got %d %v", w.Code, w.Header())
+	}
+
+	if w := send("/signup", strings.Repeat("k", 256), `{"email": "bob@mail.com"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a long key, got %d", w.Code)
+	}
+
+	anonymous := httptest.NewRequest(http.MethodPost, "/subscribe", strings.NewReader(`{"email": "bob@mail.com"}`))
+	anonymous.Header.Set(IDEMPOTENCY_HEADER, "k4")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, anonymous)
+
+	if w.Code != http.StatusBadRequest || calls != 2 {
+		t.Fatalf("expected 400 for an anonymous key, got %d after %d calls", w.Code, calls)
+	}
+}
+
+func TestIdempotencyKeyInFlight(t *testing.T) {
+	memory := &memoryIdempotency{data: map[string][]byte{}}
+	SetIdempotencyStore(memory.store())
+	defer func() { idempotencyStore = nil }()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	r := chi.NewRouter()
+	NewAPI(r).Post("/signup", Post(func(ctx context.Context, in signupInput, common b.CommonInput) countOutput {
+		var out countOutput
+		close(started)
+		<-release
+		out.SetOK()
+		return out
+	}, GetSessionWithDecodeOpts))
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(`{"email": "bob@mail.com"}`))
+		req.Header.Set(IDEMPOTENCY_HEADER, "k1")
+		req.AddCookie(&http.Cookie{Name: "sid", Value: "bob-session"})
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- send() }()
+
+	<-started
+
+	if w := send(); w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 while in flight, got %d", w.Code)
+	}
+
+	close(release)
+
+	if w := <-done; w.Code != 200 {
+		t.Fatalf("expected the first request to succeed, got %d", w.Code)
+	}
+}
+
+func TestIdempotencyKeyNotKept(t *testing.T) {
+	memory := &memoryIdempotency{data: map[string][]byte{}}
+	SetIdempotencyStore(memory.store())
+	defer func() { idempotencyStore = nil }()
+
+	panicking := true
+
+	r := chi.NewRouter()
+	api := NewAPI(r)
+	api.Post("/login", Post(func(ctx context.Context, in signupInput, common b.CommonInput) countOutput {
+		var out countOutput
+		out.SessionID = "encrypted"
+		out.SessionMaxAge = 60
+		out.SetOK()
+		return out
+	}, SetSessionWithDecodeOpts))
+	api.Post("/panicking", Post(func(ctx context.Context, in signupInput, common b.CommonInput) countOutput {
+		var out countOutput
+		if panicking {
+			panic("boom")
+		}
+
+		out.SetOK()
+		return out
+	}, GetSessionWithDecodeOpts))
+
+	send := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"email": "bob@mail.com"}`))
+		req.Header.Set(IDEMPOTENCY_HEADER, "key"+path)
+		req.AddCookie(&http.Cookie{Name: "sid", Value: "bob-session"})
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("cookies", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			w := send("/login")
+			if w.Header().Get(IDEMPOTENCY_REPLAYED) != "" || w.Header().Get("Set-Cookie") == "" {
+				t.Fatalf("expected every login to set the cookie, got %v", w.Header())
+			}
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected the panic to go through")
+				}
+			}()
+
+			send("/panicking")
+		}()
+
+		panicking = false
+
+		if w := send("/panicking"); w.Code != 200 || w.Header().Get(IDEMPOTENCY_REPLAYED) != "" {
+			t.Fatalf("expected the key released after a panic, got %d %v", w.Code, w.Header())
+		}
+	})
+}
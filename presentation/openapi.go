@@ -0,0 +1,244 @@
+package presentation
+
+import (
+	"log"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/samuelsih/guwu/pkg/codec"
+	"github.com/samuelsih/guwu/pkg/openapi"
+	"github.com/samuelsih/guwu/pkg/request"
+	"github.com/samuelsih/guwu/pkg/response"
+)
+
+var pathParamRegex = regexp.MustCompile(`\{([^}:]+)[^}]*\}`)
+
+var securitySchemes = map[string]openapi.SecurityScheme{
+	"session": {Type: "apiKey", In: "cookie", Name: "sid"},
+	"bearer":  {Type: "http", Scheme: "bearer"},
+}
+
+// Document describes every mounted endpoint.
+func (a *API) Document(info openapi.Info) openapi.Document {
+	gen := openapi.NewGenerator()
+	problem := problemSchema(gen)
+
+	doc := openapi.Document{
+		OpenAPI: openapi.Version,
+		Info:    info,
+		Paths:   map[string]openapi.PathItem{},
+	}
+
+	for _, route := range a.routes {
+		item, ok := doc.Paths[route.Path]
+		if !ok {
+			item = openapi.PathItem{}
+			doc.Paths[route.Path] = item
+		}
+
+		item[strings.ToLower(route.Method)] = operation(gen, route, problem)
+	}
+
+	doc.Components = openapi.Components{
+		Schemas:         gen.Schemas(),
+		SecuritySchemes: securitySchemes,
+	}
+
+	return doc
+}
+
+// ServeDocument responds with the document of the endpoints mounted so far.
+func (a *API) ServeDocument(info openapi.Info) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := response.JSON(w, http.StatusOK, a.Document(info)); err != nil {
+			log.Printf("presentation.ServeDocument: %v", err)
+		}
+	}
+}
+
+func operation(gen *openapi.Generator, route Route, problem *openapi.Schema) *openapi.Operation {
+	endpoint := route.Endpoint
+	output := gen.Schema(endpoint.Output)
+
+	op := &openapi.Operation{
+		OperationID: operationID(route.Method, route.Path),
+		Tags:        []string{packageName(endpoint.Output)},
+		Parameters:  parameters(gen, route.Path, endpoint.Input),
+		Responses: map[string]openapi.Response{
+			"200":     encodedResponse("OK", output),
+			"406":     jsonResponse("Not Acceptable", response.ProblemContentType, problem),
+			"default": jsonResponse("Error", response.ProblemContentType, problem),
+		},
+	}
+
+	if len(endpoint.MediaTypes) > 0 {
+		op.RequestBody = &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{}}
+
+		body := gen.Schema(endpoint.Input)
+		for _, mediaType := range endpoint.MediaTypes {
+			op.RequestBody.Content[mediaType] = openapi.MediaType{Schema: body}
+		}
+
+		op.Responses["415"] = jsonResponse("Unsupported Media Type", response.ProblemContentType, problem)
+	}
+
+	if endpoint.Opts.RawErrorBody {
+		op.Responses["default"] = jsonResponse("Error", "application/json", output)
+	}
+
+	if endpoint.Opts.RequireUser || endpoint.Opts.GetSessionCookie {
+		op.Security = []map[string][]string{{"session": {}}, {"bearer": {}}}
+		op.Responses["401"] = jsonResponse("Unauthenticated", response.ProblemContentType, problem)
+	}
+
+	if endpoint.EventStream {
+		op.Parameters = append(op.Parameters, openapi.Parameter{Name: LAST_EVENT_ID_HEADER, In: "header", Schema: &openapi.Schema{Type: "string"}})
+		op.Responses["200"] = jsonResponse("Events", EVENT_STREAM_MEDIA_TYPE, output)
+		delete(op.Responses, "406")
+
+		return op
+	}
+
+	if route.Method == http.MethodGet {
+		op.Parameters = append(op.Parameters, openapi.Parameter{Name: "If-None-Match", In: "header", Schema: &openapi.Schema{Type: "string"}})
+		op.Responses["304"] = openapi.Response{Description: "Not Modified"}
+	}
+
+	// the key is only honoured for an authenticated caller on a route that sets no session
+	authenticated := endpoint.Opts.RequireUser || endpoint.Opts.GetSessionCookie
+	if route.Method == http.MethodPost && authenticated && !endpoint.Opts.SetSessionCookie {
+		maxLen := idempotencyKeyMaxLen
+		op.Parameters = append(op.Parameters, openapi.Parameter{Name: IDEMPOTENCY_HEADER, In: "header", Schema: &openapi.Schema{Type: "string", MaxLength: &maxLen}})
+		op.Responses["409"] = jsonResponse("Idempotency-Key in progress", response.ProblemContentType, problem)
+		op.Responses["422"] = jsonResponse("Idempotency-Key reused with another request", response.ProblemContentType, problem)
+	}
+
+	return op
+}
+
+// parameters lists the path parameters of the pattern, then the query parameters of input.
+func parameters(gen *openapi.Generator, path string, input reflect.Type) []openapi.Parameter {
+	var params []openapi.Parameter
+
+	fields := map[string]reflect.StructField{}
+	var queries []reflect.StructField
+
+	paramFields(input, func(field reflect.StructField) {
+		if name := field.Tag.Get("url"); name != "" {
+			fields[name] = field
+		}
+
+		if field.Tag.Get("query") != "" {
+			queries = append(queries, field)
+		}
+	})
+
+	for _, match := range pathParamRegex.FindAllStringSubmatch(path, -1) {
+		schema := &openapi.Schema{Type: "string"}
+
+		if field, ok := fields[match[1]]; ok {
+			schema = gen.Schema(field.Type)
+			openapi.ApplyRules(schema, field.Tag.Get("validate"))
+		}
+
+		params = append(params, openapi.Parameter{Name: match[1], In: "path", Required: true, Schema: schema})
+	}
+
+	for _, field := range queries {
+		tag := field.Tag.Get("validate")
+		schema := gen.Schema(field.Type)
+		openapi.ApplyRules(schema, tag)
+
+		params = append(params, openapi.Parameter{
+			Name:     field.Tag.Get("query"),
+			In:       "query",
+			Required: hasValidateRule(tag, "required"),
+			Schema:   schema,
+		})
+	}
+
+	return params
+}
+
+func paramFields(t reflect.Type, fn func(field reflect.StructField)) {
+	if t == nil || t.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			paramFields(field.Type, fn)
+			continue
+		}
+
+		fn(field)
+	}
+}
+
+func problemSchema(gen *openapi.Generator) *openapi.Schema {
+	ref := gen.Schema(reflect.TypeOf(response.ProblemDetails{}))
+
+	problem := gen.Schemas()[openapi.ComponentName(reflect.TypeOf(response.ProblemDetails{}))]
+	problem.Properties["errors"] = &openapi.Schema{
+		Type:  "array",
+		Items: gen.Schema(reflect.TypeOf(request.FieldError{})),
+	}
+
+	return ref
+}
+
+// encodedResponse offers schema in every codec the client can negotiate.
+func encodedResponse(description string, schema *openapi.Schema) openapi.Response {
+	res := openapi.Response{Description: description, Content: map[string]openapi.MediaType{}}
+
+	for _, c := range codec.Codecs {
+		res.Content[c.MediaType] = openapi.MediaType{Schema: schema}
+	}
+
+	return res
+}
+
+func jsonResponse(description, mediaType string, schema *openapi.Schema) openapi.Response {
+	return openapi.Response{
+		Description: description,
+		Content:     map[string]openapi.MediaType{mediaType: {Schema: schema}},
+	}
+}
+
+// operationID joins the method and the path segments, as in deleteTokensId for DELETE /tokens/{id}.
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+
+	words := strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '-' || r == '_' || r == '.'
+	})
+
+	for _, word := range words {
+		id += strings.ToUpper(word[:1]) + word[1:]
+	}
+
+	return id
+}
+
+func packageName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+
+	return pkg
+}
+
+func hasValidateRule(tag, rule string) bool {
+	for _, r := range request.SplitRules(tag) {
+		if r == rule {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,51 @@
+package presentation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	b "github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/pkg/openapi"
+)
+
+func TestDocument(t *testing.T) {
+	api := NewAPI(chi.NewRouter())
+
+	api.Get("/items/{id}", GetWithInput(func(ctx context.Context, in itemInput, common b.CommonInput) itemOutput {
+		return itemOutput{}
+	}, Opts{URLParams: []string{"id"}}))
+
+	api.Patch("/profiles/{id}", Patch(func(ctx context.Context, in profilePatch, common b.CommonInput) profileOutput {
+		return profileOutput{}
+	}, RequireUserWithDecodeOpts))
+
+	doc := api.Document(openapi.Info{Title: "test", Version: "1"})
+
+	get := doc.Paths["/items/{id}"]["get"]
+	if get == nil || get.OperationID != "getItemsId" || get.RequestBody != nil || get.Security != nil {
+		t.Fatalf("unexpected get operation %+v", get)
+	}
+
+	if len(get.Parameters) != 3 || get.Parameters[0].In != "path" || get.Parameters[1].Name != "limit" || get.Parameters[2].Name != "If-None-Match" {
+		t.Fatalf("unexpected parameters %+v", get.Parameters)
+	}
+
+	patch := doc.Paths["/profiles/{id}"]["patch"]
+	if patch == nil || patch.RequestBody == nil || patch.Security == nil {
+		t.Fatalf("unexpected patch operation %+v", patch)
+	}
+
+	if _, ok := patch.RequestBody.Content["application/merge-patch+json"]; !ok {
+		t.Fatalf("expected a merge patch body, got %+v", patch.RequestBody.Content)
+	}
+
+	if _, ok := patch.Responses["401"]; !ok {
+		t.Fatalf("expected a 401 response, got %+v", patch.Responses)
+	}
+
+	body := doc.Components.Schemas["presentation.profilePatch"]
+	if _, ok := body.Properties["name"]; !ok || len(body.Properties) != 2 {
+		t.Fatalf("expected name and bio in the body, got %+v", body.Properties)
+	}
+}
@@ -0,0 +1,92 @@
+package presentation
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	b "github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/pkg/codec"
+	"github.com/samuelsih/guwu/pkg/errs"
+	"github.com/samuelsih/guwu/pkg/request"
+)
+
+// newCommonInput resolves the credentials and the url and query parameters of r.
+// The names listed in opts.URLParams and opts.QueryParams are required.
+func newCommonInput(w http.ResponseWriter, r *http.Request, opts Opts) (b.CommonInput, error) {
+	const op = errs.Op("presentation.newCommonInput")
+
+	// checked first so a client that cannot read the output does not trigger the handler
+	if _, err := codec.Negotiate(r.Header.Get("Accept")); err != nil {
+		return b.CommonInput{}, errs.E(op, http.StatusNotAcceptable, err, err.Error())
+	}
+
+	commonInput := b.CommonInput{
+		URLParam:   urlParams(r),
+		QueryParam: queryParams(r),
+	}
+
+	for _, name := range opts.URLParams {
+		if commonInput.URLParam.Get(name) == "" {
+			return commonInput, errs.E(op, errs.KindBadRequest, nil, fmt.Sprintf("missing url parameter %s", name))
+		}
+	}
+
+	for _, name := range opts.QueryParams {
+		if commonInput.QueryParam.Get(name) == "" {
+			return commonInput, errs.E(op, errs.KindBadRequest, nil, fmt.Sprintf("missing query parameter %s", name))
+		}
+	}
+
+	if opts.GetSessionCookie || opts.RequireUser {
+		if err := getCredential(r, &commonInput); err != nil {
+			return commonInput, errs.E(op, errs.KindUnauthorized, err, err.Error())
+		}
+	}
+
+	if opts.RequireUser {
+		if err := authenticateUser(w, r, &commonInput); err != nil {
+			return commonInput, err
+		}
+	}
+
+	return commonInput, nil
+}
+
+// decodeParams fills the `url` and `query` tagged fields of dst.
+func decodeParams(r *http.Request, dst any) error {
+	return request.DecodeParams(dst, func(key string) string {
+		return chi.URLParam(r, key)
+	}, r.URL.Query())
+}
+
+func urlParams(r *http.Request) b.Params {
+	params := b.Params{}
+
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return params
+	}
+
+	for i, key := range rctx.URLParams.Keys {
+		if key == "*" {
+			continue
+		}
+
+		params[key] = rctx.URLParams.Values[i]
+	}
+
+	return params
+}
+
+func queryParams(r *http.Request) b.Params {
+	params := b.Params{}
+
+	for key, values := range r.URL.Query() {
+		if len(values) > 0 {
+			params[key] = values[0]
+		}
+	}
+
+	return params
+}
@@ -0,0 +1,81 @@
+package presentation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	b "github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/pkg/response"
+)
+
+type itemInput struct {
+	ID    string `url:"id"`
+	Limit int    `query:"limit"`
+}
+
+type itemOutput struct {
+	b.CommonResponse
+	ID     string `json:"id"`
+	Limit  int    `json:"limit"`
+	Sort   string `json:"sort"`
+	Params string `json:"params"`
+}
+
+func TestParams(t *testing.T) {
+	r := chi.NewRouter()
+	api := NewAPI(r)
+
+	api.Get("/items/{id}", GetWithInput(func(ctx context.Context, in itemInput, common b.CommonInput) itemOutput {
+		out := itemOutput{ID: in.ID, Limit: in.Limit, Sort: common.QueryParam.Get("sort"), Params: common.URLParam.Get("id")}
+		out.SetOK()
+		return out
+	}, Opts{QueryParams: []string{"sort"}}))
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		want   itemOutput
+	}{
+		{"Resolved", "/items/42?limit=5&sort=asc", 200, itemOutput{ID: "42", Limit: 5, Sort: "asc", Params: "42"}},
+		{"InvalidType", "/items/42?limit=five&sort=asc", 400, itemOutput{}},
+		{"MissingRequired", "/items/42?limit=5", 400, itemOutput{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+
+			if tt.status != 200 {
+				var problem response.ProblemDetails
+				if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+					t.Fatal(err)
+				}
+
+				if problem.Status != tt.status || problem.Detail == "" {
+					t.Fatalf("expected problem details, got %+v", problem)
+				}
+
+				return
+			}
+
+			var got itemOutput
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+
+			if got.ID != tt.want.ID || got.Limit != tt.want.Limit || got.Sort != tt.want.Sort || got.Params != tt.want.Params {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package presentation
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	b "github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/pkg/codec"
+	"github.com/samuelsih/guwu/pkg/request"
+	"github.com/samuelsih/guwu/pkg/response"
+)
+
+const problemTypeBase = "/problems/"
+
+var legacyErrors bool
+
+// SetLegacyErrors renders errors with the former {code, message} envelope,
+// clients still get problem details when they accept application/problem+json.
+func SetLegacyErrors(legacy bool) {
+	legacyErrors = legacy
+}
+
+// NotFound and MethodNotAllowed are the router fallbacks.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, errors.New("no route matches "+r.URL.Path), "presentation.NotFound")
+}
+
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusMethodNotAllowed, errors.New("method "+r.Method+" is not allowed"), "presentation.MethodNotAllowed")
+}
+
+// writeOutput responds with out, or with its error when the handler failed.
+func writeOutput(w http.ResponseWriter, r *http.Request, out b.CommonOutput, opts Opts, op string) {
+	res := out.CommonRes()
+
+	if res.StatusCode >= 400 && !opts.RawErrorBody && wantsProblem(r) {
+		writeProblem(w, r, res.StatusCode, res.Msg, nil, op)
+		return
+	}
+
+	if opts.CacheControl != "" && res.StatusCode < 400 {
+		w.Header().Set("Cache-Control", opts.CacheControl)
+	}
+
+	// newCommonInput rejected the requests without an acceptable codec already
+	c, _ := codec.Negotiate(r.Header.Get("Accept"))
+
+	if err := response.Encode(w, res.StatusCode, c, out); err != nil {
+		log.Printf("%s: %v", op, err)
+	}
+}
+
+// writeError responds to errors raised before reaching the handler.
+// Validation errors also list every failed field.
+func writeError(w http.ResponseWriter, r *http.Request, status int, err error, op string) {
+	var fields []request.FieldError
+
+	var validationErr *request.ValidationError
+	if errors.As(err, &validationErr) {
+		fields = validationErr.Fields
+	}
+
+	if wantsProblem(r) {
+		writeProblem(w, r, status, err.Error(), fields, op)
+		return
+	}
+
+	res := map[string]any{
+		"code":    status,
+		"message": err.Error(),
+	}
+
+	if fields != nil {
+		res["errors"] = fields
+	}
+
+	if err := response.JSON(w, status, res); err != nil {
+		log.Printf("%s: %v", op, err)
+	}
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string, fields []request.FieldError, op string) {
+	problem := response.ProblemDetails{
+		Type:     problemTypeBase + problemSlug(status),
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: middleware.GetReqID(r.Context()),
+	}
+
+	if fields != nil {
+		problem.Type = problemTypeBase + "validation-failed"
+		problem.Title = "Validation Failed"
+		problem.Errors = fields
+	}
+
+	if err := response.Problem(w, problem); err != nil {
+		log.Printf("%s: %v", op, err)
+	}
+}
+
+func wantsProblem(r *http.Request) bool {
+	if !legacyErrors {
+		return true
+	}
+
+	return strings.Contains(r.Header.Get("Accept"), response.ProblemContentType)
+}
+
+// problemSlug names the problem type after the status, the errs kinds being http statuses.
+func problemSlug(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "unknown"
+	}
+
+	return strings.ReplaceAll(strings.ToLower(text), " ", "-")
+}
@@ -0,0 +1,134 @@
+package presentation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	b "github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/pkg/errs"
+	"github.com/samuelsih/guwu/pkg/response"
+)
+
+type failingOutput struct {
+	b.CommonResponse
+	Error string `json:"error,omitempty"`
+}
+
+func failing(ctx context.Context, commonIn b.CommonInput) failingOutput {
+	var out failingOutput
+	out.SetError(errs.E("test.failing", errs.KindNotFound, nil, "post not found"))
+	out.Error = "not_found"
+	return out
+}
+
+func problemRouter() *chi.Mux {
+	r := chi.NewRouter()
+	api := NewAPI(r)
+	r.Use(middleware.RequestID)
+
+	api.Get("/fail", Get(failing, DefaultOpts))
+	api.Get("/raw", Get(failing, Opts{RawErrorBody: true}))
+	api.Post("/signup", Post(func(ctx context.Context, in signupInput, common b.CommonInput) b.CommonResponse {
+		var out b.CommonResponse
+		out.SetOK()
+		return out
+	}, OnlyDecodeOpts))
+
+	r.NotFound(NotFound)
+	r.MethodNotAllowed(MethodNotAllowed)
+
+	return r
+}
+
+func TestProblem(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		status     int
+		wantType   string
+		wantDetail string
+	}{
+		{"HandlerError", http.MethodGet, "/fail", "", 404, "/problems/not-found", "post not found"},
+		{"Validation", http.MethodPost, "/signup", `{"email": "nope"}`, 400, "/problems/validation-failed", "email must be a valid email"},
+		{"NotFound", http.MethodGet, "/nothing", "", 404, "/problems/not-found", "no route matches /nothing"},
+		{"MethodNotAllowed", http.MethodDelete, "/fail", "", 405, "/problems/method-not-allowed", "method DELETE is not allowed"},
+	}
+
+	r := problemRouter()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status || w.Header().Get("Content-Type") != response.ProblemContentType {
+				t.Fatalf("expected %d problem, got %d %s", tt.status, w.Code, w.Header().Get("Content-Type"))
+			}
+
+			var got response.ProblemDetails
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Type != tt.wantType || got.Status != tt.status || got.Detail != tt.wantDetail {
+				t.Fatalf("unexpected problem %+v", got)
+			}
+
+			if got.Title == "" || got.Instance == "" {
+				t.Fatalf("expected title and instance, got %+v", got)
+			}
+		})
+	}
+}
+
+func TestProblemRawErrorBody(t *testing.T) {
+	w := httptest.NewRecorder()
+	problemRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/raw", nil))
+
+	var got failingOutput
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != 404 || got.Error != "not_found" || got.Msg != "post not found" {
+		t.Fatalf("expected the output as is, got %d %+v", w.Code, got)
+	}
+}
+
+func TestLegacyErrors(t *testing.T) {
+	SetLegacyErrors(true)
+	defer SetLegacyErrors(false)
+
+	r := problemRouter()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nothing", nil))
+
+	var got b.CommonResponse
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Header().Get("Content-Type") != "application/json" || got.StatusCode != 404 || got.Msg == "" {
+		t.Fatalf("expected the legacy envelope, got %s %+v", w.Header().Get("Content-Type"), got)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/fail", nil)
+	req.Header.Set("Accept", response.ProblemContentType)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Header().Get("Content-Type") != response.ProblemContentType {
+		t.Fatalf("expected a problem when accepted, got %s", w.Header().Get("Content-Type"))
+	}
+}
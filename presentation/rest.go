@@ -2,12 +2,15 @@ package presentation
 
 import (
 	"context"
-	"log"
+	"errors"
+	"mime"
 	"net/http"
+	"strings"
 
 	b "github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/pkg/codec"
+	"github.com/samuelsih/guwu/pkg/errs"
 	"github.com/samuelsih/guwu/pkg/request"
-	"github.com/samuelsih/guwu/pkg/response"
 )
 
 type DefaultHandler[out b.CommonOutput] func(ctx context.Context, commonIn b.CommonInput) out
@@ -19,6 +22,17 @@ type Opts struct {
 	SetSessionCookie  bool
 	DecodeRequestBody bool
 
+	// RequireUser authenticates the request before the handler, see SetAuthenticator.
+	RequireUser bool
+
+	// RawErrorBody keeps the output as the error body, for protocols defining their own errors like OAuth.
+	RawErrorBody bool
+
+	// CacheControl is the Cache-Control header of successful responses, reads also get validators, see writeCacheable.
+	CacheControl string
+
+	// URLParams and QueryParams are the parameters that must be present,
+	// every parameter of the request is resolved regardless.
 	URLParams   []string
 	QueryParams []string
 }
@@ -48,132 +62,228 @@ var (
 	OnlyDecodeOpts = Opts{
 		DecodeRequestBody: true,
 	}
+
+	RequireUserOpts = Opts{
+		RequireUser: true,
+	}
+
+	RequireUserWithDecodeOpts = Opts{
+		RequireUser:       true,
+		DecodeRequestBody: true,
+	}
 )
 
-func Get[outType b.CommonOutput](handle DefaultHandler[outType], opts Opts) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		var commonInput = b.CommonInput{
-			URLParam:   opts.URLParams,
-			QueryParam: opts.QueryParams,
+func Get[outType b.CommonOutput](handle DefaultHandler[outType], opts Opts) Endpoint {
+	return newEndpoint[struct{}, outType](opts, nil, func(w http.ResponseWriter, r *http.Request) {
+		commonInput, err := newCommonInput(w, r, opts)
+		if err != nil {
+			writeError(w, r, errs.GetKind(err), err, "presentation.Get")
+			return
 		}
 
-		var err error
+		out := handle(r.Context(), commonInput)
 
-		if opts.GetSessionCookie {
-			commonInput.SessionID, err = getSessionCookie(r)
-			if err != nil {
-				encodeErr := response.JSON(w, 400, map[string]any{
-					"code":     400,
-					"messsage": err.Error(),
-				})
+		writeCacheable(w, r, out, opts, "presentation.Get")
+	})
+}
 
-				if encodeErr != nil {
-					log.Printf("presentation.Get: %v", err)
-				}
+// GetWithInput is Get for handlers reading their `url` and `query` tagged input.
+func GetWithInput[inType any, outType b.CommonOutput](handle InputHandler[inType, outType], opts Opts) Endpoint {
+	return newEndpoint[inType, outType](opts, nil, func(w http.ResponseWriter, r *http.Request) {
+		var in inType
 
-				return
-			}
+		commonInput, err := newCommonInput(w, r, opts)
+		if err != nil {
+			writeError(w, r, errs.GetKind(err), err, "presentation.GetWithInput")
+			return
 		}
 
-		out := handle(r.Context(), commonInput)
+		if err := decodeParams(r, &in); err != nil {
+			writeError(w, r, 400, err, "presentation.GetWithInput")
+			return
+		}
 
-		if err := response.JSON(w, out.CommonRes().StatusCode, &out); err != nil {
-			log.Printf("presentation.Get: %v", err)
+		if err := request.Validate(&in); err != nil {
+			writeError(w, r, validationStatus(err), err, "presentation.GetWithInput")
 			return
 		}
-	}
+
+		out := handle(r.Context(), in, commonInput)
+
+		writeCacheable(w, r, out, opts, "presentation.GetWithInput")
+	})
+}
+
+func Post[inType any, outType b.CommonOutput](handle InputHandler[inType, outType], opts Opts) Endpoint {
+	return newEndpoint[inType, outType](opts, bodyMediaTypes, withBody("presentation.Post", opts, withInput("presentation.Post", handle, opts, decodeBody)))
+}
+
+// Put replaces a resource, its body is decoded the same way as Post.
+func Put[inType any, outType b.CommonOutput](handle InputHandler[inType, outType], opts Opts) Endpoint {
+	return newEndpoint[inType, outType](opts, bodyMediaTypes, withBody("presentation.Put", opts, withInput("presentation.Put", handle, opts, decodeBody)))
+}
+
+// Patch decodes the body as a JSON Merge Patch, inType should use b.Optional for the fields that can be patched.
+func Patch[inType any, outType b.CommonOutput](handle InputHandler[inType, outType], opts Opts) Endpoint {
+	next := withInput("presentation.Patch", handle, opts, request.DecodeMergePatch)
+
+	return newEndpoint[inType, outType](opts, patchMediaTypes, func(w http.ResponseWriter, r *http.Request) {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+		if opts.DecodeRequestBody && mediaType != "application/merge-patch+json" && mediaType != "application/json" {
+			writeError(w, r, http.StatusUnsupportedMediaType, errors.New("content type must be application/merge-patch+json"), "presentation.Patch")
+			return
+		}
+
+		next(w, r)
+	})
 }
 
-func Post[inType any, outType b.CommonOutput](handle InputHandler[inType, outType], opts Opts) http.HandlerFunc {
+type bodyDecoder func(w http.ResponseWriter, r *http.Request, dst any) error
+
+func withInput[inType any, outType b.CommonOutput](op string, handle InputHandler[inType, outType], opts Opts, decode bodyDecoder) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var in inType
-		var err error
 
-		var commonInput = b.CommonInput{
-			URLParam:   opts.URLParams,
-			QueryParam: opts.QueryParams,
+		commonInput, err := newCommonInput(w, r, opts)
+		if err != nil {
+			writeError(w, r, errs.GetKind(err), err, op)
+			return
 		}
 
-		if opts.GetSessionCookie {
-			commonInput.SessionID, err = getSessionCookie(r)
-			if err != nil {
-				encodeErr := response.JSON(w, 400, map[string]any{
-					"code":    400,
-					"message": err.Error(),
-				})
-
-				if encodeErr != nil {
-					log.Printf("presentation.Get: %v", err)
-				}
+		// PUT and PATCH are idempotent already, only POST honours an Idempotency-Key.
+		// A replay cannot hand out the session cookie again, so the routes setting one never replay.
+		if r.Method == http.MethodPost && !opts.SetSessionCookie {
+			var finish func()
+			var ok bool
 
+			if w, finish, ok = idempotent(w, r, commonInput, op); !ok {
 				return
 			}
+
+			defer finish()
 		}
 
 		if opts.DecodeRequestBody {
-			if err = request.Decode(w, r, &in); err != nil {
-				encodeErr := response.JSON(w, 400, map[string]any{
-					"code":     400,
-					"messsage": err.Error(),
-				})
-
-				if encodeErr != nil {
-					log.Printf("presentation.Post: %v", err)
-				}
-
+			if err = decode(w, r, &in); err != nil {
+				writeError(w, r, 400, err, op)
 				return
 			}
 
 			defer r.Body.Close()
 		}
 
+		// parameters are decoded last so the path always wins over the body
+		if err := decodeParams(r, &in); err != nil {
+			writeError(w, r, 400, err, op)
+			return
+		}
+
+		if err := request.Validate(&in); err != nil {
+			writeError(w, r, validationStatus(err), err, op)
+			return
+		}
+
 		out := handle(r.Context(), in, commonInput)
 
 		if opts.SetSessionCookie {
 			setSessionCookie(w, "sid", out.CommonRes().SessionID, out.CommonRes().SessionMaxAge)
 		}
 
-		if err = response.JSON(w, out.CommonRes().StatusCode, out); err != nil {
-			log.Printf("presentation.Post: %v", err)
-			return
-		}
+		writeOutput(w, r, out, opts, op)
 	}
 }
 
-func Delete[outType b.CommonOutput](handle DefaultHandler[outType], opts Opts) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		var commonInput = b.CommonInput{
-			URLParam:   opts.URLParams,
-			QueryParam: opts.QueryParams,
+func Delete[outType b.CommonOutput](handle DefaultHandler[outType], opts Opts) Endpoint {
+	return newEndpoint[struct{}, outType](opts, nil, func(w http.ResponseWriter, r *http.Request) {
+		commonInput, err := newCommonInput(w, r, opts)
+		if err != nil {
+			writeError(w, r, errs.GetKind(err), err, "presentation.Delete")
+			return
+		}
+
+		out := handle(r.Context(), commonInput)
+
+		if opts.SetSessionCookie {
+			setSessionCookie(w, "sid", out.CommonRes().SessionID, out.CommonRes().SessionMaxAge)
 		}
 
-		var err error
+		writeOutput(w, r, out, opts, "presentation.Delete")
+	})
+}
 
-		if opts.GetSessionCookie {
-			commonInput.SessionID, err = getSessionCookie(r)
-			if err != nil {
-				encodeErr := response.JSON(w, 400, map[string]any{
-					"code":     400,
-					"messsage": err.Error(),
-				})
+// DeleteWithInput is Delete for handlers reading their `url` and `query` tagged input.
+func DeleteWithInput[inType any, outType b.CommonOutput](handle InputHandler[inType, outType], opts Opts) Endpoint {
+	return newEndpoint[inType, outType](opts, nil, func(w http.ResponseWriter, r *http.Request) {
+		var in inType
 
-				if encodeErr != nil {
-					log.Printf("presentation.Get: %v", err)
-				}
+		commonInput, err := newCommonInput(w, r, opts)
+		if err != nil {
+			writeError(w, r, errs.GetKind(err), err, "presentation.DeleteWithInput")
+			return
+		}
 
-				return
-			}
+		if err := decodeParams(r, &in); err != nil {
+			writeError(w, r, 400, err, "presentation.DeleteWithInput")
+			return
 		}
 
-		out := handle(r.Context(), commonInput)
+		if err := request.Validate(&in); err != nil {
+			writeError(w, r, validationStatus(err), err, "presentation.DeleteWithInput")
+			return
+		}
+
+		out := handle(r.Context(), in, commonInput)
 
 		if opts.SetSessionCookie {
 			setSessionCookie(w, "sid", out.CommonRes().SessionID, out.CommonRes().SessionMaxAge)
 		}
 
-		if err := response.JSON(w, out.CommonRes().StatusCode, &out); err != nil {
-			log.Printf("presentation.Get: %v", err)
+		writeOutput(w, r, out, opts, "presentation.DeleteWithInput")
+	})
+}
+
+// withBody rejects the bodies decodeBody cannot read.
+func withBody(op string, opts Opts, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+		if opts.DecodeRequestBody && mediaType != "" && !contains(bodyMediaTypes, mediaType) {
+			writeError(w, r, http.StatusUnsupportedMediaType, errors.New("content type must be one of "+strings.Join(bodyMediaTypes, ", ")), op)
 			return
 		}
+
+		next(w, r)
+	}
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, dst any) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if mediaType == "application/x-www-form-urlencoded" {
+		return request.DecodeForm(w, r, dst)
 	}
+
+	c, _ := codec.ForContentType(mediaType)
+	return request.DecodeAs(w, r, dst, c)
+}
+
+// validationStatus is 400 for invalid input, a malformed validate tag is a bug on our side.
+func validationStatus(err error) int {
+	var validationErr *request.ValidationError
+	if errors.As(err, &validationErr) {
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
 }
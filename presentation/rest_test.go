@@ -0,0 +1,177 @@
+package presentation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	b "github.com/samuelsih/guwu/business"
+)
+
+type profilePatch struct {
+	ID   string             `json:"-" url:"id"`
+	Name b.Optional[string] `json:"name"`
+	Bio  b.Optional[string] `json:"bio"`
+}
+
+type profileOutput struct {
+	b.CommonResponse
+	ID      string `json:"id"`
+	NameSet bool   `json:"name_set"`
+	Name    string `json:"name"`
+	BioSet  bool   `json:"bio_set"`
+	BioNull bool   `json:"bio_null"`
+}
+
+func TestPatch(t *testing.T) {
+	r := chi.NewRouter()
+	api := NewAPI(r)
+
+	api.Patch("/profiles/{id}", Patch(func(ctx context.Context, in profilePatch, common b.CommonInput) profileOutput {
+		out := profileOutput{ID: in.ID, NameSet: in.Name.Set, Name: in.Name.Value, BioSet: in.Bio.Set, BioNull: in.Bio.Null}
+		out.SetOK()
+		return out
+	}, OnlyDecodeOpts))
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		want        profileOutput
+	}{
+		{"AbsentAndNull", "application/merge-patch+json", `{"bio": null}`, 200, profileOutput{ID: "7", BioSet: true, BioNull: true}},
+		{"Value", "application/json", `{"name": "bob"}`, 200, profileOutput{ID: "7", NameSet: true, Name: "bob"}},
+		{"NotObject", "application/merge-patch+json", `["bob"]`, 400, profileOutput{}},
+		{"UnsupportedType", "text/plain", `{"name": "bob"}`, 415, profileOutput{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/profiles/7", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+
+			if tt.status != 200 {
+				return
+			}
+
+			var got profileOutput
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+
+			got.CommonResponse = b.CommonResponse{}
+			if got != tt.want {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPut(t *testing.T) {
+	r := chi.NewRouter()
+	api := NewAPI(r)
+
+	api.Put("/profiles/{id}", Put(func(ctx context.Context, in profilePatch, common b.CommonInput) profileOutput {
+		out := profileOutput{ID: in.ID, Name: in.Name.Value}
+		out.SetOK()
+		return out
+	}, OnlyDecodeOpts))
+
+	req := httptest.NewRequest(http.MethodPut, "/profiles/9", strings.NewReader(`{"name": "alice", "bio": "hi"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var got profileOutput
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != 200 || got.ID != "9" || got.Name != "alice" {
+		t.Fatalf("unexpected response %d %+v", w.Code, got)
+	}
+}
+
+type signupInput struct {
+	Email string `json:"email" validate:"required,email"`
+	Name  string `json:"name" validate:"max=5"`
+}
+
+func TestPostValidation(t *testing.T) {
+	called := false
+
+	handler := Post(func(ctx context.Context, in signupInput, common b.CommonInput) b.CommonResponse {
+		called = true
+		var out b.CommonResponse
+		out.SetOK()
+		return out
+	}, OnlyDecodeOpts)
+
+	req := httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(`{"email": "nope", "name": "too long"}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != 400 || called {
+		t.Fatalf("expected 400 without calling the handler, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var got struct {
+		Errors []struct {
+			Field string `json:"field"`
+			Rule  string `json:"rule"`
+		} `json:"errors"`
+	}
+
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Errors) != 2 || got.Errors[0].Field != "email" || got.Errors[1].Rule != "max" {
+		t.Fatalf("unexpected errors %+v", got.Errors)
+	}
+}
+
+func TestPostCacheControl(t *testing.T) {
+	handler := Post(func(ctx context.Context, in signupInput, common b.CommonInput) b.CommonResponse {
+		var out b.CommonResponse
+
+		if in.Name == "" {
+			out.RawError(400, "name is required")
+			return out
+		}
+
+		out.SetOK()
+		return out
+	}, Opts{DecodeRequestBody: true, CacheControl: "no-store"})
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"success", `{"email": "a@b.co", "name": "a"}`, "no-store"},
+		{"error", `{"email": "a@b.co"}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(tt.body)))
+
+			if got := w.Header().Get("Cache-Control"); got != tt.want {
+				t.Fatalf("expected Cache-Control %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
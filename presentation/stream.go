@@ -0,0 +1,166 @@
+package presentation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	b "github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/pkg/errs"
+)
+
+const (
+	EVENT_STREAM_MEDIA_TYPE = "text/event-stream"
+	LAST_EVENT_ID_HEADER    = "Last-Event-ID"
+
+	STREAM_RETRY = time.Second
+)
+
+var (
+	streamHeartbeat = 15 * time.Second
+	streamMaxAge    = 25 * time.Second
+
+	errStreamUnsupported = errors.New("streaming unsupported")
+)
+
+// SetStreamLimits pings the streams every heartbeat and ends them after maxAge, before the write
+// timeout of the server cuts them off. Clients reconnect STREAM_RETRY later with the Last-Event-ID
+// header and miss nothing.
+func SetStreamLimits(heartbeat, maxAge time.Duration) {
+	streamHeartbeat = heartbeat
+	streamMaxAge = maxAge
+}
+
+// StreamHandler authorizes the request then returns its events, its errors are written as any other.
+type StreamHandler func(ctx context.Context, lastEventID string, commonIn b.CommonInput) (b.Stream, error)
+
+// Stream writes the events as Server-Sent Events, commenting a ping at every heartbeat
+// so that proxies and clients know the connection is alive.
+func Stream(handle StreamHandler, opts Opts) Endpoint {
+	endpoint := newEndpoint[struct{}, b.Event](opts, nil, func(w http.ResponseWriter, r *http.Request) {
+		const op = "presentation.Stream"
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, r, http.StatusInternalServerError, errStreamUnsupported, op)
+			return
+		}
+
+		// EventSource accepts text/event-stream only, which no codec negotiates
+		negotiated := r.Clone(r.Context())
+		negotiated.Header.Del("Accept")
+
+		commonInput, err := newCommonInput(w, negotiated, opts)
+		if err != nil {
+			writeError(w, r, errs.GetKind(err), err, op)
+			return
+		}
+
+		stream, err := handle(r.Context(), r.Header.Get(LAST_EVENT_ID_HEADER), commonInput)
+		if err != nil {
+			writeError(w, r, errs.GetKind(err), err, op)
+			return
+		}
+
+		w.Header().Set("Content-Type", EVENT_STREAM_MEDIA_TYPE)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		// the id alone dispatches no event, it is only what the client sends back once reconnected
+		preamble := fmt.Sprintf("retry: %d\n", STREAM_RETRY.Milliseconds())
+		if stream.LastEventID != "" {
+			preamble += "id: " + stream.LastEventID + "\n"
+		}
+
+		events := &eventWriter{w: w, flusher: flusher}
+		if err := events.write(preamble + "\n"); err != nil {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), streamMaxAge)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			events.heartbeat(ctx, cancel)
+		}()
+
+		if err := stream.Run(ctx, events.send); err != nil && ctx.Err() == nil {
+			log.Printf("%s: %v", op, err)
+		}
+
+		// nothing may be written once the handler returned
+		cancel()
+		wg.Wait()
+	})
+
+	endpoint.EventStream = true
+	return endpoint
+}
+
+// eventWriter serializes the writes of the events and the heartbeat.
+type eventWriter struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (e *eventWriter) send(event b.Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+
+	var msg strings.Builder
+
+	if event.ID != "" {
+		msg.WriteString("id: " + event.ID + "\n")
+	}
+
+	if event.Type != "" {
+		msg.WriteString("event: " + event.Type + "\n")
+	}
+
+	msg.WriteString("data: " + string(data) + "\n\n")
+
+	return e.write(msg.String())
+}
+
+func (e *eventWriter) heartbeat(ctx context.Context, cancel context.CancelFunc) {
+	ticker := time.NewTicker(streamHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// a failed ping means the client is gone
+			if err := e.write(": ping\n\n"); err != nil {
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+func (e *eventWriter) write(msg string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, err := e.w.Write([]byte(msg)); err != nil {
+		return err
+	}
+
+	e.flusher.Flush()
+	return nil
+}
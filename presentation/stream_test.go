@@ -0,0 +1,141 @@
+package presentation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	b "github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/model"
+	"github.com/samuelsih/guwu/pkg/errs"
+)
+
+func TestStream(t *testing.T) {
+	SetAuthenticator(func(ctx context.Context, in b.CommonInput) (b.Identity, error) {
+		if in.SessionID == "valid" {
+			return b.Identity{User: model.User{ID: "1"}, SessionID: "1"}, nil
+		}
+
+		return b.Identity{}, errs.E("test.authenticate", errs.KindUnauthorized, errors.New("unknown session"), "invalid or expired credentials")
+	})
+	defer SetAuthenticator(nil)
+
+	SetStreamLimits(10*time.Millisecond, 50*time.Millisecond)
+	defer SetStreamLimits(15*time.Second, 25*time.Second)
+
+	handler := Stream(func(ctx context.Context, lastEventID string, common b.CommonInput) (b.Stream, error) {
+		if lastEventID == "forbidden" {
+			return b.Stream{}, errs.E("test.stream", 403, errors.New("missing scope"), "token is missing scope")
+		}
+
+		return b.Stream{LastEventID: lastEventID, Run: func(ctx context.Context, send func(b.Event) error) error {
+			if err := send(b.Event{ID: "1-0", Type: "follow", Data: map[string]string{"after": lastEventID}}); err != nil {
+				return err
+			}
+
+			<-ctx.Done()
+			return nil
+		}}, nil
+	}, RequireUserOpts)
+
+	t.Run("events", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/events", nil)
+		req.Header.Set("Accept", EVENT_STREAM_MEDIA_TYPE)
+		req.Header.Set(LAST_EVENT_ID_HEADER, "0-1")
+		req.AddCookie(&http.Cookie{Name: "sid", Value: "valid"})
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != 200 || w.Header().Get("Content-Type") != EVENT_STREAM_MEDIA_TYPE {
+			t.Fatalf("expected an event stream, got %d %s", w.Code, w.Header().Get("Content-Type"))
+		}
+
+		body := w.Body.String()
+
+		if !strings.HasPrefix(body, "retry: 1000\nid: 0-1\n\nid: 1-0\nevent: follow\ndata: {\"after\":\"0-1\"}\n\n") {
+			t.Fatalf("unexpected body: %q", body)
+		}
+
+		if !strings.Contains(body, ": ping\n\n") {
+			t.Fatalf("expected a heartbeat, got %q", body)
+		}
+	})
+
+	t.Run("reconnect after no events", func(t *testing.T) {
+		var resumedFrom []string
+
+		quiet := Stream(func(ctx context.Context, lastEventID string, common b.CommonInput) (b.Stream, error) {
+			resumedFrom = append(resumedFrom, lastEventID)
+
+			// without a Last-Event-ID the stream starts after the latest event kept
+			if lastEventID == "" {
+				lastEventID = "5-0"
+			}
+
+			return b.Stream{LastEventID: lastEventID, Run: func(ctx context.Context, send func(b.Event) error) error {
+				<-ctx.Done()
+				return nil
+			}}, nil
+		}, RequireUserOpts)
+
+		connect := func(lastEventID string) string {
+			req := httptest.NewRequest(http.MethodGet, "/events", nil)
+			req.Header.Set("Accept", EVENT_STREAM_MEDIA_TYPE)
+			req.AddCookie(&http.Cookie{Name: "sid", Value: "valid"})
+
+			if lastEventID != "" {
+				req.Header.Set(LAST_EVENT_ID_HEADER, lastEventID)
+			}
+
+			w := httptest.NewRecorder()
+			quiet.ServeHTTP(w, req)
+			return w.Body.String()
+		}
+
+		body := connect("")
+		if !strings.HasPrefix(body, "retry: 1000\nid: 5-0\n\n") {
+			t.Fatalf("expected the last event id before any event, got %q", body)
+		}
+
+		// EventSource sends back the last id it was given
+		connect("5-0")
+
+		if len(resumedFrom) != 2 || resumedFrom[1] != "5-0" {
+			t.Fatalf("expected the reconnection to resume from 5-0, got %q", resumedFrom)
+		}
+	})
+
+	tests := []struct {
+		name        string
+		cookie      string
+		lastEventID string
+		status      int
+	}{
+		{"Unauthenticated", "", "", 401},
+		{"Forbidden", "valid", "forbidden", 403},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/events", nil)
+			req.Header.Set("Accept", EVENT_STREAM_MEDIA_TYPE)
+			req.Header.Set(LAST_EVENT_ID_HEADER, tt.lastEventID)
+
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "sid", Value: tt.cookie})
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -1,95 +1,265 @@
 package main
 
 import (
-	"log"
-	"net/http"
+	"context"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/jmoiron/sqlx"
+	"github.com/samuelsih/guwu/business"
+	"github.com/samuelsih/guwu/business/admin"
 	"github.com/samuelsih/guwu/business/auth"
+	"github.com/samuelsih/guwu/business/event"
 	"github.com/samuelsih/guwu/business/follow"
 	"github.com/samuelsih/guwu/business/health"
-	"github.com/samuelsih/guwu/pkg/mail"
+	"github.com/samuelsih/guwu/business/notification"
+	"github.com/samuelsih/guwu/business/oauth"
+	"github.com/samuelsih/guwu/business/outbox"
+	"github.com/samuelsih/guwu/business/post"
+	"github.com/samuelsih/guwu/business/preference"
+	"github.com/samuelsih/guwu/business/token"
+	"github.com/samuelsih/guwu/model"
+	push "github.com/samuelsih/guwu/pkg/notification"
+	"github.com/samuelsih/guwu/pkg/oidc"
+	"github.com/samuelsih/guwu/pkg/openapi"
 	"github.com/samuelsih/guwu/pkg/redis"
-	"github.com/samuelsih/guwu/pkg/response"
 	pr "github.com/samuelsih/guwu/presentation"
 )
 
-func loadRoutes(r *chi.Mux, deps Dependencies) {
+type identifyFunc func(ctx context.Context, in business.CommonInput) (business.Identity, error)
+
+var apiInfo = openapi.Info{Title: "guwu", Version: "1.0.0"}
+
+// reads are revalidated with their ETag on every use, private ones stay out of shared caches.
+var (
+	publicReadOpts  = pr.Opts{CacheControl: "public, no-cache"}
+	privateReadOpts = pr.Opts{RequireUser: true, CacheControl: "private, no-cache"}
+)
+
+// loadRoutes mounts every route on r, the returned API describes them.
+func loadRoutes(r *chi.Mux, deps Dependencies) *pr.API {
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-None-Match", "If-Modified-Since", pr.IDEMPOTENCY_HEADER, pr.LAST_EVENT_ID_HEADER},
+		ExposedHeaders: []string{"ETag", "Last-Modified", pr.IDEMPOTENCY_REPLAYED},
 	}))
 
+	r.Use(middleware.RequestID)
 	r.Use(middleware.Recoverer)
 
 	redisClient := redis.NewClient(deps.Redis)
 
-	authRoutes(r, deps.DB, redisClient, deps.Mailer)
-	followHandlers(r, deps.DB, redisClient)
+	api := pr.NewAPI(r)
+
+	pr.SetIdempotencyStore(pr.IdempotencyStore{
+		SetIfAbsent: redisClient.SetJSONIfAbsent,
+		Set:         redisClient.SetJSON,
+		Get:         redisClient.GetJSON,
+		Destroy:     redisClient.Destroy,
+	})
+
+	authDeps := authRoutes(api, deps.DB, redisClient, deps.Providers)
+	pr.SetAuthenticator(authDeps.Authenticate)
 
-	healthCheckHandlers(r, deps)
-	notFound(r)
-	methodNotAllowed(r)
+	events := eventHandlers(api, deps.DB, redisClient, authDeps.Identify)
+	notifications := notificationHandlers(api, deps.DB, authDeps.Identify, deps.Push, events)
+	followHandlers(api, deps.DB, authDeps.Identify, notifications, events)
+	tokenHandlers(api, deps.DB, authDeps.Identify)
+	postHandlers(api, deps.DB, authDeps.Identify, notifications, events)
+	authDeps.IdentifyOAuth = oauthHandlers(api, deps.DB, redisClient, authDeps.Identify)
+
+	preferenceHandlers(api, deps.DB, authDeps.Identify)
+	adminHandlers(api, deps, authDeps.Identify)
+	healthCheckHandlers(api, deps)
+	r.Get("/openapi.json", api.ServeDocument(apiInfo))
+	r.NotFound(pr.NotFound)
+	r.MethodNotAllowed(pr.MethodNotAllowed)
+
+	return api
 }
 
-func authRoutes(r *chi.Mux, db *sqlx.DB, rdb *redis.Client, mailer mail.Client) {
-	deps := auth.Deps{
-		DB:        db,
-		Store:     rdb.SetJSON,
-		Destroy:   rdb.Destroy,
-		SendEmail: mailer.Send,
-		Get:       rdb.GetJSON,
+// sessionDeps are the auth.Deps storing the sessions in rdb, the routes and the jobs share them.
+func sessionDeps(db *sqlx.DB, rdb *redis.Client) auth.Deps {
+	return auth.Deps{
+		DB:      db,
+		Store:   rdb.SetJSON,
+		Destroy: rdb.Destroy,
+		Get:     rdb.GetJSON,
+		TTL:     rdb.TTL,
+		Expire:  rdb.Expire,
+		Track:   rdb.AddMember,
+		Untrack: rdb.RemoveMember,
+		Members: rdb.Members,
 	}
+}
+
+func authRoutes(api *pr.API, db *sqlx.DB, rdb *redis.Client, providers map[string]*oidc.Provider) *auth.Deps {
+	mails := outbox.Deps{DB: db}
+
+	deps := sessionDeps(db, rdb)
+	deps.SendEmail = mails.Enqueue
+	deps.Providers = providers
+
+	api.Post("/register", pr.Post(deps.Register, pr.OnlyDecodeOpts))
+	api.Post("/login", pr.Post(deps.Login, pr.SetSessionWithDecodeOpts))
+	api.Delete("/logout", pr.Delete(deps.Logout, pr.GetterSetterSessionOpts))
+	api.Get("/whoami", pr.Get(deps.WhoAmI, privateReadOpts))
 
-	r.Post("/register", pr.Post(deps.Register, pr.OnlyDecodeOpts))
-	r.Post("/login", pr.Post(deps.Login, pr.SetSessionWithDecodeOpts))
-	r.Delete("/logout", pr.Delete(deps.Logout, pr.GetterSetterSessionOpts))
-	r.Get("/whoami", pr.Get(deps.WhoAmI, pr.GetSessionOnly))
+	api.Post("/account/password", pr.Post(deps.ChangePassword, pr.RequireUserWithDecodeOpts))
+	api.Post("/account/email", pr.Post(deps.ChangeEmail, pr.RequireUserWithDecodeOpts))
+	api.Post("/account/email/verify", pr.Post(deps.VerifyEmailChange, pr.RequireUserWithDecodeOpts))
+	api.Post("/account/deletion", pr.Post(deps.DeleteAccount, pr.RequireUserWithDecodeOpts))
+	api.Delete("/account/deletion", pr.Delete(deps.RestoreAccount, pr.RequireUserOpts))
+	api.Patch("/account/profile", pr.Patch(deps.UpdateProfile, pr.RequireUserWithDecodeOpts))
+
+	api.Post("/auth/social/login", pr.Post(deps.SocialLogin, pr.OnlyDecodeOpts))
+	api.Post("/auth/social/callback", pr.Post(deps.SocialCallback, pr.SetSessionWithDecodeOpts))
+	api.Post("/auth/social/link", pr.Post(deps.SocialLink, pr.RequireUserWithDecodeOpts))
+	api.Post("/auth/social/link/callback", pr.Post(deps.SocialLinkCallback, pr.RequireUserWithDecodeOpts))
+	api.Get("/account/identities", pr.Get(deps.Identities, privateReadOpts))
+	api.Post("/account/identities/unlink", pr.Post(deps.Unlink, pr.RequireUserWithDecodeOpts))
+
+	return &deps
 }
 
-func followHandlers(r *chi.Mux, db *sqlx.DB, rdb *redis.Client) {
+func followHandlers(api *pr.API, db *sqlx.DB, identify identifyFunc, notifications *notification.Deps, events *event.Deps) {
 	f := follow.Deps{
-		DB:             db,
-		GetUserSession: rdb.GetJSON,
+		DB:       db,
+		Identify: identify,
+		Notify:   notifications.Record,
+		Publish:  events.Publish,
 	}
 
-	r.Post("/follow", pr.Post(f.Follow, pr.GetSessionWithDecodeOpts))
+	api.Post("/follow", pr.Post(f.Follow, pr.RequireUserWithDecodeOpts))
+	api.Delete("/follow/{id}", pr.DeleteWithInput(f.Unfollow, pr.RequireUserOpts))
 }
 
-func healthCheckHandlers(r *chi.Mux, deps Dependencies) {
-	healthCheck := health.Deps{
-		DB: deps.DB,
+func tokenHandlers(api *pr.API, db *sqlx.DB, identify identifyFunc) {
+	t := token.Deps{
+		DB:       db,
+		Identify: identify,
 	}
 
-	r.Get("/health", pr.Get(healthCheck.Check, pr.Opts{}))
+	api.Post("/tokens", pr.Post(t.Create, pr.RequireUserWithDecodeOpts))
+	api.Get("/tokens", pr.Get(t.List, privateReadOpts))
+	api.Post("/tokens/revoke", pr.Post(t.Revoke, pr.RequireUserWithDecodeOpts))
+	api.Delete("/tokens/{id}", pr.DeleteWithInput(t.Revoke, pr.RequireUserOpts))
 }
 
-func notFound(r *chi.Mux) {
-	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
-		res := map[string]any{
-			"status_code": http.StatusNotFound,
-			"msg":         http.StatusText(http.StatusNotFound),
-		}
+func postHandlers(api *pr.API, db *sqlx.DB, identify identifyFunc, notifications *notification.Deps, events *event.Deps) {
+	p := post.Deps{
+		DB:               db,
+		Identify:         identify,
+		Mentioned:        notifications.Mentioned,
+		PublishFollowers: events.PublishFollowers,
+	}
 
-		if err := response.JSON(w, http.StatusNotFound, res); err != nil {
-			log.Println(err)
-		}
-	})
+	api.Post("/posts", pr.Post(p.Create, pr.RequireUserWithDecodeOpts))
+	api.Get("/posts/{id}", pr.GetWithInput(p.Get, publicReadOpts))
+	api.Put("/posts/{id}", pr.Put(p.Replace, pr.RequireUserWithDecodeOpts))
+	api.Patch("/posts/{id}", pr.Patch(p.Update, pr.RequireUserWithDecodeOpts))
+	api.Delete("/posts/{id}", pr.DeleteWithInput(p.Delete, pr.RequireUserOpts))
+	api.Get("/users/{id}/posts", pr.GetWithInput(p.List, publicReadOpts))
+	api.Get("/feed", pr.GetWithInput(p.Feed, privateReadOpts))
 }
 
-func methodNotAllowed(r *chi.Mux) {
-	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
-		res := map[string]any{
-			"status_code": http.StatusMethodNotAllowed,
-			"msg":         http.StatusText(http.StatusMethodNotAllowed),
-		}
+func oauthHandlers(api *pr.API, db *sqlx.DB, rdb *redis.Client, identify identifyFunc) func(ctx context.Context, token string) (business.Identity, error) {
+	o := oauth.Deps{
+		DB:       db,
+		Identify: identify,
+		Store:    rdb.SetJSON,
+		Get:      rdb.GetJSON,
+		Destroy:  rdb.Destroy,
+		Exists:   rdb.Exists,
+	}
 
-		if err := response.JSON(w, http.StatusMethodNotAllowed, res); err != nil {
-			log.Println(err)
-		}
-	})
+	api.Post("/oauth/clients", pr.Post(o.RegisterClient, pr.RequireUserWithDecodeOpts))
+	api.Post("/oauth/authorize/consent", pr.Post(o.Consent, pr.RequireUserWithDecodeOpts))
+	api.Post("/oauth/authorize", pr.Post(o.Authorize, pr.RequireUserWithDecodeOpts))
+	// the token endpoints answer with the errors of RFC 6749, and their tokens must not be cached
+	protocolOpts := pr.Opts{DecodeRequestBody: true, RawErrorBody: true, CacheControl: "no-store"}
+
+	api.Post("/oauth/token", pr.Post(o.Token, protocolOpts))
+	api.Post("/oauth/introspect", pr.Post(o.Introspect, protocolOpts))
+	api.Post("/oauth/revoke", pr.Post(o.Revoke, protocolOpts))
+
+	return o.IdentifyAccessToken
+}
+
+func notificationHandlers(api *pr.API, db *sqlx.DB, identify identifyFunc, pusher push.Provider, events *event.Deps) *notification.Deps {
+	n := notification.Deps{
+		DB:       db,
+		Identify: identify,
+		Publish:  events.Publish,
+	}
+
+	if pusher != nil {
+		n.Push = pusher.Send
+	}
+
+	api.Get("/notifications", pr.GetWithInput(n.List, privateReadOpts))
+	api.Get("/notifications/unread", pr.Get(n.Unread, privateReadOpts))
+	api.Post("/notifications/read", pr.Post(n.MarkMany, pr.RequireUserWithDecodeOpts))
+	api.Put("/notifications/{id}/read", pr.Put(n.MarkRead, pr.RequireUserOpts))
+	api.Delete("/notifications/{id}/read", pr.DeleteWithInput(n.MarkUnread, pr.RequireUserOpts))
+
+	return &n
+}
+
+func eventHandlers(api *pr.API, db *sqlx.DB, rdb *redis.Client, identify identifyFunc) *event.Deps {
+	e := event.Deps{
+		DB:        db,
+		Identify:  identify,
+		Append:    rdb.Append,
+		Range:     rdb.Range,
+		LastID:    rdb.LastID,
+		Subscribe: rdb.Subscribe,
+	}
+
+	pr.SetStreamLimits(streamHeartbeat, streamMaxAge)
+
+	api.Get("/events", pr.Stream(e.Stream, pr.RequireUserOpts))
+
+	return &e
+}
+
+func preferenceHandlers(api *pr.API, db *sqlx.DB, identify identifyFunc) {
+	p := preference.Deps{
+		DB:       db,
+		Identify: identify,
+	}
+
+	api.Get("/account/email-preferences", pr.Get(p.List, privateReadOpts))
+	api.Put("/account/email-preferences/{category}", pr.Put(p.Update, pr.RequireUserWithDecodeOpts))
+
+	// mail providers POST a form body to the one-click link, only the token in the query matters
+	api.Get(preference.UNSUBSCRIBE_PATH, pr.GetWithInput(p.Subscription, pr.DefaultOpts))
+	api.Post(preference.UNSUBSCRIBE_PATH, pr.Post(p.Unsubscribe, pr.DefaultOpts))
+}
+
+func adminHandlers(api *pr.API, deps Dependencies, identify identifyFunc) {
+	a := admin.Deps{
+		Identify: identify,
+		IsAdmin: func(ctx context.Context, userID string) (bool, error) {
+			return model.IsAdmin(ctx, deps.DB, userID)
+		},
+		Templates: deps.Mailer.Templates(),
+		Render:    deps.Mailer.Render,
+		SendEmail: deps.Mailer.Send,
+	}
+
+	api.Get("/admin/mails", pr.Get(a.ListMails, privateReadOpts))
+	api.Get("/admin/mails/{template}/preview", pr.GetWithInput(a.PreviewMail, privateReadOpts))
+	api.Post("/admin/mails/{template}/send", pr.Post(a.SendTestMail, pr.RequireUserWithDecodeOpts))
+	api.Get("/admin/vars", pr.Get(a.Vars, privateReadOpts))
+}
+
+func healthCheckHandlers(api *pr.API, deps Dependencies) {
+	healthCheck := health.Deps{
+		DB: deps.DB,
+	}
+
+	api.Get("/health", pr.Get(healthCheck.Check, pr.Opts{}))
 }
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var update = flag.Bool("update", false, "rewrite openapi.json from the routes")
+
+const openAPIFile = "openapi.json"
+
+// TestOpenAPIDrift fails when openapi.json no longer matches the routes,
+// run `go test -run TestOpenAPIDrift -update .` after changing an endpoint.
+func TestOpenAPIDrift(t *testing.T) {
+	api := loadRoutes(chi.NewRouter(), Dependencies{})
+
+	generated, err := json.MarshalIndent(api.Document(apiInfo), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generated = append(generated, '\n')
+
+	if *update {
+		if err := os.WriteFile(openAPIFile, generated, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	committed, err := os.ReadFile(openAPIFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(committed, generated) {
+		t.Fatalf("%s is out of date, run go test -run TestOpenAPIDrift -update .", openAPIFile)
+	}
+}
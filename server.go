@@ -15,6 +15,8 @@ import (
 	"github.com/rueian/rueidis"
 	"github.com/samuelsih/guwu/pkg/logger"
 	"github.com/samuelsih/guwu/pkg/mail"
+	"github.com/samuelsih/guwu/pkg/notification"
+	"github.com/samuelsih/guwu/pkg/oidc"
 )
 
 const (
@@ -23,6 +25,10 @@ const (
 	writeTimeout    = 30 * time.Second
 	ctxTimeout      = 5 * time.Second
 	shutdownTimeout = 30 * time.Second
+
+	// the event streams end before writeTimeout cuts them off
+	streamHeartbeat = 15 * time.Second
+	streamMaxAge    = 25 * time.Second
 )
 
 type shutdownFunc func(ctx context.Context) error
@@ -31,6 +37,8 @@ type Dependencies struct {
 	DB    *sqlx.DB
 	Redis rueidis.Client
 	Mailer mail.Client
+	Providers map[string]*oidc.Provider
+	Push notification.Provider
 	// many more will come
 }
 
@@ -45,11 +53,19 @@ func RunServer(router *chi.Mux, addr string, dependencies Dependencies) {
 
 	loadRoutes(router, dependencies)
 
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	loadJobs(jobCtx, dependencies)
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
 	done := make(chan struct{})
 
 	listenOnShutdown(&server, quit, done, map[string]shutdownFunc{
+		"stop jobs": func(_ context.Context) error {
+			stopJobs()
+			return nil
+		},
+
 		"shutdown server": func(ctx context.Context) error {
 			return server.Shutdown(ctx)
 		},